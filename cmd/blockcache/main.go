@@ -234,7 +234,7 @@ func (c *blockCache) getID() string {
 func cacheBlocks(cache *blockCache, peer *rpc.Client) {
 	height := cache.getHeight() + 1
 	ctx, cancel := context.WithCancel(context.Background())
-	blocks, errs := fetch.DownloadBlocks(ctx, peer, height)
+	blocks, errs := fetch.DownloadBlocks(ctx, []*fetch.Peer{{Client: peer}}, height)
 	for {
 		select {
 		case block := <-blocks:
@@ -260,7 +260,7 @@ func cacheBlocks(cache *blockCache, peer *rpc.Client) {
 				height = 1
 
 				ctx, cancel = context.WithCancel(context.Background())
-				blocks, errs = fetch.DownloadBlocks(ctx, peer, height)
+				blocks, errs = fetch.DownloadBlocks(ctx, []*fetch.Peer{{Client: peer}}, height)
 			} else {
 				log.Fatalkv(ctx, log.KeyError, err)
 			}
@@ -5,6 +5,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"chain/core/coreunsafe"
 	"chain/core/mockhsm"
@@ -29,6 +30,7 @@ func createBlockKeyPair(db *sql.DB, args []string) {
 	}
 	ctx := context.Background()
 	migrateIfMissingSchema(ctx, db)
+	unlockMockHSM(ctx, db)
 	hsm := mockhsm.New(db)
 	pub, err := hsm.Create(ctx, "block_key")
 	if err != nil {
@@ -38,6 +40,19 @@ func createBlockKeyPair(db *sql.DB, args []string) {
 	fmt.Printf("%x\n", pub.Pub)
 }
 
+// unlockMockHSM unlocks the MockHSM with $MOCKHSM_PASSPHRASE,
+// if it's set, so commands can use its keys.
+func unlockMockHSM(ctx context.Context, db *sql.DB) {
+	pass := os.Getenv("MOCKHSM_PASSPHRASE")
+	if pass == "" {
+		return
+	}
+	err := mockhsm.New(db).Unlock(ctx, []byte(pass))
+	if err != nil {
+		fatalln("error:", err)
+	}
+}
+
 func versionProdPrintln() {
 	fmt.Println("production: false")
 }
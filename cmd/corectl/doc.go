@@ -42,6 +42,43 @@ Flag -k causes the core to be a block signer.
 Its argument is the local public key for signing blocks.
 If -k is not given, the core will be a participant (not a generator or a signer).
 
+Propose Block Signers
+
+Subcommand 'propose-block-signers' changes the block signers of a
+running blockchain. Run on the generator, it makes the consensus
+program for the quorum and keys given, as config-generator does,
+and prints it in hex. The generator puts the program in the next
+block it makes, which the current signers sign; later blocks need
+signatures from the new signers. Once that block is committed,
+the generator's remote signers are replaced by those given.
+
+	corectl propose-block-signers [-no-local] [quorum] [pubkey url]...
+
+If the generator is also a signer, its local block signing key is
+one of the new signers, as with config-generator. Flag -no-local
+leaves it out, so that the new signers are only those given.
+
+Accept Block Signers
+
+Subcommand 'accept-block-signers' makes a block signer accept the
+given consensus program, as printed by propose-block-signers.
+A signer signs a block that changes the consensus program only
+if it has accepted the new program, so each current signer must
+accept it before the generator can make its next block.
+
+	corectl accept-block-signers [program]
+
+Cancel Block Signers
+
+Subcommand 'cancel-block-signers' withdraws the consensus program
+proposed with propose-block-signers, and prints it in hex. Run on
+the generator when the current signers won't sign the block that
+changes to it. The generator drops that block and goes back to
+making blocks under the current program and signers. A signer that
+already signed the dropped block won't sign another at its height.
+
+	corectl cancel-block-signers
+
 Create Block Keypair
 
 Subcommand 'create-block-keypair' generates a new keypair in the MockHSM for block signing,
@@ -57,6 +94,19 @@ otherwise it will create a client token.
 
     corectl create-token [-net] [name]
 
+Compile
+
+Subcommand 'compile' compiles an Ivy contract, read from the given
+file (or standard input, if the file is "-"), into a control program,
+and prints the program in hex. The remaining arguments are the
+contract's arguments: true or false for a Boolean, 0x-prefixed hex
+for a byte string, and a decimal integer for a number.
+
+    corectl compile [-json] [file] [arg]...
+
+Flag -json prints the whole compiled contract, including its
+opcodes and the parameters of each clause, as JSON.
+
 Reset
 
 Subcommand 'reset' resets the database so the Chain Core can be configured again.
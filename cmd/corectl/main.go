@@ -4,21 +4,26 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"chain/core/accesstoken"
+	"chain/core/blocksigner"
 	"chain/core/config"
+	"chain/core/generator"
 	"chain/core/migrate"
 	"chain/crypto/ed25519"
 	"chain/database/sql"
 	chainjson "chain/encoding/json"
 	"chain/env"
+	"chain/exp/ivy/compiler"
 	"chain/generated/rev"
 	"chain/log"
 )
@@ -42,12 +47,16 @@ type command struct {
 }
 
 var commands = map[string]*command{
-	"config-generator":     {configGenerator},
-	"create-block-keypair": {createBlockKeyPair},
-	"create-token":         {createToken},
-	"config":               {configNongenerator},
-	"migrate":              {runMigrations},
-	"reset":                {reset},
+	"accept-block-signers":  {acceptBlockSigners},
+	"cancel-block-signers":  {cancelBlockSigners},
+	"compile":               {compileContract},
+	"config-generator":      {configGenerator},
+	"create-block-keypair":  {createBlockKeyPair},
+	"create-token":          {createToken},
+	"config":                {configNongenerator},
+	"migrate":               {runMigrations},
+	"propose-block-signers": {proposeBlockSigners},
+	"reset":                 {reset},
 }
 
 func main() {
@@ -190,6 +199,7 @@ func configGenerator(db *sql.DB, args []string) {
 
 	ctx := context.Background()
 	migrateIfMissingSchema(ctx, db)
+	unlockMockHSM(ctx, db)
 	err = config.Configure(ctx, db, conf)
 	if err != nil {
 		fatalln("error:", err)
@@ -267,12 +277,192 @@ func configNongenerator(db *sql.DB, args []string) {
 
 	ctx := context.Background()
 	migrateIfMissingSchema(ctx, db)
+	unlockMockHSM(ctx, db)
 	err = config.Configure(ctx, db, &conf)
 	if err != nil {
 		fatalln("error:", err)
 	}
 }
 
+func proposeBlockSigners(db *sql.DB, args []string) {
+	const usage = "usage: corectl propose-block-signers [-no-local] [quorum] [pubkey url]..."
+
+	var flags flag.FlagSet
+	flagNoLocal := flags.Bool("no-local", false, "leave the local block signing key out of the new signers")
+	flags.Usage = func() {
+		fmt.Println(usage)
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	flags.Parse(args)
+	args = flags.Args()
+
+	if len(args) == 0 || len(args)%2 != 1 {
+		fatalln(usage)
+	}
+	quorum, err := strconv.Atoi(args[0])
+	if err != nil {
+		fatalln(usage)
+	}
+
+	ctx := context.Background()
+	conf, err := config.Load(ctx, db)
+	if err != nil {
+		fatalln("error:", err)
+	}
+	if conf == nil || !conf.IsGenerator {
+		fatalln("error: core is not configured as a generator")
+	}
+
+	// As in config-generator, the local
+	// signing key, if any, comes first.
+	var pubkeys []ed25519.PublicKey
+	if conf.IsSigner && !*flagNoLocal {
+		blockPub, err := hex.DecodeString(conf.BlockPub)
+		if err != nil {
+			fatalln("error:", err)
+		}
+		pubkeys = append(pubkeys, blockPub)
+	}
+	var signers []config.BlockSigner
+	for i := 1; i < len(args); i += 2 {
+		pubkey, err := hex.DecodeString(args[i])
+		if err != nil {
+			fatalln(usage)
+		}
+		if len(pubkey) != ed25519.PublicKeySize {
+			fatalln("error:", "bad ed25519 public key length")
+		}
+		pubkeys = append(pubkeys, pubkey)
+		signers = append(signers, config.BlockSigner{
+			Pubkey: pubkey,
+			URL:    args[i+1],
+		})
+	}
+
+	prog, err := generator.ProposeConsensusProgram(ctx, db, pubkeys, quorum, signers)
+	if err != nil {
+		fatalln("error:", err)
+	}
+	fmt.Printf("%x\n", prog)
+}
+
+func cancelBlockSigners(db *sql.DB, args []string) {
+	const usage = "usage: corectl cancel-block-signers"
+	if len(args) != 0 {
+		fatalln(usage)
+	}
+
+	ctx := context.Background()
+	conf, err := config.Load(ctx, db)
+	if err != nil {
+		fatalln("error:", err)
+	}
+	if conf == nil || !conf.IsGenerator {
+		fatalln("error: core is not configured as a generator")
+	}
+
+	prog, err := generator.CancelConsensusProgram(ctx, db)
+	if err != nil {
+		fatalln("error:", err)
+	}
+	if prog == nil {
+		fatalln("error: no block signers proposed")
+	}
+	fmt.Printf("%x\n", prog)
+}
+
+func acceptBlockSigners(db *sql.DB, args []string) {
+	const usage = "usage: corectl accept-block-signers [program]"
+	if len(args) != 1 {
+		fatalln(usage)
+	}
+	prog, err := hex.DecodeString(args[0])
+	if err != nil {
+		fatalln(usage)
+	}
+
+	ctx := context.Background()
+	conf, err := config.Load(ctx, db)
+	if err != nil {
+		fatalln("error:", err)
+	}
+	if conf == nil || !conf.IsSigner {
+		fatalln("error: core is not configured as a block signer")
+	}
+	err = blocksigner.AcceptConsensusProgram(ctx, db, prog)
+	if err != nil {
+		fatalln("error:", err)
+	}
+}
+
+func compileContract(db *sql.DB, args []string) {
+	const usage = "usage: corectl compile [-json] [file] [arg]..."
+	var flags flag.FlagSet
+	flagJSON := flags.Bool("json", false, "print the compiled contract as JSON")
+	flags.Usage = func() {
+		fmt.Println(usage)
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	flags.Parse(args)
+	args = flags.Args()
+	if len(args) < 1 {
+		fatalln(usage)
+	}
+
+	var (
+		src []byte
+		err error
+	)
+	if args[0] == "-" {
+		src, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		src, err = ioutil.ReadFile(args[0])
+	}
+	if err != nil {
+		fatalln("error:", err)
+	}
+
+	var contractArgs []compiler.ContractArg
+	for _, arg := range args[1:] {
+		var a compiler.ContractArg
+		switch {
+		case arg == "true" || arg == "false":
+			b := arg == "true"
+			a.B = &b
+		case strings.HasPrefix(arg, "0x"):
+			b, err := hex.DecodeString(arg[2:])
+			if err != nil {
+				fatalln("error: bad hex argument", arg)
+			}
+			h := chainjson.HexBytes(b)
+			a.S = &h
+		default:
+			n, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				fatalln("error: bad argument", arg)
+			}
+			a.I = &n
+		}
+		contractArgs = append(contractArgs, a)
+	}
+
+	contract, err := compiler.Compile(string(src), contractArgs)
+	if err != nil {
+		fatalln("error:", err)
+	}
+	if *flagJSON {
+		out, err := json.MarshalIndent(contract, "", "  ")
+		if err != nil {
+			fatalln("error:", err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+	fmt.Println(hex.EncodeToString(contract.Program))
+}
+
 // migrateIfMissingSchema will migrate the provided database only
 // if the database is blank without any migrations.
 func migrateIfMissingSchema(ctx context.Context, db *sql.DB) {
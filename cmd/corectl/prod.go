@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"chain/database/sql"
@@ -16,6 +17,8 @@ func createBlockKeyPair(db *sql.DB, args []string) {
 	fatalln("error: create-block-keypair disabled in prod build")
 }
 
+func unlockMockHSM(ctx context.Context, db *sql.DB) {}
+
 func versionProdPrintln() {
 	fmt.Println("production: true")
 }
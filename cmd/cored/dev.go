@@ -19,8 +19,9 @@ import (
 )
 
 var (
-	reset = env.String("RESET", "")
-	prod  = false
+	reset             = env.String("RESET", "")
+	mockHSMPassphrase = env.String("MOCKHSM_PASSPHRASE", "")
+	prod              = false
 )
 
 func resetInDevIfRequested(db pg.DB) {
@@ -49,6 +50,21 @@ func authLoopbackInDev(req *http.Request) bool {
 	return err == nil && a.IP.IsLoopback()
 }
 
+// unlockMockHSMInDev unlocks the MockHSM with $MOCKHSM_PASSPHRASE,
+// if it's set. If the MockHSM has no passphrase yet, this sets it
+// and encrypts the keys stored in plaintext.
+func unlockMockHSMInDev(db pg.DB) {
+	if *mockHSMPassphrase == "" {
+		return
+	}
+	ctx := context.Background()
+	err := mockhsm.New(db).Unlock(ctx, []byte(*mockHSMPassphrase))
+	if err != nil {
+		log.Fatalkv(ctx, log.KeyError, err)
+	}
+	os.Setenv("MOCKHSM_PASSPHRASE", "")
+}
+
 func devEnableMockHSM(db pg.DB) []core.RunOption {
 	return []core.RunOption{core.MockHSM(mockhsm.New(db))}
 }
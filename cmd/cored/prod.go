@@ -19,6 +19,8 @@ func authLoopbackInDev(req *http.Request) bool {
 	return false
 }
 
+func unlockMockHSMInDev(_ pg.DB) {}
+
 func devEnableMockHSM(_ pg.DB) []core.RunOption {
 	return nil
 }
@@ -0,0 +1,144 @@
+/*
+Command signerd is a block signing service for Chain Core signers.
+A Core configured with a block HSM URL asks it to sign each block.
+
+Usage:
+
+	signerd
+	signerd create-key
+	signerd list-keys
+
+With no subcommand, signerd serves /sign-block on $LISTEN. The
+create-key subcommand makes a new block signing key and prints
+its public key in hex, to give the Core as its block_pub. The
+list-keys subcommand prints the public keys in the key store.
+
+It reads its configuration from the environment:
+
+	LISTEN           address to listen on (default ":1998")
+	KEYSTORE         "file" or "softhsm" (default "file")
+	KEY_DIR          directory of key files for the file key store
+	PASSPHRASE       passphrase that encrypts the key files
+	SOFTHSM_PIN      user PIN for the softhsm key store
+	KEY_LABEL        label of the keys to use on the token
+	AUDIT_LOG        file to record signing decisions in
+	ACCESS_TOKENS    comma-separated id:secret tokens clients must use
+	INSECURE_NO_AUTH if "true", serve without ACCESS_TOKENS
+	TLSCRT           TLS certificate, to serve over HTTPS
+	TLSKEY           TLS private key
+
+signerd signs whatever block headers its clients send it, so it
+refuses to serve without ACCESS_TOKENS. INSECURE_NO_AUTH lets any
+client that can reach it get signatures, and is only for
+development.
+
+The softhsm key store keeps its keys in memory, in a software
+stand-in for a PKCS#11 token, for development and tests. Its keys
+don't outlive the process.
+*/
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+
+	"chain/core/signerd"
+	"chain/env"
+	"chain/errors"
+	"chain/log"
+)
+
+var (
+	listen       = env.String("LISTEN", ":1998")
+	keyStoreType = env.String("KEYSTORE", "file")
+	keyDir       = env.String("KEY_DIR", "signerd-keys")
+	passphrase   = os.Getenv("PASSPHRASE")
+	softHSMPIN   = env.String("SOFTHSM_PIN", "")
+	keyLabel     = env.String("KEY_LABEL", "chain-block-signer")
+	auditLog     = env.String("AUDIT_LOG", "signerd-audit.log")
+	accessTokens = env.StringSlice("ACCESS_TOKENS")
+	tlsCrt       = env.String("TLSCRT", "")
+	tlsKey       = env.String("TLSKEY", "")
+
+	insecureNoAuth = env.Bool("INSECURE_NO_AUTH", false)
+)
+
+func main() {
+	env.Parse()
+	ctx := context.Background()
+
+	keys, err := openKeyStore()
+	if err != nil {
+		log.Fatalkv(ctx, log.KeyError, err)
+	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "create-key":
+			pub, err := keys.CreateKey(ctx)
+			if err != nil {
+				log.Fatalkv(ctx, log.KeyError, err)
+			}
+			fmt.Println(hex.EncodeToString(pub))
+		case "list-keys":
+			pubs, err := keys.PublicKeys(ctx)
+			if err != nil {
+				log.Fatalkv(ctx, log.KeyError, err)
+			}
+			for _, pub := range pubs {
+				fmt.Println(hex.EncodeToString(pub))
+			}
+		default:
+			fmt.Fprintln(os.Stderr, "usage: signerd [create-key|list-keys]")
+			os.Exit(2)
+		}
+		return
+	}
+
+	if len(*accessTokens) == 0 {
+		if !*insecureNoAuth {
+			log.Fatalkv(ctx, log.KeyError, errors.New("ACCESS_TOKENS is required (set INSECURE_NO_AUTH=true to serve without it, for development only)"))
+		}
+		log.Printf(ctx, "warning: serving without ACCESS_TOKENS; any client can get signatures")
+	}
+
+	audit, err := signerd.OpenAuditLog(*auditLog)
+	if err != nil {
+		log.Fatalkv(ctx, log.KeyError, err)
+	}
+	server, err := signerd.NewServer(keys, audit, *accessTokens)
+	if err != nil {
+		log.Fatalkv(ctx, log.KeyError, err)
+	}
+
+	httpServer := &http.Server{Addr: *listen, Handler: server}
+	if *tlsCrt != "" {
+		cert, err := tls.X509KeyPair([]byte(*tlsCrt), []byte(*tlsKey))
+		if err != nil {
+			log.Fatalkv(ctx, log.KeyError, errors.Wrap(err, "parsing tls X509 key pair"))
+		}
+		httpServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		err = httpServer.ListenAndServeTLS("", "")
+		log.Fatalkv(ctx, log.KeyError, errors.Wrap(err, "ListenAndServeTLS"))
+	}
+	err = httpServer.ListenAndServe()
+	log.Fatalkv(ctx, log.KeyError, errors.Wrap(err, "ListenAndServe"))
+}
+
+func openKeyStore() (signerd.KeyStore, error) {
+	switch *keyStoreType {
+	case "file":
+		if passphrase == "" {
+			return nil, errors.New("PASSPHRASE is required for the file key store")
+		}
+		return signerd.OpenFileStore(*keyDir, []byte(passphrase))
+	case "softhsm":
+		token := signerd.NewSoftToken(*softHSMPIN)
+		return signerd.NewPKCS11Store(token, *softHSMPIN, *keyLabel), nil
+	}
+	return nil, fmt.Errorf("unknown KEYSTORE %q", *keyStoreType)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"chain/protocol/vm"
+)
+
+const commandHelp = `
+	s, step           run the next instruction, entering
+	                  programs run by CHECKPREDICATE
+	n, next           run the next instruction, stepping
+	                  over programs run by CHECKPREDICATE
+	o, out            run until the current program finishes
+	c, continue       run until a breakpoint
+	b, break pc       set a breakpoint at pc (in any program)
+	b, break OP       set a breakpoint on each OP instruction
+	d, delete [bp]    delete a breakpoint, or all of them
+	stack             print the data stack, top first
+	alt               print the alt stack, top first
+	limit             print the remaining run limit
+	l, list           disassemble the current program
+	q, quit           stop debugging
+`
+
+var errQuit = errors.New("quit")
+
+// frame is the state of a running program,
+// as of its most recent trace event.
+type frame struct {
+	prog      []byte
+	pc        uint32
+	runLimit  int64 // -1 until the first step
+	dataStack [][]byte
+	altStack  [][]byte
+}
+
+// debugger is a vm.Tracer that stops before each
+// instruction and reads commands, one per line,
+// until one of them resumes execution.
+type debugger struct {
+	in  *bufio.Scanner
+	out io.Writer
+
+	frames []*frame // by depth
+
+	// stopDepth is the greatest depth at which
+	// to stop; -1 stops only at breakpoints.
+	stopDepth int
+
+	pcBreaks map[uint32]bool
+	opBreaks map[vm.Op]bool
+
+	quit bool
+}
+
+func newDebugger(in io.Reader, out io.Writer) *debugger {
+	return &debugger{
+		in:       bufio.NewScanner(in),
+		out:      out,
+		pcBreaks: make(map[uint32]bool),
+		opBreaks: make(map[vm.Op]bool),
+	}
+}
+
+// run verifies the program in ctx under the debugger.
+// It returns errQuit if the user quit before the
+// program finished.
+func (d *debugger) run(ctx *vm.Context) error {
+	ctx.Tracer = d
+	err := vm.Verify(ctx)
+	if d.quit {
+		return errQuit
+	}
+	return err
+}
+
+// stopVM stops the VM by panicking; Verify
+// recovers, and returns ErrUnexpected.
+func (d *debugger) stopVM() {
+	d.quit = true
+	panic(errQuit)
+}
+
+func (d *debugger) Begin(depth int, prog []byte, dataStack [][]byte) {
+	f := &frame{prog: prog, runLimit: -1, dataStack: dataStack}
+	d.frames = append(d.frames[:depth], f)
+	if depth > 0 {
+		fmt.Fprintf(d.out, "entering program at depth %d\n", depth)
+	}
+	d.stop(depth)
+}
+
+func (d *debugger) Step(s *vm.TraceStep) {
+	f := d.frames[s.Depth]
+	f.pc = s.NextPC
+	f.runLimit = s.RunLimitAfter
+	f.dataStack = s.DataStack
+	f.altStack = s.AltStack
+	if s.Err != nil {
+		fmt.Fprintf(d.out, "depth %d pc %d: %s: %s\n", s.Depth, s.PC, s.Op, s.Err)
+		return
+	}
+	if int(f.pc) < len(f.prog) {
+		d.stop(s.Depth)
+	}
+}
+
+func (d *debugger) Finish(depth int, err error) {
+	if err != nil {
+		fmt.Fprintf(d.out, "program at depth %d failed: %s\n", depth, err)
+	} else {
+		fmt.Fprintf(d.out, "program at depth %d succeeded\n", depth)
+	}
+	d.frames = d.frames[:depth]
+}
+
+// stop reads commands if execution should stop before
+// the next instruction of the program at depth.
+func (d *debugger) stop(depth int) {
+	f := d.frames[depth]
+	inst, err := vm.ParseOp(f.prog, f.pc)
+	if err != nil {
+		// The VM will report this error when it tries to run it.
+		return
+	}
+	if depth > d.stopDepth && !d.pcBreaks[f.pc] && !d.opBreaks[inst.Op] {
+		return
+	}
+	fmt.Fprintf(d.out, "depth %d pc %d: %s\n", depth, f.pc, formatInst(inst))
+
+	for {
+		fmt.Fprint(d.out, "(vmdebug) ")
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			d.stopVM()
+		}
+		if d.command(depth, strings.Fields(d.in.Text())) {
+			return
+		}
+	}
+}
+
+// command runs the command in args, and reports
+// whether execution should resume.
+func (d *debugger) command(depth int, args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	f := d.frames[depth]
+	switch args[0] {
+	case "s", "step":
+		d.stopDepth = int(^uint(0) >> 1)
+		return true
+	case "n", "next":
+		d.stopDepth = depth
+		return true
+	case "o", "out":
+		d.stopDepth = depth - 1
+		return true
+	case "c", "continue":
+		d.stopDepth = -1
+		return true
+	case "b", "break":
+		if len(args) != 2 {
+			fmt.Fprintln(d.out, "usage: break pc|OP")
+			return false
+		}
+		if pc, ok := parsePC(args[1]); ok {
+			d.pcBreaks[pc] = true
+		} else if op, ok := opByName(args[1]); ok {
+			d.opBreaks[op] = true
+		} else {
+			fmt.Fprintf(d.out, "unknown opcode %s\n", args[1])
+		}
+	case "d", "delete":
+		if len(args) == 1 {
+			d.pcBreaks = make(map[uint32]bool)
+			d.opBreaks = make(map[vm.Op]bool)
+			return false
+		}
+		if pc, ok := parsePC(args[1]); ok {
+			delete(d.pcBreaks, pc)
+		} else if op, ok := opByName(args[1]); ok {
+			delete(d.opBreaks, op)
+		} else {
+			fmt.Fprintf(d.out, "unknown opcode %s\n", args[1])
+		}
+	case "stack":
+		printStack(d.out, f.dataStack)
+	case "alt":
+		printStack(d.out, f.altStack)
+	case "limit":
+		if f.runLimit < 0 {
+			fmt.Fprintln(d.out, "no instructions have run")
+		} else {
+			fmt.Fprintln(d.out, f.runLimit)
+		}
+	case "l", "list":
+		d.list(f)
+	case "q", "quit":
+		d.stopVM()
+	case "h", "help":
+		fmt.Fprint(d.out, strings.TrimPrefix(commandHelp, "\n"))
+	default:
+		fmt.Fprintf(d.out, "unknown command %s (try help)\n", args[0])
+	}
+	return false
+}
+
+func (d *debugger) list(f *frame) {
+	for pc := uint32(0); pc < uint32(len(f.prog)); {
+		inst, err := vm.ParseOp(f.prog, pc)
+		if err != nil {
+			fmt.Fprintf(d.out, "  %4d  %s\n", pc, err)
+			return
+		}
+		mark := " "
+		if pc == f.pc {
+			mark = ">"
+		}
+		fmt.Fprintf(d.out, "%s %4d  %s\n", mark, pc, formatInst(inst))
+		pc += inst.Len
+	}
+}
+
+func formatInst(inst vm.Instruction) string {
+	if inst.Op >= vm.OP_DATA_1 && inst.Op <= vm.OP_PUSHDATA4 {
+		return fmt.Sprintf("0x%x", inst.Data)
+	}
+	return inst.Op.String()
+}
+
+func printStack(w io.Writer, stack [][]byte) {
+	if len(stack) == 0 {
+		fmt.Fprintln(w, "(empty)")
+		return
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		fmt.Fprintf(w, "%d: 0x%x\n", len(stack)-1-i, stack[i])
+	}
+}
+
+func parsePC(s string) (uint32, bool) {
+	n, err := strconv.ParseUint(s, 10, 32)
+	return uint32(n), err == nil
+}
+
+func opByName(name string) (vm.Op, bool) {
+	name = strings.ToUpper(name)
+	for i := 0; i < 256; i++ {
+		if vm.Op(i).String() == name {
+			return vm.Op(i), true
+		}
+	}
+	return 0, false
+}
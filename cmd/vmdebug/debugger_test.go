@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"chain/protocol/vm"
+)
+
+func TestDebugger(t *testing.T) {
+	cases := []struct {
+		cmds     string
+		wantOut  []string // substrings, in order
+		wantQuit bool
+	}{{
+		cmds: "s\ns\ns\nstack\ns\nlimit\ns\nq\n",
+		wantOut: []string{
+			"depth 0 pc 0: FALSE",
+			"depth 0 pc 1: 0x51",
+			"depth 0 pc 3: FALSE",
+			"depth 0 pc 4: CHECKPREDICATE",
+			"0: 0x\n1: 0x51\n2: 0x\n",
+			"entering program at depth 1",
+			"depth 1 pc 0: 1",
+			"no instructions have run",
+			"program at depth 1 succeeded",
+			"depth 0 pc 5: 2",
+		},
+		wantQuit: true,
+	}, {
+		cmds: "break CHECKPREDICATE\nc\nn\nc\n",
+		wantOut: []string{
+			"depth 0 pc 0: FALSE",
+			"depth 0 pc 4: CHECKPREDICATE",
+			"program at depth 1 succeeded",
+			"depth 0 pc 5: 2",
+			"program at depth 0 succeeded",
+		},
+	}, {
+		cmds: "b 5\nc\nlimit\nl\nd\nc\n",
+		wantOut: []string{
+			"depth 0 pc 5: 2",
+			"9923\n",
+			"  4  CHECKPREDICATE\n>    5  2\n     6  DROP\n",
+			"program at depth 0 succeeded",
+		},
+	}}
+	prog, err := vm.Assemble("0 0x51 0 CHECKPREDICATE 2 DROP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range cases {
+		var out bytes.Buffer
+		d := newDebugger(strings.NewReader(c.cmds), &out)
+		err := d.run(&vm.Context{VMVersion: 1, Code: prog})
+		if (err == errQuit) != c.wantQuit {
+			t.Errorf("case %d: err = %v want quit = %v", i, err, c.wantQuit)
+		}
+		got := out.String()
+		for _, want := range c.wantOut {
+			j := strings.Index(got, want)
+			if j < 0 {
+				t.Errorf("case %d: output missing %q:\n%s", i, want, out.String())
+				break
+			}
+			got = got[j+len(want):]
+		}
+	}
+}
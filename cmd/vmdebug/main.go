@@ -0,0 +1,88 @@
+// Command vmdebug runs the program of one input of a transaction
+// under an interactive debugger.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"chain/protocol/bc"
+	"chain/protocol/validation"
+)
+
+const help = `
+Command vmdebug reads a hex-encoded transaction from a file
+(or standard input, if the file is "-") and runs the program
+of one of its inputs, in the same context as validation does,
+stopping before each instruction to read a command from the
+terminal.
+
+	vmdebug [-i index] file
+
+Flag -i selects the input to run. The default is 0.
+
+Commands:
+` + commandHelp
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, args...)
+	os.Exit(1)
+}
+
+func main() {
+	index := flag.Int("i", 0, "input `index`")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, strings.TrimSpace(help))
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if args[0] == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(args[0])
+	}
+	if err != nil {
+		fatalf("%v\n", err)
+	}
+
+	var tx bc.Tx
+	err = tx.UnmarshalText(bytes.TrimSpace(data))
+	if err != nil {
+		fatalf("error decoding: %s\n", err)
+	}
+	if *index < 0 || *index >= len(tx.Inputs) {
+		fatalf("input %d out of range: tx has %d inputs\n", *index, len(tx.Inputs))
+	}
+
+	cmds := os.Stdin
+	if args[0] == "-" {
+		// Standard input held the transaction,
+		// so read commands from the terminal.
+		cmds, err = os.Open("/dev/tty")
+		if err != nil {
+			fatalf("%v\n", err)
+		}
+	}
+
+	d := newDebugger(cmds, os.Stdout)
+	err = d.run(validation.InputVMContext(&tx, *index))
+	if err != nil {
+		fmt.Printf("result: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("result: ok")
+}
@@ -2,6 +2,7 @@
 package account
 
 import (
+	"bytes"
 	"context"
 	stdsql "database/sql"
 	"encoding/json"
@@ -28,13 +29,15 @@ var ErrDuplicateAlias = errors.New("duplicate account alias")
 
 func NewManager(db pg.DB, chain *protocol.Chain, pinStore *pin.Store) *Manager {
 	return &Manager{
-		db:          db,
-		chain:       chain,
-		utxoDB:      newReserver(db, chain, pinStore),
-		pinStore:    pinStore,
-		cache:       lru.New(maxAccountCache),
-		aliasCache:  lru.New(maxAccountCache),
-		delayedACPs: make(map[*txbuilder.TemplateBuilder][]*controlProgram),
+		db:           db,
+		chain:        chain,
+		utxoDB:       newReserver(db, chain, pinStore),
+		pinStore:     pinStore,
+		cache:        lru.New(maxAccountCache),
+		aliasCache:   lru.New(maxAccountCache),
+		delayedACPs:  make(map[*txbuilder.TemplateBuilder][]*controlProgram),
+		policySpends: make(map[*txbuilder.TemplateBuilder]map[string]*policySpends),
+		spendHolds:   make(map[*spendHold]bool),
 	}
 }
 
@@ -53,6 +56,12 @@ type Manager struct {
 	delayedACPsMu sync.Mutex
 	delayedACPs   map[*txbuilder.TemplateBuilder][]*controlProgram
 
+	policySpendsMu sync.Mutex
+	policySpends   map[*txbuilder.TemplateBuilder]map[string]*policySpends // by account ID
+
+	spendHoldsMu sync.Mutex
+	spendHolds   map[*spendHold]bool
+
 	acpMu        sync.Mutex
 	acpIndexNext uint64 // next acp index in our block
 	acpIndexCap  uint64 // points to end of block
@@ -82,12 +91,19 @@ func (m *Manager) ExpireReservations(ctx context.Context, period time.Duration)
 
 type Account struct {
 	*signers.Signer
-	Alias string
-	Tags  map[string]interface{}
+	Alias  string
+	Tags   map[string]interface{}
+	Policy *Policy
 }
 
-// Create creates a new Account.
-func (m *Manager) Create(ctx context.Context, xpubs []chainkd.XPub, quorum int, alias string, tags map[string]interface{}, clientToken string) (*Account, error) {
+// Create creates a new Account with the given spending
+// policy, which may be nil.
+func (m *Manager) Create(ctx context.Context, xpubs []chainkd.XPub, quorum int, alias string, tags map[string]interface{}, policy *Policy, clientToken string) (*Account, error) {
+	policyParam, err := policyToNullString(policy)
+	if err != nil {
+		return nil, err
+	}
+
 	signer, err := signers.Create(ctx, m.db, "account", xpubs, quorum, clientToken)
 	if err != nil {
 		return nil, errors.Wrap(err)
@@ -104,10 +120,10 @@ func (m *Manager) Create(ctx context.Context, xpubs []chainkd.XPub, quorum int,
 	}
 
 	const q = `
-		INSERT INTO accounts (account_id, alias, tags) VALUES ($1, $2, $3)
-		ON CONFLICT (account_id) DO UPDATE SET alias = $2, tags = $3
+		INSERT INTO accounts (account_id, alias, tags, policy) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (account_id) DO UPDATE SET alias = $2, tags = $3, policy = $4
 	`
-	_, err = m.db.Exec(ctx, q, signer.ID, aliasSQL, tagsParam)
+	_, err = m.db.Exec(ctx, q, signer.ID, aliasSQL, tagsParam, policyParam)
 	if pg.IsUniqueViolation(err) {
 		return nil, errors.WithDetail(ErrDuplicateAlias, "an account with the provided alias already exists")
 	} else if err != nil {
@@ -118,6 +134,7 @@ func (m *Manager) Create(ctx context.Context, xpubs []chainkd.XPub, quorum int,
 		Signer: signer,
 		Alias:  alias,
 		Tags:   tags,
+		Policy: policy,
 	}
 
 	err = m.indexAnnotatedAccount(ctx, account)
@@ -128,6 +145,143 @@ func (m *Manager) Create(ctx context.Context, xpubs []chainkd.XPub, quorum int,
 	return account, nil
 }
 
+// UpdateTags replaces the tags of the account identified by id or,
+// if id is empty, by alias. It returns the updated account.
+//
+// If backfill is set, it also rewrites, in the same statement,
+// the account tags recorded on the account's transactions that
+// have already been indexed.
+func (m *Manager) UpdateTags(ctx context.Context, id, alias string, tags map[string]interface{}, backfill bool) (*Account, error) {
+	tagsParam, err := tagsToNullString(tags)
+	if err != nil {
+		return nil, err
+	}
+	annotatedTags := `{}`
+	if tagsParam.Valid {
+		annotatedTags = tagsParam.String
+	}
+
+	var q bytes.Buffer
+	q.WriteString(`WITH acc AS (UPDATE accounts SET tags = $1 WHERE `)
+	if id != "" {
+		q.WriteString(`account_id=$2`)
+	} else {
+		q.WriteString(`alias=$2`)
+		id = alias
+	}
+	q.WriteString(` RETURNING account_id, alias)`)
+	q.WriteString(backfillAccountTagsQ)
+	q.WriteString(`SELECT account_id, alias FROM acc`)
+
+	var (
+		accountID string
+		aliasSQL  stdsql.NullString
+	)
+	err = m.db.QueryRow(ctx, q.String(), tagsParam, id, annotatedTags, backfill).Scan(&accountID, &aliasSQL)
+	if err == stdsql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "account id/alias: %s", id)
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	signer, err := m.findByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &Account{
+		Signer: signer,
+		Alias:  aliasSQL.String,
+		Tags:   tags,
+	}
+
+	err = m.indexAnnotatedAccount(ctx, account)
+	if err != nil {
+		return nil, errors.Wrap(err, "indexing annotated account")
+	}
+
+	return account, nil
+}
+
+// backfillAccountTagsQ continues the query in UpdateTags,
+// after the acc CTE, if $4 is true, setting the account tags
+// of the annotated inputs, outputs, and transactions of the
+// updated account to $3.
+const backfillAccountTagsQ = `
+	, inputs AS (
+		UPDATE annotated_inputs SET account_tags = $3::jsonb
+		WHERE $4 AND account_id = (SELECT account_id FROM acc)
+		RETURNING tx_hash
+	), outputs AS (
+		UPDATE annotated_outputs SET account_tags = $3::jsonb
+		WHERE $4 AND account_id = (SELECT account_id FROM acc)
+		RETURNING tx_hash
+	), txs AS (
+		UPDATE annotated_txs SET data = jsonb_set(jsonb_set(data,
+			'{inputs}', (
+				SELECT COALESCE(jsonb_agg(CASE WHEN e->>'account_id' = acc.account_id
+					THEN jsonb_set(e, '{account_tags}', $3::jsonb) ELSE e END ORDER BY n), '[]')
+				FROM jsonb_array_elements(data->'inputs') WITH ORDINALITY AS x(e, n)
+			)),
+			'{outputs}', (
+				SELECT COALESCE(jsonb_agg(CASE WHEN e->>'account_id' = acc.account_id
+					THEN jsonb_set(e, '{account_tags}', $3::jsonb) ELSE e END ORDER BY n), '[]')
+				FROM jsonb_array_elements(data->'outputs') WITH ORDINALITY AS x(e, n)
+			))
+		FROM acc
+		WHERE tx_hash IN (SELECT tx_hash FROM inputs UNION SELECT tx_hash FROM outputs)
+	)
+`
+
+// RotateKeys replaces the keys and quorum of the account identified
+// by id or, if id is empty, by alias. Control programs created from
+// then on use the new keys. Outputs controlled by the old keys stay
+// spendable with them, and can be moved to the new keys with the
+// sweep action. It returns the updated account.
+func (m *Manager) RotateKeys(ctx context.Context, id, alias string, xpubs []chainkd.XPub, quorum int) (*Account, error) {
+	if id == "" {
+		signer, err := m.FindByAlias(ctx, alias)
+		if err != nil {
+			return nil, err
+		}
+		id = signer.ID
+	}
+
+	signer, err := signers.Rotate(ctx, m.db, "account", id, xpubs, quorum)
+	if err != nil {
+		return nil, err
+	}
+	m.cacheMu.Lock()
+	m.cache.Remove(id)
+	m.cacheMu.Unlock()
+
+	var (
+		aliasSQL stdsql.NullString
+		tagsJSON []byte
+	)
+	const q = `SELECT alias, tags FROM accounts WHERE account_id=$1`
+	err = m.db.QueryRow(ctx, q, id).Scan(&aliasSQL, &tagsJSON)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	account := &Account{
+		Signer: signer,
+		Alias:  aliasSQL.String,
+	}
+	if len(tagsJSON) > 0 {
+		err = json.Unmarshal(tagsJSON, &account.Tags)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+	}
+
+	err = m.indexAnnotatedAccount(ctx, account)
+	if err != nil {
+		return nil, errors.Wrap(err, "indexing annotated account")
+	}
+	return account, nil
+}
+
 // FindByAlias retrieves an account's Signer record by its alias
 func (m *Manager) FindByAlias(ctx context.Context, alias string) (*signers.Signer, error) {
 	var accountID string
@@ -173,6 +327,7 @@ func (m *Manager) findByID(ctx context.Context, id string) (*signers.Signer, err
 
 type controlProgram struct {
 	accountID      string
+	signerVersion  int
 	keyIndex       uint64
 	controlProgram []byte
 	change         bool
@@ -199,6 +354,7 @@ func (m *Manager) createControlProgram(ctx context.Context, accountID string, ch
 	}
 	return &controlProgram{
 		accountID:      account.ID,
+		signerVersion:  account.Version,
 		keyIndex:       idx,
 		controlProgram: control,
 		change:         change,
@@ -222,12 +378,13 @@ func (m *Manager) CreateControlProgram(ctx context.Context, accountID string, ch
 
 func (m *Manager) insertAccountControlProgram(ctx context.Context, progs ...*controlProgram) error {
 	const q = `
-		INSERT INTO account_control_programs (signer_id, key_index, control_program, change, expires_at)
+		INSERT INTO account_control_programs (signer_id, key_index, control_program, change, expires_at, signer_version)
 		SELECT unnest($1::text[]), unnest($2::bigint[]), unnest($3::bytea[]), unnest($4::boolean[]),
-			unnest($5::timestamp with time zone[])
+			unnest($5::timestamp with time zone[]), unnest($6::integer[])
 	`
 	var (
 		accountIDs   pq.StringArray
+		versions     pq.Int64Array
 		keyIndexes   pq.Int64Array
 		controlProgs pq.ByteaArray
 		change       pq.BoolArray
@@ -235,6 +392,7 @@ func (m *Manager) insertAccountControlProgram(ctx context.Context, progs ...*con
 	)
 	for _, p := range progs {
 		accountIDs = append(accountIDs, p.accountID)
+		versions = append(versions, int64(p.signerVersion))
 		keyIndexes = append(keyIndexes, int64(p.keyIndex))
 		controlProgs = append(controlProgs, p.controlProgram)
 		change = append(change, p.change)
@@ -244,7 +402,7 @@ func (m *Manager) insertAccountControlProgram(ctx context.Context, progs ...*con
 		})
 	}
 
-	_, err := m.db.Exec(ctx, q, accountIDs, keyIndexes, controlProgs, change, pq.Array(expirations))
+	_, err := m.db.Exec(ctx, q, accountIDs, keyIndexes, controlProgs, change, pq.Array(expirations), versions)
 	return errors.Wrap(err)
 }
 
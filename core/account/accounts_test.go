@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"fmt"
 	"testing"
 	"time"
 
 	"chain/crypto/ed25519/chainkd"
+	"chain/database/pg"
 	"chain/database/pg/pgtest"
 	"chain/errors"
 	"chain/protocol/bc"
@@ -21,7 +23,7 @@ func TestCreateAccount(t *testing.T) {
 	m := NewManager(db, prottest.NewChain(t), nil)
 	ctx := context.Background()
 
-	account, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "", nil, "")
+	account, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "", nil, nil, "")
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
@@ -44,11 +46,11 @@ func TestCreateAccountIdempotency(t *testing.T) {
 	ctx := context.Background()
 	var clientToken = "a-unique-client-token"
 
-	account1, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "satoshi", nil, clientToken)
+	account1, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "satoshi", nil, nil, clientToken)
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
-	account2, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "satoshi", nil, clientToken)
+	account2, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "satoshi", nil, nil, clientToken)
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
@@ -63,19 +65,102 @@ func TestCreateAccountReusedAlias(t *testing.T) {
 	ctx := context.Background()
 	m.createTestAccount(ctx, t, "some-account", nil)
 
-	_, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "some-account", nil, "")
+	_, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "some-account", nil, nil, "")
 	if errors.Root(err) != ErrDuplicateAlias {
 		t.Errorf("Expected %s when reusing an alias, got %v", ErrDuplicateAlias, err)
 	}
 }
 
+func TestUpdateAccountTags(t *testing.T) {
+	db := pgtest.NewTx(t)
+	m := NewManager(db, prottest.NewChain(t), nil)
+	ctx := context.Background()
+	acc := m.createTestAccount(ctx, t, "some-account", map[string]interface{}{"tier": "basic"})
+
+	newTags := map[string]interface{}{"tier": "gold"}
+	updated, err := m.UpdateTags(ctx, "", "some-account", newTags, false)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if updated.ID != acc.ID {
+		t.Errorf("updated account ID = %s want %s", updated.ID, acc.ID)
+	}
+	if !testutil.DeepEqual(updated.Tags, newTags) {
+		t.Errorf("updated account tags = %v want %v", updated.Tags, newTags)
+	}
+
+	var tags []byte
+	err = db.QueryRow(ctx, `SELECT tags FROM accounts WHERE account_id=$1`, acc.ID).Scan(&tags)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if string(tags) != `{"tier": "gold"}` {
+		t.Errorf("stored tags = %s want %s", tags, `{"tier": "gold"}`)
+	}
+
+	_, err = m.UpdateTags(ctx, "nonexistent", "", newTags, false)
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("got error %v want %v", err, pg.ErrUserInputNotFound)
+	}
+}
+
+func TestUpdateAccountTagsBackfill(t *testing.T) {
+	db := pgtest.NewTx(t)
+	m := NewManager(db, prottest.NewChain(t), nil)
+	ctx := context.Background()
+	acc := m.createTestAccount(ctx, t, "", map[string]interface{}{"tier": "basic"})
+
+	txHash := randHash()
+	const inputQ = `
+		INSERT INTO annotated_inputs (tx_hash, index, type, asset_id, asset_alias,
+			asset_definition, asset_tags, asset_local, amount, account_id,
+			account_tags, issuance_program, reference_data, local, spent_output_id)
+		VALUES ($1, 0, 'spend', $2, '', '{}', '{}', false, 1, $3,
+			'{"tier": "basic"}', '', '{}', true, $4)
+	`
+	_, err := db.Exec(ctx, inputQ, txHash, randHash(), acc.ID, randHash())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	const txQ = `
+		INSERT INTO annotated_txs (block_height, tx_pos, tx_hash, data,
+			"timestamp", block_id, local, reference_data)
+		VALUES (1, 0, $1, $2::jsonb, now(), $3, true, '{}')
+	`
+	data := fmt.Sprintf(`{"inputs": [{"account_id": %q, "account_tags": {"tier": "basic"}}], "outputs": []}`, acc.ID)
+	_, err = db.Exec(ctx, txQ, txHash, data, randHash())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	_, err = m.UpdateTags(ctx, acc.ID, "", map[string]interface{}{"tier": "gold"}, true)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	var inputTags, txTags []byte
+	const selectQ = `
+		SELECT i.account_tags, t.data->'inputs'->0->'account_tags'
+		FROM annotated_inputs i JOIN annotated_txs t USING (tx_hash)
+		WHERE tx_hash = $1
+	`
+	err = db.QueryRow(ctx, selectQ, txHash).Scan(&inputTags, &txTags)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	const want = `{"tier": "gold"}`
+	if string(inputTags) != want || string(txTags) != want {
+		t.Errorf("backfilled tags = %s and %s, want %s", inputTags, txTags, want)
+	}
+}
+
 func TestCreateControlProgram(t *testing.T) {
 	// use pgtest.NewDB for deterministic postgres sequences
 	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
 	m := NewManager(db, prottest.NewChain(t), nil)
 	ctx := context.Background()
 
-	account, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "", nil, "")
+	account, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "", nil, nil, "")
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
@@ -96,7 +181,7 @@ func TestCreateControlProgram(t *testing.T) {
 }
 
 func (m *Manager) createTestAccount(ctx context.Context, t testing.TB, alias string, tags map[string]interface{}) *Account {
-	account, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, alias, tags, "")
+	account, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, alias, tags, nil, "")
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
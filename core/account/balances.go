@@ -0,0 +1,94 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"sort"
+
+	"github.com/lib/pq"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// BalanceChange is the net change in an account's
+// balance of an asset.
+type BalanceChange struct {
+	AccountID string     `json:"account_id"`
+	AssetID   bc.AssetID `json:"asset_id"`
+	Amount    int64      `json:"amount"`
+}
+
+// BalanceChanges returns the net changes that tx would make
+// to the balances of this core's accounts, sorted by account
+// and asset. Inputs count toward an account if they spend one
+// of its outputs; outputs count if their control programs are
+// the account's.
+func (m *Manager) BalanceChanges(ctx context.Context, tx *bc.Tx) ([]*BalanceChange, error) {
+	type key struct {
+		accountID string
+		assetID   bc.AssetID
+	}
+	changes := make(map[key]int64)
+
+	var spentIDs pq.ByteaArray
+	inputs := make(map[bc.Hash]*bc.TxInput)
+	for i, in := range tx.Inputs {
+		if in.IsIssuance() {
+			continue
+		}
+		id := tx.SpentOutputIDs[i]
+		inputs[id] = in
+		spentIDs = append(spentIDs, id.Bytes())
+	}
+	const inputsQ = `
+		SELECT output_id, account_id FROM account_utxos
+		WHERE output_id = ANY($1::bytea[])
+	`
+	err := pg.ForQueryRows(ctx, m.db, inputsQ, spentIDs, func(outputID bc.Hash, accountID string) {
+		in := inputs[outputID]
+		changes[key{accountID, in.AssetID()}] -= int64(in.Amount())
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "looking up spent outputs")
+	}
+
+	var progs pq.ByteaArray
+	outputs := make(map[string][]*bc.TxOutput)
+	for _, out := range tx.Outputs {
+		progs = append(progs, out.ControlProgram)
+		outputs[string(out.ControlProgram)] = append(outputs[string(out.ControlProgram)], out)
+	}
+	const outputsQ = `
+		SELECT DISTINCT signer_id, control_program FROM account_control_programs
+		WHERE control_program = ANY($1::bytea[])
+	`
+	err = pg.ForQueryRows(ctx, m.db, outputsQ, progs, func(accountID string, prog []byte) {
+		for _, out := range outputs[string(prog)] {
+			changes[key{accountID, out.AssetID}] += int64(out.Amount)
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "looking up control programs")
+	}
+
+	result := make([]*BalanceChange, 0, len(changes))
+	for k, amount := range changes {
+		if amount == 0 {
+			continue
+		}
+		result = append(result, &BalanceChange{
+			AccountID: k.accountID,
+			AssetID:   k.assetID,
+			Amount:    amount,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].AccountID != result[j].AccountID {
+			return result[i].AccountID < result[j].AccountID
+		}
+		return bytes.Compare(result[i].AssetID[:], result[j].AssetID[:]) < 0
+	})
+	return result, nil
+}
@@ -65,8 +65,17 @@ func (a *spendAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) e
 	// Cancel the reservation if the build gets rolled back.
 	b.OnRollback(canceler(ctx, a.accounts, res.ID))
 
+	var outputIDs []bc.Hash
 	for _, r := range res.UTXOs {
-		txInput, sigInst, err := utxoToInputs(ctx, acct, r, a.ReferenceData)
+		outputIDs = append(outputIDs, r.OutputID)
+	}
+	err = a.accounts.checkPolicyDelayed(ctx, b, a.AccountID, a.AssetAmount, a.ReferenceData, outputIDs)
+	if err != nil {
+		return errors.Wrap(err, "loading account policy")
+	}
+
+	for _, r := range res.UTXOs {
+		txInput, sigInst, err := a.accounts.utxoToInputs(ctx, acct, r, a.ReferenceData)
 		if err != nil {
 			return errors.Wrap(err, "creating inputs")
 		}
@@ -129,7 +138,12 @@ func (a *spendUTXOAction) Build(ctx context.Context, b *txbuilder.TemplateBuilde
 	if err != nil {
 		return err
 	}
-	txInput, sigInst, err := utxoToInputs(ctx, acct, res.UTXOs[0], a.ReferenceData)
+	u := res.UTXOs[0]
+	err = a.accounts.checkPolicyDelayed(ctx, b, u.AccountID, u.AssetAmount, a.ReferenceData, []bc.Hash{u.OutputID})
+	if err != nil {
+		return errors.Wrap(err, "loading account policy")
+	}
+	txInput, sigInst, err := a.accounts.utxoToInputs(ctx, acct, u, a.ReferenceData)
 	if err != nil {
 		return err
 	}
@@ -146,11 +160,21 @@ func canceler(ctx context.Context, m *Manager, rid uint64) func() {
 	}
 }
 
-func utxoToInputs(ctx context.Context, account *signers.Signer, u *utxo, refData []byte) (
+func (m *Manager) utxoToInputs(ctx context.Context, account *signers.Signer, u *utxo, refData []byte) (
 	*bc.TxInput,
 	*txbuilder.SigningInstruction,
 	error,
 ) {
+	// UTXOs controlled by keys the account has since
+	// rotated away from must be signed with those keys.
+	if u.SignerVersion != 0 && u.SignerVersion != account.Version {
+		var err error
+		account, err = signers.FindVersion(ctx, m.db, "account", account.ID, u.SignerVersion)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "finding retired account keys")
+		}
+	}
+
 	txInput := bc.NewSpendInput(nil, u.SourceID, u.AssetID, u.Amount, u.SourcePos, u.ControlProgram, u.RefDataHash, refData)
 
 	sigInst := &txbuilder.SigningInstruction{
@@ -1,8 +1,11 @@
 package account_test
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
@@ -13,8 +16,10 @@ import (
 	"chain/core/pin"
 	"chain/core/query"
 	"chain/core/txbuilder"
+	"chain/crypto/ed25519/chainkd"
 	"chain/database/pg"
 	"chain/database/pg/pgtest"
+	"chain/errors"
 	"chain/protocol/bc"
 	"chain/protocol/prottest"
 	"chain/testutil"
@@ -202,3 +207,214 @@ func programInAccount(ctx context.Context, t testing.TB, db pg.DB, program []byt
 	}
 	return in
 }
+
+func TestAccountSourcePolicy(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		g        = generator.New(c, nil, db)
+		pinStore = pin.NewStore(db)
+		accounts = account.NewManager(db, c, pinStore)
+		assets   = asset.NewRegistry(db, c, pinStore)
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		accID   = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		otherID = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		asset   = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	)
+	coretest.IssueAssets(ctx, t, c, g, assets, accounts, asset, 100, accID)
+
+	coretest.CreatePins(ctx, t, pinStore)
+	assets.IndexAssets(indexer)
+	accounts.IndexAccounts(indexer)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c, g.PendingTxs())
+	<-pinStore.PinWaiter(account.PinName, c.Height())
+
+	_, err := accounts.UpdatePolicy(ctx, accID, "", &account.Policy{
+		AssetLimits:                []account.AssetLimit{{AssetID: asset, MaxPerTransaction: 10}},
+		AllowedDestinationAccounts: []string{otherID},
+		RequiredReferenceDataKeys:  []string{"invoice"},
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	transfer := func(amount uint64, dest txbuilder.Action, refData string) error {
+		amt := bc.AssetAmount{AssetID: asset, Amount: amount}
+		actions := []txbuilder.Action{
+			accounts.NewSpendAction(amt, accID, []byte(refData), nil),
+			dest,
+		}
+		_, err := txbuilder.Build(ctx, nil, actions, time.Now().Add(time.Minute))
+		return err
+	}
+	toOther := func(amount uint64) txbuilder.Action {
+		return accounts.NewControlAction(bc.AssetAmount{AssetID: asset, Amount: amount}, otherID, nil)
+	}
+	toProgram, err := txbuilder.DecodeControlProgramAction([]byte(fmt.Sprintf(
+		`{"asset_id": "%s", "amount": 5, "control_program": "51"}`, asset,
+	)))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	cases := []struct {
+		amount  uint64
+		dest    txbuilder.Action
+		refData string
+		wantErr error
+	}{
+		{11, toOther(11), `{"invoice": "1"}`, account.ErrPolicyViolation},
+		{5, toOther(5), `{"memo": "1"}`, account.ErrPolicyViolation},
+		{5, toProgram, `{"invoice": "1"}`, account.ErrPolicyViolation},
+
+		// Violations roll back the reservations,
+		// so this tx can spend the same UTXO.
+		{5, toOther(5), `{"invoice": "1"}`, nil},
+	}
+	for i, c := range cases {
+		err := transfer(c.amount, c.dest, c.refData)
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("case %d: build error = %v, want %v", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestAccountSourceDailyLimit(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		g        = generator.New(c, nil, db)
+		pinStore = pin.NewStore(db)
+		accounts = account.NewManager(db, c, pinStore)
+		assets   = asset.NewRegistry(db, c, pinStore)
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		accID   = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		otherID = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		asset   = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	)
+	coretest.IssueAssets(ctx, t, c, g, assets, accounts, asset, 100, accID)
+	coretest.IssueAssets(ctx, t, c, g, assets, accounts, asset, 100, accID)
+
+	coretest.CreatePins(ctx, t, pinStore)
+	assets.IndexAssets(indexer)
+	accounts.IndexAccounts(indexer)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c, g.PendingTxs())
+	<-pinStore.PinWaiter(account.PinName, c.Height())
+
+	_, err := accounts.UpdatePolicy(ctx, accID, "", &account.Policy{
+		AssetLimits: []account.AssetLimit{{AssetID: asset, MaxPerDay: 8}},
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	transfer := func() error {
+		amt := bc.AssetAmount{AssetID: asset, Amount: 5}
+		actions := []txbuilder.Action{
+			accounts.NewSpendAction(amt, accID, nil, nil),
+			accounts.NewControlAction(amt, otherID, nil),
+		}
+		_, err := txbuilder.Build(ctx, nil, actions, time.Now().Add(time.Minute))
+		return err
+	}
+
+	// The first transaction isn't confirmed, but
+	// its spend still counts against the limit.
+	err = transfer()
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = transfer()
+	if errors.Root(err) != account.ErrPolicyViolation {
+		t.Errorf("second build error = %v, want %v", err, account.ErrPolicyViolation)
+	}
+}
+
+func TestSweepAction(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		g        = generator.New(c, nil, db)
+		pinStore = pin.NewStore(db)
+		accounts = account.NewManager(db, c, pinStore)
+		assets   = asset.NewRegistry(db, c, pinStore)
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		accID  = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		asset1 = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+		asset2 = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	)
+	coretest.IssueAssets(ctx, t, c, g, assets, accounts, asset1, 2, accID)
+	coretest.IssueAssets(ctx, t, c, g, assets, accounts, asset1, 3, accID)
+	coretest.IssueAssets(ctx, t, c, g, assets, accounts, asset2, 4, accID)
+
+	coretest.CreatePins(ctx, t, pinStore)
+	assets.IndexAssets(indexer)
+	accounts.IndexAccounts(indexer)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c, g.PendingTxs())
+	<-pinStore.PinWaiter(account.PinName, c.Height())
+
+	_, err := txbuilder.Build(ctx, nil, []txbuilder.Action{accounts.NewSweepAction(accID, 0, nil)}, time.Now().Add(time.Minute))
+	if errors.Root(err) != txbuilder.ErrAction {
+		t.Fatalf("sweep before rotation: got error %v want %v", err, txbuilder.ErrAction)
+	}
+
+	newXPrv, err := chainkd.NewXPrv(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	acc, err := accounts.RotateKeys(ctx, accID, "", []chainkd.XPub{newXPrv.XPub()}, 1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if acc.Version != 2 {
+		t.Errorf("account version = %d want 2", acc.Version)
+	}
+
+	// Sweep in batches of two outputs.
+	sweep := accounts.NewSweepAction(accID, 2, nil)
+	tpl, err := txbuilder.Build(ctx, nil, []txbuilder.Action{sweep}, time.Now().Add(time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	tx := tpl.Transaction
+	if len(tx.Inputs) != 2 {
+		t.Errorf("first batch spends %d outputs want 2", len(tx.Inputs))
+	}
+	for _, out := range tx.Outputs {
+		if !programInAccount(ctx, t, db, out.ControlProgram, accID) {
+			t.Errorf("expected sweep output control program to belong to account")
+		}
+	}
+
+	// The inputs are signed with the old keys.
+	tplJSON, err := json.Marshal(tpl.SigningInstructions)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !bytes.Contains(tplJSON, []byte(testutil.TestXPub.String())) {
+		t.Errorf("signing instructions %s don't use the retired key", tplJSON)
+	}
+
+	tpl, err = txbuilder.Build(ctx, nil, []txbuilder.Action{sweep}, time.Now().Add(time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(tpl.Transaction.Inputs) != 1 {
+		t.Errorf("second batch spends %d outputs want 1", len(tpl.Transaction.Inputs))
+	}
+
+	// The remaining outputs are reserved by the earlier batches.
+	_, err = txbuilder.Build(ctx, nil, []txbuilder.Action{sweep}, time.Now().Add(time.Minute))
+	if errors.Root(err) != txbuilder.ErrAction {
+		t.Errorf("third batch: got error %v want %v", err, txbuilder.ErrAction)
+	}
+}
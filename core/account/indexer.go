@@ -92,9 +92,10 @@ type rawOutput struct {
 
 type accountOutput struct {
 	rawOutput
-	AccountID string
-	keyIndex  uint64
-	change    bool
+	AccountID     string
+	signerVersion int
+	keyIndex      uint64
+	change        bool
 }
 
 func (m *Manager) ProcessBlocks(ctx context.Context) {
@@ -121,13 +122,19 @@ func (m *Manager) expireControlPrograms(ctx context.Context, b *bc.Block) error
 }
 
 func (m *Manager) deleteSpentOutputs(ctx context.Context, b *bc.Block) error {
+	// Record the spends from accounts before their UTXOs are gone.
+	err := m.recordAccountSpends(ctx, b)
+	if err != nil {
+		return err
+	}
+
 	// Delete consumed account UTXOs.
 	delOutputIDs := prevoutDBKeys(b.Transactions...)
 	const delQ = `
 		DELETE FROM account_utxos
 		WHERE output_id IN (SELECT unnest($1::bytea[]))
 	`
-	_, err := m.db.Exec(ctx, delQ, delOutputIDs)
+	_, err = m.db.Exec(ctx, delQ, delOutputIDs)
 	return errors.Wrap(err, "deleting spent account utxos")
 }
 
@@ -190,17 +197,18 @@ func (m *Manager) loadAccountInfo(ctx context.Context, outs []*rawOutput) ([]*ac
 	result := make([]*accountOutput, 0, len(outs))
 
 	const q = `
-		SELECT signer_id, key_index, control_program, change
+		SELECT signer_id, signer_version, key_index, control_program, change
 		FROM account_control_programs
 		WHERE control_program IN (SELECT unnest($1::bytea[]))
 	`
-	err := pg.ForQueryRows(ctx, m.db, q, scripts, func(accountID string, keyIndex uint64, program []byte, change bool) {
+	err := pg.ForQueryRows(ctx, m.db, q, scripts, func(accountID string, signerVersion int, keyIndex uint64, program []byte, change bool) {
 		for _, out := range outsByScript[string(program)] {
 			newOut := &accountOutput{
-				rawOutput: *out,
-				AccountID: accountID,
-				keyIndex:  keyIndex,
-				change:    change,
+				rawOutput:     *out,
+				AccountID:     accountID,
+				signerVersion: signerVersion,
+				keyIndex:      keyIndex,
+				change:        change,
 			}
 			result = append(result, newOut)
 		}
@@ -227,6 +235,7 @@ func (m *Manager) upsertConfirmedAccountOutputs(ctx context.Context, outs []*acc
 		sourcePos pq.Int64Array
 		refData   pq.ByteaArray
 		change    pq.BoolArray
+		version   pq.Int64Array
 	)
 	for _, out := range outs {
 		outputID = append(outputID, out.OutputID.Bytes())
@@ -239,14 +248,16 @@ func (m *Manager) upsertConfirmedAccountOutputs(ctx context.Context, outs []*acc
 		sourcePos = append(sourcePos, int64(out.sourcePos))
 		refData = append(refData, out.refData[:])
 		change = append(change, out.change)
+		version = append(version, int64(out.signerVersion))
 	}
 
 	const q = `
 		INSERT INTO account_utxos (output_id, asset_id, amount, account_id, control_program_index,
-			control_program, confirmed_in, source_id, source_pos, ref_data_hash, change)
+			control_program, confirmed_in, source_id, source_pos, ref_data_hash, change, signer_version)
 		SELECT unnest($1::bytea[]), unnest($2::bytea[]),  unnest($3::bigint[]),
 			   unnest($4::text[]), unnest($5::bigint[]), unnest($6::bytea[]), $7,
-			   unnest($8::bytea[]), unnest($9::bigint[]), unnest($10::bytea[]), unnest($11::boolean[])
+			   unnest($8::bytea[]), unnest($9::bigint[]), unnest($10::bytea[]), unnest($11::boolean[]),
+			   unnest($12::integer[])
 		ON CONFLICT (output_id) DO NOTHING
 	`
 	_, err := m.db.Exec(ctx, q,
@@ -261,6 +272,7 @@ func (m *Manager) upsertConfirmedAccountOutputs(ctx context.Context, outs []*acc
 		sourcePos,
 		refData,
 		change,
+		version,
 	)
 	return errors.Wrap(err)
 }
@@ -0,0 +1,82 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+
+	"chain/core/txbuilder"
+	chainjson "chain/encoding/json"
+	"chain/protocol/bc"
+)
+
+// NewOfferAction returns an action that offers amt from an
+// account in exchange for payment to the account.
+func (m *Manager) NewOfferAction(amt, payment bc.AssetAmount, accountID string, refData chainjson.Map, clientToken *string) txbuilder.Action {
+	return &offerAction{
+		accounts:      m,
+		AssetAmount:   amt,
+		Payment:       payment,
+		AccountID:     accountID,
+		ReferenceData: refData,
+		ClientToken:   clientToken,
+	}
+}
+
+func (m *Manager) DecodeOfferAction(data []byte) (txbuilder.Action, error) {
+	a := &offerAction{accounts: m}
+	err := json.Unmarshal(data, a)
+	return a, err
+}
+
+// offerAction spends an amount from an account and pays
+// an amount of another asset back to the account. The
+// transaction is left unbalanced, and allows additional
+// actions: once signed, it's an offer that a counterparty
+// takes by adding the payment and taking the amount.
+type offerAction struct {
+	accounts *Manager
+	bc.AssetAmount
+	Payment       bc.AssetAmount `json:"payment"`
+	AccountID     string         `json:"account_id"`
+	ReferenceData chainjson.Map  `json:"reference_data"`
+	ClientToken   *string        `json:"client_token"`
+}
+
+func (a *offerAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
+	var missing []string
+	if a.AccountID == "" {
+		missing = append(missing, "account_id")
+	}
+	if a.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if a.Payment.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "payment.asset_id")
+	}
+	if len(missing) > 0 {
+		return txbuilder.MissingFieldsError(missing...)
+	}
+
+	spend := &spendAction{
+		accounts:      a.accounts,
+		AssetAmount:   a.AssetAmount,
+		AccountID:     a.AccountID,
+		ReferenceData: a.ReferenceData,
+		ClientToken:   a.ClientToken,
+	}
+	err := spend.Build(ctx, b)
+	if err != nil {
+		return err
+	}
+	control := &controlAction{
+		accounts:    a.accounts,
+		AssetAmount: a.Payment,
+		AccountID:   a.AccountID,
+	}
+	err = control.Build(ctx, b)
+	if err != nil {
+		return err
+	}
+	b.AllowAdditionalActions()
+	return nil
+}
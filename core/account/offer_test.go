@@ -0,0 +1,85 @@
+package account_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/core/account"
+	"chain/core/asset"
+	"chain/core/coretest"
+	"chain/core/generator"
+	"chain/core/pin"
+	"chain/core/query"
+	"chain/core/txbuilder"
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+func TestOfferAction(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		g        = generator.New(c, nil, db)
+		pinStore = pin.NewStore(db)
+		accounts = account.NewManager(db, c, pinStore)
+		assets   = asset.NewRegistry(db, c, pinStore)
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		accID   = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		offered = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+		wanted  = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	)
+
+	coretest.CreatePins(ctx, t, pinStore)
+	coretest.IssueAssets(ctx, t, c, g, assets, accounts, offered, 100, accID)
+	assets.IndexAssets(indexer)
+	accounts.IndexAccounts(indexer)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c, g.PendingTxs())
+	<-pinStore.PinWaiter(account.PinName, c.Height())
+
+	amt := bc.AssetAmount{AssetID: offered, Amount: 100}
+	payment := bc.AssetAmount{AssetID: wanted, Amount: 50}
+	offer := accounts.NewOfferAction(amt, payment, accID, nil, nil)
+	tpl, err := txbuilder.Build(ctx, nil, []txbuilder.Action{offer}, time.Now().Add(time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	if !tpl.AllowAdditional {
+		t.Error("offer template doesn't allow additional actions")
+	}
+	tx := tpl.Transaction
+	if len(tx.Inputs) != 1 || tx.Inputs[0].AssetAmount() != amt {
+		t.Errorf("offer inputs = %+v, want one spend of %+v", tx.Inputs, amt)
+	}
+	if len(tx.Outputs) != 1 {
+		t.Fatalf("got %d offer outputs, want 1", len(tx.Outputs))
+	}
+	if tx.Outputs[0].AssetAmount != payment {
+		t.Errorf("offer output = %+v, want %+v", tx.Outputs[0].AssetAmount, payment)
+	}
+	if !programInAccount(ctx, t, db, tx.Outputs[0].ControlProgram, accID) {
+		t.Error("expected payment control program to belong to account")
+	}
+}
+
+func TestOfferActionMissingFields(t *testing.T) {
+	ctx := context.Background()
+	accounts := account.NewManager(nil, nil, nil)
+	offer := accounts.NewOfferAction(bc.AssetAmount{Amount: 1}, bc.AssetAmount{Amount: 1}, "", nil, nil)
+	builder := txbuilder.NewBuilder(time.Now().Add(time.Minute))
+	err := offer.Build(ctx, builder)
+	if errors.Root(err) != txbuilder.ErrMissingFields {
+		t.Errorf("Build() error = %v, want %v", err, txbuilder.ErrMissingFields)
+	}
+	want := []string{"account_id", "asset_id", "payment.asset_id"}
+	if got := errors.Data(err)["missing_fields"]; !testutil.DeepEqual(got, want) {
+		t.Errorf("missing fields = %v, want %v", got, want)
+	}
+}
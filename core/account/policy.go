@@ -0,0 +1,579 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/txbuilder"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+var (
+	// ErrBadPolicy is returned when setting an account
+	// spending policy that is malformed.
+	ErrBadPolicy = errors.New("invalid account spending policy")
+
+	// ErrPolicyViolation is returned when building a transaction
+	// that spends from an account in a way its spending policy
+	// forbids. The error's data names the account and the rule.
+	ErrPolicyViolation = errors.New("account spending policy violation")
+)
+
+// Names of the spending policy rules, as reported
+// in the data of ErrPolicyViolation errors.
+const (
+	RuleMaxPerTransaction   = "max_amount_per_transaction"
+	RuleMaxPerDay           = "max_amount_per_day"
+	RuleAllowedDestinations = "allowed_destinations"
+	RuleRequiredRefDataKeys = "required_reference_data_keys"
+)
+
+const (
+	// spendWindow is the period over which
+	// daily spending limits are enforced.
+	spendWindow = 24 * time.Hour
+
+	maxPolicyRefDataKeyBytes = 256
+)
+
+// Policy restricts how assets may be spent from an account.
+// It is enforced when transactions spending from the account
+// are built. The zero Policy permits everything.
+type Policy struct {
+	// AssetLimits limits the amounts of assets that
+	// can be spent from the account.
+	AssetLimits []AssetLimit `json:"asset_limits,omitempty"`
+
+	// AllowedDestinationAccounts and AllowedDestinationPrograms,
+	// if either is set, restrict where assets spent from the
+	// account may go. Every output of a spent asset must be
+	// controlled by the account itself, by one of the accounts
+	// listed by ID, or by one of the listed control programs.
+	AllowedDestinationAccounts []string             `json:"allowed_destination_accounts,omitempty"`
+	AllowedDestinationPrograms []chainjson.HexBytes `json:"allowed_destination_programs,omitempty"`
+
+	// RequiredReferenceDataKeys lists the keys that must be present
+	// in the reference data of the transaction or of the account's
+	// spends in the transaction.
+	RequiredReferenceDataKeys []string `json:"required_reference_data_keys,omitempty"`
+}
+
+// AssetLimit limits the amount of one asset that can be spent
+// from an account. A zero maximum means no limit.
+type AssetLimit struct {
+	AssetID           bc.AssetID `json:"asset_id"`
+	MaxPerTransaction uint64     `json:"max_amount_per_transaction,omitempty"`
+
+	// MaxPerDay limits the amount spent in any 24 hours,
+	// counting the transactions confirmed in that time and
+	// those built by this Core that are still pending.
+	MaxPerDay uint64 `json:"max_amount_per_day,omitempty"`
+}
+
+func (p *Policy) validate() error {
+	seen := make(map[bc.AssetID]bool)
+	for i, l := range p.AssetLimits {
+		if l.AssetID == (bc.AssetID{}) {
+			return errors.WithDetailf(ErrBadPolicy, "asset limit %d has no asset_id", i)
+		}
+		if seen[l.AssetID] {
+			return errors.WithDetailf(ErrBadPolicy, "more than one limit for asset %s", l.AssetID)
+		}
+		seen[l.AssetID] = true
+	}
+	for _, id := range p.AllowedDestinationAccounts {
+		if id == "" {
+			return errors.WithDetail(ErrBadPolicy, "empty allowed destination account")
+		}
+	}
+	for _, prog := range p.AllowedDestinationPrograms {
+		if len(prog) == 0 {
+			return errors.WithDetail(ErrBadPolicy, "empty allowed destination program")
+		}
+	}
+	for _, k := range p.RequiredReferenceDataKeys {
+		if k == "" || len(k) > maxPolicyRefDataKeyBytes {
+			return errors.WithDetailf(ErrBadPolicy, "invalid required reference data key %q", k)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) limit(assetID bc.AssetID) *AssetLimit {
+	for i := range p.AssetLimits {
+		if p.AssetLimits[i].AssetID == assetID {
+			return &p.AssetLimits[i]
+		}
+	}
+	return nil
+}
+
+// UpdatePolicy replaces the spending policy of the account identified
+// by id or, if id is empty, by alias. A nil policy removes any
+// restrictions. It returns the updated account.
+func (m *Manager) UpdatePolicy(ctx context.Context, id, alias string, policy *Policy) (*Account, error) {
+	policyParam, err := policyToNullString(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	var q bytes.Buffer
+	q.WriteString(`UPDATE accounts SET policy = $1 WHERE `)
+	if id != "" {
+		q.WriteString(`account_id=$2`)
+	} else {
+		q.WriteString(`alias=$2`)
+		id = alias
+	}
+	q.WriteString(` RETURNING account_id, alias, tags`)
+
+	var (
+		accountID string
+		aliasSQL  stdsql.NullString
+		tagsJSON  []byte
+	)
+	err = m.db.QueryRow(ctx, q.String(), policyParam, id).Scan(&accountID, &aliasSQL, &tagsJSON)
+	if err == stdsql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "account id/alias: %s", id)
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	signer, err := m.findByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	account := &Account{
+		Signer: signer,
+		Alias:  aliasSQL.String,
+		Policy: policy,
+	}
+	if len(tagsJSON) > 0 {
+		err = json.Unmarshal(tagsJSON, &account.Tags)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+	}
+	return account, nil
+}
+
+// policyToNullString validates policy and
+// returns it as stored in the policy column.
+func policyToNullString(policy *Policy) (stdsql.NullString, error) {
+	if policy == nil {
+		return stdsql.NullString{}, nil
+	}
+	err := policy.validate()
+	if err != nil {
+		return stdsql.NullString{}, err
+	}
+	b, err := json.Marshal(policy)
+	if err != nil {
+		return stdsql.NullString{}, errors.Wrap(err)
+	}
+	return stdsql.NullString{String: string(b), Valid: true}, nil
+}
+
+// FindPolicy returns the spending policy of the account
+// with the given ID, or nil if it has none.
+func (m *Manager) FindPolicy(ctx context.Context, accountID string) (*Policy, error) {
+	const q = `SELECT policy FROM accounts WHERE account_id=$1`
+	var policyJSON []byte
+	err := m.db.QueryRow(ctx, q, accountID).Scan(&policyJSON)
+	if err == stdsql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "account id: %s", accountID)
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if len(policyJSON) == 0 {
+		return nil, nil
+	}
+	policy := new(Policy)
+	err = json.Unmarshal(policyJSON, policy)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding account policy")
+	}
+	return policy, nil
+}
+
+// policySpends accumulates the spends from one
+// account in a transaction being built.
+type policySpends struct {
+	policy    *Policy
+	amounts   map[bc.AssetID]uint64
+	refDatas  [][]byte
+	outputIDs []bc.Hash
+}
+
+// A spendHold counts a spend from an account in a built
+// transaction against the account's daily limit until the
+// transaction is confirmed or expires, or the build is
+// rolled back.
+type spendHold struct {
+	accountID string
+	assetID   bc.AssetID
+	amount    uint64
+	outputIDs []bc.Hash // the account UTXOs the transaction spends
+	expiry    time.Time
+}
+
+// checkPolicyDelayed records a spend from an account, of the
+// account UTXOs in outputIDs, in the transaction being built
+// by b. Once all actions are built, the account's spends in
+// the transaction are checked against the account's policy,
+// if it has one.
+func (m *Manager) checkPolicyDelayed(ctx context.Context, b *txbuilder.TemplateBuilder, accountID string, amt bc.AssetAmount, refData []byte, outputIDs []bc.Hash) error {
+	m.policySpendsMu.Lock()
+	spends := m.policySpends[b][accountID]
+	m.policySpendsMu.Unlock()
+
+	if spends == nil {
+		policy, err := m.FindPolicy(ctx, accountID)
+		if err != nil {
+			return err
+		}
+		spends = &policySpends{policy: policy, amounts: make(map[bc.AssetID]uint64)}
+
+		m.policySpendsMu.Lock()
+		if m.policySpends[b] == nil {
+			m.policySpends[b] = make(map[string]*policySpends)
+			forget := func() {
+				m.policySpendsMu.Lock()
+				delete(m.policySpends, b)
+				m.policySpendsMu.Unlock()
+			}
+			b.OnRollback(forget)
+			b.OnBuild(func() error {
+				forget()
+				return nil
+			})
+		}
+		m.policySpends[b][accountID] = spends
+		m.policySpendsMu.Unlock()
+
+		if policy != nil {
+			b.OnBuild(func() error {
+				return m.checkPolicy(ctx, b, accountID, spends)
+			})
+		}
+	}
+
+	spends.amounts[amt.AssetID] += amt.Amount
+	spends.outputIDs = append(spends.outputIDs, outputIDs...)
+	if len(refData) > 0 {
+		spends.refDatas = append(spends.refDatas, refData)
+	}
+	return nil
+}
+
+// checkPolicy checks the spends from an account in the
+// transaction being built by b against the account's policy.
+func (m *Manager) checkPolicy(ctx context.Context, b *txbuilder.TemplateBuilder, accountID string, spends *policySpends) error {
+	violation := func(rule, format string, args ...interface{}) error {
+		err := errors.WithDetailf(ErrPolicyViolation, format, args...)
+		return errors.WithData(err, "account_id", accountID, "rule", rule)
+	}
+	policy := spends.policy
+
+	for assetID, amount := range spends.amounts {
+		limit := policy.limit(assetID)
+		if limit == nil {
+			continue
+		}
+		if limit.MaxPerTransaction > 0 && amount > limit.MaxPerTransaction {
+			return violation(RuleMaxPerTransaction, "spending %d of asset %s exceeds the limit of %d per transaction", amount, assetID, limit.MaxPerTransaction)
+		}
+	}
+
+	err := m.holdDailySpends(ctx, b, accountID, spends, violation)
+	if err != nil {
+		return err
+	}
+
+	if len(policy.AllowedDestinationAccounts) > 0 || len(policy.AllowedDestinationPrograms) > 0 {
+		prog, err := m.disallowedDestination(ctx, b, accountID, spends)
+		if err != nil {
+			return err
+		}
+		if prog != nil {
+			return violation(RuleAllowedDestinations, "control program %x is not an allowed destination", prog)
+		}
+	}
+
+	if len(policy.RequiredReferenceDataKeys) > 0 {
+		keys := refDataKeys(b.ReferenceData())
+		for _, refData := range spends.refDatas {
+			for k := range refDataKeys(refData) {
+				keys[k] = true
+			}
+		}
+		for _, k := range policy.RequiredReferenceDataKeys {
+			if !keys[k] {
+				return violation(RuleRequiredRefDataKeys, "reference data is missing required key %q", k)
+			}
+		}
+	}
+	return nil
+}
+
+// disallowedDestination returns the control program of an output
+// of an asset spent from an account that the account's policy
+// doesn't allow, or nil if all such outputs are allowed.
+func (m *Manager) disallowedDestination(ctx context.Context, b *txbuilder.TemplateBuilder, accountID string, spends *policySpends) ([]byte, error) {
+	allowed := map[string]bool{accountID: true}
+	for _, id := range spends.policy.AllowedDestinationAccounts {
+		allowed[id] = true
+	}
+
+	var outs []*bc.TxOutput
+	for _, out := range b.Outputs() {
+		if _, ok := spends.amounts[out.AssetID]; !ok {
+			continue
+		}
+		if containsProgram(spends.policy.AllowedDestinationPrograms, out.ControlProgram) {
+			continue
+		}
+		outs = append(outs, out)
+	}
+	if len(outs) == 0 {
+		return nil, nil
+	}
+
+	// Find the accounts controlling the remaining outputs, among
+	// the control programs created while building this transaction
+	// and those already stored.
+	owners := make(map[string]string)
+	m.delayedACPsMu.Lock()
+	for _, acp := range m.delayedACPs[b] {
+		owners[string(acp.controlProgram)] = acp.accountID
+	}
+	m.delayedACPsMu.Unlock()
+
+	var progs pq.ByteaArray
+	for _, out := range outs {
+		progs = append(progs, out.ControlProgram)
+	}
+	const q = `
+		SELECT signer_id, control_program FROM account_control_programs
+		WHERE control_program IN (SELECT unnest($1::bytea[]))
+	`
+	err := pg.ForQueryRows(ctx, m.db, q, progs, func(signerID string, prog []byte) {
+		owners[string(prog)] = signerID
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "looking up destination accounts")
+	}
+
+	for _, out := range outs {
+		if !allowed[owners[string(out.ControlProgram)]] {
+			return out.ControlProgram, nil
+		}
+	}
+	return nil, nil
+}
+
+func containsProgram(progs []chainjson.HexBytes, prog []byte) bool {
+	for _, p := range progs {
+		if bytes.Equal(p, prog) {
+			return true
+		}
+	}
+	return false
+}
+
+// refDataKeys returns the top-level keys of refData,
+// if it holds a JSON object.
+func refDataKeys(refData []byte) map[string]bool {
+	keys := make(map[string]bool)
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(refData, &obj) == nil {
+		for k := range obj {
+			keys[k] = true
+		}
+	}
+	return keys
+}
+
+// holdDailySpends checks the spends from an account in the
+// transaction being built by b against the account's daily
+// limits, counting the spends held for other transactions.
+// If they're within the limits, it holds them as well.
+func (m *Manager) holdDailySpends(ctx context.Context, b *txbuilder.TemplateBuilder, accountID string, spends *policySpends, violation func(rule, format string, args ...interface{}) error) error {
+	// Checking and holding must be atomic, so that
+	// concurrent builds each count the other's spends.
+	m.spendHoldsMu.Lock()
+	defer m.spendHoldsMu.Unlock()
+
+	now := time.Now()
+	var holds []*spendHold
+	for assetID, amount := range spends.amounts {
+		limit := spends.policy.limit(assetID)
+		if limit == nil || limit.MaxPerDay == 0 {
+			continue
+		}
+		spent, err := m.spentSince(ctx, accountID, assetID, now.Add(-spendWindow))
+		if err != nil {
+			return err
+		}
+		for h := range m.spendHolds {
+			if h.accountID == accountID && h.assetID == assetID && h.expiry.After(now) {
+				spent += h.amount
+			}
+		}
+		if spent+amount > limit.MaxPerDay {
+			return violation(RuleMaxPerDay, "spending %d of asset %s after spending %d in the last day exceeds the daily limit of %d", amount, assetID, spent, limit.MaxPerDay)
+		}
+		holds = append(holds, &spendHold{
+			accountID: accountID,
+			assetID:   assetID,
+			amount:    amount,
+			outputIDs: spends.outputIDs,
+			expiry:    b.MaxTime(),
+		})
+	}
+	if len(holds) == 0 {
+		return nil
+	}
+
+	for _, h := range holds {
+		m.spendHolds[h] = true
+	}
+	b.OnRollback(func() {
+		m.spendHoldsMu.Lock()
+		for _, h := range holds {
+			delete(m.spendHolds, h)
+		}
+		m.spendHoldsMu.Unlock()
+	})
+	return nil
+}
+
+// releaseSpendHolds forgets the holds for transactions that
+// spent any of the given account UTXOs, since their spends
+// are now recorded in account_spends, and those that have
+// expired.
+func (m *Manager) releaseSpendHolds(spent map[bc.Hash]bool, now time.Time) {
+	m.spendHoldsMu.Lock()
+	defer m.spendHoldsMu.Unlock()
+	for h := range m.spendHolds {
+		if !h.expiry.After(now) {
+			delete(m.spendHolds, h)
+			continue
+		}
+		for _, id := range h.outputIDs {
+			if spent[id] {
+				delete(m.spendHolds, h)
+				break
+			}
+		}
+	}
+}
+
+// spentSince returns the amount of an asset the account has
+// spent in transactions confirmed in blocks since t.
+func (m *Manager) spentSince(ctx context.Context, accountID string, assetID bc.AssetID, t time.Time) (uint64, error) {
+	const q = `
+		SELECT COALESCE(SUM(amount), 0) FROM account_spends
+		WHERE account_id = $1 AND asset_id = $2 AND spent_at > $3
+	`
+	var spent uint64
+	err := m.db.QueryRow(ctx, q, accountID, assetID, t).Scan(&spent)
+	return spent, errors.Wrap(err, "summing account spends")
+}
+
+// recordAccountSpends records the net amount of each asset each
+// account spent in each transaction in block b, for enforcing daily
+// spending limits, and forgets spends that no limit can reach.
+// It must run after the block's account UTXOs have been indexed,
+// and before the UTXOs it spent are deleted.
+func (m *Manager) recordAccountSpends(ctx context.Context, b *bc.Block) error {
+	var outputIDs pq.ByteaArray
+	spent := make(map[bc.Hash]bool)
+	for _, tx := range b.Transactions {
+		for i, in := range tx.Inputs {
+			if !in.IsIssuance() {
+				outputIDs = append(outputIDs, tx.SpentOutputIDs[i].Bytes())
+				spent[tx.SpentOutputIDs[i]] = true
+			}
+		}
+		for j := range tx.Outputs {
+			outputIDs = append(outputIDs, tx.OutputID(uint32(j)).Bytes())
+		}
+	}
+
+	type accountUTXO struct {
+		accountID string
+		assetID   bc.AssetID
+		amount    int64
+	}
+	utxos := make(map[bc.Hash]accountUTXO)
+	const selectQ = `
+		SELECT output_id, account_id, asset_id, amount FROM account_utxos
+		WHERE output_id IN (SELECT unnest($1::bytea[]))
+	`
+	err := pg.ForQueryRows(ctx, m.db, selectQ, outputIDs, func(outputID bc.Hash, accountID string, assetID bc.AssetID, amount int64) {
+		utxos[outputID] = accountUTXO{accountID, assetID, amount}
+	})
+	if err != nil {
+		return errors.Wrap(err, "loading spent account utxos")
+	}
+
+	var (
+		txHashes   pq.ByteaArray
+		accountIDs pq.StringArray
+		assetIDs   pq.ByteaArray
+		amounts    pq.Int64Array
+	)
+	for _, tx := range b.Transactions {
+		type key struct {
+			accountID string
+			assetID   bc.AssetID
+		}
+		net := make(map[key]int64)
+		for i, in := range tx.Inputs {
+			if in.IsIssuance() {
+				continue
+			}
+			if u, ok := utxos[tx.SpentOutputIDs[i]]; ok {
+				net[key{u.accountID, u.assetID}] += u.amount
+			}
+		}
+		for j := range tx.Outputs {
+			if u, ok := utxos[tx.OutputID(uint32(j))]; ok {
+				net[key{u.accountID, u.assetID}] -= u.amount
+			}
+		}
+		for k, amount := range net {
+			if amount <= 0 {
+				continue
+			}
+			txHashes = append(txHashes, tx.ID.Bytes())
+			accountIDs = append(accountIDs, k.accountID)
+			assetIDs = append(assetIDs, k.assetID[:])
+			amounts = append(amounts, amount)
+		}
+	}
+
+	const insertQ = `
+		INSERT INTO account_spends (tx_hash, account_id, asset_id, amount, spent_at)
+		SELECT unnest($1::bytea[]), unnest($2::text[]), unnest($3::bytea[]), unnest($4::bigint[]), $5
+		ON CONFLICT (tx_hash, account_id, asset_id) DO NOTHING
+	`
+	_, err = m.db.Exec(ctx, insertQ, txHashes, accountIDs, assetIDs, amounts, b.Time())
+	if err != nil {
+		return errors.Wrap(err, "inserting account spends")
+	}
+	m.releaseSpendHolds(spent, time.Now())
+
+	const deleteQ = `DELETE FROM account_spends WHERE spent_at < $1`
+	_, err = m.db.Exec(ctx, deleteQ, b.Time().Add(-spendWindow))
+	return errors.Wrap(err, "deleting old account spends")
+}
@@ -0,0 +1,135 @@
+package account
+
+import (
+	"context"
+	"testing"
+
+	"chain/crypto/ed25519/chainkd"
+	"chain/database/pg"
+	"chain/database/pg/pgtest"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	asset := bc.AssetID{1}
+	cases := []struct {
+		policy Policy
+		ok     bool
+	}{
+		{Policy{}, true},
+		{Policy{
+			AssetLimits:                []AssetLimit{{AssetID: asset, MaxPerTransaction: 10, MaxPerDay: 100}},
+			AllowedDestinationAccounts: []string{"acc1"},
+			AllowedDestinationPrograms: []chainjson.HexBytes{{0x51}},
+			RequiredReferenceDataKeys:  []string{"invoice"},
+		}, true},
+		{Policy{AssetLimits: []AssetLimit{{MaxPerTransaction: 10}}}, false},
+		{Policy{AssetLimits: []AssetLimit{{AssetID: asset}, {AssetID: asset}}}, false},
+		{Policy{AllowedDestinationAccounts: []string{""}}, false},
+		{Policy{AllowedDestinationPrograms: []chainjson.HexBytes{{}}}, false},
+		{Policy{RequiredReferenceDataKeys: []string{""}}, false},
+	}
+	for i, c := range cases {
+		err := c.policy.validate()
+		if c.ok && err != nil {
+			t.Errorf("case %d: validate() = %v, want nil", i, err)
+		}
+		if !c.ok && errors.Root(err) != ErrBadPolicy {
+			t.Errorf("case %d: validate() = %v, want %v", i, err, ErrBadPolicy)
+		}
+	}
+}
+
+func TestRefDataKeys(t *testing.T) {
+	cases := []struct {
+		refData string
+		want    map[string]bool
+	}{
+		{``, map[string]bool{}},
+		{`"not an object"`, map[string]bool{}},
+		{`{"a": 1, "b": {"c": 2}}`, map[string]bool{"a": true, "b": true}},
+	}
+	for _, c := range cases {
+		got := refDataKeys([]byte(c.refData))
+		if !testutil.DeepEqual(got, c.want) {
+			t.Errorf("refDataKeys(%s) = %v, want %v", c.refData, got, c.want)
+		}
+	}
+}
+
+func TestCreateAccountPolicy(t *testing.T) {
+	db := pgtest.NewTx(t)
+	m := NewManager(db, prottest.NewChain(t), nil)
+	ctx := context.Background()
+
+	policy := &Policy{
+		AssetLimits: []AssetLimit{{AssetID: bc.AssetID{1}, MaxPerDay: 100}},
+	}
+	acc, err := m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "", nil, policy, "")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	got, err := m.FindPolicy(ctx, acc.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !testutil.DeepEqual(got, policy) {
+		t.Errorf("FindPolicy() = %+v want %+v", got, policy)
+	}
+
+	// An invalid policy creates no account.
+	bad := &Policy{AssetLimits: []AssetLimit{{MaxPerDay: 100}}}
+	_, err = m.Create(ctx, []chainkd.XPub{testutil.TestXPub}, 1, "", nil, bad, "")
+	if errors.Root(err) != ErrBadPolicy {
+		t.Errorf("got error %v want %v", err, ErrBadPolicy)
+	}
+}
+
+func TestUpdatePolicy(t *testing.T) {
+	db := pgtest.NewTx(t)
+	m := NewManager(db, prottest.NewChain(t), nil)
+	ctx := context.Background()
+	acc := m.createTestAccount(ctx, t, "some-account", nil)
+
+	policy := &Policy{
+		AssetLimits:               []AssetLimit{{AssetID: bc.AssetID{1}, MaxPerTransaction: 10}},
+		RequiredReferenceDataKeys: []string{"invoice"},
+	}
+	updated, err := m.UpdatePolicy(ctx, "", "some-account", policy)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if updated.ID != acc.ID {
+		t.Errorf("updated account ID = %s want %s", updated.ID, acc.ID)
+	}
+
+	got, err := m.FindPolicy(ctx, acc.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !testutil.DeepEqual(got, policy) {
+		t.Errorf("FindPolicy() = %+v want %+v", got, policy)
+	}
+
+	// A nil policy removes the restrictions.
+	_, err = m.UpdatePolicy(ctx, acc.ID, "", nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	got, err = m.FindPolicy(ctx, acc.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if got != nil {
+		t.Errorf("FindPolicy() = %+v want nil", got)
+	}
+
+	_, err = m.UpdatePolicy(ctx, "nonexistent", "", policy)
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("got error %v want %v", err, pg.ErrUserInputNotFound)
+	}
+}
@@ -42,6 +42,7 @@ type utxo struct {
 	RefDataHash    bc.Hash
 
 	AccountID           string
+	SignerVersion       int
 	ControlProgramIndex uint64
 }
 
@@ -383,14 +384,14 @@ func (sr *sourceReserver) refillCache(ctx context.Context) error {
 
 func findMatchingUTXOs(ctx context.Context, db pg.DB, src source, height uint64) ([]*utxo, error) {
 	const q = `
-		SELECT output_id, amount, control_program_index, control_program,
+		SELECT output_id, amount, signer_version, control_program_index, control_program,
 			source_id, source_pos, ref_data_hash
 		FROM account_utxos
 		WHERE account_id = $1 AND asset_id = $2 AND confirmed_in > $3
 	`
 	var utxos []*utxo
 	err := pg.ForQueryRows(ctx, db, q, src.AccountID, src.AssetID, height,
-		func(oid bc.Hash, amount uint64, cpIndex uint64, controlProg []byte, sourceID bc.Hash, sourcePos uint64, refData bc.Hash) {
+		func(oid bc.Hash, amount uint64, signerVersion int, cpIndex uint64, controlProg []byte, sourceID bc.Hash, sourcePos uint64, refData bc.Hash) {
 			utxos = append(utxos, &utxo{
 				OutputID: oid,
 				SourceID: sourceID,
@@ -402,6 +403,7 @@ func findMatchingUTXOs(ctx context.Context, db pg.DB, src source, height uint64)
 				ControlProgram:      controlProg,
 				RefDataHash:         refData,
 				AccountID:           src.AccountID,
+				SignerVersion:       signerVersion,
 				ControlProgramIndex: cpIndex,
 			})
 		})
@@ -413,7 +415,7 @@ func findMatchingUTXOs(ctx context.Context, db pg.DB, src source, height uint64)
 
 func findSpecificUTXO(ctx context.Context, db pg.DB, out bc.Hash) (*utxo, error) {
 	const q = `
-		SELECT account_id, asset_id, amount, control_program_index, control_program,
+		SELECT account_id, asset_id, amount, signer_version, control_program_index, control_program,
 			source_id, source_pos, ref_data_hash
 		FROM account_utxos
 		WHERE output_id = $1
@@ -424,6 +426,7 @@ func findSpecificUTXO(ctx context.Context, db pg.DB, out bc.Hash) (*utxo, error)
 		&u.AccountID,
 		&u.AssetID,
 		&u.Amount,
+		&u.SignerVersion,
 		&u.ControlProgramIndex,
 		&u.ControlProgram,
 		&u.SourceID,
@@ -0,0 +1,140 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+
+	"chain/core/txbuilder"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// ErrNothingToSweep is returned when building a sweep action
+// for an account that has no unreserved outputs controlled
+// by keys it has rotated away from.
+var ErrNothingToSweep = errors.New("no outputs controlled by retired account keys")
+
+// defaultSweepInputs is the default limit on the number
+// of outputs a single sweep action spends.
+const defaultSweepInputs = 100
+
+// NewSweepAction returns an action that spends up to maxInputs
+// outputs controlled by the retired keys of an account and pays
+// them back to the account under its current keys. A zero
+// maxInputs means the default limit.
+func (m *Manager) NewSweepAction(accountID string, maxInputs int, refData chainjson.Map) txbuilder.Action {
+	return &sweepAction{
+		accounts:      m,
+		AccountID:     accountID,
+		MaxInputs:     maxInputs,
+		ReferenceData: refData,
+	}
+}
+
+func (m *Manager) DecodeSweepAction(data []byte) (txbuilder.Action, error) {
+	a := &sweepAction{accounts: m}
+	err := json.Unmarshal(data, a)
+	return a, err
+}
+
+// sweepAction moves an account's funds from outputs controlled
+// by its retired keys to new outputs controlled by its current
+// keys. Each action moves one batch of outputs; the outputs are
+// reserved, so a client sweeps an account by building and
+// submitting transactions until ErrNothingToSweep.
+type sweepAction struct {
+	accounts      *Manager
+	AccountID     string        `json:"account_id"`
+	MaxInputs     int           `json:"max_inputs"`
+	ReferenceData chainjson.Map `json:"reference_data"`
+}
+
+func (a *sweepAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
+	if a.AccountID == "" {
+		return txbuilder.MissingFieldsError("account_id")
+	}
+	maxInputs := a.MaxInputs
+	if maxInputs <= 0 {
+		maxInputs = defaultSweepInputs
+	}
+
+	acct, err := a.accounts.findByID(ctx, a.AccountID)
+	if err != nil {
+		return errors.Wrap(err, "get account info")
+	}
+
+	const q = `
+		SELECT output_id FROM account_utxos
+		WHERE account_id = $1 AND signer_version < $2
+		ORDER BY confirmed_in, output_id
+	`
+	var outputIDs []bc.Hash
+	err = pg.ForQueryRows(ctx, a.accounts.db, q, acct.ID, acct.Version, func(outputID bc.Hash) {
+		outputIDs = append(outputIDs, outputID)
+	})
+	if err != nil {
+		return errors.Wrap(err, "finding outputs to sweep")
+	}
+
+	totals := make(map[bc.AssetID]uint64)
+	var n int
+	for _, outputID := range outputIDs {
+		if n >= maxInputs {
+			break
+		}
+		res, err := a.accounts.utxoDB.ReserveUTXO(ctx, outputID, nil, b.MaxTime())
+		if errors.Root(err) == ErrReserved || errors.Root(err) == pg.ErrUserInputNotFound {
+			// Another transaction is spending it, or already has.
+			continue
+		} else if err != nil {
+			return errors.Wrap(err, "reserving utxo")
+		}
+		u := res.UTXOs[0]
+		if u.Amount > math.MaxInt64-totals[u.AssetID] {
+			// Leave it for the next batch rather than
+			// overflow the amount of the sweep output.
+			canceler(ctx, a.accounts, res.ID)()
+			continue
+		}
+		b.OnRollback(canceler(ctx, a.accounts, res.ID))
+
+		txInput, sigInst, err := a.accounts.utxoToInputs(ctx, acct, u, a.ReferenceData)
+		if err != nil {
+			return errors.Wrap(err, "creating inputs")
+		}
+		err = b.AddInput(txInput, sigInst)
+		if err != nil {
+			return errors.Wrap(err, "adding inputs")
+		}
+		totals[u.AssetID] += u.Amount
+		n++
+	}
+	if n == 0 {
+		return errors.WithDetailf(ErrNothingToSweep, "account id: %s", acct.ID)
+	}
+
+	assetIDs := make([]bc.AssetID, 0, len(totals))
+	for assetID := range totals {
+		assetIDs = append(assetIDs, assetID)
+	}
+	sort.Slice(assetIDs, func(i, j int) bool {
+		return assetIDs[i].String() < assetIDs[j].String()
+	})
+	for _, assetID := range assetIDs {
+		acp, err := a.accounts.createControlProgram(ctx, acct.ID, false, b.MaxTime())
+		if err != nil {
+			return errors.Wrap(err, "creating control program")
+		}
+		a.accounts.insertControlProgramDelayed(ctx, b, acp)
+
+		err = b.AddOutput(bc.NewTxOutput(assetID, totals[assetID], acp.controlProgram, nil))
+		if err != nil {
+			return errors.Wrap(err, "adding sweep output")
+		}
+	}
+	return nil
+}
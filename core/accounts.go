@@ -16,6 +16,10 @@ func (a *API) createAccount(ctx context.Context, ins []struct {
 	Alias     string
 	Tags      map[string]interface{}
 
+	// Policy, if set, restricts how assets
+	// may be spent from the account.
+	Policy *account.Policy
+
 	// ClientToken is the application's unique token for the account. Every account
 	// should have a unique client token. The client token is used to ensure
 	// idempotency of create account requests. Duplicate create account requests
@@ -32,7 +36,82 @@ func (a *API) createAccount(ctx context.Context, ins []struct {
 			defer wg.Done()
 			defer batchRecover(subctx, &responses[i])
 
-			acc, err := a.accounts.Create(subctx, ins[i].RootXPubs, ins[i].Quorum, ins[i].Alias, ins[i].Tags, ins[i].ClientToken)
+			acc, err := a.accounts.Create(subctx, ins[i].RootXPubs, ins[i].Quorum, ins[i].Alias, ins[i].Tags, ins[i].Policy, ins[i].ClientToken)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			aa, err := account.Annotated(acc)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			responses[i] = aa
+		}(i)
+	}
+
+	wg.Wait()
+	return responses
+}
+
+// POST /update-account-tags
+func (a *API) updateAccountTags(ctx context.Context, ins []struct {
+	ID    string
+	Alias string
+	Tags  map[string]interface{}
+
+	// Backfill, if set, also rewrites the account tags recorded on
+	// transactions that have already been indexed, and on their
+	// inputs and outputs, so that /list-transactions and
+	// /list-balances see the new tags.
+	Backfill bool
+}) interface{} {
+	responses := make([]interface{}, len(ins))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := range responses {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			acc, err := a.accounts.UpdateTags(subctx, ins[i].ID, ins[i].Alias, ins[i].Tags, ins[i].Backfill && a.indexTxs)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			aa, err := account.Annotated(acc)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			responses[i] = aa
+		}(i)
+	}
+
+	wg.Wait()
+	return responses
+}
+
+// POST /rotate-account-keys
+func (a *API) rotateAccountKeys(ctx context.Context, ins []struct {
+	ID        string
+	Alias     string
+	RootXPubs []chainkd.XPub `json:"root_xpubs"`
+	Quorum    int
+}) interface{} {
+	responses := make([]interface{}, len(ins))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := range responses {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			acc, err := a.accounts.RotateKeys(subctx, ins[i].ID, ins[i].Alias, ins[i].RootXPubs, ins[i].Quorum)
 			if err != nil {
 				responses[i] = err
 				return
@@ -49,3 +128,49 @@ func (a *API) createAccount(ctx context.Context, ins []struct {
 	wg.Wait()
 	return responses
 }
+
+type accountPolicy struct {
+	ID     string          `json:"id"`
+	Alias  string          `json:"alias,omitempty"`
+	Policy *account.Policy `json:"policy"`
+}
+
+// POST /update-account-policy
+func (a *API) updateAccountPolicy(ctx context.Context, ins []struct {
+	ID     string
+	Alias  string
+	Policy *account.Policy
+}) interface{} {
+	responses := make([]interface{}, len(ins))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := range responses {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			acc, err := a.accounts.UpdatePolicy(subctx, ins[i].ID, ins[i].Alias, ins[i].Policy)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			responses[i] = accountPolicy{ID: acc.ID, Alias: acc.Alias, Policy: acc.Policy}
+		}(i)
+	}
+
+	wg.Wait()
+	return responses
+}
+
+// POST /get-account-policy
+func (a *API) getAccountPolicy(ctx context.Context, in struct {
+	ID string `json:"id"`
+}) (accountPolicy, error) {
+	policy, err := a.accounts.FindPolicy(ctx, in.ID)
+	if err != nil {
+		return accountPolicy{}, err
+	}
+	return accountPolicy{ID: in.ID, Policy: policy}, nil
+}
@@ -13,7 +13,9 @@ import (
 	"chain/core/accesstoken"
 	"chain/core/account"
 	"chain/core/asset"
+	"chain/core/blocksigner"
 	"chain/core/config"
+	"chain/core/fetch"
 	"chain/core/generator"
 	"chain/core/leader"
 	"chain/core/pin"
@@ -58,6 +60,7 @@ type API struct {
 	accounts        *account.Manager
 	indexer         *query.Indexer
 	txFeeds         *txfeed.Tracker
+	txFeedWebhooks  *txfeed.Dispatcher
 	accessTokens    *accesstoken.CredentialStore
 	config          *config.Config
 	submitter       txbuilder.Submitter
@@ -71,10 +74,16 @@ type API struct {
 	requestLimits   []requestLimit
 	generator       *generator.Generator
 	remoteGenerator *rpc.Client
+	blockPeers      []*rpc.Client
+	fetchPeers      []*fetch.Peer
+	signerPeers     []*rpc.Client
 	indexTxs        bool
 
 	healthMu     sync.Mutex
 	healthErrors map[string]interface{}
+
+	outputsMu       sync.Mutex
+	reservedOutputs map[bc.Hash]*outputReservation
 }
 
 func (a *API) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
@@ -127,8 +136,15 @@ func (a *API) buildHandler() {
 
 	m.Handle("/create-account", needConfig(a.createAccount))
 	m.Handle("/create-asset", needConfig(a.createAsset))
+	m.Handle("/update-account-tags", needConfig(a.updateAccountTags))
+	m.Handle("/update-account-policy", needConfig(a.updateAccountPolicy))
+	m.Handle("/rotate-account-keys", needConfig(a.rotateAccountKeys))
+	m.Handle("/get-account-policy", needConfig(a.getAccountPolicy))
+	m.Handle("/update-asset-tags", needConfig(a.updateAssetTags))
 	m.Handle("/build-transaction", needConfig(a.build))
-	m.Handle("/submit-transaction", needConfig(a.submit))
+	m.Handle("/submit-transaction", a.acceptTemplates(needConfig(a.submit), a.submitTemplates))
+	m.Handle("/accept-offer", needConfig(a.acceptOffer))
+	m.Handle("/simulate-transaction", needConfig(a.simulate))
 	m.Handle("/create-control-program", needConfig(a.createControlProgram)) // DEPRECATED
 	m.Handle("/create-account-receiver", needConfig(a.createAccountReceiver))
 	m.Handle("/create-transaction-feed", needConfig(a.createTxFeed))
@@ -141,16 +157,25 @@ func (a *API) buildHandler() {
 	m.Handle("/list-transaction-feeds", needConfig(a.listTxFeeds))
 	m.Handle("/list-transactions", needConfig(a.listTransactions))
 	m.Handle("/list-balances", needConfig(a.listBalances))
+	m.Handle("/list-balance-history", needConfig(a.listBalanceHistory))
 	m.Handle("/list-unspent-outputs", needConfig(a.listUnspentOutputs))
+	m.Handle("/list-pending-transactions", needConfig(a.listPendingTxs))
+	m.Handle("/get-transaction-status", needConfig(a.getTxStatus))
 	m.Handle("/reset", devOnly(needConfig(a.reset)))
+	m.Handle("/debug/trace-transaction", devOnly(needConfig(a.traceTx)))
 
 	m.Handle(networkRPCPrefix+"submit", needConfig(func(ctx context.Context, tx *bc.Tx) error {
 		return a.submitter.Submit(ctx, tx)
 	}))
+	m.Handle(networkRPCPrefix+"get-transaction-status", needConfig(a.getTxStatusRPC))
+	m.Handle(networkRPCPrefix+"list-pending-transactions", needConfig(a.listPendingTxsRPC))
 	m.Handle(networkRPCPrefix+"get-block", needConfig(a.getBlockRPC))
 	m.Handle(networkRPCPrefix+"get-snapshot-info", needConfig(a.getSnapshotInfoRPC))
 	m.Handle(networkRPCPrefix+"get-snapshot", http.HandlerFunc(a.getSnapshotRPC))
 	m.Handle(networkRPCPrefix+"signer/sign-block", needConfig(a.leaderSignHandler(a.signer)))
+	m.Handle(networkRPCPrefix+"signer/signed-headers", needConfig(func(ctx context.Context, height uint64) ([]*blocksigner.SignedHeader, error) {
+		return blocksigner.SignedHeaders(ctx, a.db, height)
+	}))
 	m.Handle(networkRPCPrefix+"block-height", needConfig(func(ctx context.Context) map[string]uint64 {
 		h := a.chain.Height()
 		return map[string]uint64{
@@ -163,6 +188,7 @@ func (a *API) buildHandler() {
 	m.Handle("/delete-access-token", jsonHandler(a.deleteAccessToken))
 	m.Handle("/configure", jsonHandler(a.configure))
 	m.Handle("/info", jsonHandler(a.info))
+	m.Handle("/compile", jsonHandler(a.compile))
 
 	m.Handle("/debug/vars", expvar.Handler())
 	m.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
@@ -219,10 +245,19 @@ type requestQuery struct {
 	StartTimeMS uint64 `json:"start_time,omitempty"`
 	EndTimeMS   uint64 `json:"end_time,omitempty"`
 
+	// This is used by /list-balance-history to set the time between
+	// points in the history. Value must be "hour", "day" or "week".
+	BucketInterval string `json:"bucket_interval,omitempty"`
+
 	// This is used for point-in-time queries like /list-balances
 	// TODO(bobg): Different request structs for endpoints with different needs
 	TimestampMS uint64 `json:"timestamp,omitempty"`
 
+	// This is used for point-in-time queries like /list-balances
+	// that should reflect the blockchain as of a given block,
+	// independent of block timestamps.
+	AsOfHeight uint64 `json:"as_of_height,omitempty"`
+
 	// This is used for filtering results from /list-access-tokens
 	// Value must be "client" or "network"
 	Type string `json:"type"`
@@ -151,6 +151,43 @@ func (reg *Registry) Define(ctx context.Context, xpubs []chainkd.XPub, quorum in
 	return asset, nil
 }
 
+// UpdateTags replaces the tags of the asset identified by id or,
+// if id is nil, by alias. It returns the updated asset.
+func (reg *Registry) UpdateTags(ctx context.Context, id *bc.AssetID, alias string, tags map[string]interface{}, backfill bool) (*Asset, error) {
+	var (
+		asset *Asset
+		err   error
+	)
+	if id != nil {
+		asset, err = reg.findByID(ctx, *id)
+	} else {
+		asset, err = reg.FindByAlias(ctx, alias)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "looking up asset")
+	}
+
+	err = updateAssetTags(ctx, reg.db, asset.AssetID, tags, backfill)
+	if err != nil {
+		return nil, errors.Wrap(err, "updating asset tags")
+	}
+
+	// Cached assets are shared, so update a copy and replace
+	// the cache entry rather than modifying the asset in place.
+	updated := *asset
+	updated.Tags = tags
+	reg.cacheMu.Lock()
+	reg.cache.Add(updated.AssetID, &updated)
+	reg.cacheMu.Unlock()
+
+	err = reg.indexAnnotatedAsset(ctx, &updated)
+	if err != nil {
+		return nil, errors.Wrap(err, "indexing annotated asset")
+	}
+
+	return &updated, nil
+}
+
 // findByID retrieves an Asset record along with its signer, given an assetID.
 func (reg *Registry) findByID(ctx context.Context, id bc.AssetID) (*Asset, error) {
 	reg.cacheMu.Lock()
@@ -264,6 +301,50 @@ func insertAssetTags(ctx context.Context, db pg.DB, assetID bc.AssetID, tags map
 	return nil
 }
 
+// updateAssetTags replaces the tags of an asset, as insertAssetTags
+// does. If backfill is set, it also rewrites, in the same statement,
+// the asset tags recorded on the asset's transactions that have
+// already been indexed.
+func updateAssetTags(ctx context.Context, db pg.DB, assetID bc.AssetID, tags map[string]interface{}, backfill bool) error {
+	tagsParam, err := mapToNullString(tags)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	annotatedTags := `{}`
+	if tagsParam.Valid {
+		annotatedTags = tagsParam.String
+	}
+
+	const q = `
+		WITH tags AS (
+			INSERT INTO asset_tags (asset_id, tags) VALUES ($1, $2)
+			ON CONFLICT (asset_id) DO UPDATE SET tags = $2
+		), inputs AS (
+			UPDATE annotated_inputs SET asset_tags = $3::jsonb
+			WHERE $4 AND asset_id = $1
+			RETURNING tx_hash
+		), outputs AS (
+			UPDATE annotated_outputs SET asset_tags = $3::jsonb
+			WHERE $4 AND asset_id = $1
+			RETURNING tx_hash
+		)
+		UPDATE annotated_txs SET data = jsonb_set(jsonb_set(data,
+			'{inputs}', (
+				SELECT COALESCE(jsonb_agg(CASE WHEN e->>'asset_id' = $5
+					THEN jsonb_set(e, '{asset_tags}', $3::jsonb) ELSE e END ORDER BY n), '[]')
+				FROM jsonb_array_elements(data->'inputs') WITH ORDINALITY AS x(e, n)
+			)),
+			'{outputs}', (
+				SELECT COALESCE(jsonb_agg(CASE WHEN e->>'asset_id' = $5
+					THEN jsonb_set(e, '{asset_tags}', $3::jsonb) ELSE e END ORDER BY n), '[]')
+				FROM jsonb_array_elements(data->'outputs') WITH ORDINALITY AS x(e, n)
+			))
+		WHERE tx_hash IN (SELECT tx_hash FROM inputs UNION SELECT tx_hash FROM outputs)
+	`
+	_, err = db.Exec(ctx, q, assetID, tagsParam, annotatedTags, backfill, assetID.String())
+	return errors.Wrap(err)
+}
+
 // assetByClientToken loads an asset from the database using its client token.
 func assetByClientToken(ctx context.Context, db pg.DB, clientToken string) (*Asset, error) {
 	return assetQuery(ctx, db, "assets.client_token=$1", clientToken)
@@ -59,6 +59,40 @@ func TestDefineAssetIdempotency(t *testing.T) {
 	}
 }
 
+func TestUpdateAssetTags(t *testing.T) {
+	r := NewRegistry(pgtest.NewTx(t), prottest.NewChain(t), nil)
+	ctx := context.Background()
+	keys := []chainkd.XPub{testutil.TestXPub}
+	asset, err := r.Define(ctx, keys, 1, nil, "gold", map[string]interface{}{"class": "commodity"}, "")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	newTags := map[string]interface{}{"class": "precious-metal"}
+	updated, err := r.UpdateTags(ctx, &asset.AssetID, "", newTags, false)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !testutil.DeepEqual(updated.Tags, newTags) {
+		t.Errorf("updated asset tags = %v want %v", updated.Tags, newTags)
+	}
+
+	// The registry's cache and the database should both
+	// reflect the new tags.
+	for _, find := range []func() (*Asset, error){
+		func() (*Asset, error) { return r.FindByAlias(ctx, "gold") },
+		func() (*Asset, error) { return assetQuery(ctx, r.db, "assets.id=$1", asset.AssetID) },
+	} {
+		found, err := find()
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if !testutil.DeepEqual(found.Tags, newTags) {
+			t.Errorf("found asset tags = %v want %v", found.Tags, newTags)
+		}
+	}
+}
+
 func TestFindAssetByID(t *testing.T) {
 	r := NewRegistry(pgtest.NewTx(t), prottest.NewChain(t), nil)
 	ctx := context.Background()
@@ -7,6 +7,7 @@ import (
 	"chain/core/asset"
 	"chain/crypto/ed25519/chainkd"
 	"chain/net/http/reqid"
+	"chain/protocol/bc"
 )
 
 // POST /create-asset
@@ -58,3 +59,43 @@ func (a *API) createAsset(ctx context.Context, ins []struct {
 	wg.Wait()
 	return responses, nil
 }
+
+// POST /update-asset-tags
+func (a *API) updateAssetTags(ctx context.Context, ins []struct {
+	ID    *bc.AssetID
+	Alias string
+	Tags  map[string]interface{}
+
+	// Backfill, if set, also rewrites the asset tags recorded on
+	// transactions that have already been indexed, and on their
+	// inputs and outputs, so that /list-transactions and
+	// /list-balances see the new tags.
+	Backfill bool
+}) interface{} {
+	responses := make([]interface{}, len(ins))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := range responses {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			updated, err := a.assets.UpdateTags(subctx, ins[i].ID, ins[i].Alias, ins[i].Tags, ins[i].Backfill && a.indexTxs)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			aa, err := asset.Annotated(updated)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			responses[i] = aa
+		}(i)
+	}
+
+	wg.Wait()
+	return responses
+}
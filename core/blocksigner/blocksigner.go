@@ -6,15 +6,18 @@ import (
 	"context"
 	"fmt"
 
+	"chain/core/config"
 	"chain/crypto/ed25519"
 	"chain/database/pg"
 	"chain/errors"
+	"chain/log"
 	"chain/protocol"
 	"chain/protocol/bc"
 )
 
 // ErrConsensusChange is returned from ValidateAndSignBlock
-// when a new consensus program is detected.
+// when a block changes the consensus program to one other
+// than the one the signer accepted with AcceptConsensusProgram.
 var ErrConsensusChange = errors.New("consensus program has changed")
 
 // ErrInvalidKey is returned from SignBlock when the
@@ -68,23 +71,50 @@ func (s *BlockSigner) String() string {
 //
 // This function fails if this node has ever signed a different block at the
 // same height as b.
+//
+// It records the header of every block it's asked to sign, with the
+// signature or the reason it didn't sign, for WatchEquivocation.
 func (s *BlockSigner) ValidateAndSignBlock(ctx context.Context, b *bc.Block) ([]byte, error) {
+	err := recordRequest(ctx, s.db, s.Pub, b)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := s.validateAndSignBlock(ctx, b)
+	if err != nil {
+		rerr := recordRejection(ctx, s.db, s.Pub, b, err)
+		if rerr != nil {
+			log.Error(ctx, rerr)
+		}
+		return nil, err
+	}
+	err = recordSignature(ctx, s.db, s.Pub, b, sig)
+	if err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+func (s *BlockSigner) validateAndSignBlock(ctx context.Context, b *bc.Block) ([]byte, error) {
 	err := <-s.c.BlockSoonWaiter(ctx, b.Height-1)
 	if err != nil {
 		return nil, errors.Wrapf(err, "waiting for block at height %d", b.Height-1)
 	}
 	prev, err := s.c.GetBlock(ctx, b.Height-1)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting block at height %d", b.Height-1)
+		return nil, errors.Wrapf(err, "getting block at height %d", b.Height-1)
 	}
-	// TODO: Add the ability to change the consensus program
-	// by having a current consensus program, and a potential
-	// next consensus program. Once the next consensus program
-	// has been used, it will become the current consensus program
-	// and the only signable consensus program until a new
-	// next is set.
+	// The block may change the consensus program only to the
+	// one next consensus program this signer has accepted.
+	// Once it's in use it's the current one, and the only one
+	// the signer signs for until it accepts another.
 	if !bytes.Equal(b.ConsensusProgram, prev.ConsensusProgram) {
-		return nil, errors.Wrap(ErrConsensusChange)
+		next, err := config.NextConsensusProgram(ctx, s.db)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting next consensus program")
+		}
+		if !bytes.Equal(b.ConsensusProgram, next) {
+			return nil, errors.Wrap(ErrConsensusChange)
+		}
 	}
 	err = s.c.ValidateBlockForSig(ctx, b)
 	if err != nil {
@@ -97,6 +127,15 @@ func (s *BlockSigner) ValidateAndSignBlock(ctx context.Context, b *bc.Block) ([]
 	return s.SignBlock(ctx, b)
 }
 
+// AcceptConsensusProgram makes prog the one next consensus
+// program the signer whose database is db will sign blocks
+// for, replacing any it accepted before. The generator must
+// propose the same program, with
+// generator.ProposeConsensusProgram.
+func AcceptConsensusProgram(ctx context.Context, db pg.DB, prog []byte) error {
+	return config.SetNextConsensusProgram(ctx, db, prog)
+}
+
 // lockBlockHeight records a signer's intention to sign a given block
 // at a given height.  It's an error if a different block at the same
 // height has previously been signed.
@@ -0,0 +1,395 @@
+package blocksigner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"chain/core/rpc"
+	"chain/crypto/ed25519"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol"
+	"chain/protocol/bc"
+	"chain/protocol/vmutil"
+)
+
+const (
+	// evidencePeriod is how often WatchEquivocation
+	// exchanges signed headers with its peers.
+	evidencePeriod = 10 * time.Second
+
+	// maxSignedHeaders is the most signed headers
+	// returned for one signed-headers request.
+	maxSignedHeaders = 1000
+)
+
+// ErrBadSignedHeader is returned when a signed header
+// or an equivocation proof fails verification.
+var ErrBadSignedHeader = errors.New("invalid signed header")
+
+// A SignedHeader records a block header a signer was asked
+// to sign, with its signature if it signed the block or the
+// reason it didn't.
+type SignedHeader struct {
+	Header    *bc.BlockHeader    `json:"header"`
+	Pubkey    chainjson.HexBytes `json:"pubkey"`
+	Signature chainjson.HexBytes `json:"signature,omitempty"`
+	Rejection string             `json:"rejection,omitempty"`
+}
+
+// Verify checks that h is signed with its pubkey, and that the
+// pubkey is one of the block signer keys in prog, the consensus
+// program in effect at h's height.
+func (h *SignedHeader) Verify(prog []byte) error {
+	if h.Header == nil || len(h.Signature) == 0 {
+		return errors.WithDetail(ErrBadSignedHeader, "no signature")
+	}
+	if len(h.Pubkey) != ed25519.PublicKeySize {
+		return errors.WithDetailf(ErrBadSignedHeader, "pubkey %x", h.Pubkey)
+	}
+	pubkeys, _, err := vmutil.ParseBlockMultiSigProgram(prog)
+	if err != nil {
+		return errors.Sub(ErrBadSignedHeader, err)
+	}
+	var found bool
+	for _, pub := range pubkeys {
+		found = found || bytes.Equal(pub, h.Pubkey)
+	}
+	if !found {
+		return errors.WithDetailf(ErrBadSignedHeader, "pubkey %x not in consensus program", h.Pubkey)
+	}
+	hash := h.Header.Hash()
+	if !ed25519.Verify(ed25519.PublicKey(h.Pubkey), hash[:], h.Signature) {
+		return errors.WithDetailf(ErrBadSignedHeader, "bad signature by %x", h.Pubkey)
+	}
+	return nil
+}
+
+// An Equivocation is proof that two different blocks at one
+// height were signed with block signer keys from the consensus
+// program in effect at that height. A correct generator makes
+// one block at each height, sending that same block again if it
+// doesn't get enough signatures, and a correct signer signs one
+// block at each height, so the proof shows that the generator
+// sent conflicting blocks to different signers (or that a signer
+// signed both).
+//
+// Anyone who knows the consensus program can check the proof
+// with Verify.
+type Equivocation struct {
+	ConsensusProgram chainjson.HexBytes `json:"consensus_program"`
+	Headers          [2]*SignedHeader   `json:"headers"`
+}
+
+// Verify checks that e is a valid proof of equivocation.
+func (e *Equivocation) Verify() error {
+	a, b := e.Headers[0], e.Headers[1]
+	if a == nil || b == nil || a.Header == nil || b.Header == nil {
+		return errors.WithDetail(ErrBadSignedHeader, "missing header")
+	}
+	if a.Header.Height != b.Header.Height {
+		return errors.WithDetailf(ErrBadSignedHeader, "heights %d and %d differ", a.Header.Height, b.Header.Height)
+	}
+	if a.Header.Hash() == b.Header.Hash() {
+		return errors.WithDetail(ErrBadSignedHeader, "headers are the same")
+	}
+	err := a.Verify(e.ConsensusProgram)
+	if err != nil {
+		return err
+	}
+	return b.Verify(e.ConsensusProgram)
+}
+
+// Error makes an Equivocation an error, so that it can be
+// reported as the Core's health.
+func (e *Equivocation) Error() string {
+	return fmt.Sprintf("equivocation at height %d: blocks %s and %s both signed",
+		e.Headers[0].Header.Height, e.Headers[0].Header.Hash(), e.Headers[1].Header.Hash())
+}
+
+// SignedHeaders returns up to maxSignedHeaders signed headers
+// recorded in db at or above the given height, in height order.
+// It includes those from other members of the federation that
+// WatchEquivocation stored, as well as those of this Core's
+// block signer.
+//
+// It is used as the httpjson handler for /rpc/signer/signed-headers.
+func SignedHeaders(ctx context.Context, db pg.DB, height uint64) ([]*SignedHeader, error) {
+	const q = `
+		SELECT header, pubkey, signature FROM signer_headers
+		WHERE block_height >= $1 AND signature IS NOT NULL
+		ORDER BY block_height, block_hash, pubkey
+		LIMIT $2
+	`
+	headers := []*SignedHeader{}
+	err := pg.ForQueryRows(ctx, db, q, height, maxSignedHeaders, func(header bc.BlockHeader, pubkey, sig []byte) {
+		headers = append(headers, &SignedHeader{
+			Header:    &header,
+			Pubkey:    pubkey,
+			Signature: sig,
+		})
+	})
+	return headers, errors.Wrap(err, "signed headers query")
+}
+
+// WatchEquivocation runs in a loop, exchanging signed headers
+// with peers, which are other members of the federation, and
+// checking them and the headers signed by this Core for
+// equivocation. It stores each peer header that verifies against
+// the blockchain in c, so later checks and other peers see it too.
+//
+// It calls health after each exchange. Once it finds an
+// equivocation, it logs the proof and reports it to health
+// from then on.
+//
+// It returns when its context is canceled.
+func WatchEquivocation(ctx context.Context, db pg.DB, c *protocol.Chain, peers []*rpc.Client, health func(error)) {
+	w := &evidenceWatcher{
+		db:    db,
+		c:     c,
+		peers: peers,
+		next:  make([]uint64, len(peers)),
+
+		reported: make(map[uint64]bool),
+	}
+
+	ticker := time.NewTicker(evidencePeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf(ctx, "Deposed, WatchEquivocation exiting")
+			return
+		case <-ticker.C:
+			err := w.check(ctx)
+			if err != nil {
+				log.Error(ctx, err)
+			}
+			if w.found != nil {
+				err = w.found
+			}
+			health(err)
+		}
+	}
+}
+
+type evidenceWatcher struct {
+	db    pg.DB
+	c     *protocol.Chain
+	peers []*rpc.Client
+	next  []uint64 // next height to request from each peer
+	since time.Time
+	found *Equivocation
+
+	reported map[uint64]bool // heights of equivocations logged
+}
+
+func (w *evidenceWatcher) check(ctx context.Context) error {
+	// Look again at headers recorded a little before the last
+	// check, in case they were committed after it ran.
+	var now time.Time
+	err := w.db.QueryRow(ctx, `SELECT now()`).Scan(&now)
+	if err != nil {
+		return errors.Wrap(err, "getting database time")
+	}
+
+	var peerErr error
+	for i := range w.peers {
+		err := w.exchange(ctx, i)
+		if err != nil && peerErr == nil {
+			peerErr = err
+		}
+	}
+
+	eqs, err := findEquivocations(ctx, w.db, w.c, w.since)
+	if err != nil {
+		return err
+	}
+	w.since = now.Add(-time.Minute)
+	for _, e := range eqs {
+		height := e.Headers[0].Header.Height
+		if w.reported[height] {
+			continue
+		}
+		w.reported[height] = true
+		proof, _ := json.Marshal(e)
+		log.Printkv(ctx, log.KeyError, e, "proof", string(proof))
+		w.found = e
+	}
+	return peerErr
+}
+
+// exchange gets the signed headers of peer i and stores
+// those that verify.
+func (w *evidenceWatcher) exchange(ctx context.Context, i int) error {
+	peer := w.peers[i]
+	var headers []*SignedHeader
+	err := peer.Call(ctx, "/rpc/signer/signed-headers", w.next[i], &headers)
+	if err != nil {
+		return errors.Wrapf(err, "getting signed headers from %s", peer.BaseURL)
+	}
+
+	for _, h := range headers {
+		if h.Header == nil {
+			return errors.Wrapf(ErrBadSignedHeader, "no header from %s", peer.BaseURL)
+		}
+		height := h.Header.Height
+		if height > w.c.Height()+1 {
+			// We can't verify it until we have the
+			// block before it; ask again later.
+			w.next[i] = height
+			return nil
+		}
+		prog, err := consensusProgram(ctx, w.c, height)
+		if err != nil {
+			// We may not have old blocks if we
+			// bootstrapped from a snapshot.
+			log.Error(ctx, err)
+			continue
+		}
+		if prog == nil {
+			continue
+		}
+		err = h.Verify(prog)
+		if err != nil {
+			log.Error(ctx, errors.Wrapf(err, "signed header from %s", peer.BaseURL))
+			continue
+		}
+		err = storeSignedHeader(ctx, w.db, h)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A full page may end partway through a height,
+	// so start there next time, unless the page is all
+	// one height.
+	if n := len(headers); n > 0 {
+		next := headers[n-1].Header.Height
+		if n < maxSignedHeaders || next == w.next[i] {
+			next++
+		}
+		w.next[i] = next
+	}
+	return nil
+}
+
+// consensusProgram returns the consensus program in effect for
+// the block at height, or nil for the initial block, which
+// isn't signed.
+func consensusProgram(ctx context.Context, c *protocol.Chain, height uint64) ([]byte, error) {
+	if height <= 1 {
+		return nil, nil
+	}
+	prev, err := c.GetBlock(ctx, height-1)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting block at height %d", height-1)
+	}
+	return prev.ConsensusProgram, nil
+}
+
+// findEquivocations looks for heights with more than one
+// signed block among the heights of headers recorded
+// since the given time.
+func findEquivocations(ctx context.Context, db pg.DB, c *protocol.Chain, since time.Time) ([]*Equivocation, error) {
+	const heightsQ = `
+		SELECT block_height FROM signer_headers
+		WHERE signature IS NOT NULL AND block_height IN (
+			SELECT block_height FROM signer_headers WHERE recorded_at >= $1
+		)
+		GROUP BY block_height HAVING count(DISTINCT block_hash) > 1
+	`
+	var heights []uint64
+	err := pg.ForQueryRows(ctx, db, heightsQ, since, func(height uint64) {
+		heights = append(heights, height)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "equivocation query")
+	}
+
+	const headersQ = `
+		SELECT header, pubkey, signature FROM signer_headers
+		WHERE block_height = $1 AND signature IS NOT NULL
+		ORDER BY block_hash, pubkey
+	`
+	var eqs []*Equivocation
+	for _, height := range heights {
+		prog, err := consensusProgram(ctx, c, height)
+		if err != nil {
+			return nil, err
+		}
+		e := &Equivocation{ConsensusProgram: prog}
+		err = pg.ForQueryRows(ctx, db, headersQ, height, func(header bc.BlockHeader, pubkey, sig []byte) {
+			h := &SignedHeader{Header: &header, Pubkey: pubkey, Signature: sig}
+			if e.Headers[0] == nil {
+				e.Headers[0] = h
+			} else if e.Headers[1] == nil && header.Hash() != e.Headers[0].Header.Hash() {
+				e.Headers[1] = h
+			}
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "signed headers query")
+		}
+		err = e.Verify()
+		if err != nil {
+			// Our own records should always verify, and we
+			// store others' only if they do.
+			log.Error(ctx, errors.Wrapf(err, "checking equivocation at height %d", height))
+			continue
+		}
+		eqs = append(eqs, e)
+	}
+	return eqs, nil
+}
+
+// storeSignedHeader stores a header another member of the
+// federation signed. It keeps any record already there.
+func storeSignedHeader(ctx context.Context, db pg.DB, h *SignedHeader) error {
+	const q = `
+		INSERT INTO signer_headers (block_height, block_hash, pubkey, header, signature)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (block_height, block_hash, pubkey) DO NOTHING
+	`
+	_, err := db.Exec(ctx, q, h.Header.Height, h.Header.Hash(), []byte(h.Pubkey), h.Header, []byte(h.Signature))
+	return errors.Wrap(err, "storing signed header")
+}
+
+// recordRequest records that the signer with key pub was
+// asked to sign b. It records every request, valid or not,
+// as evidence in case the generator equivocates.
+func recordRequest(ctx context.Context, db pg.DB, pub ed25519.PublicKey, b *bc.Block) error {
+	const q = `
+		INSERT INTO signer_headers (block_height, block_hash, pubkey, header)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (block_height, block_hash, pubkey) DO NOTHING
+	`
+	_, err := db.Exec(ctx, q, b.Height, b.Hash(), []byte(pub), &b.BlockHeader)
+	return errors.Wrap(err, "recording block to sign")
+}
+
+// recordSignature records the signature the signer
+// with key pub made for b.
+func recordSignature(ctx context.Context, db pg.DB, pub ed25519.PublicKey, b *bc.Block, sig []byte) error {
+	const q = `
+		UPDATE signer_headers SET signature = $4, rejection = NULL, recorded_at = now()
+		WHERE block_height = $1 AND block_hash = $2 AND pubkey = $3
+	`
+	_, err := db.Exec(ctx, q, b.Height, b.Hash(), []byte(pub), sig)
+	return errors.Wrap(err, "recording block signature")
+}
+
+// recordRejection records why the signer with key pub
+// didn't sign b, unless it signed b before.
+func recordRejection(ctx context.Context, db pg.DB, pub ed25519.PublicKey, b *bc.Block, reason error) error {
+	const q = `
+		UPDATE signer_headers SET rejection = $4
+		WHERE block_height = $1 AND block_hash = $2 AND pubkey = $3 AND signature IS NULL
+	`
+	_, err := db.Exec(ctx, q, b.Height, b.Hash(), []byte(pub), reason.Error())
+	return errors.Wrap(err, "recording block rejection")
+}
@@ -0,0 +1,146 @@
+package blocksigner
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"chain/crypto/ed25519"
+	"chain/database/pg/pgtest"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vmutil"
+)
+
+func TestEquivocationVerify(t *testing.T) {
+	pub1, prv1, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub2, prv2, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outsiderPub, outsiderPrv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := vmutil.BlockMultiSigProgram([]ed25519.PublicKey{pub1, pub2}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(pub ed25519.PublicKey, prv ed25519.PrivateKey, bh *bc.BlockHeader) *SignedHeader {
+		hash := bh.Hash()
+		return &SignedHeader{Header: bh, Pubkey: chainjson.HexBytes(pub), Signature: ed25519.Sign(prv, hash[:])}
+	}
+	a := &bc.BlockHeader{Version: 1, Height: 5, TimestampMS: 1}
+	b := &bc.BlockHeader{Version: 1, Height: 5, TimestampMS: 2}
+	c := &bc.BlockHeader{Version: 1, Height: 6, TimestampMS: 2}
+
+	e := &Equivocation{ConsensusProgram: prog, Headers: [2]*SignedHeader{sign(pub1, prv1, a), sign(pub2, prv2, b)}}
+	err = e.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The proof should survive a round trip through JSON,
+	// as when it's logged or sent to another Core.
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Equivocation
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = decoded.Verify()
+	if err != nil {
+		t.Errorf("after JSON round trip: %v", err)
+	}
+
+	forged := sign(pub2, prv2, b)
+	forged.Signature[0] ^= 1
+
+	cases := []struct {
+		name    string
+		headers [2]*SignedHeader
+	}{
+		{"same block", [2]*SignedHeader{sign(pub1, prv1, a), sign(pub2, prv2, a)}},
+		{"different heights", [2]*SignedHeader{sign(pub1, prv1, a), sign(pub2, prv2, c)}},
+		{"bad signature", [2]*SignedHeader{sign(pub1, prv1, a), forged}},
+		{"key not in program", [2]*SignedHeader{sign(pub1, prv1, a), sign(outsiderPub, outsiderPrv, b)}},
+		{"unsigned", [2]*SignedHeader{sign(pub1, prv1, a), {Header: b, Pubkey: chainjson.HexBytes(pub2)}}},
+		{"missing header", [2]*SignedHeader{sign(pub1, prv1, a), nil}},
+	}
+	for _, c := range cases {
+		e := &Equivocation{ConsensusProgram: prog, Headers: c.headers}
+		err := e.Verify()
+		if errors.Root(err) != ErrBadSignedHeader {
+			t.Errorf("%s: got error %v, want %v", c.name, err, ErrBadSignedHeader)
+		}
+	}
+}
+
+func TestRecordSignedHeaders(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := &bc.Block{BlockHeader: bc.BlockHeader{Version: 1, Height: 2, TimestampMS: 1}}
+	rejected := &bc.Block{BlockHeader: bc.BlockHeader{Version: 1, Height: 2, TimestampMS: 2}}
+	for _, b := range []*bc.Block{signed, rejected, signed} {
+		err = recordRequest(ctx, db, pub, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = recordSignature(ctx, db, pub, signed, []byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = recordRejection(ctx, db, pub, rejected, errors.New("rejected"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A later rejection of a block it signed
+	// doesn't change the record.
+	err = recordRejection(ctx, db, pub, signed, errors.New("rejected"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers, err := SignedHeaders(ctx, db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 1 {
+		t.Fatalf("got %d signed headers, want 1", len(headers))
+	}
+	if got := headers[0].Header.Hash(); got != signed.Hash() {
+		t.Errorf("got header %s, want %s", got, signed.Hash())
+	}
+
+	var n int
+	const q = `SELECT count(*) FROM signer_headers WHERE rejection IS NOT NULL`
+	err = db.QueryRow(ctx, q).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d rejected headers, want 1", n)
+	}
+
+	headers, err = SignedHeaders(ctx, db, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 0 {
+		t.Errorf("above the signed height, got %d headers, want 0", len(headers))
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"chain/crypto/ed25519"
+	"chain/database/pg"
+	"chain/database/sql"
+	"chain/errors"
+	"chain/protocol/validation"
+)
+
+// NextConsensusProgram returns the consensus program this Core
+// has accepted as the next one for the blockchain, or nil if
+// there is none.
+//
+// A generator puts the next consensus program in the next
+// block it makes, and a signer signs only blocks that keep
+// the consensus program or change it to the next one.
+func NextConsensusProgram(ctx context.Context, db pg.DB) ([]byte, error) {
+	const q = `SELECT program FROM next_consensus_program`
+	var prog []byte
+	err := db.QueryRow(ctx, q).Scan(&prog)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return prog, errors.Wrap(err, "next consensus program query")
+}
+
+// SetNextConsensusProgram makes prog the next consensus program,
+// replacing any other. There is at most one next consensus
+// program at a time. It is an error if prog doesn't pass
+// validation.CheckConsensusProgram.
+//
+// If prog is already the next consensus program, any signers
+// proposed with it are kept; a generator's local signer shares
+// the generator's database.
+func SetNextConsensusProgram(ctx context.Context, db pg.DB, prog []byte) error {
+	err := validation.CheckConsensusProgram(prog)
+	if err != nil {
+		return err
+	}
+	const q = `
+		INSERT INTO next_consensus_program (program) VALUES ($1)
+		ON CONFLICT (singleton) DO UPDATE SET program = $1,
+			signers = CASE WHEN next_consensus_program.program = $1
+				THEN next_consensus_program.signers END
+	`
+	_, err = db.Exec(ctx, q, prog)
+	return errors.Wrap(err, "next consensus program insert query")
+}
+
+// ProposeSigners makes prog the next consensus program of
+// a generator, as SetNextConsensusProgram does, along with
+// the remote block signers for it. The generator keeps using
+// its current signers until ClearNextConsensusProgram puts
+// these in their place.
+func ProposeSigners(ctx context.Context, db pg.DB, prog []byte, signers []BlockSigner) error {
+	err := validation.CheckConsensusProgram(prog)
+	if err != nil {
+		return err
+	}
+	blockSignerData, err := signerData(signers)
+	if err != nil {
+		return err
+	}
+	const q = `
+		INSERT INTO next_consensus_program (program, signers) VALUES ($1, $2)
+		ON CONFLICT (singleton) DO UPDATE SET program = $1, signers = $2
+	`
+	_, err = db.Exec(ctx, q, prog, blockSignerData)
+	return errors.Wrap(err, "next consensus program insert query")
+}
+
+// ClearNextConsensusProgram removes prog as the next consensus
+// program once it's in use. If it was proposed with
+// ProposeSigners, its signers replace the remote block signers
+// in the same step. It does nothing if another program has
+// since replaced prog.
+func ClearNextConsensusProgram(ctx context.Context, db pg.DB, prog []byte) error {
+	const q = `
+		WITH next AS (
+			DELETE FROM next_consensus_program WHERE program = $1
+			RETURNING signers
+		)
+		UPDATE config SET remote_block_signers = next.signers
+		FROM next WHERE next.signers IS NOT NULL
+	`
+	_, err := db.Exec(ctx, q, prog)
+	return errors.Wrap(err, "next consensus program delete query")
+}
+
+// signerData checks signers and returns them
+// as stored in the remote_block_signers column.
+func signerData(signers []BlockSigner) ([]byte, error) {
+	for _, signer := range signers {
+		_, err := url.Parse(signer.URL)
+		if err != nil {
+			return nil, errors.Sub(ErrBadSignerURL, err)
+		}
+		if len(signer.Pubkey) != ed25519.PublicKeySize {
+			return nil, errors.WithDetailf(ErrBadSignerPubkey, "pubkey %x", signer.Pubkey)
+		}
+	}
+	if len(signers) == 0 {
+		return []byte{}, nil
+	}
+	b, err := json.Marshal(signers)
+	return b, errors.Wrap(err)
+}
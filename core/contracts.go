@@ -0,0 +1,15 @@
+package core
+
+import (
+	"context"
+
+	"chain/exp/ivy/compiler"
+)
+
+// POST /compile
+func (a *API) compile(ctx context.Context, req struct {
+	Contract string                 `json:"contract"`
+	Args     []compiler.ContractArg `json:"args"`
+}) (*compiler.Contract, error) {
+	return compiler.Compile(req.Contract, req.Args)
+}
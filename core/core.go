@@ -108,6 +108,11 @@ func (a *API) leaderInfo(ctx context.Context) (map[string]interface{}, error) {
 		"health":                            a.health(),
 	}
 
+	// Add the health of each peer we fetch blocks from.
+	if !a.config.IsGenerator {
+		m["block_peers"] = fetch.PeerHealth()
+	}
+
 	// Add in snapshot information if we're downloading a snapshot.
 	if snapshot != nil {
 		m["snapshot"] = map[string]interface{}{
@@ -35,7 +35,7 @@ func CreatePins(ctx context.Context, t testing.TB, s *pin.Store) {
 
 func CreateAccount(ctx context.Context, t testing.TB, accounts *account.Manager, alias string, tags map[string]interface{}) string {
 	keys := []chainkd.XPub{testutil.TestXPub}
-	acc, err := accounts.Create(ctx, keys, 1, alias, tags, "")
+	acc, err := accounts.Create(ctx, keys, 1, alias, tags, nil, "")
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
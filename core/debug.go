@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"chain/core/txbuilder"
+	chainjson "chain/encoding/json"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+	"chain/protocol/validation"
+	"chain/protocol/vm"
+)
+
+// inputTrace records the execution of an input's program.
+// Its events are beginEvents, stepEvents and finishEvents,
+// in order.
+type inputTrace struct {
+	Events []interface{} `json:"events"`
+}
+
+type beginEvent struct {
+	Type      string               `json:"type"`
+	Depth     int                  `json:"depth"`
+	Program   chainjson.HexBytes   `json:"program"`
+	DataStack []chainjson.HexBytes `json:"data_stack"`
+}
+
+type stepEvent struct {
+	Type      string               `json:"type"`
+	Depth     int                  `json:"depth"`
+	PC        uint32               `json:"pc"`
+	Op        string               `json:"op"`
+	Data      chainjson.HexBytes   `json:"data,omitempty"`
+	NextPC    uint32               `json:"next_pc"`
+	RunLimit  int64                `json:"run_limit"`
+	DataStack []chainjson.HexBytes `json:"data_stack"`
+	AltStack  []chainjson.HexBytes `json:"alt_stack"`
+	Error     string               `json:"error,omitempty"`
+}
+
+type finishEvent struct {
+	Type  string `json:"type"`
+	Depth int    `json:"depth"`
+	Error string `json:"error,omitempty"`
+}
+
+func (t *inputTrace) Begin(depth int, prog []byte, dataStack [][]byte) {
+	t.Events = append(t.Events, beginEvent{
+		Type:      "begin",
+		Depth:     depth,
+		Program:   prog,
+		DataStack: hexStack(dataStack),
+	})
+}
+
+func (t *inputTrace) Step(s *vm.TraceStep) {
+	e := stepEvent{
+		Type:      "step",
+		Depth:     s.Depth,
+		PC:        s.PC,
+		Op:        s.Op.String(),
+		Data:      s.Data,
+		NextPC:    s.NextPC,
+		RunLimit:  s.RunLimit,
+		DataStack: hexStack(s.DataStack),
+		AltStack:  hexStack(s.AltStack),
+	}
+	if s.Err != nil {
+		e.Error = s.Err.Error()
+	}
+	t.Events = append(t.Events, e)
+}
+
+func (t *inputTrace) Finish(depth int, err error) {
+	e := finishEvent{Type: "finish", Depth: depth}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	t.Events = append(t.Events, e)
+}
+
+func hexStack(stack [][]byte) []chainjson.HexBytes {
+	res := make([]chainjson.HexBytes, 0, len(stack))
+	for _, item := range stack {
+		res = append(res, item)
+	}
+	return res
+}
+
+// POST /debug/trace-transaction
+//
+// traceTx validates the transaction in tpl against the current
+// blockchain state, and returns a trace of the execution of
+// each input's program. Inputs whose programs didn't run,
+// because validation failed first, have no events.
+func (a *API) traceTx(ctx context.Context, tpl *txbuilder.Template) (interface{}, error) {
+	if tpl.Transaction == nil {
+		return nil, httpjson.ErrBadRequest
+	}
+	tx := tpl.Transaction
+
+	traces := make([]*inputTrace, len(tx.Inputs))
+	for i := range traces {
+		traces[i] = &inputTrace{Events: []interface{}{}}
+	}
+	err := validation.CheckTxWellFormedTrace(tx, func(input int) vm.Tracer {
+		return traces[input]
+	})
+	if err == nil {
+		_, snapshot := a.chain.State()
+		err = validation.ConfirmTx(snapshot, a.chain.InitialBlockHash, bc.NewBlockVersion, bc.Millis(time.Now()), tx)
+	}
+
+	resp := struct {
+		Inputs []*inputTrace `json:"inputs"`
+		Error  string        `json:"error,omitempty"`
+	}{Inputs: traces}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp, nil
+}
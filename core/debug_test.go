@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"chain/core/txbuilder"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/protocol/vm"
+)
+
+func TestTraceTx(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	a := &API{chain: c}
+	now := time.Now()
+
+	issue := func(prog []byte) *bc.Tx {
+		assetID := bc.ComputeAssetID(prog, c.InitialBlockHash, 1, bc.EmptyStringHash)
+		return bc.NewTx(bc.TxData{
+			Version: 1,
+			Inputs:  []*bc.TxInput{bc.NewIssuanceInput([]byte{1}, 1, nil, c.InitialBlockHash, prog, nil, nil)},
+			Outputs: []*bc.TxOutput{bc.NewTxOutput(assetID, 1, []byte{byte(vm.OP_TRUE)}, nil)},
+			MinTime: bc.Millis(now),
+			MaxTime: bc.Millis(now.Add(time.Hour)),
+		})
+	}
+
+	cases := []struct {
+		prog       []byte
+		wantEvents []interface{}
+		wantErr    bool
+	}{{
+		prog: []byte{byte(vm.OP_TRUE)},
+		wantEvents: []interface{}{
+			beginEvent{Type: "begin", Program: []byte{byte(vm.OP_TRUE)}, DataStack: hexStack(nil)},
+			stepEvent{Type: "step", Op: "1", Data: []byte{1}, NextPC: 1, RunLimit: 10000, DataStack: hexStack([][]byte{{1}}), AltStack: hexStack(nil)},
+			finishEvent{Type: "finish"},
+		},
+	}, {
+		prog: []byte{byte(vm.OP_FALSE)},
+		wantEvents: []interface{}{
+			beginEvent{Type: "begin", Program: []byte{byte(vm.OP_FALSE)}, DataStack: hexStack(nil)},
+			stepEvent{Type: "step", Op: "FALSE", NextPC: 1, RunLimit: 10000, DataStack: hexStack([][]byte{{}}), AltStack: hexStack(nil)},
+			finishEvent{Type: "finish", Error: vm.ErrFalseVMResult.Error()},
+		},
+		wantErr: true,
+	}}
+	for i, tc := range cases {
+		got, err := a.traceTx(ctx, &txbuilder.Template{Transaction: issue(tc.prog)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := reflect.ValueOf(got)
+		inputs := resp.FieldByName("Inputs").Interface().([]*inputTrace)
+		if len(inputs) != 1 || !reflect.DeepEqual(inputs[0].Events, tc.wantEvents) {
+			t.Errorf("case %d: events = %+v want %+v", i, inputs[0].Events, tc.wantEvents)
+		}
+		if gotErr := resp.FieldByName("Error").String() != ""; gotErr != tc.wantErr {
+			t.Errorf("case %d: error = %q, want error = %v", i, resp.FieldByName("Error").String(), tc.wantErr)
+		}
+	}
+}
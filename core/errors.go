@@ -8,6 +8,7 @@ import (
 	"chain/core/asset"
 	"chain/core/blocksigner"
 	"chain/core/config"
+	"chain/core/generator"
 	"chain/core/query"
 	"chain/core/query/filter"
 	"chain/core/rpc"
@@ -16,6 +17,7 @@ import (
 	"chain/core/txfeed"
 	"chain/database/pg"
 	"chain/errors"
+	"chain/exp/ivy/compiler"
 	"chain/net/http/httpjson"
 	"chain/protocol"
 )
@@ -40,6 +42,8 @@ func isTemporary(info errorInfo, err error) bool {
 		return true
 	case "CH001": // request timed out
 		return true
+	case "CH739": // pending transaction pool full
+		return true
 	case "CH761": // outputs currently reserved
 		return true
 	case "CH706": // 1 or more action errors
@@ -106,20 +110,28 @@ var (
 		accesstoken.ErrDuplicateID: errorInfo{400, "CH302", "Access token id is already in use"},
 		errCurrentToken:            errorInfo{400, "CH310", "The access token used to authenticate this request cannot be deleted"},
 
+		// Contract compiler error namespace (4xx)
+		compiler.ErrSyntax:      errorInfo{400, "CH400", "Contract syntax error"},
+		compiler.ErrContract:    errorInfo{400, "CH401", "Invalid contract"},
+		compiler.ErrBadArgument: errorInfo{400, "CH402", "Invalid contract argument"},
+
 		// Query error namespace (6xx)
 		query.ErrBadAfter:               errorInfo{400, "CH600", "Malformed pagination parameter `after`"},
 		query.ErrParameterCountMismatch: errorInfo{400, "CH601", "Incorrect number of parameters to filter"},
 		filter.ErrBadFilter:             errorInfo{400, "CH602", "Malformed query filter"},
+		txfeed.ErrBadWebhook:            errorInfo{400, "CH603", "Invalid transaction feed webhook"},
 
 		// Transaction error namespace (7xx)
 		// Build error namespace (70x)
-		txbuilder.ErrBadRefData: errorInfo{400, "CH700", "Reference data does not match previous transaction's reference data"},
-		errBadActionType:        errorInfo{400, "CH701", "Invalid action type"},
-		errBadAlias:             errorInfo{400, "CH702", "Invalid alias on action"},
-		errBadAction:            errorInfo{400, "CH703", "Invalid action object"},
-		txbuilder.ErrBadAmount:  errorInfo{400, "CH704", "Invalid asset amount"},
-		txbuilder.ErrBlankCheck: errorInfo{400, "CH705", "Unsafe transaction: leaves assets to be taken without requiring payment"},
-		txbuilder.ErrAction:     errorInfo{400, "CH706", "One or more actions had an error: see attached data"},
+		txbuilder.ErrBadRefData:  errorInfo{400, "CH700", "Reference data does not match previous transaction's reference data"},
+		errBadActionType:         errorInfo{400, "CH701", "Invalid action type"},
+		errBadAlias:              errorInfo{400, "CH702", "Invalid alias on action"},
+		errBadAction:             errorInfo{400, "CH703", "Invalid action object"},
+		txbuilder.ErrBadAmount:   errorInfo{400, "CH704", "Invalid asset amount"},
+		txbuilder.ErrBlankCheck:  errorInfo{400, "CH705", "Unsafe transaction: leaves assets to be taken without requiring payment"},
+		txbuilder.ErrAction:      errorInfo{400, "CH706", "One or more actions had an error: see attached data"},
+		txbuilder.ErrBadContract: errorInfo{400, "CH707", "Invalid contract"},
+		errBadOffer:              errorInfo{400, "CH708", "Invalid offer"},
 
 		// Submit error namespace (73x)
 		txbuilder.ErrMissingRawTx:          errorInfo{400, "CH730", "Missing raw transaction"},
@@ -130,10 +142,15 @@ var (
 		txbuilder.ErrNoTxSighashCommitment: errorInfo{400, "CH736", "Transaction is not final, additional actions still allowed"},
 		txbuilder.ErrTxSignatureFailure:    errorInfo{400, "CH737", "Transaction signature missing, client may be missing signature key"},
 		txbuilder.ErrNoTxSighashAttempt:    errorInfo{400, "CH738", "Transaction signature was not attempted"},
+		generator.ErrPoolFull:              errorInfo{503, "CH739", "Too many pending transactions; try again soon"},
+		txbuilder.ErrTemplateEncoding:      errorInfo{400, "CH740", "Invalid template encoding"},
 
 		// account action error namespace (76x)
-		account.ErrInsufficient: errorInfo{400, "CH760", "Insufficient funds for tx"},
-		account.ErrReserved:     errorInfo{400, "CH761", "Some outputs are reserved; try again"},
+		account.ErrInsufficient:    errorInfo{400, "CH760", "Insufficient funds for tx"},
+		account.ErrReserved:        errorInfo{400, "CH761", "Some outputs are reserved; try again"},
+		account.ErrPolicyViolation: errorInfo{400, "CH762", "Transaction violates the account's spending policy"},
+		account.ErrBadPolicy:       errorInfo{400, "CH763", "Invalid account spending policy"},
+		account.ErrNothingToSweep:  errorInfo{400, "CH764", "No outputs controlled by retired account keys"},
 
 		// Mock HSM error namespace (80x)
 	}
@@ -22,13 +22,22 @@ import (
 	"chain/protocol/state"
 )
 
-const heightPollingPeriod = 3 * time.Second
+const (
+	heightPollingPeriod = 3 * time.Second
+
+	// maxParallelBlocks is the most blocks Fetch
+	// downloads at once when catching up.
+	maxParallelBlocks = 16
+)
 
 var (
 	generatorHeight          uint64
 	generatorHeightFetchedAt time.Time
 	generatorLock            sync.Mutex
 
+	peers   []*Peer
+	peersMu sync.Mutex
+
 	downloadingSnapshot   *Snapshot
 	downloadingSnapshotMu sync.Mutex
 )
@@ -41,41 +50,75 @@ func GeneratorHeight() (uint64, time.Time) {
 	return h, t
 }
 
+// PeerHealth returns the status of each peer given to Init,
+// the generator first.
+func PeerHealth() []PeerStatus {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+	var statuses []PeerStatus
+	for _, p := range peers {
+		statuses = append(statuses, p.Status())
+	}
+	return statuses
+}
+
 func SnapshotProgress() *Snapshot {
 	downloadingSnapshotMu.Lock()
 	defer downloadingSnapshotMu.Unlock()
 	return downloadingSnapshot
 }
 
-// Init initializes the fetch package.
-func Init(ctx context.Context, peer *rpc.Client) {
-	// Fetch the generator height periodically.
-	go pollGeneratorHeight(ctx, peer)
+// Init initializes the fetch package with the peers to
+// download blocks from. The first peer must be the generator;
+// the others may be other Cores or block caches on the same
+// blockchain.
+func Init(ctx context.Context, ps []*Peer) {
+	peersMu.Lock()
+	peers = ps
+	peersMu.Unlock()
+
+	// Fetch the peers' heights periodically.
+	for i, p := range ps {
+		go pollHeight(ctx, p, i == 0)
+	}
 }
 
-// BootstrapSnapshot downloads and stores the most recent snapshot from the
-// provided peer. It's run when bootstrapping a new Core to an existing
-// network. It should be run before invoking Chain.Recover.
-func BootstrapSnapshot(ctx context.Context, c *protocol.Chain, store protocol.Store, peer *rpc.Client, health func(error)) {
+// BootstrapSnapshot downloads and stores the most recent snapshot from
+// one of the provided peers, trying another if one fails. The first
+// peer must be the generator, which vouches for the snapshot block of
+// a snapshot from any other peer. It's run when bootstrapping a new
+// Core to an existing network. It should be run before invoking
+// Chain.Recover.
+func BootstrapSnapshot(ctx context.Context, c *protocol.Chain, store protocol.Store, peers []*Peer, health func(error)) {
 	const maxAttempts = 5
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		err := fetchSnapshot(ctx, peer, store, attempt)
+		peer := pickPeer(peers, nil, 0, attempt-1)
+		err := fetchSnapshot(ctx, c, peer, peers[0], store, attempt)
 		health(err)
 		if err == nil {
+			peer.succeed()
 			break
 		}
+		peer.fail(err)
 		logNetworkError(ctx, err)
 	}
 }
 
 // Fetch runs in a loop, fetching blocks from the configured
-// peer (e.g. the generator) and applying them to the local
-// Chain.
+// peers (the generator, and any others) and applying them
+// to the local Chain. When the peers have several blocks this
+// Core doesn't, it downloads them in parallel from whichever
+// peers are healthy.
+//
+// Each block is validated against the chain before it's applied.
+// If a peer serves an invalid block, Fetch gets that block from
+// another peer instead. It's a fatal error if every peer serves
+// an invalid block at the same height.
 //
 // It returns when its context is canceled.
 // After each attempt to fetch and apply a block, it calls health
 // to report either an error or nil to indicate success.
-func Fetch(ctx context.Context, c *protocol.Chain, peer *rpc.Client, health func(error), prevBlock *bc.Block, prevSnapshot *state.Snapshot) {
+func Fetch(ctx context.Context, c *protocol.Chain, peers []*Peer, health func(error), prevBlock *bc.Block, prevSnapshot *state.Snapshot) {
 	// If we downloaded a snapshot, now that we've recovered and successfully
 	// booted from the snapshot, mark it as done.
 	if sp := SnapshotProgress(); sp != nil {
@@ -86,25 +129,30 @@ func Fetch(ctx context.Context, c *protocol.Chain, peer *rpc.Client, health func
 	if prevBlock != nil {
 		height = prevBlock.Height
 	}
+	height++
 
-	blockch, errch := DownloadBlocks(ctx, peer, height+1)
-
-	var err error
-	var nfailures uint
+	d := &downloader{peers: peers}
+	bad := make(map[*Peer]bool) // peers that served an invalid block at height
 	for {
 		select {
 		case <-ctx.Done():
 			log.Printf(ctx, "Deposed, Fetch exiting")
 			return
-		case err = <-errch:
+		default:
+		}
+
+		blocks, errs := d.next(ctx, height, bad)
+		for _, err := range errs {
 			health(err)
 			logNetworkError(ctx, err)
-		case b := <-blockch:
+		}
+
+		var nfailures uint
+		for _, dl := range blocks {
+			var err error
 			for {
-				prevSnapshot, prevBlock, err = applyBlock(ctx, c, prevSnapshot, prevBlock, b)
-				if err == protocol.ErrBadBlock {
-					log.Fatalkv(ctx, log.KeyError, err)
-				} else if err != nil {
+				prevSnapshot, prevBlock, err = applyBlock(ctx, c, prevSnapshot, prevBlock, dl.block)
+				if err != nil && errors.Root(err) != protocol.ErrBadBlock {
 					// This is a serious I/O error.
 					health(err)
 					log.Error(ctx, err)
@@ -115,8 +163,21 @@ func Fetch(ctx context.Context, c *protocol.Chain, peer *rpc.Client, health func
 				}
 				break
 			}
+			if err != nil {
+				err = errors.Wrapf(err, "block %d from %s", height, dl.peer.Client.BaseURL)
+				bad[dl.peer] = true
+				if len(bad) == len(peers) {
+					log.Fatalkv(ctx, log.KeyError, err)
+				}
+				dl.peer.fail(err)
+				health(err)
+				log.Error(ctx, err)
+				break
+			}
 
+			dl.peer.succeed()
 			height++
+			bad = make(map[*Peer]bool)
 			health(nil)
 			nfailures = 0
 		}
@@ -124,75 +185,185 @@ func Fetch(ctx context.Context, c *protocol.Chain, peer *rpc.Client, health func
 }
 
 // DownloadBlocks starts a goroutine to download blocks from
-// the given peer, starting at the given height and incrementing from there.
+// the given peers, starting at the given height and incrementing from there.
 // It will re-attempt downloads for the next block in the network
 // until it is available. It returns two channels, one for reading blocks
 // and the other for reading errors. Progress will halt unless callers are
 // reading from both. DownloadBlocks will continue even if it encounters errors,
 // until its context is done.
-func DownloadBlocks(ctx context.Context, peer *rpc.Client, height uint64) (chan *bc.Block, chan error) {
+//
+// Blocks arrive in height order, but DownloadBlocks doesn't
+// validate them.
+func DownloadBlocks(ctx context.Context, peers []*Peer, height uint64) (chan *bc.Block, chan error) {
 	blockch := make(chan *bc.Block)
 	errch := make(chan error)
 	go func() {
-		var nfailures uint // for backoff
-		var ntimeouts uint // for backoff
+		defer close(blockch)
+		defer close(errch)
+
+		d := &downloader{peers: peers}
 		for {
-			select {
-			case <-ctx.Done():
-				close(blockch)
-				close(errch)
-				return
-			default:
-				block, err := getBlock(ctx, peer, height, timeoutBackoffDur(ntimeouts))
-				if err != nil {
-					errch <- err
-					nfailures++
-					time.Sleep(backoffDur(nfailures))
-					continue
+			blocks, errs := d.next(ctx, height, nil)
+			for _, err := range errs {
+				select {
+				case <-ctx.Done():
+					return
+				case errch <- err:
 				}
-				if block == nil {
-					// Request time out. There might not have been any blocks published,
-					// or there was a network error or it just took too long to process the
-					// request.
-					ntimeouts++
-					continue
+			}
+			for _, dl := range blocks {
+				select {
+				case <-ctx.Done():
+					return
+				case blockch <- dl.block:
 				}
-
-				blockch <- block
-				ntimeouts, nfailures = 0, 0
+				dl.peer.succeed()
 				height++
 			}
+			if ctx.Err() != nil {
+				return
+			}
 		}
 	}()
 	return blockch, errch
 }
 
-func pollGeneratorHeight(ctx context.Context, peer *rpc.Client) {
-	updateGeneratorHeight(ctx, peer)
+// A downloader gets blocks from a set of peers,
+// several at a time when the peers have them.
+type downloader struct {
+	peers     []*Peer
+	nfailures uint // for backoff
+	ntimeouts uint // for backoff
+	nreqs     int  // for spreading requests among peers
+}
+
+// A download is a block and the peer that served it.
+type download struct {
+	block *bc.Block
+	peer  *Peer
+}
+
+// next downloads consecutive blocks starting at height, as many
+// as the peers have reported having (up to maxParallelBlocks),
+// or else just the block at height, once a peer has it. It asks
+// no peer in exclude.
+//
+// It returns the blocks it got before the first one it didn't,
+// along with the errors from any requests that failed.
+func (d *downloader) next(ctx context.Context, height uint64, exclude map[*Peer]bool) ([]download, []error) {
+	n := 1
+	if best := bestHeight(d.peers); best > height {
+		if best-height >= maxParallelBlocks {
+			n = maxParallelBlocks
+		} else {
+			n = int(best-height) + 1
+		}
+	}
+
+	var (
+		wg        sync.WaitGroup
+		results   = make([]download, n)
+		errs      = make([]error, n)
+		timeouts  = make([]bool, n)
+		timeout   = timeoutBackoffDur(d.ntimeouts)
+		waitAtTip = n == 1
+	)
+	for i := 0; i < n; i++ {
+		h := height + uint64(i)
+		peer := pickPeer(d.peers, exclude, h, d.nreqs)
+		d.nreqs++
+		if peer == nil {
+			errs[i] = errors.New("no peers to fetch blocks from")
+			continue
+		}
+		wg.Add(1)
+		go func(i int, h uint64, peer *Peer) {
+			defer wg.Done()
+			block, err := getBlock(ctx, peer.Client, h, timeout)
+			if err == nil && block == nil {
+				// Request time out. There might not have been any blocks
+				// published, or there was a network error or it just took
+				// too long to process the request. The peer is only at
+				// fault if it said it had the block.
+				timeouts[i] = true
+				if waitAtTip && peer.knownHeight() < h {
+					return
+				}
+				err = errors.Wrapf(context.DeadlineExceeded, "get block %d", h)
+			} else if err == nil && block.Height != h {
+				err = errors.New("peer sent a block at the wrong height")
+				err = errors.WithDetailf(err, "got %d, want %d", block.Height, h)
+			}
+			if err != nil {
+				err = errors.Wrapf(err, "fetching from %s", peer.Client.BaseURL)
+				peer.fail(err)
+				errs[i] = err
+				return
+			}
+			results[i] = download{block: block, peer: peer}
+		}(i, h, peer)
+	}
+	wg.Wait()
+
+	var (
+		got    []download
+		failed []error
+	)
+	for i := range results {
+		if results[i].block == nil {
+			break
+		}
+		got = append(got, results[i])
+	}
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	switch {
+	case len(got) > 0:
+		d.ntimeouts, d.nfailures = 0, 0
+	case len(failed) > 0:
+		d.nfailures++
+		time.Sleep(backoffDur(d.nfailures))
+	case timeouts[0]:
+		d.ntimeouts++
+	}
+	return got, failed
+}
+
+func pollHeight(ctx context.Context, peer *Peer, isGenerator bool) {
+	updateHeight(ctx, peer, isGenerator)
 
 	ticker := time.NewTicker(heightPollingPeriod)
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf(ctx, "Deposed, fetchGeneratorHeight exiting")
+			log.Printf(ctx, "Deposed, pollHeight exiting")
 			ticker.Stop()
 			return
 		case <-ticker.C:
-			updateGeneratorHeight(ctx, peer)
+			updateHeight(ctx, peer, isGenerator)
 		}
 	}
 }
 
-func updateGeneratorHeight(ctx context.Context, peer *rpc.Client) {
-	gh, err := getHeight(ctx, peer)
+func updateHeight(ctx context.Context, peer *Peer, isGenerator bool) {
+	h, err := getHeight(ctx, peer.Client)
 	if err != nil {
+		peer.fail(err)
 		logNetworkError(ctx, err)
 		return
 	}
+	peer.setHeight(h)
+	if !isGenerator {
+		return
+	}
 
 	generatorLock.Lock()
 	defer generatorLock.Unlock()
-	generatorHeight = gh
+	generatorHeight = h
 	generatorHeightFetchedAt = time.Now()
 }
 
@@ -251,7 +422,7 @@ func getHeight(ctx context.Context, peer *rpc.Client) (uint64, error) {
 	}
 	h, ok := resp["block_height"]
 	if !ok {
-		return 0, errors.New("unexpected response from generator")
+		return 0, errors.New("unexpected response from peer")
 	}
 
 	return h, nil
@@ -288,11 +459,18 @@ func (s *Snapshot) done() {
 	s.stopped = true
 }
 
-// fetchSnapshot fetches the latest snapshot from the generator and applies it
+// fetchSnapshot fetches the latest snapshot from peer and applies it
 // to the store. It should only be called on freshly configured cores--
 // cores that have been operating should replay all transactions so that
 // they can index them properly.
-func fetchSnapshot(ctx context.Context, peer *rpc.Client, s protocol.Store, attempt int) error {
+//
+// The initial block must match the blockchain of c. Nothing here can
+// check the snapshot block's signatures, and later blocks are checked
+// against its consensus program, so unless p is the generator gen,
+// the snapshot block must also match gen's block at that height.
+func fetchSnapshot(ctx context.Context, c *protocol.Chain, p, gen *Peer, s protocol.Store, attempt int) error {
+	peer := p.Client
+
 	const getBlockTimeout = 30 * time.Second
 	const readSnapshotTimeout = 30 * time.Second
 
@@ -342,7 +520,10 @@ func fetchSnapshot(ctx context.Context, peer *rpc.Client, s protocol.Store, atte
 	}
 	if initialBlock == nil {
 		// Something seriously funny is afoot.
-		return errors.New("could not get initial block from generator")
+		return errors.New("could not get initial block from peer")
+	}
+	if initialBlock.Hash() != c.InitialBlockHash {
+		return errors.New("peer's initial block doesn't match blockchain ID")
 	}
 
 	// Also get the corresponding block.
@@ -352,11 +533,23 @@ func fetchSnapshot(ctx context.Context, peer *rpc.Client, s protocol.Store, atte
 	}
 	if snapshotBlock == nil {
 		// Something seriously funny is still afoot.
-		return errors.New("generator provided snapshot but could not provide block")
+		return errors.New("peer provided snapshot but could not provide block")
 	}
 	if snapshotBlock.AssetsMerkleRoot != snapshot.Tree.RootHash() {
 		return errors.New("snapshot merkle root doesn't match block")
 	}
+	if p != gen {
+		genBlock, err := getBlock(ctx, gen.Client, info.Height, getBlockTimeout)
+		if err != nil {
+			return errors.Wrap(err, "getting snapshot block from generator")
+		}
+		if genBlock == nil {
+			return errors.New("generator could not provide snapshot block")
+		}
+		if genBlock.Hash() != snapshotBlock.Hash() {
+			return errors.New("snapshot block doesn't match generator's")
+		}
+	}
 
 	// Commit the snapshot, initial block and snapshot block.
 	err = s.SaveBlock(ctx, initialBlock)
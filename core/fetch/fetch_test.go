@@ -0,0 +1,231 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chain/core/rpc"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/protocol/prottest/memstore"
+	"chain/protocol/state"
+	"chain/protocol/vm"
+)
+
+func blockServer(t *testing.T, height uint64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var h uint64
+		err := json.NewDecoder(req.Body).Decode(&h)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if h > height {
+			// Wait for a block that will never come.
+			<-req.Context().Done()
+			return
+		}
+		json.NewEncoder(w).Encode(&bc.Block{BlockHeader: bc.BlockHeader{Height: h}})
+	}))
+}
+
+func TestDownloadBlocksFallback(t *testing.T) {
+	const height = 40
+
+	good := blockServer(t, height)
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+
+	badPeer := &Peer{Client: &rpc.Client{BaseURL: bad.URL}}
+	goodPeer := &Peer{Client: &rpc.Client{BaseURL: good.URL}}
+	badPeer.setHeight(height)
+	goodPeer.setHeight(height)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	blocks, errs := DownloadBlocks(ctx, []*Peer{badPeer, goodPeer}, 1)
+
+	var nerrs int
+	for want := uint64(1); want <= height; {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for block %d", want)
+		case <-errs:
+			nerrs++
+		case b := <-blocks:
+			if b.Height != want {
+				t.Fatalf("got block %d, want %d", b.Height, want)
+			}
+			want++
+		}
+	}
+	if nerrs == 0 {
+		t.Error("got no errors from the bad peer")
+	}
+	if s := badPeer.Status(); s.Healthy || s.LastError == "" {
+		t.Errorf("bad peer status = %+v, want unhealthy with an error", s)
+	}
+	if s := goodPeer.Status(); !s.Healthy || s.LastSuccessAt.IsZero() {
+		t.Errorf("good peer status = %+v, want healthy with a success", s)
+	}
+}
+
+func TestDownloaderParallel(t *testing.T) {
+	var peers []*Peer
+	for i := 0; i < 3; i++ {
+		s := blockServer(t, 100)
+		defer s.Close()
+		p := &Peer{Client: &rpc.Client{BaseURL: s.URL}}
+		p.setHeight(100)
+		peers = append(peers, p)
+	}
+	// This one hasn't reported the blocks, so it
+	// shouldn't be asked for them.
+	behind := blockServer(t, 0)
+	defer behind.Close()
+	behindPeer := &Peer{Client: &rpc.Client{BaseURL: behind.URL}}
+	peers = append(peers, behindPeer)
+
+	d := &downloader{peers: peers}
+	got, errs := d.next(context.Background(), 1, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(got) != maxParallelBlocks {
+		t.Fatalf("got %d blocks, want %d", len(got), maxParallelBlocks)
+	}
+	used := make(map[*Peer]bool)
+	for i, dl := range got {
+		if dl.block.Height != uint64(i+1) {
+			t.Errorf("block %d has height %d", i, dl.block.Height)
+		}
+		used[dl.peer] = true
+	}
+	if len(used) != 3 || used[behindPeer] {
+		t.Errorf("downloaded from %d peers (behind peer used: %v), want the 3 up-to-date peers", len(used), used[behindPeer])
+	}
+
+	got, _ = d.next(context.Background(), 95, nil)
+	if len(got) != 6 {
+		t.Errorf("near the tip, got %d blocks, want 6", len(got))
+	}
+}
+
+func TestPickPeer(t *testing.T) {
+	a := &Peer{Client: &rpc.Client{BaseURL: "a"}}
+	b := &Peer{Client: &rpc.Client{BaseURL: "b"}}
+	c := &Peer{Client: &rpc.Client{BaseURL: "c"}}
+	peers := []*Peer{a, b, c}
+	b.setHeight(10)
+	c.setHeight(10)
+
+	if got := pickPeer(peers, nil, 5, 0); got != b {
+		t.Errorf("pickPeer(5, 0) = %s, want b", got.Client.BaseURL)
+	}
+	if got := pickPeer(peers, nil, 5, 1); got != c {
+		t.Errorf("pickPeer(5, 1) = %s, want c", got.Client.BaseURL)
+	}
+	if got := pickPeer(peers, nil, 11, 1); got != a {
+		t.Errorf("past every peer's height, got %s, want the first peer", got.Client.BaseURL)
+	}
+	if got := pickPeer(peers, map[*Peer]bool{b: true}, 5, 0); got != c {
+		t.Errorf("excluding b, got %s, want c", got.Client.BaseURL)
+	}
+
+	a.fail(errTest)
+	b.fail(errTest)
+	b.fail(errTest)
+	c.fail(errTest)
+	c.fail(errTest)
+	if got := pickPeer(peers, nil, 5, 0); got != a {
+		t.Errorf("with all peers failing, got %s, want the one to retry soonest", got.Client.BaseURL)
+	}
+	if got := pickPeer(peers, map[*Peer]bool{a: true, b: true, c: true}, 5, 0); got != nil {
+		t.Errorf("excluding all peers, got %s, want nil", got.Client.BaseURL)
+	}
+}
+
+// snapshotServer serves an empty snapshot at the
+// height of snapshotBlock, and the given blocks.
+func snapshotServer(t *testing.T, snapshotBlock *bc.Block, blocks ...*bc.Block) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/rpc/get-snapshot-info":
+			json.NewEncoder(w).Encode(map[string]uint64{"height": snapshotBlock.Height})
+		case "/rpc/get-snapshot":
+			// An empty snapshot encodes as no bytes.
+		case "/rpc/get-block":
+			var h uint64
+			err := json.NewDecoder(req.Body).Decode(&h)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for _, b := range append(blocks, snapshotBlock) {
+				if b.Height == h {
+					json.NewEncoder(w).Encode(b)
+					return
+				}
+			}
+			http.Error(w, "no block", http.StatusNotFound)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+}
+
+func TestFetchSnapshotForged(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	initial, err := c.GetBlock(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genuine := &bc.Block{BlockHeader: bc.BlockHeader{
+		Height:           5,
+		TimestampMS:      initial.TimestampMS + 4,
+		AssetsMerkleRoot: state.Empty().Tree.RootHash(),
+		ConsensusProgram: initial.ConsensusProgram,
+	}}
+	// The forged block lets anyone sign the blocks after it.
+	forged := &bc.Block{BlockHeader: genuine.BlockHeader}
+	forged.ConsensusProgram = []byte{byte(vm.OP_TRUE)}
+
+	gen := snapshotServer(t, genuine, initial)
+	defer gen.Close()
+	bad := snapshotServer(t, forged, initial)
+	defer bad.Close()
+	good := snapshotServer(t, genuine, initial)
+	defer good.Close()
+	genPeer := &Peer{Client: &rpc.Client{BaseURL: gen.URL}}
+	badPeer := &Peer{Client: &rpc.Client{BaseURL: bad.URL}}
+	goodPeer := &Peer{Client: &rpc.Client{BaseURL: good.URL}}
+
+	store := memstore.New()
+	err = fetchSnapshot(ctx, c, badPeer, genPeer, store, 1)
+	if err == nil {
+		t.Fatal("fetchSnapshot accepted a forged snapshot block")
+	}
+	if len(store.Blocks) != 0 {
+		t.Errorf("stored %d blocks from the forged snapshot, want 0", len(store.Blocks))
+	}
+
+	err = fetchSnapshot(ctx, c, goodPeer, genPeer, store, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := store.Blocks[genuine.Height]; b == nil || b.Hash() != genuine.Hash() {
+		t.Errorf("stored snapshot block %v, want %s", b, genuine.Hash())
+	}
+}
+
+var errTest = errors.New("test error")
@@ -0,0 +1,166 @@
+package fetch
+
+import (
+	"sync"
+	"time"
+
+	"chain/core/rpc"
+)
+
+// maxPeerBackoff caps how long an unhealthy peer
+// is passed over before we try it again.
+const maxPeerBackoff = time.Minute
+
+// A Peer is another Core or a block cache that serves blocks
+// and snapshots of the blockchain. Fetch downloads blocks from
+// whichever of its peers are healthy, and records the health
+// of each one.
+//
+// The zero value of Peer (with Client set) is ready to use.
+type Peer struct {
+	Client *rpc.Client
+
+	mu              sync.Mutex
+	height          uint64
+	heightFetchedAt time.Time
+	succeededAt     time.Time
+	lastErr         error
+	failedAt        time.Time
+	nfailures       uint
+	retryAt         time.Time
+}
+
+// PeerStatus describes the health of a peer,
+// as reported by PeerHealth.
+type PeerStatus struct {
+	URL                  string    `json:"url"`
+	Healthy              bool      `json:"healthy"`
+	BlockHeight          uint64    `json:"block_height"`
+	BlockHeightFetchedAt time.Time `json:"block_height_fetched_at"`
+	LastSuccessAt        time.Time `json:"last_success_at"`
+	LastError            string    `json:"last_error,omitempty"`
+	LastErrorAt          time.Time `json:"last_error_at"`
+}
+
+// Status returns the current health of p.
+func (p *Peer) Status() PeerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := PeerStatus{
+		URL:                  p.Client.BaseURL,
+		Healthy:              p.nfailures == 0,
+		BlockHeight:          p.height,
+		BlockHeightFetchedAt: p.heightFetchedAt,
+		LastSuccessAt:        p.succeededAt,
+		LastErrorAt:          p.failedAt,
+	}
+	if p.lastErr != nil {
+		s.LastError = p.lastErr.Error()
+	}
+	return s
+}
+
+// succeed records that p served a good block.
+func (p *Peer) succeed() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.succeededAt = time.Now()
+	p.nfailures = 0
+	p.retryAt = time.Time{}
+}
+
+// fail records that a request to p failed, or that p
+// served a bad block, and passes over p for a while.
+func (p *Peer) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastErr = err
+	p.failedAt = time.Now()
+	p.nfailures++
+	p.retryAt = p.failedAt.Add(peerBackoffDur(p.nfailures))
+}
+
+func (p *Peer) setHeight(height uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.height = height
+	p.heightFetchedAt = time.Now()
+}
+
+// knownHeight returns the latest height p
+// reported having, or 0 if it hasn't reported one.
+func (p *Peer) knownHeight() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.height
+}
+
+func (p *Peer) retryTime() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.retryAt
+}
+
+func peerBackoffDur(n uint) time.Duration {
+	if n > 6 {
+		n = 6
+	}
+	d := time.Second << (n - 1)
+	if d > maxPeerBackoff {
+		d = maxPeerBackoff
+	}
+	return d
+}
+
+// pickPeer returns the peer to ask for the block at height.
+// It prefers healthy peers that have reported having that
+// block, and spreads requests among them using n. If no peer
+// is healthy, it returns the one that will recover soonest,
+// so fetching never stops altogether. It skips peers in
+// exclude, and returns nil if that leaves none.
+func pickPeer(peers []*Peer, exclude map[*Peer]bool, height uint64, n int) *Peer {
+	var (
+		now       = time.Now()
+		haveBlock []*Peer
+		healthy   []*Peer
+		soonest   *Peer
+	)
+	for _, p := range peers {
+		if exclude[p] {
+			continue
+		}
+		retryAt := p.retryTime()
+		if retryAt.After(now) {
+			if soonest == nil || retryAt.Before(soonest.retryTime()) {
+				soonest = p
+			}
+			continue
+		}
+		healthy = append(healthy, p)
+		if p.knownHeight() >= height {
+			haveBlock = append(haveBlock, p)
+		}
+	}
+	switch {
+	case len(haveBlock) > 0:
+		return haveBlock[n%len(haveBlock)]
+	case len(healthy) > 0:
+		// Nobody has reported the block yet; ask the first
+		// healthy peer, which is the generator if it's
+		// healthy, to wait for it.
+		return healthy[0]
+	}
+	return soonest
+}
+
+// bestHeight returns the greatest height reported by
+// any of peers.
+func bestHeight(peers []*Peer) uint64 {
+	var h uint64
+	for _, p := range peers {
+		if ph := p.knownHeight(); ph > h {
+			h = ph
+		}
+	}
+	return h
+}
@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"sync"
@@ -14,6 +15,7 @@ import (
 	"chain/metrics"
 	"chain/protocol/bc"
 	"chain/protocol/state"
+	"chain/protocol/validation"
 	"chain/protocol/vmutil"
 )
 
@@ -43,24 +45,82 @@ func (g *Generator) makeBlock(ctx context.Context) error {
 	t0 := time.Now()
 	defer recordSince(t0)
 
+	// A block that didn't get enough signatures is retried
+	// as it is. A signer that signed it won't sign another
+	// block at the same height.
+	b, s, err := g.retryBlock(ctx)
+	if err != nil {
+		return err
+	}
+	if b != nil {
+		err = g.commitBlock(ctx, b, s)
+		if err != nil {
+			return err
+		}
+		g.mu.Lock()
+		g.pool.update(b, nil)
+		g.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
 	g.mu.Lock()
-	txs := g.pool
-	g.pool = nil
-	g.poolHashes = make(map[bc.Hash]bool)
+	txs := g.pool.ready(now)
 	g.mu.Unlock()
 
-	b, s, err := g.chain.GenerateBlock(ctx, g.latestBlock, g.latestSnapshot, time.Now(), txs)
+	next, err := g.nextConsensusProgram(ctx)
+	if err != nil {
+		return err
+	}
+
+	b, s, rejected, err := g.chain.GenerateBlockWithRejections(ctx, g.latestBlock, g.latestSnapshot, now, txs)
 	if err != nil {
 		return errors.Wrap(err, "generate")
 	}
-	if len(b.Transactions) == 0 {
-		return nil // don't bother making an empty block
+	if next != nil {
+		b.ConsensusProgram = next
+	}
+	if len(b.Transactions) == 0 && next == nil {
+		// Don't bother making an empty block,
+		// but do drop the rejected txs.
+		g.mu.Lock()
+		g.pool.update(b, rejected)
+		g.mu.Unlock()
+		return nil
 	}
 	err = savePendingBlock(ctx, g.db, b)
 	if err != nil {
 		return err
 	}
-	return g.commitBlock(ctx, b, s)
+	err = g.commitBlock(ctx, b, s)
+	if err != nil {
+		return err
+	}
+
+	// Only remove txs from the pool once the block is committed,
+	// so they're retried if this attempt fails.
+	g.mu.Lock()
+	g.pool.update(b, rejected)
+	g.mu.Unlock()
+	return nil
+}
+
+// retryBlock returns the saved pending block, and the snapshot
+// after it, if it's the next block after g.latestBlock.
+func (g *Generator) retryBlock(ctx context.Context) (*bc.Block, *state.Snapshot, error) {
+	b, err := getPendingBlock(ctx, g.db)
+	if err != nil || b == nil || g.latestBlock == nil {
+		return nil, nil, err
+	}
+	if b.Height != g.latestBlock.Height+1 || b.PreviousBlockHash != g.latestBlock.Hash() {
+		return nil, nil, nil
+	}
+	s := state.Copy(g.latestSnapshot)
+	err = validation.ApplyBlock(s, b)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "applying pending block")
+	}
+	return b, s, nil
 }
 
 func (g *Generator) commitBlock(ctx context.Context, b *bc.Block, s *state.Snapshot) error {
@@ -74,8 +134,16 @@ func (g *Generator) commitBlock(ctx context.Context, b *bc.Block, s *state.Snaps
 		return errors.Wrap(err, "commit")
 	}
 
+	prev := g.latestBlock
 	g.latestBlock = b
 	g.latestSnapshot = s
+
+	if prev != nil && !bytes.Equal(b.ConsensusProgram, prev.ConsensusProgram) {
+		err = g.finishConsensusChange(ctx, b.ConsensusProgram)
+		if err != nil {
+			return errors.Wrap(err, "finishing consensus program change")
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,116 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+
+	"chain/core/config"
+	"chain/crypto/ed25519"
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/vmutil"
+)
+
+// ProposeConsensusProgram makes the block multisig program for
+// pubkeys and quorum the next consensus program of the generator
+// whose database is db, and returns it. The generator puts it in
+// the next block it makes, which is signed by the current signers.
+// Blocks after that need signatures from the new ones, and the
+// generator asks the remote signers in signers for them once that
+// block is committed.
+//
+// Each signer must accept the same program, with
+// blocksigner.AcceptConsensusProgram, before the generator
+// can get enough signatures for that block.
+func ProposeConsensusProgram(ctx context.Context, db pg.DB, pubkeys []ed25519.PublicKey, quorum int, signers []config.BlockSigner) ([]byte, error) {
+	prog, err := vmutil.BlockMultiSigProgram(pubkeys, quorum)
+	if err != nil {
+		return nil, errors.Wrap(err, "making consensus program")
+	}
+	err = config.ProposeSigners(ctx, db, prog, signers)
+	if err != nil {
+		return nil, err
+	}
+	return prog, nil
+}
+
+// CancelConsensusProgram withdraws the next consensus program
+// proposed with ProposeConsensusProgram, and the signers proposed
+// with it, along with the pending block that puts it in use, so
+// that the generator goes back to making blocks under the current
+// consensus program. It returns the withdrawn program, or nil if
+// there was none.
+//
+// It's for a change the signers won't accept. The generator makes
+// a new block at the height of the withdrawn one, and a signer
+// that signed the withdrawn block won't sign the new one.
+func CancelConsensusProgram(ctx context.Context, db pg.DB) ([]byte, error) {
+	prog, err := config.NextConsensusProgram(ctx, db)
+	if err != nil || prog == nil {
+		return nil, err
+	}
+	b, err := getPendingBlock(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	var pending interface{} // matches no row if nil
+	if b != nil && bytes.Equal(b.ConsensusProgram, prog) {
+		pending = b
+	}
+	const q = `
+		WITH next AS (
+			DELETE FROM next_consensus_program WHERE program = $1
+		)
+		DELETE FROM generator_pending_block WHERE data = $2
+	`
+	_, err = db.Exec(ctx, q, prog, pending)
+	if err != nil {
+		return nil, errors.Wrap(err, "next consensus program delete query")
+	}
+	return prog, nil
+}
+
+// SetSignerLoader sets the function the generator uses to reload
+// its block signers once it changes the consensus program, so
+// that it can reach signers added to the Core's configuration
+// since it started.
+func (g *Generator) SetSignerLoader(f func(context.Context) ([]BlockSigner, error)) {
+	g.loadSigners = f
+}
+
+// nextConsensusProgram returns the consensus program for the
+// next block, if it's to differ from the latest block's.
+func (g *Generator) nextConsensusProgram(ctx context.Context) ([]byte, error) {
+	prog, err := config.NextConsensusProgram(ctx, g.db)
+	if err != nil {
+		return nil, err
+	}
+	if prog == nil {
+		return nil, nil
+	}
+	if bytes.Equal(prog, g.latestBlock.ConsensusProgram) {
+		// A block put it in use, but the generator
+		// stopped before finishing the change.
+		return nil, g.finishConsensusChange(ctx, prog)
+	}
+	return prog, nil
+}
+
+// finishConsensusChange clears the next consensus program once
+// a block has put it in use, switching to the signers proposed
+// with it, and reloads the block signers.
+func (g *Generator) finishConsensusChange(ctx context.Context, prog []byte) error {
+	err := config.ClearNextConsensusProgram(ctx, g.db, prog)
+	if err != nil {
+		return err
+	}
+	if g.loadSigners == nil {
+		return nil
+	}
+	signers, err := g.loadSigners(ctx)
+	if err != nil {
+		return errors.Wrap(err, "reloading block signers")
+	}
+	g.signers = signers
+	return nil
+}
@@ -33,9 +33,12 @@ type Generator struct {
 	chain   *protocol.Chain
 	signers []BlockSigner
 
-	mu         sync.Mutex
-	pool       []*bc.Tx // in topological order
-	poolHashes map[bc.Hash]bool
+	// loadSigners, if set, reloads signers
+	// after a consensus program change.
+	loadSigners func(context.Context) ([]BlockSigner, error)
+
+	mu   sync.Mutex
+	pool *mempool
 
 	// latestBlock and latestSnapshot are current as long as this
 	// process remains the leader process. If the process is demoted,
@@ -52,36 +55,67 @@ func New(
 	db pg.DB,
 ) *Generator {
 	return &Generator{
-		db:         db,
-		chain:      c,
-		signers:    s,
-		poolHashes: make(map[bc.Hash]bool),
+		db:      db,
+		chain:   c,
+		signers: s,
+		pool:    newMempool(DefaultMaxPendingTxs),
 	}
 }
 
-// PendingTxs returns all of the pendings txs that will be
-// included in the generator's next block.
+// SetMaxPendingTxs sets the maximum number of pending txs
+// the generator holds. Submit returns ErrPoolFull once the
+// limit is reached.
+func (g *Generator) SetMaxPendingTxs(n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pool.maxTxs = n
+}
+
+// PendingTxs returns all of the pending txs that are ready to be
+// included in the generator's next block, in the order they will
+// be added to it.
 func (g *Generator) PendingTxs() []*bc.Tx {
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	return g.pool.ready(time.Now())
+}
+
+// ListPendingTxs returns up to limit pending txs with IDs
+// greater than after, ordered by ID. A zero limit means no limit.
+func (g *Generator) ListPendingTxs(after bc.Hash, limit int) []*PendingTx {
+	g.mu.Lock()
+	all := g.pool.pending()
+	g.mu.Unlock()
+
+	var res []*PendingTx
+	for _, ptx := range all {
+		if (after != bc.Hash{}) && ptx.ID.String() <= after.String() {
+			continue
+		}
+		if limit > 0 && len(res) == limit {
+			break
+		}
+		res = append(res, ptx)
+	}
+	return res
+}
 
-	txs := make([]*bc.Tx, len(g.pool))
-	copy(txs, g.pool)
-	return txs
+// TxStatus reports whether the tx with the given ID is pending,
+// confirmed or was rejected. The generator only remembers the
+// most recent confirmed and rejected txs; for others the status
+// is StatusUnknown.
+func (g *Generator) TxStatus(id bc.Hash) *TxStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.pool.status(id)
 }
 
 // Submit adds a new pending tx to the pending tx pool.
+// It returns ErrPoolFull if the pool has reached its size limit.
 func (g *Generator) Submit(ctx context.Context, tx *bc.Tx) error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-
-	if g.poolHashes[tx.ID] {
-		return nil
-	}
-
-	g.poolHashes[tx.ID] = true
-	g.pool = append(g.pool, tx)
-	return nil
+	return g.pool.add(tx, time.Now())
 }
 
 // Generate runs in a loop, making one new block
@@ -1,12 +1,15 @@
 package generator
 
 import (
+	"bytes"
 	"context"
 	"testing"
 	"time"
 
+	"chain/core/config"
 	"chain/crypto/ed25519"
 	"chain/database/pg/pgtest"
+	"chain/errors"
 	"chain/protocol"
 	"chain/protocol/bc"
 	"chain/protocol/prottest"
@@ -120,3 +123,281 @@ func (s testSigner) SignBlock(ctx context.Context, b *bc.Block) ([]byte, error)
 func (s testSigner) String() string {
 	return "test-signer"
 }
+
+func TestConsensusChange(t *testing.T) {
+	dbtx := pgtest.NewTx(t)
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	b, s := c.State()
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	prog, err := ProposeConsensusProgram(ctx, dbtx, []ed25519.PublicKey{pubKey}, 1, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	g := New(c, nil, dbtx)
+	g.latestBlock, g.latestSnapshot = b, s
+	g.SetSignerLoader(func(context.Context) ([]BlockSigner, error) {
+		return []BlockSigner{testSigner{pubKey, privKey}}, nil
+	})
+
+	// The change is made even without any txs to put in a block.
+	err = g.makeBlock(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if g.latestBlock.Height != b.Height+1 {
+		t.Fatalf("got height %d, want %d", g.latestBlock.Height, b.Height+1)
+	}
+	if !bytes.Equal(g.latestBlock.ConsensusProgram, prog) {
+		t.Errorf("got consensus program %x, want %x", g.latestBlock.ConsensusProgram, prog)
+	}
+	next, err := config.NextConsensusProgram(ctx, dbtx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if next != nil {
+		t.Errorf("next consensus program is %x, want none", next)
+	}
+
+	// Later blocks are signed by the new signers.
+	block, _, err := c.GenerateBlock(ctx, g.latestBlock, g.latestSnapshot, time.Now(), nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = g.getAndAddBlockSignatures(ctx, block, g.latestBlock)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = vm.Verify(bc.NewBlockVMContext(block, prog, block.Witness))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+}
+
+// lockingSigner signs blocks as a block signer does: it signs
+// a consensus program change only once it has accepted the new
+// program, and at most one block at each height.
+type lockingSigner struct {
+	testSigner
+	accepted []byte
+	locked   map[uint64]bc.Hash
+}
+
+func (s *lockingSigner) SignBlock(ctx context.Context, b *bc.Block) ([]byte, error) {
+	if !bytes.Equal(b.ConsensusProgram, s.accepted) {
+		return nil, errors.New("consensus program not accepted")
+	}
+	if h, ok := s.locked[b.Height]; ok && h != b.Hash() {
+		return nil, errors.New("already signed another block at this height")
+	}
+	s.locked[b.Height] = b.Hash()
+	return s.testSigner.SignBlock(ctx, b)
+}
+
+func TestConsensusChangeLateSigner(t *testing.T) {
+	dbtx := pgtest.NewTx(t)
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	b, s := c.State()
+
+	var signers []BlockSigner
+	var pubkeys []ed25519.PublicKey
+	for i := 0; i < 2; i++ {
+		pub, prv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		pubkeys = append(pubkeys, pub)
+		signers = append(signers, &lockingSigner{
+			testSigner: testSigner{pub, prv},
+			locked:     make(map[uint64]bc.Hash),
+		})
+	}
+	early, late := signers[0].(*lockingSigner), signers[1].(*lockingSigner)
+
+	// Start with a 2-of-2 consensus program.
+	prog, err := ProposeConsensusProgram(ctx, dbtx, pubkeys, 2, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	g := New(c, nil, dbtx)
+	g.latestBlock, g.latestSnapshot = b, s
+	g.SetSignerLoader(func(context.Context) ([]BlockSigner, error) {
+		return signers, nil
+	})
+	err = g.makeBlock(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	early.accepted, late.accepted = prog, prog
+
+	// Change it again. Only one signer has accepted the
+	// new program, so the first attempt fails.
+	newPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	next, err := ProposeConsensusProgram(ctx, dbtx, []ed25519.PublicKey{newPub}, 1, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	early.accepted = next
+	err = g.makeBlock(ctx)
+	if err == nil {
+		t.Fatal("makeBlock succeeded without the late signer")
+	}
+	height := g.latestBlock.Height + 1
+	signed, ok := early.locked[height]
+	if !ok {
+		t.Fatalf("early signer didn't sign a block at height %d", height)
+	}
+
+	// Once the late signer accepts, the retry gets
+	// both signatures for the block the early signer
+	// already signed.
+	late.accepted = next
+	time.Sleep(2 * time.Millisecond) // a new block would have a new timestamp
+	err = g.makeBlock(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if g.latestBlock.Height != height {
+		t.Fatalf("got height %d, want %d", g.latestBlock.Height, height)
+	}
+	if g.latestBlock.Hash() != signed {
+		t.Errorf("committed block %x, want the retried block %x", g.latestBlock.Hash(), signed)
+	}
+	if !bytes.Equal(g.latestBlock.ConsensusProgram, next) {
+		t.Errorf("got consensus program %x, want %x", g.latestBlock.ConsensusProgram, next)
+	}
+}
+
+// refusingSigner refuses to sign, recording
+// the hash of each block it's asked to sign.
+type refusingSigner struct {
+	asked []bc.Hash
+}
+
+func (s *refusingSigner) SignBlock(ctx context.Context, b *bc.Block) ([]byte, error) {
+	s.asked = append(s.asked, b.Hash())
+	return nil, errors.New("refused")
+}
+
+func TestRetryBlock(t *testing.T) {
+	dbtx := pgtest.NewTx(t)
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	b, s := c.State()
+
+	// Require a signature for blocks after the next one,
+	// then propose another change to make a block that
+	// needs one.
+	g := New(c, nil, dbtx)
+	g.latestBlock, g.latestSnapshot = b, s
+	for i := 0; i < 2; i++ {
+		pub, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		_, err = ProposeConsensusProgram(ctx, dbtx, []ed25519.PublicKey{pub}, 1, nil)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if i == 0 {
+			err = g.makeBlock(ctx)
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+		}
+	}
+	signer := new(refusingSigner)
+	g.signers = []BlockSigner{signer}
+
+	// Each failed attempt sends the same block, so signers
+	// don't see what looks like equivocation by the generator.
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			time.Sleep(2 * time.Millisecond) // a new block would have a new timestamp
+		}
+		err := g.makeBlock(ctx)
+		if err == nil {
+			t.Fatal("makeBlock succeeded without signatures")
+		}
+	}
+	if len(signer.asked) != 3 {
+		t.Fatalf("signer asked %d times, want 3", len(signer.asked))
+	}
+	for _, h := range signer.asked[1:] {
+		if h != signer.asked[0] {
+			t.Errorf("retry sent block %x, want %x", h, signer.asked[0])
+		}
+	}
+}
+
+func TestCancelConsensusProgram(t *testing.T) {
+	dbtx := pgtest.NewTx(t)
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	b, s := c.State()
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	g := New(c, nil, dbtx)
+	g.latestBlock, g.latestSnapshot = b, s
+	_, err = ProposeConsensusProgram(ctx, dbtx, []ed25519.PublicKey{pub}, 1, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = g.makeBlock(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// The signer never accepts the next change.
+	newPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	next, err := ProposeConsensusProgram(ctx, dbtx, []ed25519.PublicKey{newPub}, 1, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	signer := new(refusingSigner)
+	g.signers = []BlockSigner{signer}
+	err = g.makeBlock(ctx)
+	if err == nil {
+		t.Fatal("makeBlock succeeded without signatures")
+	}
+
+	got, err := CancelConsensusProgram(ctx, dbtx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !bytes.Equal(got, next) {
+		t.Errorf("canceled program %x, want %x", got, next)
+	}
+	prog, err := config.NextConsensusProgram(ctx, dbtx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if prog != nil {
+		t.Errorf("next consensus program = %x, want none", prog)
+	}
+
+	// With no txs and no change to make,
+	// the generator makes no block at all.
+	err = g.makeBlock(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(signer.asked) != 1 {
+		t.Errorf("signer asked %d times, want 1", len(signer.asked))
+	}
+}
@@ -0,0 +1,237 @@
+package generator
+
+import (
+	"sort"
+	"time"
+
+	"chain/errors"
+	"chain/protocol"
+	"chain/protocol/bc"
+)
+
+var (
+	// ErrPoolFull is returned by Submit when the pool
+	// of pending transactions has reached its size limit.
+	ErrPoolFull = errors.New("pending transaction pool is full")
+
+	errExpired = errors.New("transaction max time elapsed before it was included in a block")
+)
+
+const (
+	// DefaultMaxPendingTxs is the default limit on the
+	// number of pending transactions the generator holds.
+	DefaultMaxPendingTxs = 10000
+
+	// maxRecentTxs is the number of confirmed and rejected
+	// transactions whose status the pool remembers.
+	maxRecentTxs = 10000
+)
+
+// Transaction statuses reported by TxStatus.
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+	StatusRejected  = "rejected"
+	StatusUnknown   = "unknown"
+)
+
+// TxStatus describes the progress of a
+// transaction submitted to the generator.
+type TxStatus struct {
+	ID     bc.Hash `json:"id"`
+	Status string  `json:"status"`
+
+	// BlockHeight is the height of the block that includes
+	// the transaction, for confirmed transactions.
+	BlockHeight uint64 `json:"block_height,omitempty"`
+
+	// Reason is the validation error that caused the
+	// transaction to be rejected, for rejected transactions.
+	Reason string `json:"rejection_reason,omitempty"`
+}
+
+// PendingTx is a transaction waiting in the
+// generator's pool to be included in a block.
+type PendingTx struct {
+	ID          bc.Hash   `json:"id"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	Tx          *bc.Tx    `json:"raw_transaction"`
+}
+
+// mempool holds the pending transactions of a generator and
+// remembers the fate of transactions that have left it.
+// It is not safe for concurrent use.
+type mempool struct {
+	maxTxs int
+	seq    uint64
+	txs    map[bc.Hash]*poolTx
+
+	recent      map[bc.Hash]*TxStatus // confirmed and rejected txs
+	recentOrder []bc.Hash             // oldest first
+}
+
+type poolTx struct {
+	tx        *bc.Tx
+	seq       uint64 // submission order
+	submitted time.Time
+}
+
+func newMempool(maxTxs int) *mempool {
+	return &mempool{
+		maxTxs: maxTxs,
+		txs:    make(map[bc.Hash]*poolTx),
+		recent: make(map[bc.Hash]*TxStatus),
+	}
+}
+
+// add adds tx to the pool. Adding a transaction that is
+// already pending or confirmed has no effect. A rejected
+// transaction gets another chance.
+func (p *mempool) add(tx *bc.Tx, now time.Time) error {
+	if p.txs[tx.ID] != nil {
+		return nil
+	}
+	if st := p.recent[tx.ID]; st != nil && st.Status == StatusConfirmed {
+		return nil
+	}
+	if len(p.txs) >= p.maxTxs {
+		return errors.WithDetailf(ErrPoolFull, "the pool holds %d transactions", p.maxTxs)
+	}
+	delete(p.recent, tx.ID) // forget any earlier rejection
+	p.seq++
+	p.txs[tx.ID] = &poolTx{tx: tx, seq: p.seq, submitted: now}
+	return nil
+}
+
+// pending returns the pending transactions, ordered by ID.
+func (p *mempool) pending() []*PendingTx {
+	res := make([]*PendingTx, 0, len(p.txs))
+	for _, ptx := range p.txs {
+		res = append(res, &PendingTx{ID: ptx.tx.ID, SubmittedAt: ptx.submitted, Tx: ptx.tx})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID.String() < res[j].ID.String()
+	})
+	return res
+}
+
+func (p *mempool) status(id bc.Hash) *TxStatus {
+	if p.txs[id] != nil {
+		return &TxStatus{ID: id, Status: StatusPending}
+	}
+	if st := p.recent[id]; st != nil {
+		cp := *st
+		return &cp
+	}
+	return &TxStatus{ID: id, Status: StatusUnknown}
+}
+
+// ready returns the transactions that may go in a block made
+// at time now, ordered so that every transaction comes after the
+// pending transactions whose outputs it spends, and otherwise in
+// submission order.
+//
+// Transactions whose max time has passed are rejected and removed
+// from the pool. Transactions whose min time hasn't arrived yet,
+// and transactions spending their outputs, stay in the pool but
+// aren't returned.
+func (p *mempool) ready(now time.Time) []*bc.Tx {
+	nowMS := bc.Millis(now)
+
+	// Build the dependency graph between pending txs.
+	var (
+		creators = make(map[bc.Hash]*poolTx) // output ID -> tx creating it
+		deps     = make(map[*poolTx][]*poolTx)
+		waiting  = make(map[*poolTx]int) // number of unprocessed parents
+		all      []*poolTx
+	)
+	for _, ptx := range p.txs {
+		if ptx.tx.MaxTime > 0 && ptx.tx.MaxTime < nowMS {
+			p.reject(ptx.tx.ID, errExpired)
+			continue
+		}
+		all = append(all, ptx)
+		for _, res := range ptx.tx.Results {
+			creators[res.ID] = ptx
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].seq < all[j].seq })
+	for _, ptx := range all {
+		for _, spent := range ptx.tx.SpentOutputIDs {
+			parent := creators[spent]
+			if parent == nil || parent == ptx {
+				continue
+			}
+			deps[parent] = append(deps[parent], ptx)
+			waiting[ptx]++
+		}
+	}
+
+	// Topologically sort the graph, always taking the earliest
+	// submitted tx among those whose parents are all done. A tx
+	// that isn't ready holds back the txs that depend on it.
+	var (
+		res      []*bc.Tx
+		heldBack = make(map[*poolTx]bool)
+		queue    []*poolTx
+	)
+	for _, ptx := range all {
+		if waiting[ptx] == 0 {
+			queue = append(queue, ptx)
+		}
+	}
+	for len(queue) > 0 {
+		sort.Slice(queue, func(i, j int) bool { return queue[i].seq < queue[j].seq })
+		ptx := queue[0]
+		queue = queue[1:]
+
+		if ptx.tx.MinTime > nowMS || heldBack[ptx] {
+			for _, child := range deps[ptx] {
+				heldBack[child] = true
+			}
+		} else {
+			res = append(res, ptx.tx)
+		}
+		for _, child := range deps[ptx] {
+			waiting[child]--
+			if waiting[child] == 0 {
+				queue = append(queue, child)
+			}
+		}
+	}
+	return res
+}
+
+// update removes the txs confirmed in block b and the
+// rejected txs from the pool, remembering their status.
+func (p *mempool) update(b *bc.Block, rejected []protocol.TxRejection) {
+	for _, tx := range b.Transactions {
+		delete(p.txs, tx.ID)
+		p.remember(&TxStatus{ID: tx.ID, Status: StatusConfirmed, BlockHeight: b.Height})
+	}
+	for _, r := range rejected {
+		p.reject(r.Tx.ID, r.Err)
+	}
+}
+
+func (p *mempool) reject(id bc.Hash, err error) {
+	delete(p.txs, id)
+	reason := errors.Detail(err)
+	if reason == "" {
+		reason = err.Error()
+	}
+	p.remember(&TxStatus{ID: id, Status: StatusRejected, Reason: reason})
+}
+
+func (p *mempool) remember(st *TxStatus) {
+	if p.recent[st.ID] == nil {
+		p.recentOrder = append(p.recentOrder, st.ID)
+	}
+	p.recent[st.ID] = st
+
+	for len(p.recentOrder) > maxRecentTxs {
+		id := p.recentOrder[0]
+		p.recentOrder = p.recentOrder[1:]
+		delete(p.recent, id)
+	}
+}
@@ -0,0 +1,163 @@
+package generator
+
+import (
+	"testing"
+	"time"
+
+	"chain/errors"
+	"chain/protocol"
+	"chain/protocol/bc"
+	"chain/testutil"
+)
+
+// mempoolTestTx returns a tx with the given ID that creates
+// one output with ID out and spends the outputs in spends.
+func mempoolTestTx(id, out byte, spends ...byte) *bc.Tx {
+	tx := &bc.Tx{}
+	tx.ID = bc.Hash{id}
+	tx.Results = []bc.ResultInfo{{ID: bc.Hash{out}}}
+	for _, s := range spends {
+		tx.SpentOutputIDs = append(tx.SpentOutputIDs, bc.Hash{s})
+	}
+	return tx
+}
+
+func TestMempoolReadyOrder(t *testing.T) {
+	now := time.Now()
+	p := newMempool(10)
+
+	// Submit children before their parents.
+	grandchild := mempoolTestTx(1, 0x11, 0x12)
+	child := mempoolTestTx(2, 0x12, 0x13)
+	parent := mempoolTestTx(3, 0x13)
+	unrelated := mempoolTestTx(4, 0x14)
+	for _, tx := range []*bc.Tx{grandchild, child, unrelated, parent} {
+		err := p.add(tx, now)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	got := p.ready(now)
+	want := []*bc.Tx{unrelated, parent, child, grandchild}
+	if !testutil.DeepEqual(got, want) {
+		t.Errorf("ready() = %v, want %v", txIDs(got), txIDs(want))
+	}
+}
+
+func TestMempoolTimeRange(t *testing.T) {
+	now := time.Now()
+	p := newMempool(10)
+
+	expired := mempoolTestTx(1, 0x11)
+	expired.MaxTime = bc.Millis(now) - 1
+	early := mempoolTestTx(2, 0x12)
+	early.MinTime = bc.Millis(now) + 1000
+	child := mempoolTestTx(3, 0x13, 0x12)
+	ok := mempoolTestTx(4, 0x14)
+	ok.MinTime = bc.Millis(now)
+	ok.MaxTime = bc.Millis(now) + 2000
+	for _, tx := range []*bc.Tx{expired, early, child, ok} {
+		err := p.add(tx, now)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	got := p.ready(now)
+	want := []*bc.Tx{ok}
+	if !testutil.DeepEqual(got, want) {
+		t.Errorf("ready() = %v, want %v", txIDs(got), txIDs(want))
+	}
+
+	st := p.status(expired.ID)
+	if st.Status != StatusRejected || st.Reason != errExpired.Error() {
+		t.Errorf("status(expired) = %+v, want rejected with reason %q", st, errExpired)
+	}
+	for _, tx := range []*bc.Tx{early, child} {
+		if st := p.status(tx.ID); st.Status != StatusPending {
+			t.Errorf("status(%x) = %s, want %s", tx.ID[0], st.Status, StatusPending)
+		}
+	}
+
+	// Once the early tx's min time arrives, it and its child are ready.
+	got = p.ready(now.Add(time.Second))
+	want = []*bc.Tx{early, child, ok}
+	if !testutil.DeepEqual(got, want) {
+		t.Errorf("ready() = %v, want %v", txIDs(got), txIDs(want))
+	}
+}
+
+func TestMempoolFull(t *testing.T) {
+	now := time.Now()
+	p := newMempool(2)
+
+	tx1, tx2, tx3 := mempoolTestTx(1, 0x11), mempoolTestTx(2, 0x12), mempoolTestTx(3, 0x13)
+	for _, tx := range []*bc.Tx{tx1, tx2, tx1} {
+		err := p.add(tx, now)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+	err := p.add(tx3, now)
+	if errors.Root(err) != ErrPoolFull {
+		t.Fatalf("add(tx3) = %v, want %v", err, ErrPoolFull)
+	}
+
+	// Confirming a tx makes room.
+	p.update(&bc.Block{BlockHeader: bc.BlockHeader{Height: 2}, Transactions: []*bc.Tx{tx1}}, nil)
+	err = p.add(tx3, now)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+}
+
+func TestMempoolStatus(t *testing.T) {
+	now := time.Now()
+	p := newMempool(10)
+
+	confirmed, rejected, pending := mempoolTestTx(1, 0x11), mempoolTestTx(2, 0x12), mempoolTestTx(3, 0x13)
+	for _, tx := range []*bc.Tx{confirmed, rejected, pending} {
+		err := p.add(tx, now)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	b := &bc.Block{BlockHeader: bc.BlockHeader{Height: 7}, Transactions: []*bc.Tx{confirmed}}
+	rejectErr := errors.WithDetail(errors.New("bad tx"), "output already spent")
+	p.update(b, []protocol.TxRejection{{Tx: rejected, Err: rejectErr}})
+
+	cases := []struct {
+		id   bc.Hash
+		want *TxStatus
+	}{
+		{confirmed.ID, &TxStatus{ID: confirmed.ID, Status: StatusConfirmed, BlockHeight: 7}},
+		{rejected.ID, &TxStatus{ID: rejected.ID, Status: StatusRejected, Reason: "output already spent"}},
+		{pending.ID, &TxStatus{ID: pending.ID, Status: StatusPending}},
+		{bc.Hash{9}, &TxStatus{ID: bc.Hash{9}, Status: StatusUnknown}},
+	}
+	for _, c := range cases {
+		got := p.status(c.id)
+		if !testutil.DeepEqual(got, c.want) {
+			t.Errorf("status(%x) = %+v, want %+v", c.id[0], got, c.want)
+		}
+	}
+
+	// Resubmitting a confirmed tx is a no-op, but a
+	// rejected tx goes back into the pool.
+	p.add(confirmed, now)
+	p.add(rejected, now)
+	got := p.pending()
+	if len(got) != 2 || got[0].ID != rejected.ID || got[1].ID != pending.ID {
+		t.Errorf("pending() = %+v, want txs %x and %x", got, rejected.ID[0], pending.ID[0])
+	}
+}
+
+func txIDs(txs []*bc.Tx) []bc.Hash {
+	var ids []bc.Hash
+	for _, tx := range txs {
+		ids = append(ids, tx.ID)
+	}
+	return ids
+}
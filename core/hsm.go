@@ -4,10 +4,14 @@ package core
 
 import (
 	"context"
+	"net/http"
 
 	"chain/core/mockhsm"
 	"chain/core/txbuilder"
 	"chain/crypto/ed25519/chainkd"
+	"chain/crypto/passphrase"
+	chainjson "chain/encoding/json"
+	"chain/errors"
 	"chain/net/http/httpjson"
 )
 
@@ -15,6 +19,12 @@ func init() {
 	errorInfoTab[mockhsm.ErrDuplicateKeyAlias] = errorInfo{400, "CH050", "Alias already exists"}
 	errorInfoTab[mockhsm.ErrInvalidAfter] = errorInfo{400, "CH801", "Invalid `after` in query"}
 	errorInfoTab[mockhsm.ErrTooManyAliasesToList] = errorInfo{400, "CH802", "Too many aliases to list"}
+	errorInfoTab[mockhsm.ErrLocked] = errorInfo{400, "CH803", "MockHSM is locked"}
+	errorInfoTab[mockhsm.ErrEmptyPassphrase] = errorInfo{400, "CH804", "Passphrase is empty"}
+	errorInfoTab[passphrase.ErrWrongPassphrase] = errorInfo{400, "CH805", "Wrong passphrase"}
+	errorInfoTab[passphrase.ErrBadSealed] = errorInfo{400, "CH806", "Malformed encrypted data"}
+	errorInfoTab[mockhsm.ErrBadBackup] = errorInfo{400, "CH807", "Invalid key backup"}
+	errorInfoTab[mockhsm.ErrBadStoredKey] = errorInfo{500, "CH808", "Stored key can't be decrypted"}
 }
 
 // MockHSM configures the Core to expose the MockHSM endpoints. It
@@ -27,7 +37,11 @@ func MockHSM(hsm *mockhsm.HSM) RunOption {
 		a.mux.Handle("/mockhsm/create-key", needConfig(h.mockhsmCreateKey))
 		a.mux.Handle("/mockhsm/list-keys", needConfig(h.mockhsmListKeys))
 		a.mux.Handle("/mockhsm/delkey", needConfig(h.mockhsmDelKey))
-		a.mux.Handle("/mockhsm/sign-transaction", needConfig(h.mockhsmSignTemplates))
+		a.mux.Handle("/mockhsm/sign-transaction", a.acceptTemplates(needConfig(h.mockhsmSignTemplates), h.mockhsmSignTemplateStream))
+		a.mux.Handle("/mockhsm/unlock", jsonHandler(h.mockhsmUnlock))
+		a.mux.Handle("/mockhsm/change-passphrase", jsonHandler(h.mockhsmChangePassphrase))
+		a.mux.Handle("/mockhsm/export-keys", needConfig(h.mockhsmExportKeys))
+		a.mux.Handle("/mockhsm/import-keys", needConfig(h.mockhsmImportKeys))
 	}
 }
 
@@ -68,13 +82,68 @@ func (h *mockHSMHandler) mockhsmDelKey(ctx context.Context, xpub chainkd.XPub) e
 	return h.MockHSM.DeleteChainKDKey(ctx, xpub)
 }
 
+func (h *mockHSMHandler) mockhsmUnlock(ctx context.Context, in struct {
+	Passphrase string `json:"passphrase"`
+}) error {
+	return h.MockHSM.Unlock(ctx, []byte(in.Passphrase))
+}
+
+func (h *mockHSMHandler) mockhsmChangePassphrase(ctx context.Context, in struct {
+	Old string `json:"old_passphrase"`
+	New string `json:"new_passphrase"`
+}) error {
+	return h.MockHSM.ChangePassphrase(ctx, []byte(in.Old), []byte(in.New))
+}
+
+// mockhsmExportKeys returns a backup of the MockHSM's keys,
+// encrypted with the given passphrase.
+func (h *mockHSMHandler) mockhsmExportKeys(ctx context.Context, in struct {
+	Passphrase string `json:"passphrase"`
+}) (map[string]interface{}, error) {
+	backup, err := h.MockHSM.ExportKeys(ctx, []byte(in.Passphrase))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"backup": chainjson.HexBytes(backup)}, nil
+}
+
+func (h *mockHSMHandler) mockhsmImportKeys(ctx context.Context, in struct {
+	Backup     chainjson.HexBytes `json:"backup"`
+	Passphrase string             `json:"passphrase"`
+}) (map[string]interface{}, error) {
+	n, err := h.MockHSM.ImportKeys(ctx, in.Backup, []byte(in.Passphrase))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"imported": n}, nil
+}
+
 func (h *mockHSMHandler) mockhsmSignTemplates(ctx context.Context, x struct {
 	Txs   []*txbuilder.Template `json:"transactions"`
 	XPubs []chainkd.XPub        `json:"xpubs"`
 }) []interface{} {
-	resp := make([]interface{}, 0, len(x.Txs))
-	for _, tx := range x.Txs {
-		err := txbuilder.Sign(ctx, tx, x.XPubs, h.mockhsmSignTemplate)
+	return h.signTemplates(ctx, x.Txs, x.XPubs)
+}
+
+// mockhsmSignTemplateStream is mockhsmSignTemplates for templates
+// in the binary encoding, with xpubs given in the URL query.
+func (h *mockHSMHandler) mockhsmSignTemplateStream(ctx context.Context, req *http.Request, tpls []*txbuilder.Template) (interface{}, error) {
+	var xpubs []chainkd.XPub
+	for _, s := range req.URL.Query()["xpubs"] {
+		var xpub chainkd.XPub
+		err := xpub.UnmarshalText([]byte(s))
+		if err != nil {
+			return nil, errors.WithDetailf(httpjson.ErrBadRequest, "bad xpub %q: %s", s, err)
+		}
+		xpubs = append(xpubs, xpub)
+	}
+	return h.signTemplates(ctx, tpls, xpubs), nil
+}
+
+func (h *mockHSMHandler) signTemplates(ctx context.Context, tpls []*txbuilder.Template, xpubs []chainkd.XPub) []interface{} {
+	resp := make([]interface{}, 0, len(tpls))
+	for _, tx := range tpls {
+		err := txbuilder.Sign(ctx, tx, xpubs, h.mockhsmSignTemplate)
 		if err != nil {
 			info, _ := errInfo(err)
 			resp = append(resp, info)
@@ -37,7 +37,7 @@ func TestMockHSM(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	acct1, err := accounts.Create(ctx, []chainkd.XPub{xpub1.XPub}, 1, "", nil, "")
+	acct1, err := accounts.Create(ctx, []chainkd.XPub{xpub1.XPub}, 1, "", nil, nil, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -46,7 +46,7 @@ func TestMockHSM(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	acct2, err := accounts.Create(ctx, []chainkd.XPub{xpub2}, 1, "", nil, "")
+	acct2, err := accounts.Create(ctx, []chainkd.XPub{xpub2}, 1, "", nil, nil, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -105,10 +105,13 @@ func TestMockHSM(t *testing.T) {
 }
 
 func inspectSigInst(t *testing.T, si *txbuilder.SigningInstruction, expectSig bool) {
-	if len(si.SignatureWitnesses) != 1 {
-		t.Fatalf("len(si.SignatureWitnesses) is %d, want 1", len(si.SignatureWitnesses))
+	if len(si.WitnessComponents) != 1 {
+		t.Fatalf("len(si.WitnessComponents) is %d, want 1", len(si.WitnessComponents))
+	}
+	s, ok := si.WitnessComponents[0].(*txbuilder.SignatureWitness)
+	if !ok {
+		t.Fatalf("witness component is %T, want *txbuilder.SignatureWitness", si.WitnessComponents[0])
 	}
-	s := si.SignatureWitnesses[0]
 	if len(s.Sigs) != 1 {
 		t.Fatalf("len(s.Sigs) is %d, want 1", len(s.Sigs))
 	}
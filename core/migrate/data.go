@@ -57,4 +57,70 @@ var migrations = []migration{
 		ALTER TABLE account_utxos ALTER COLUMN change SET NOT NULL;
 		COMMIT;
 	`},
+	{Name: `2017-03-13.0.core.txfeed-webhooks.sql`, SQL: `
+		ALTER TABLE txfeeds
+			ADD COLUMN webhook_url text,
+			ADD COLUMN webhook_secret text;
+	`},
+	{Name: `2017-03-14.0.account.spending-policies.sql`, SQL: `
+		ALTER TABLE accounts ADD COLUMN policy jsonb;
+		CREATE TABLE account_spends (
+			account_id text NOT NULL,
+			asset_id bytea NOT NULL,
+			tx_hash bytea NOT NULL,
+			amount bigint NOT NULL,
+			spent_at timestamp with time zone NOT NULL,
+			PRIMARY KEY (tx_hash, account_id, asset_id)
+		);
+		CREATE INDEX account_spends_account_id_asset_id_spent_at_idx
+			ON account_spends (account_id, asset_id, spent_at);
+	`},
+	{Name: `2017-03-15.0.signers.key-rotation.sql`, SQL: `
+		ALTER TABLE signers ADD COLUMN version integer DEFAULT 1 NOT NULL;
+		CREATE TABLE signer_versions (
+			signer_id text NOT NULL,
+			version integer NOT NULL,
+			xpubs bytea[] NOT NULL,
+			quorum integer NOT NULL,
+			retired_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (signer_id, version)
+		);
+		ALTER TABLE account_control_programs ADD COLUMN signer_version integer DEFAULT 1 NOT NULL;
+		ALTER TABLE account_utxos ADD COLUMN signer_version integer DEFAULT 1 NOT NULL;
+		CREATE INDEX account_utxos_account_id_signer_version_idx
+			ON account_utxos (account_id, signer_version);
+	`},
+	{Name: `2017-03-16.0.core.next-consensus-program.sql`, SQL: `
+		CREATE TABLE next_consensus_program (
+			singleton boolean DEFAULT true NOT NULL,
+			program bytea NOT NULL,
+			CONSTRAINT next_consensus_program_singleton CHECK (singleton),
+			PRIMARY KEY (singleton)
+		);
+	`},
+	{Name: `2017-03-17.0.signer.signer-headers.sql`, SQL: `
+		CREATE TABLE signer_headers (
+			block_height bigint NOT NULL,
+			block_hash bytea NOT NULL,
+			pubkey bytea NOT NULL,
+			header bytea NOT NULL,
+			signature bytea,
+			rejection text,
+			recorded_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (block_height, block_hash, pubkey)
+		);
+		CREATE INDEX signer_headers_recorded_at_idx ON signer_headers (recorded_at);
+	`},
+	{Name: `2017-03-20.0.core.mockhsm-encryption.sql`, SQL: `
+		ALTER TABLE mockhsm ADD COLUMN encrypted boolean DEFAULT false NOT NULL;
+		CREATE TABLE mockhsm_keyring (
+			singleton boolean DEFAULT true NOT NULL,
+			sealed_key bytea NOT NULL,
+			CONSTRAINT mockhsm_keyring_singleton CHECK (singleton),
+			PRIMARY KEY (singleton)
+		);
+	`},
+	{Name: `2017-03-21.0.core.next-consensus-signers.sql`, SQL: `
+		ALTER TABLE next_consensus_program ADD COLUMN signers bytea;
+	`},
 }
@@ -0,0 +1,165 @@
+package mockhsm
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lib/pq"
+
+	"chain/crypto/ed25519"
+	"chain/crypto/ed25519/chainkd"
+	"chain/crypto/passphrase"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+)
+
+// ErrBadBackup is returned by ImportKeys when
+// a decrypted backup isn't in the backup format.
+var ErrBadBackup = errors.New("malformed key backup")
+
+const backupVersion = 1
+
+// A backup is the plaintext of an encrypted key backup.
+// ExportKeys seals its JSON encoding with a passphrase,
+// as in package passphrase.
+type backup struct {
+	Version int          `json:"version"`
+	Keys    []*backupKey `json:"keys"`
+}
+
+type backupKey struct {
+	Type  string             `json:"type"`
+	Pub   chainjson.HexBytes `json:"pub"`
+	Prv   chainjson.HexBytes `json:"prv"`
+	Alias *string            `json:"alias"`
+}
+
+// ExportKeys returns a backup of all the HSM's keys,
+// encrypted with pass. The HSM must be unlocked.
+func (h *HSM) ExportKeys(ctx context.Context, pass []byte) ([]byte, error) {
+	if len(pass) == 0 {
+		return nil, ErrEmptyPassphrase
+	}
+	b := backup{Version: backupVersion}
+	var encrypted []bool
+	const q = `SELECT key_type, pub, prv, alias, encrypted FROM mockhsm ORDER BY sort_id`
+	err := pg.ForQueryRows(ctx, h.db, q, func(typ string, pub, prv []byte, alias sql.NullString, enc bool) {
+		k := &backupKey{Type: typ, Pub: pub, Prv: prv}
+		if alias.Valid {
+			k.Alias = &alias.String
+		}
+		b.Keys = append(b.Keys, k)
+		encrypted = append(encrypted, enc)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading keys")
+	}
+	for i, k := range b.Keys {
+		k.Prv, err = h.openStoredPrv(ctx, k.Pub, k.Prv, encrypted[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "decrypting key %x", []byte(k.Pub))
+		}
+	}
+
+	plaintext, err := json.Marshal(b)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return passphrase.Seal(plaintext, pass)
+}
+
+// ImportKeys adds the keys in a backup made by ExportKeys,
+// decrypting it with pass. It skips keys the HSM already has,
+// and returns the number of keys it added. If a passphrase
+// is set, the HSM must be unlocked.
+func (h *HSM) ImportKeys(ctx context.Context, sealed, pass []byte) (int, error) {
+	plaintext, err := passphrase.Open(sealed, pass)
+	if err != nil {
+		return 0, err
+	}
+	var b backup
+	err = json.Unmarshal(plaintext, &b)
+	if err != nil {
+		return 0, errors.WithDetail(ErrBadBackup, err.Error())
+	}
+	if b.Version != backupVersion {
+		return 0, errors.WithDetailf(ErrBadBackup, "version %d", b.Version)
+	}
+	for _, k := range b.Keys {
+		err = checkBackupKey(k)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// The keys are inserted in one statement, so that if
+	// any can't be, such as for a duplicate alias, none are.
+	var (
+		pubs, prvs     pq.ByteaArray
+		aliases, types pq.StringArray
+		encrypted      pq.BoolArray
+	)
+	for _, k := range b.Keys {
+		stored, enc, err := h.storedPrv(ctx, k.Pub, k.Prv)
+		if err != nil {
+			return 0, err
+		}
+		var alias string
+		if k.Alias != nil {
+			alias = *k.Alias
+		}
+		pubs = append(pubs, k.Pub)
+		prvs = append(prvs, stored)
+		aliases = append(aliases, alias)
+		types = append(types, k.Type)
+		encrypted = append(encrypted, enc)
+	}
+	const q = `
+		INSERT INTO mockhsm (pub, prv, alias, key_type, encrypted)
+		SELECT pub, prv, NULLIF(alias, ''), key_type, encrypted
+		FROM unnest($1::bytea[], $2::bytea[], $3::text[], $4::text[], $5::boolean[])
+			AS k (pub, prv, alias, key_type, encrypted)
+		ON CONFLICT (pub) DO NOTHING
+	`
+	res, err := h.db.Exec(ctx, q, pubs, prvs, aliases, types, encrypted)
+	if pg.IsUniqueViolation(err) {
+		return 0, errors.WithDetail(ErrDuplicateKeyAlias, err.(*pq.Error).Detail)
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "storing imported keys")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err)
+	}
+	return int(n), nil
+}
+
+// checkBackupKey checks that k's private key
+// matches its type and public key.
+func checkBackupKey(k *backupKey) error {
+	var pub []byte
+	switch k.Type {
+	case "chain_kd":
+		var xprv chainkd.XPrv
+		if len(k.Prv) != len(xprv) {
+			return errors.WithDetailf(ErrBadBackup, "key %x has the wrong size", []byte(k.Pub))
+		}
+		copy(xprv[:], k.Prv)
+		pub = xprv.XPub().Bytes()
+	case "ed25519":
+		if len(k.Prv) != ed25519.PrivateKeySize {
+			return errors.WithDetailf(ErrBadBackup, "key %x has the wrong size", []byte(k.Pub))
+		}
+		pub = ed25519.PrivateKey(k.Prv).Public().(ed25519.PublicKey)
+	default:
+		return errors.WithDetailf(ErrBadBackup, "unknown key type %q", k.Type)
+	}
+	if !bytes.Equal(pub, k.Pub) {
+		return errors.WithDetailf(ErrBadBackup, "private key doesn't match public key %x", []byte(k.Pub))
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package mockhsm
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"sync"
+
+	"chain/crypto/passphrase"
+	"chain/database/pg"
+	"chain/errors"
+)
+
+// The MockHSM can encrypt the private keys it stores. Each key
+// is encrypted with AES-256-GCM under a random data key. The data
+// key is sealed, as in package passphrase, under a key derived
+// from the passphrase with scrypt, and stored in mockhsm_keyring.
+// Changing the passphrase reseals the data key; the stored keys
+// stay as they are.
+//
+// Until a passphrase is set, keys are stored in plaintext.
+
+var (
+	ErrLocked          = errors.New("mockhsm is locked")
+	ErrEmptyPassphrase = errors.New("passphrase is empty")
+	ErrBadStoredKey    = errors.New("stored key can't be decrypted")
+)
+
+const dataKeySize = 32
+
+// unlocked holds the data keys this process has unlocked,
+// by their sealed form. Every HSM on the same database shares
+// them, so unlocking one unlocks the MockHSM for the process.
+var (
+	unlockedMu sync.Mutex
+	unlocked   = make(map[string][]byte)
+)
+
+// Unlock decrypts the data key with pass, so the HSM can
+// use its stored keys. If no passphrase is set, it sets pass
+// as the passphrase and encrypts the stored keys.
+//
+// It returns passphrase.ErrWrongPassphrase if pass is not
+// the passphrase.
+func (h *HSM) Unlock(ctx context.Context, pass []byte) error {
+	if len(pass) == 0 {
+		return ErrEmptyPassphrase
+	}
+	sealed, err := h.sealedDataKey(ctx)
+	if err != nil {
+		return err
+	}
+	if sealed == nil {
+		return h.setPassphrase(ctx, pass)
+	}
+	dataKey, err := passphrase.Open(sealed, pass)
+	if err != nil {
+		return err
+	}
+	noteUnlocked(sealed, dataKey)
+
+	// Finish encrypting keys, in case setting the passphrase
+	// was interrupted.
+	return h.encryptPlaintextKeys(ctx, dataKey)
+}
+
+// ChangePassphrase changes the passphrase from old to new.
+// If no passphrase is set, old must be empty, and new becomes
+// the passphrase.
+func (h *HSM) ChangePassphrase(ctx context.Context, old, new []byte) error {
+	if len(new) == 0 {
+		return ErrEmptyPassphrase
+	}
+	sealed, err := h.sealedDataKey(ctx)
+	if err != nil {
+		return err
+	}
+	if sealed == nil {
+		if len(old) != 0 {
+			return passphrase.ErrWrongPassphrase
+		}
+		return h.setPassphrase(ctx, new)
+	}
+
+	dataKey, err := passphrase.Open(sealed, old)
+	if err != nil {
+		return err
+	}
+	resealed, err := passphrase.Seal(dataKey, new)
+	if err != nil {
+		return err
+	}
+	const q = `UPDATE mockhsm_keyring SET sealed_key = $1 WHERE sealed_key = $2`
+	res, err := h.db.Exec(ctx, q, resealed, sealed)
+	if err != nil {
+		return errors.Wrap(err, "updating mockhsm keyring")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.New("passphrase changed concurrently")
+	}
+	noteUnlocked(resealed, dataKey)
+	return nil
+}
+
+func (h *HSM) setPassphrase(ctx context.Context, pass []byte) error {
+	dataKey := make([]byte, dataKeySize)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return errors.Wrap(err, "generating data key")
+	}
+	sealed, err := passphrase.Seal(dataKey, pass)
+	if err != nil {
+		return err
+	}
+	const q = `INSERT INTO mockhsm_keyring (sealed_key) VALUES ($1) ON CONFLICT DO NOTHING`
+	res, err := h.db.Exec(ctx, q, sealed)
+	if err != nil {
+		return errors.Wrap(err, "storing mockhsm keyring")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		// Another process set the passphrase first.
+		return h.Unlock(ctx, pass)
+	}
+	noteUnlocked(sealed, dataKey)
+	return h.encryptPlaintextKeys(ctx, dataKey)
+}
+
+// encryptPlaintextKeys encrypts the keys that were
+// stored before the passphrase was set.
+func (h *HSM) encryptPlaintextKeys(ctx context.Context, dataKey []byte) error {
+	var pubs, prvs [][]byte
+	const q = `SELECT pub, prv FROM mockhsm WHERE NOT encrypted`
+	err := pg.ForQueryRows(ctx, h.db, q, func(pub, prv []byte) {
+		pubs = append(pubs, pub)
+		prvs = append(prvs, prv)
+	})
+	if err != nil {
+		return errors.Wrap(err, "reading plaintext keys")
+	}
+	for i, pub := range pubs {
+		sealed, err := encryptKey(dataKey, pub, prvs[i])
+		if err != nil {
+			return err
+		}
+		const q = `UPDATE mockhsm SET prv = $2, encrypted = true WHERE pub = $1 AND NOT encrypted`
+		_, err = h.db.Exec(ctx, q, pub, sealed)
+		if err != nil {
+			return errors.Wrap(err, "encrypting stored key")
+		}
+	}
+	return nil
+}
+
+// dataKey returns the data key, or nil if no passphrase is set.
+// It returns ErrLocked if this process hasn't unlocked it.
+func (h *HSM) dataKey(ctx context.Context) ([]byte, error) {
+	sealed, err := h.sealedDataKey(ctx)
+	if err != nil || sealed == nil {
+		return nil, err
+	}
+	unlockedMu.Lock()
+	defer unlockedMu.Unlock()
+	dataKey, ok := unlocked[string(sealed)]
+	if !ok {
+		return nil, ErrLocked
+	}
+	return dataKey, nil
+}
+
+// sealedDataKey returns the sealed data key,
+// or nil if no passphrase is set.
+func (h *HSM) sealedDataKey(ctx context.Context) ([]byte, error) {
+	var sealed []byte
+	err := h.db.QueryRow(ctx, `SELECT sealed_key FROM mockhsm_keyring`).Scan(&sealed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sealed, errors.Wrap(err, "reading mockhsm keyring")
+}
+
+func noteUnlocked(sealed, dataKey []byte) {
+	unlockedMu.Lock()
+	defer unlockedMu.Unlock()
+	unlocked[string(sealed)] = dataKey
+}
+
+// storedPrv returns prv as it should be stored for pub,
+// encrypted if a passphrase is set.
+func (h *HSM) storedPrv(ctx context.Context, pub, prv []byte) (stored []byte, encrypted bool, err error) {
+	dataKey, err := h.dataKey(ctx)
+	if err != nil || dataKey == nil {
+		return prv, false, err
+	}
+	stored, err = encryptKey(dataKey, pub, prv)
+	return stored, err == nil, err
+}
+
+// openStoredPrv returns the private key for pub
+// from its stored form.
+func (h *HSM) openStoredPrv(ctx context.Context, pub, stored []byte, encrypted bool) ([]byte, error) {
+	if !encrypted {
+		return stored, nil
+	}
+	dataKey, err := h.dataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dataKey == nil {
+		return nil, ErrBadStoredKey
+	}
+	return decryptKey(dataKey, pub, stored)
+}
+
+// encryptKey encrypts prv with dataKey. The result is a nonce
+// followed by the ciphertext. The public key is additional
+// data, so a stored key can't be moved to another row.
+func encryptKey(dataKey, pub, prv []byte) ([]byte, error) {
+	aead, err := newKeyAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading random nonce")
+	}
+	return aead.Seal(nonce, nonce, prv, pub), nil
+}
+
+func decryptKey(dataKey, pub, stored []byte) ([]byte, error) {
+	aead, err := newKeyAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(stored) < aead.NonceSize() {
+		return nil, ErrBadStoredKey
+	}
+	nonce, ciphertext := stored[:aead.NonceSize()], stored[aead.NonceSize():]
+	prv, err := aead.Open(nil, nonce, ciphertext, pub)
+	if err != nil {
+		return nil, ErrBadStoredKey
+	}
+	return prv, nil
+}
+
+func newKeyAEAD(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, errors.Wrap(err)
+}
@@ -71,8 +71,12 @@ func (h *HSM) createChainKDKey(ctx context.Context, alias string, get bool) (*XP
 	if alias != "" {
 		ptrAlias = &alias
 	}
-	const q = `INSERT INTO mockhsm (pub, prv, alias, key_type) VALUES ($1, $2, $3, 'chain_kd')`
-	_, err = h.db.Exec(ctx, q, xpub.Bytes(), xprv.Bytes(), sqlAlias)
+	prv, encrypted, err := h.storedPrv(ctx, xpub.Bytes(), xprv.Bytes())
+	if err != nil {
+		return nil, false, err
+	}
+	const q = `INSERT INTO mockhsm (pub, prv, alias, key_type, encrypted) VALUES ($1, $2, $3, 'chain_kd', $4)`
+	_, err = h.db.Exec(ctx, q, xpub.Bytes(), prv, sqlAlias, encrypted)
 	if err != nil {
 		if pg.IsUniqueViolation(err) {
 			if !get {
@@ -116,8 +120,12 @@ func (h *HSM) createEd25519Key(ctx context.Context, alias string, get bool) (*Pu
 	if alias != "" {
 		ptrAlias = &alias
 	}
-	const q = `INSERT INTO mockhsm (pub, prv, alias, key_type) VALUES ($1, $2, $3, 'ed25519')`
-	_, err = h.db.Exec(ctx, q, []byte(pub), []byte(prv), sqlAlias)
+	stored, encrypted, err := h.storedPrv(ctx, pub, prv)
+	if err != nil {
+		return nil, false, err
+	}
+	const q = `INSERT INTO mockhsm (pub, prv, alias, key_type, encrypted) VALUES ($1, $2, $3, 'ed25519', $4)`
+	_, err = h.db.Exec(ctx, q, []byte(pub), stored, sqlAlias, encrypted)
 	if err != nil {
 		if pg.IsUniqueViolation(err) {
 			if !get {
@@ -203,14 +211,21 @@ func (h *HSM) loadChainKDKey(ctx context.Context, xpub chainkd.XPub) (xprv chain
 		return xprv, nil
 	}
 
-	var b []byte
-	err = h.db.QueryRow(ctx, "SELECT prv FROM mockhsm WHERE pub = $1 AND key_type='chain_kd'", xpub.Bytes()).Scan(&b)
+	var (
+		b         []byte
+		encrypted bool
+	)
+	err = h.db.QueryRow(ctx, "SELECT prv, encrypted FROM mockhsm WHERE pub = $1 AND key_type='chain_kd'", xpub.Bytes()).Scan(&b, &encrypted)
 	if err == sql.ErrNoRows {
 		return xprv, ErrNoKey
 	}
 	if err != nil {
 		return xprv, err
 	}
+	b, err = h.openStoredPrv(ctx, xpub.Bytes(), b, encrypted)
+	if err != nil {
+		return xprv, err
+	}
 	copy(xprv[:], b)
 	h.kdCache[xpub] = xprv
 	return xprv, nil
@@ -248,13 +263,22 @@ func (h *HSM) loadEd25519Key(ctx context.Context, pub ed25519.PublicKey) (prv ed
 		return prv, nil
 	}
 
-	err = h.db.QueryRow(ctx, "SELECT prv FROM mockhsm WHERE pub = $1 AND key_type='ed25519'", []byte(pub)).Scan(&prv)
+	var (
+		b         []byte
+		encrypted bool
+	)
+	err = h.db.QueryRow(ctx, "SELECT prv, encrypted FROM mockhsm WHERE pub = $1 AND key_type='ed25519'", []byte(pub)).Scan(&b, &encrypted)
 	if err == sql.ErrNoRows {
 		return prv, ErrNoKey
 	}
 	if err != nil {
 		return prv, err
 	}
+	b, err = h.openStoredPrv(ctx, pub, b, encrypted)
+	if err != nil {
+		return prv, err
+	}
+	prv = ed25519.PrivateKey(b)
 	h.edCache[pubStr] = prv
 	return prv, nil
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 
 	"chain/crypto/ed25519"
+	"chain/crypto/passphrase"
 	"chain/database/pg/pgtest"
 	"chain/errors"
 	"chain/protocol/bc"
@@ -217,3 +218,227 @@ func BenchmarkSign(b *testing.B) {
 		}
 	}
 }
+
+func TestPassphrase(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	ctx := context.Background()
+	defer forgetUnlocked()
+
+	xpub, err := New(db).XCreate(ctx, "before-passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = New(db).Unlock(ctx, []byte("one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	err = db.QueryRow(ctx, `SELECT count(*) FROM mockhsm WHERE NOT encrypted`).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("got %d plaintext keys after setting a passphrase, want 0", n)
+	}
+
+	pub, err := New(db).Create(ctx, "after-passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new process starts out locked.
+	forgetUnlocked()
+	hsm := New(db)
+	_, err = hsm.XSign(ctx, xpub.XPub, nil, []byte("msg"))
+	if errors.Root(err) != ErrLocked {
+		t.Fatalf("XSign on locked HSM: got error %v, want %v", err, ErrLocked)
+	}
+	_, err = hsm.XCreate(ctx, "")
+	if errors.Root(err) != ErrLocked {
+		t.Fatalf("XCreate on locked HSM: got error %v, want %v", err, ErrLocked)
+	}
+	err = hsm.Unlock(ctx, []byte("two"))
+	if errors.Root(err) != passphrase.ErrWrongPassphrase {
+		t.Fatalf("Unlock with wrong passphrase: got error %v, want %v", err, passphrase.ErrWrongPassphrase)
+	}
+
+	err = hsm.ChangePassphrase(ctx, []byte("one"), []byte("two"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgetUnlocked()
+	hsm = New(db)
+	err = hsm.Unlock(ctx, []byte("one"))
+	if errors.Root(err) != passphrase.ErrWrongPassphrase {
+		t.Fatalf("Unlock with old passphrase: got error %v, want %v", err, passphrase.ErrWrongPassphrase)
+	}
+	err = hsm.Unlock(ctx, []byte("two"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []byte("msg")
+	sig, err := hsm.XSign(ctx, xpub.XPub, nil, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !xpub.XPub.Verify(msg, sig) {
+		t.Error("expected verify to succeed")
+	}
+	bh := bc.BlockHeader{}
+	h := bh.Hash()
+	sig, err = hsm.Sign(ctx, pub.Pub, &bh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(pub.Pub, h[:], sig) {
+		t.Error("expected verify to succeed")
+	}
+}
+
+func TestExportImportKeys(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	ctx := context.Background()
+	defer forgetUnlocked()
+
+	hsm := New(db)
+	err := hsm.Unlock(ctx, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := hsm.XCreate(ctx, "some-alias")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := hsm.Create(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := hsm.ExportKeys(ctx, []byte("backup passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, db2 := pgtest.NewDB(t, pgtest.SchemaPath)
+	hsm2 := New(db2)
+	_, err = hsm2.ImportKeys(ctx, backup, []byte("wrong"))
+	if errors.Root(err) != passphrase.ErrWrongPassphrase {
+		t.Fatalf("ImportKeys with wrong passphrase: got error %v, want %v", err, passphrase.ErrWrongPassphrase)
+	}
+	n, err := hsm2.ImportKeys(ctx, backup, []byte("backup passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("imported %d keys, want 2", n)
+	}
+	n, err = hsm2.ImportKeys(ctx, backup, []byte("backup passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("imported %d keys again, want 0", n)
+	}
+
+	xpubs, _, err := hsm2.ListKeys(ctx, []string{"some-alias"}, "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(xpubs) != 1 || !testutil.DeepEqual(xpubs[0], xpub) {
+		t.Fatalf("ListKeys after import = %v, want [%v]", spew.Sdump(xpubs), spew.Sdump(xpub))
+	}
+	msg := []byte("msg")
+	sig, err := hsm2.XSign(ctx, xpub.XPub, nil, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !xpub.XPub.Verify(msg, sig) {
+		t.Error("expected verify to succeed")
+	}
+	bh := bc.BlockHeader{}
+	h := bh.Hash()
+	sig, err = hsm2.Sign(ctx, pub.Pub, &bh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(pub.Pub, h[:], sig) {
+		t.Error("expected verify to succeed")
+	}
+}
+
+func TestImportKeysDuplicateAlias(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	ctx := context.Background()
+
+	hsm := New(db)
+	_, err := hsm.XCreate(ctx, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = hsm.XCreate(ctx, "taken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := hsm.ExportKeys(ctx, []byte("backup passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second key's alias is in use, so
+	// the first key isn't imported either.
+	_, db2 := pgtest.NewDB(t, pgtest.SchemaPath)
+	hsm2 := New(db2)
+	_, err = hsm2.XCreate(ctx, "taken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = hsm2.ImportKeys(ctx, backup, []byte("backup passphrase"))
+	if errors.Root(err) != ErrDuplicateKeyAlias {
+		t.Fatalf("ImportKeys with a duplicate alias: got error %v, want %v", err, ErrDuplicateKeyAlias)
+	}
+	xpubs, _, err := hsm2.ListKeys(ctx, nil, "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(xpubs) != 1 {
+		t.Errorf("after failed import, got %d keys, want 1", len(xpubs))
+	}
+}
+
+func TestEncryptKey(t *testing.T) {
+	dataKey := make([]byte, dataKeySize)
+	pub, prv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := encryptKey(dataKey, pub, prv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decryptKey(dataKey, pub, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !testutil.DeepEqual(got, []byte(prv)) {
+		t.Errorf("decryptKey = %x, want %x", got, []byte(prv))
+	}
+
+	// A stored key can't be moved to another row.
+	pub2, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = decryptKey(dataKey, pub2, stored)
+	if err != ErrBadStoredKey {
+		t.Errorf("decryptKey with wrong pub: got error %v, want %v", err, ErrBadStoredKey)
+	}
+}
+
+// forgetUnlocked locks the MockHSM again,
+// as if in a new process.
+func forgetUnlocked() {
+	unlockedMu.Lock()
+	defer unlockedMu.Unlock()
+	unlocked = make(map[string][]byte)
+}
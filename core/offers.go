@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/leader"
+	"chain/core/txbuilder"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/validation"
+	"chain/protocol/vm"
+)
+
+// errBadOffer is returned by acceptOffer for offers that
+// don't allow additional actions, or whose signatures don't
+// hold once the counterparty's actions are added.
+var errBadOffer = errors.New("bad offer")
+
+type acceptOfferRequest struct {
+	Offer   *txbuilder.Template      `json:"offer"`
+	Actions []map[string]interface{} `json:"actions"`
+	TTL     chainjson.Duration       `json:"ttl"`
+}
+
+// POST /accept-offer
+//
+// acceptOffer adds the counterparty's actions to a signed offer,
+// made with the offer action, and returns the template for the
+// counterparty to sign and submit.
+func (a *API) acceptOffer(ctx context.Context, req *acceptOfferRequest) (*txbuilder.Template, error) {
+	// As in build, only the leader has the current reservations.
+	if a.leader.State() != leader.Leading {
+		var resp *txbuilder.Template
+		err := a.forwardToLeader(ctx, "/accept-offer", req, &resp)
+		return resp, err
+	}
+
+	if req.Offer == nil || req.Offer.Transaction == nil {
+		return nil, txbuilder.MissingFieldsError("offer")
+	}
+	if !req.Offer.AllowAdditional {
+		return nil, errors.WithDetail(errBadOffer, "offer does not allow additional actions")
+	}
+
+	offer := req.Offer.Transaction
+	base := offer.TxData
+	tpl, err := a.buildSingle(ctx, &buildRequest{
+		Tx:      &base,
+		Actions: req.Actions,
+		TTL:     req.TTL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The offer's inputs are already signed; make sure
+	// their signatures still hold with the new actions.
+	for i := range offer.Inputs {
+		err = vm.Verify(validation.InputVMContext(tpl.Transaction, i))
+		if err != nil {
+			return nil, errors.WithDetailf(errBadOffer, "offer input %d: %s", i, err)
+		}
+	}
+	return tpl, nil
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"chain/core/account"
+	"chain/core/asset"
+	"chain/core/coretest"
+	"chain/core/generator"
+	"chain/core/pin"
+	"chain/core/query"
+	"chain/core/txbuilder"
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+func TestAcceptOffer(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	g := generator.New(c, nil, db)
+	pinStore := pin.NewStore(db)
+	coretest.CreatePins(ctx, t, pinStore)
+	api := &API{
+		chain:     c,
+		submitter: g,
+		assets:    asset.NewRegistry(db, c, pinStore),
+		accounts:  account.NewManager(db, c, pinStore),
+		indexer:   query.NewIndexer(db, c, pinStore),
+		db:        db,
+		leader:    alwaysLeader{},
+	}
+	api.assets.IndexAssets(api.indexer)
+	api.accounts.IndexAccounts(api.indexer)
+	go api.accounts.ProcessBlocks(ctx)
+
+	offered := coretest.CreateAsset(ctx, t, api.assets, nil, "", nil)
+	wanted := coretest.CreateAsset(ctx, t, api.assets, nil, "", nil)
+	maker := coretest.CreateAccount(ctx, t, api.accounts, "", nil)
+	taker := coretest.CreateAccount(ctx, t, api.accounts, "", nil)
+
+	// The maker has 100 of the offered asset, and the taker has
+	// the wanted asset in two outputs of 50, one for each attempt
+	// to take the offer below.
+	offerAmt := bc.AssetAmount{AssetID: offered, Amount: 100}
+	payment := bc.AssetAmount{AssetID: wanted, Amount: 50}
+	issue, err := txbuilder.Build(ctx, nil, []txbuilder.Action{
+		api.assets.NewIssueAction(offerAmt, nil),
+		api.assets.NewIssueAction(bc.AssetAmount{AssetID: wanted, Amount: 100}, nil),
+		api.accounts.NewControlAction(offerAmt, maker, nil),
+		api.accounts.NewControlAction(payment, taker, nil),
+		api.accounts.NewControlAction(payment, taker, nil),
+	}, time.Now().Add(time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	coretest.SignTxTemplate(t, ctx, issue, nil)
+	err = txbuilder.FinalizeTx(ctx, c, g, issue.Transaction)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	prottest.MakeBlock(t, c, g.PendingTxs())
+	<-pinStore.PinWaiter(account.PinName, c.Height())
+
+	offer, err := txbuilder.Build(ctx, nil, []txbuilder.Action{
+		api.accounts.NewOfferAction(offerAmt, payment, maker, nil, nil),
+	}, time.Now().Add(time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	coretest.SignTxTemplate(t, ctx, offer, nil)
+
+	takeReq := func(tpl *txbuilder.Template, pay uint64) *acceptOfferRequest {
+		const actionsFmt = `[
+			{"type": "spend_account", "asset_id": "%s", "amount": %d, "account_id": "%s"},
+			{"type": "control_account", "asset_id": "%s", "amount": 100, "account_id": "%s"}
+		]`
+		req := &acceptOfferRequest{Offer: tpl}
+		err := json.Unmarshal([]byte(fmt.Sprintf(actionsFmt, wanted, pay, taker, offered, taker)), &req.Actions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	// Paying less than the offer asks means changing the
+	// maker's payment output, which breaks the offer's signature.
+	data := offer.Transaction.TxData
+	data.Outputs = append([]*bc.TxOutput(nil), data.Outputs...)
+	cheaper := *data.Outputs[0]
+	cheaper.Amount = 40
+	data.Outputs[0] = &cheaper
+	tampered := &txbuilder.Template{
+		Transaction:         bc.NewTx(data),
+		SigningInstructions: offer.SigningInstructions,
+		AllowAdditional:     true,
+	}
+	_, err = api.acceptOffer(ctx, takeReq(tampered, 40))
+	if errors.Root(err) != errBadOffer {
+		t.Fatalf("acceptOffer(underpaying) error = %v, want %v", err, errBadOffer)
+	}
+
+	tpl, err := api.acceptOffer(ctx, takeReq(offer, 50))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	tx := tpl.Transaction
+	if len(tx.Inputs) != 2 {
+		t.Errorf("got %d inputs, want the offer's and the taker's", len(tx.Inputs))
+	}
+	var gotPayment, gotOffered bool
+	for _, out := range tx.Outputs {
+		switch out.AssetAmount {
+		case payment:
+			gotPayment = true
+		case offerAmt:
+			gotOffered = true
+		}
+	}
+	if !gotPayment || !gotOffered {
+		t.Errorf("outputs = %+v, want payment %+v to maker and %+v to taker", tx.Outputs, payment, offerAmt)
+	}
+
+	coretest.SignTxTemplate(t, ctx, tpl, nil)
+	err = txbuilder.FinalizeTx(ctx, c, g, tpl.Transaction)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	prottest.MakeBlock(t, c, g.PendingTxs())
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"chain/core/account"
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// lookupOutput returns the spend commitment of an unspent
+// output, for reserveOutput.
+// It finds the output in the annotated outputs, so it
+// requires transaction indexing.
+func (a *API) lookupOutput(ctx context.Context, outputID bc.Hash) (*bc.SpendCommitment, error) {
+	const q = `
+		SELECT block_height, tx_pos, output_index FROM annotated_outputs
+		WHERE output_id = $1 AND upper_inf(timespan)
+	`
+	var (
+		height      uint64
+		txPos, outI int
+	)
+	err := a.db.QueryRow(ctx, q, outputID).Scan(&height, &txPos, &outI)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "unspent output %s", outputID)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "looking up output")
+	}
+
+	// The index can lag behind the chain; make sure
+	// the output hasn't been spent since.
+	_, snapshot := a.chain.State()
+	if !snapshot.Tree.Contains(outputID.Bytes()) {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "unspent output %s", outputID)
+	}
+
+	b, err := a.store.GetBlock(ctx, height)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting block")
+	}
+	tx := b.Transactions[txPos]
+	res, out := tx.Results[outI], tx.Outputs[outI]
+	return &bc.SpendCommitment{
+		AssetAmount:    out.AssetAmount,
+		SourceID:       res.SourceID,
+		SourcePosition: res.SourcePos,
+		VMVersion:      out.VMVersion,
+		ControlProgram: out.ControlProgram,
+		RefDataHash:    res.RefDataHash,
+	}, nil
+}
+
+// outputReservation is an in-memory reservation of a
+// contract output, made by reserveOutput.
+type outputReservation struct {
+	expiry time.Time
+}
+
+// reserveOutput reserves an unspent contract output until exp,
+// for the actions that spend contract outputs, and returns its
+// spend commitment. Contract outputs don't belong to an account,
+// so the account reserver doesn't track them.
+func (a *API) reserveOutput(ctx context.Context, outputID bc.Hash, exp time.Time) (*bc.SpendCommitment, func(), error) {
+	sc, err := a.lookupOutput(ctx, outputID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	a.outputsMu.Lock()
+	defer a.outputsMu.Unlock()
+	if a.reservedOutputs == nil {
+		a.reservedOutputs = make(map[bc.Hash]*outputReservation)
+	}
+	now := time.Now()
+	for id, res := range a.reservedOutputs {
+		if res.expiry.Before(now) {
+			delete(a.reservedOutputs, id)
+		}
+	}
+	if _, ok := a.reservedOutputs[outputID]; ok {
+		return nil, nil, errors.WithDetailf(account.ErrReserved, "output %s", outputID)
+	}
+	res := &outputReservation{expiry: exp}
+	a.reservedOutputs[outputID] = res
+
+	cancel := func() {
+		a.outputsMu.Lock()
+		defer a.outputsMu.Unlock()
+		// The reservation may have expired and
+		// been replaced by another build's.
+		if a.reservedOutputs[outputID] == res {
+			delete(a.reservedOutputs, outputID)
+		}
+	}
+	return sc, cancel, nil
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/generator"
+	"chain/core/leader"
+	"chain/core/query"
+	"chain/errors"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+)
+
+var errNoGenerator = errors.New("this core is not a generator")
+
+type txStatusReq struct {
+	ID bc.Hash `json:"id"`
+}
+
+// POST /get-transaction-status
+func (a *API) getTxStatus(ctx context.Context, in txStatusReq) (*generator.TxStatus, error) {
+	if a.leader.State() != leader.Leading {
+		var resp generator.TxStatus
+		err := a.forwardToLeader(ctx, "/get-transaction-status", in, &resp)
+		return &resp, err
+	}
+	return a.txStatus(ctx, in.ID)
+}
+
+// txStatus asks the generator, local or remote,
+// for the status of the transaction with the given ID.
+func (a *API) txStatus(ctx context.Context, id bc.Hash) (*generator.TxStatus, error) {
+	if a.generator != nil {
+		return a.generator.TxStatus(id), nil
+	}
+	if a.remoteGenerator == nil {
+		return nil, errNoGenerator
+	}
+	var resp generator.TxStatus
+	err := a.remoteGenerator.Call(ctx, networkRPCPrefix+"get-transaction-status", id, &resp)
+	if err != nil {
+		return nil, errors.Wrap(err, "generator transaction status")
+	}
+	return &resp, nil
+}
+
+// POST /list-pending-transactions
+func (a *API) listPendingTxs(ctx context.Context, in requestQuery) (page, error) {
+	if a.leader.State() != leader.Leading {
+		var resp page
+		err := a.forwardToLeader(ctx, "/list-pending-transactions", in, &resp)
+		return resp, err
+	}
+
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+
+	var after bc.Hash
+	if in.After != "" {
+		err := after.UnmarshalText([]byte(in.After))
+		if err != nil {
+			return page{}, errors.Sub(query.ErrBadAfter, err)
+		}
+	}
+
+	var txs []*generator.PendingTx
+	if a.generator != nil {
+		txs = a.generator.ListPendingTxs(after, limit)
+	} else {
+		req := pendingTxsReq{After: after, Limit: limit}
+		err := a.remoteGenerator.Call(ctx, networkRPCPrefix+"list-pending-transactions", req, &txs)
+		if err != nil {
+			return page{}, errors.Wrap(err, "generator pending transactions")
+		}
+	}
+
+	out := in
+	if len(txs) > 0 {
+		out.After = txs[len(txs)-1].ID.String()
+	}
+	return page{
+		Items:    httpjson.Array(txs),
+		LastPage: len(txs) < limit,
+		Next:     out,
+	}, nil
+}
+
+type pendingTxsReq struct {
+	After bc.Hash `json:"after"`
+	Limit int     `json:"limit"`
+}
+
+func (a *API) getTxStatusRPC(ctx context.Context, id bc.Hash) (*generator.TxStatus, error) {
+	if a.generator == nil {
+		return nil, errNoGenerator
+	}
+	return a.generator.TxStatus(id), nil
+}
+
+func (a *API) listPendingTxsRPC(ctx context.Context, in pendingTxsReq) ([]*generator.PendingTx, error) {
+	if a.generator == nil {
+		return nil, errNoGenerator
+	}
+	return a.generator.ListPendingTxs(in.After, in.Limit), nil
+}
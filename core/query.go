@@ -3,11 +3,13 @@ package core
 import (
 	"context"
 	"math"
+	"time"
 
 	"chain/core/query"
 	"chain/core/query/filter"
 	"chain/errors"
 	"chain/net/http/httpjson"
+	"chain/protocol/bc"
 )
 
 // listAccounts is an http handler for listing accounts matching
@@ -81,20 +83,96 @@ func (a *API) listBalances(ctx context.Context, in requestQuery) (result page, e
 		sumBy = append(sumBy, f)
 	}
 
-	timestampMS := in.TimestampMS
-	if timestampMS == 0 {
-		timestampMS = math.MaxInt64
-	} else if timestampMS > math.MaxInt64 {
-		return result, errors.WithDetail(httpjson.ErrBadRequest, "timestamp is too large")
+	timestampMS, err := pointInTime(in)
+	if err != nil {
+		return result, err
 	}
 
-	// TODO(jackson): paginate this endpoint.
-	balances, err := a.indexer.Balances(ctx, in.Filter, in.FilterParams, sumBy, timestampMS)
+	var after query.BalancesAfter
+	if in.After != "" {
+		after, err = query.DecodeBalancesAfter(in.After, len(sumBy))
+		if err != nil {
+			return result, err
+		}
+	}
+
+	limit := in.PageSize
+	if limit == 0 {
+		limit = defGenericPageSize
+	}
+
+	balances, newAfter, err := a.indexer.Balances(ctx, in.Filter, in.FilterParams, sumBy, timestampMS, in.AsOfHeight, after, limit)
 	if err != nil {
 		return result, err
 	}
 
+	out := in
+	if newAfter != nil {
+		out.After = newAfter.String()
+	}
 	result.Items = httpjson.Array(balances)
+	result.LastPage = len(balances) < limit
+	result.Next = out
+	return result, nil
+}
+
+// bucketIntervals maps the values of the bucket_interval
+// parameter to their lengths in milliseconds.
+var bucketIntervals = map[string]uint64{
+	"hour": uint64(time.Hour / time.Millisecond),
+	"day":  uint64(24 * time.Hour / time.Millisecond),
+	"week": uint64(7 * 24 * time.Hour / time.Millisecond),
+}
+
+// maxBalanceHistoryBuckets limits the number of points
+// in time a single balance history request can cover.
+const maxBalanceHistoryBuckets = 1000
+
+// POST /list-balance-history
+func (a *API) listBalanceHistory(ctx context.Context, in requestQuery) (result page, err error) {
+	var sumBy []filter.Field
+
+	// As with /list-balances, default to grouping by asset.
+	if len(in.SumBy) == 0 {
+		in.SumBy = []string{"asset_alias", "asset_id"}
+	}
+
+	for _, field := range in.SumBy {
+		f, err := filter.ParseField(field)
+		if err != nil {
+			return result, err
+		}
+		sumBy = append(sumBy, f)
+	}
+
+	intervalMS, ok := bucketIntervals[in.BucketInterval]
+	if !ok {
+		return result, errors.WithDetail(httpjson.ErrBadRequest, "bucket_interval must be hour, day or week")
+	}
+
+	endTimeMS := in.EndTimeMS
+	if endTimeMS == 0 {
+		endTimeMS = bc.Millis(time.Now())
+	}
+	if in.StartTimeMS == 0 {
+		return result, errors.WithDetail(httpjson.ErrBadRequest, "start_time is required")
+	}
+	if endTimeMS > math.MaxInt64 {
+		return result, errors.WithDetail(httpjson.ErrBadRequest, "end_time is too large")
+	}
+	if in.StartTimeMS > endTimeMS {
+		return result, errors.WithDetail(httpjson.ErrBadRequest, "start_time is after end_time")
+	}
+	if (endTimeMS-in.StartTimeMS)/intervalMS >= maxBalanceHistoryBuckets {
+		return result, errors.WithDetailf(httpjson.ErrBadRequest, "time range covers more than %d buckets", maxBalanceHistoryBuckets)
+	}
+
+	buckets, err := a.indexer.BalanceHistory(ctx, in.Filter, in.FilterParams, sumBy, in.StartTimeMS, endTimeMS, intervalMS)
+	if err != nil {
+		return result, err
+	}
+
+	result.Items = httpjson.Array(buckets)
 	result.LastPage = true
 	result.Next = in
 	return result, nil
@@ -192,13 +270,11 @@ func (a *API) listUnspentOutputs(ctx context.Context, in requestQuery) (result p
 		}
 	}
 
-	timestampMS := in.TimestampMS
-	if timestampMS == 0 {
-		timestampMS = math.MaxInt64
-	} else if timestampMS > math.MaxInt64 {
-		return result, errors.WithDetail(httpjson.ErrBadRequest, "timestamp is too large")
+	timestampMS, err := pointInTime(in)
+	if err != nil {
+		return result, err
 	}
-	outputs, nextAfter, err := a.indexer.Outputs(ctx, in.Filter, in.FilterParams, timestampMS, after, limit)
+	outputs, nextAfter, err := a.indexer.Outputs(ctx, in.Filter, in.FilterParams, timestampMS, in.AsOfHeight, after, limit)
 	if err != nil {
 		return result, errors.Wrap(err, "querying outputs")
 	}
@@ -211,3 +287,23 @@ func (a *API) listUnspentOutputs(ctx context.Context, in requestQuery) (result p
 		Next:     outQuery,
 	}, nil
 }
+
+// pointInTime validates the timestamp and as_of_height parameters
+// of a point-in-time query and returns the timestamp to query at.
+// If neither is set, the query is for the current state.
+func pointInTime(in requestQuery) (timestampMS uint64, err error) {
+	if in.TimestampMS != 0 && in.AsOfHeight != 0 {
+		return 0, errors.WithDetail(httpjson.ErrBadRequest, "timestamp and as_of_height cannot both be set")
+	}
+	if in.AsOfHeight > math.MaxInt64 {
+		return 0, errors.WithDetail(httpjson.ErrBadRequest, "as_of_height is too large")
+	}
+
+	timestampMS = in.TimestampMS
+	if timestampMS == 0 {
+		timestampMS = math.MaxInt64
+	} else if timestampMS > math.MaxInt64 {
+		return 0, errors.WithDetail(httpjson.ErrBadRequest, "timestamp is too large")
+	}
+	return timestampMS, nil
+}
@@ -21,7 +21,7 @@ func (ind *Indexer) SaveAnnotatedAccount(ctx context.Context, account *Annotated
 	const q = `
 		INSERT INTO annotated_accounts (id, alias, keys, quorum, tags)
 		VALUES($1, $2, $3::jsonb, $4, $5::jsonb)
-		ON CONFLICT (id) DO UPDATE SET tags = $5::jsonb
+		ON CONFLICT (id) DO UPDATE SET keys = $3::jsonb, quorum = $4, tags = $5::jsonb
 	`
 	_, err = ind.db.Exec(ctx, q, account.ID, account.Alias, keysJSON,
 		account.Quorum, string(*account.Tags))
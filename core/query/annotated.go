@@ -9,6 +9,7 @@ import (
 	"chain/crypto/ed25519/chainkd"
 	chainjson "chain/encoding/json"
 	"chain/protocol/bc"
+	"chain/protocol/vm"
 	"chain/protocol/vmutil"
 )
 
@@ -22,6 +23,16 @@ type AnnotatedTx struct {
 	IsLocal       Bool               `json:"is_local"`
 	Inputs        []*AnnotatedInput  `json:"inputs"`
 	Outputs       []*AnnotatedOutput `json:"outputs"`
+	Trades        []*AnnotatedTrade  `json:"trades,omitempty"`
+}
+
+// AnnotatedTrade describes an offer that a transaction
+// executed: an input signed with a predicate requiring
+// outputs of the transaction, rather than committing to
+// the whole transaction, which another party added to.
+type AnnotatedTrade struct {
+	InputPosition   uint32   `json:"input_position"`
+	OutputPositions []uint32 `json:"output_positions"`
 }
 
 type AnnotatedInput struct {
@@ -60,6 +71,17 @@ type AnnotatedOutput struct {
 	ControlProgram  chainjson.HexBytes `json:"control_program"`
 	ReferenceData   *json.RawMessage   `json:"reference_data"`
 	IsLocal         Bool               `json:"is_local"`
+	Contract        *AnnotatedContract `json:"contract,omitempty"`
+}
+
+// AnnotatedContract describes the terms of an output's
+// contract control program, if it has one.
+type AnnotatedContract struct {
+	Type    string               `json:"type"`
+	Pubkeys []chainjson.HexBytes `json:"pubkeys"`
+	Quorum  int                  `json:"quorum"`
+	MinTime *time.Time           `json:"min_time,omitempty"`
+	Hash    chainjson.HexBytes   `json:"hash,omitempty"`
 }
 
 type AnnotatedAccount struct {
@@ -134,9 +156,56 @@ func buildAnnotatedTransaction(orig *bc.Tx, b *bc.Block, indexInBlock uint32) *A
 	for i := range orig.Outputs {
 		tx.Outputs = append(tx.Outputs, buildAnnotatedOutput(orig, uint32(i)))
 	}
+	for i, in := range orig.Inputs {
+		positions, ok := offerOutputs(in)
+		if ok && len(positions) < len(orig.Outputs) {
+			tx.Trades = append(tx.Trades, &AnnotatedTrade{
+				InputPosition:   uint32(i),
+				OutputPositions: positions,
+			})
+		}
+	}
 	return tx
 }
 
+// offerOutputs reports whether in was signed as an offer,
+// with a predicate that requires outputs of the transaction
+// (using CHECKOUTPUT) rather than committing to its sighash,
+// and if so returns the positions of the required outputs.
+func offerOutputs(in *bc.TxInput) ([]uint32, bool) {
+	if in.IsIssuance() {
+		return nil, false
+	}
+	_, _, err := vmutil.ParseP2SPMultiSigProgram(in.ControlProgram())
+	args := in.Arguments()
+	if err != nil || len(args) == 0 {
+		return nil, false
+	}
+	// The predicate is the last argument of a P2SP program.
+	insts, err := vm.ParseProgram(args[len(args)-1])
+	if err != nil {
+		return nil, false
+	}
+	var positions []uint32
+	for i, inst := range insts {
+		switch inst.Op {
+		case vm.OP_TXSIGHASH:
+			return nil, false
+		case vm.OP_CHECKOUTPUT:
+			// Expected: <index> <refdatahash> <amount> <asset> <vmversion> <program> CHECKOUTPUT
+			if i < 6 {
+				return nil, false
+			}
+			n, err := vm.AsInt64(insts[i-6].Data)
+			if err != nil || n < 0 {
+				return nil, false
+			}
+			positions = append(positions, uint32(n))
+		}
+	}
+	return positions, len(positions) > 0
+}
+
 func buildAnnotatedInput(tx *bc.Tx, i uint32) *AnnotatedInput {
 	orig := tx.Inputs[i]
 	in := &AnnotatedInput{
@@ -187,9 +256,32 @@ func buildAnnotatedOutput(tx *bc.Tx, idx uint32) *AnnotatedOutput {
 	} else {
 		out.Type = "control"
 	}
+	out.Contract = buildAnnotatedContract(out.ControlProgram)
 	return out
 }
 
+// buildAnnotatedContract returns the terms of the contract
+// in prog, or nil if prog isn't a contract program.
+func buildAnnotatedContract(prog []byte) *AnnotatedContract {
+	c, err := vmutil.ParseContractProgram(prog)
+	if err != nil {
+		return nil
+	}
+	ac := &AnnotatedContract{
+		Type:   c.Type,
+		Quorum: c.Quorum,
+		Hash:   c.Hash,
+	}
+	for _, pub := range c.Pubkeys {
+		ac.Pubkeys = append(ac.Pubkeys, chainjson.HexBytes(pub))
+	}
+	if c.Type == vmutil.TimeLockContract {
+		t := time.Unix(0, int64(c.MinTimeMS)*int64(time.Millisecond)).UTC()
+		ac.MinTime = &t
+	}
+	return ac
+}
+
 // localAnnotator depends on the asset and account annotators and
 // must be run after them.
 func localAnnotator(ctx context.Context, txs []*AnnotatedTx) {
@@ -0,0 +1,54 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"chain/crypto/ed25519"
+	"chain/protocol/bc"
+	"chain/protocol/vm"
+	"chain/protocol/vmutil"
+)
+
+func TestTradeAnnotations(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := vmutil.P2SPMultiSigProgram([]ed25519.PublicKey{pub}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asset := bc.AssetID{1}
+	offer, err := vm.Assemble(fmt.Sprintf("1 0 5 0x%x 1 0x51 CHECKOUTPUT", asset[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sighash, err := vm.Assemble("0x00 TXSIGHASH EQUAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		predicate []byte
+		outputs   int
+		want      []*AnnotatedTrade
+	}{
+		{offer, 2, []*AnnotatedTrade{{InputPosition: 0, OutputPositions: []uint32{1}}}},
+		{offer, 1, nil}, // nothing added to the offer
+		{sighash, 2, nil},
+	}
+	for i, c := range cases {
+		in := bc.NewSpendInput([][]byte{vm.Int64Bytes(0), []byte("sig"), c.predicate}, bc.Hash{}, asset, 5, 0, prog, bc.Hash{}, nil)
+		var outs []*bc.TxOutput
+		for j := 0; j < c.outputs; j++ {
+			outs = append(outs, bc.NewTxOutput(asset, 5, []byte{byte(vm.OP_TRUE)}, nil))
+		}
+		tx := bc.NewTx(bc.TxData{Version: 1, Inputs: []*bc.TxInput{in}, Outputs: outs})
+		got := buildAnnotatedTransaction(tx, &bc.Block{}, 0).Trades
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d: trades = %v want %v", i, got, c.want)
+		}
+	}
+}
@@ -3,8 +3,11 @@ package query
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/lib/pq"
 
@@ -12,30 +15,71 @@ import (
 	"chain/errors"
 )
 
+// BalancesAfter is a cursor into the results of a balances
+// query. It holds the sum_by values of the last balance returned,
+// with nil for null values.
+type BalancesAfter []*string
+
+func (cur BalancesAfter) String() string {
+	b, _ := json.Marshal([]*string(cur))
+	return string(b)
+}
+
+// DecodeBalancesAfter decodes a cursor for a
+// balances query grouped by n sum_by fields.
+func DecodeBalancesAfter(str string, n int) (BalancesAfter, error) {
+	var cur []*string
+	err := json.Unmarshal([]byte(str), &cur)
+	if err != nil {
+		return nil, errors.Sub(ErrBadAfter, err)
+	}
+	if len(cur) != n {
+		return nil, errors.WithDetailf(ErrBadAfter, "cursor has %d sum_by values, want %d", len(cur), n)
+	}
+	return BalancesAfter(cur), nil
+}
+
 // Balances performs a balances query against the annotated_outputs.
-func (ind *Indexer) Balances(ctx context.Context, filt string, vals []interface{}, sumBy []filter.Field, timestampMS uint64) ([]interface{}, error) {
+// It sums the outputs unspent at timestampMS or, if asOfHeight is
+// nonzero, the outputs unspent after the block at height asOfHeight.
+//
+// If limit is nonzero, it returns at most limit balances, ordered
+// by their sum_by values and starting after the cursor after, if
+// set, along with the cursor for the next page.
+func (ind *Indexer) Balances(ctx context.Context, filt string, vals []interface{}, sumBy []filter.Field, timestampMS, asOfHeight uint64, after BalancesAfter, limit int) ([]interface{}, BalancesAfter, error) {
+	if asOfHeight > 0 {
+		var err error
+		timestampMS, err = ind.heightTimestamp(ctx, asOfHeight)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	p, err := filter.Parse(filt, outputsTable, vals)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if len(vals) != p.Parameters {
-		return nil, ErrParameterCountMismatch
+		return nil, nil, ErrParameterCountMismatch
 	}
 	expr, err := filter.AsSQL(p, outputsTable, vals)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	queryStr, queryArgs, err := constructBalancesQuery(expr, vals, sumBy, timestampMS)
+	queryStr, queryArgs, err := constructBalancesQuery(expr, vals, sumBy, timestampMS, asOfHeight, after, limit)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	rows, err := ind.db.Query(ctx, queryStr, queryArgs...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
-	var balances []interface{}
+	var (
+		balances []interface{}
+		newAfter = after
+	)
 	for rows.Next() {
 		// balance and groupings will hold the output of the row scan
 		var balance uint64
@@ -47,12 +91,14 @@ func (ind *Indexer) Balances(ctx context.Context, filt string, vals []interface{
 		}
 		err := rows.Scan(scanArguments...)
 		if err != nil {
-			return nil, errors.Wrap(err, "scanning balance row")
+			return nil, nil, errors.Wrap(err, "scanning balance row")
 		}
 
 		sumByValues := map[string]interface{}{}
+		newAfter = make(BalancesAfter, 0, len(sumBy))
 		for i, f := range sumBy {
 			sumByValues[f.String()] = scanArguments[i+1]
+			newAfter = append(newAfter, *scanArguments[i+1].(**string))
 		}
 		// This struct enforces JSON field ordering in API output.
 		item := struct {
@@ -66,11 +112,18 @@ func (ind *Indexer) Balances(ctx context.Context, filt string, vals []interface{
 		}
 		balances = append(balances, item)
 	}
-	return balances, errors.Wrap(rows.Err())
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, errors.Wrap(err)
+	}
+	return balances, newAfter, nil
 }
 
-func constructBalancesQuery(expr string, vals []interface{}, sumBy []filter.Field, timestampMS uint64) (string, []interface{}, error) {
-	var buf bytes.Buffer
+func constructBalancesQuery(expr string, vals []interface{}, sumBy []filter.Field, timestampMS, asOfHeight uint64, after BalancesAfter, limit int) (string, []interface{}, error) {
+	var (
+		buf       bytes.Buffer
+		fieldSQLs []string
+	)
 
 	buf.WriteString("SELECT COALESCE(SUM(amount), 0)")
 	for _, field := range sumBy {
@@ -78,6 +131,7 @@ func constructBalancesQuery(expr string, vals []interface{}, sumBy []filter.Fiel
 		if err != nil {
 			return "", nil, err
 		}
+		fieldSQLs = append(fieldSQLs, fieldSQL)
 
 		buf.WriteString(", ")
 		buf.WriteString(fieldSQL)
@@ -91,9 +145,33 @@ func constructBalancesQuery(expr string, vals []interface{}, sumBy []filter.Fiel
 		buf.WriteString(") AND ")
 	}
 
-	vals = append(vals, timestampMS)
-	timestampValIndex := len(vals)
-	buf.WriteString(fmt.Sprintf("timespan @> $%d::int8", timestampValIndex))
+	vals = writeUnspentCond(&buf, vals, timestampMS, asOfHeight)
+
+	// Pages are ordered by the sum_by values, with nulls first.
+	// Each value contributes a pair of sort keys, so that null
+	// and the empty string stay distinct.
+	paginate := limit > 0 && len(sumBy) > 0
+	var sortKeys []string
+	for _, fieldSQL := range fieldSQLs {
+		sortKeys = append(sortKeys,
+			fmt.Sprintf("(%s) IS NOT NULL", fieldSQL),
+			fmt.Sprintf("COALESCE((%s)::text, '')", fieldSQL),
+		)
+	}
+	if paginate && after != nil {
+		var params []string
+		for _, v := range after {
+			vals = append(vals, v != nil)
+			params = append(params, fmt.Sprintf("$%d::boolean", len(vals)))
+			var s string
+			if v != nil {
+				s = *v
+			}
+			vals = append(vals, s)
+			params = append(params, fmt.Sprintf("$%d::text", len(vals)))
+		}
+		buf.WriteString(fmt.Sprintf(" AND (%s) > (%s)", strings.Join(sortKeys, ", "), strings.Join(params, ", ")))
+	}
 
 	if len(sumBy) > 0 {
 		buf.WriteString(" GROUP BY ")
@@ -104,6 +182,127 @@ func constructBalancesQuery(expr string, vals []interface{}, sumBy []filter.Fiel
 			buf.WriteString(strconv.Itoa(i + 2)) // 1-indexed, skipping first col
 		}
 	}
-	// TODO(jackson): Support pagination.
+	if paginate {
+		buf.WriteString(" ORDER BY ")
+		buf.WriteString(strings.Join(sortKeys, ", "))
+		buf.WriteString(fmt.Sprintf(" LIMIT %d", limit))
+	}
+	return buf.String(), vals, nil
+}
+
+// BalanceBucket holds the balances at one point of a balance history.
+type BalanceBucket struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Balances  []interface{} `json:"balances"`
+}
+
+// BalanceHistory performs a balances query against the
+// annotated_outputs at a series of points in time, starting at
+// startMS and every intervalMS thereafter, up to and including
+// endMS. The balances at each point are those a balances query
+// with that timestamp would return. All points are computed
+// in a single query.
+func (ind *Indexer) BalanceHistory(ctx context.Context, filt string, vals []interface{}, sumBy []filter.Field, startMS, endMS, intervalMS uint64) ([]*BalanceBucket, error) {
+	p, err := filter.Parse(filt, outputsTable, vals)
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) != p.Parameters {
+		return nil, ErrParameterCountMismatch
+	}
+	expr, err := filter.AsSQL(p, outputsTable, vals)
+	if err != nil {
+		return nil, err
+	}
+	queryStr, queryArgs, err := constructBalanceHistoryQuery(expr, vals, sumBy, startMS, endMS, intervalMS)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ind.db.Query(ctx, queryStr, queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []*BalanceBucket
+	for rows.Next() {
+		var (
+			timestampMS uint64
+			count       uint64
+			balance     uint64
+		)
+		scanArguments := make([]interface{}, 0, len(sumBy)+3)
+		scanArguments = append(scanArguments, &timestampMS, &count, &balance)
+		for range sumBy {
+			scanArguments = append(scanArguments, new(*string))
+		}
+		err := rows.Scan(scanArguments...)
+		if err != nil {
+			return nil, errors.Wrap(err, "scanning balance history row")
+		}
+
+		t := time.Unix(0, int64(timestampMS)*int64(time.Millisecond)).UTC()
+		if len(buckets) == 0 || !buckets[len(buckets)-1].Timestamp.Equal(t) {
+			buckets = append(buckets, &BalanceBucket{Timestamp: t, Balances: []interface{}{}})
+		}
+		if count == 0 && len(sumBy) > 0 {
+			// No outputs at this point in time, so no groups.
+			continue
+		}
+
+		sumByValues := map[string]interface{}{}
+		for i, f := range sumBy {
+			sumByValues[f.String()] = scanArguments[i+3]
+		}
+		item := struct {
+			SumBy  map[string]interface{} `json:"sum_by,omitempty"`
+			Amount uint64                 `json:"amount"`
+		}{
+			Amount: balance,
+		}
+		if len(sumByValues) > 0 {
+			item.SumBy = sumByValues
+		}
+		b := buckets[len(buckets)-1]
+		b.Balances = append(b.Balances, item)
+	}
+	return buckets, errors.Wrap(rows.Err())
+}
+
+func constructBalanceHistoryQuery(expr string, vals []interface{}, sumBy []filter.Field, startMS, endMS, intervalMS uint64) (string, []interface{}, error) {
+	var buf bytes.Buffer
+
+	buf.WriteString("SELECT bucket.t, COUNT(out.output_id), COALESCE(SUM(out.amount), 0)")
+	for _, field := range sumBy {
+		fieldSQL, err := filter.FieldAsSQL(outputsTable, field)
+		if err != nil {
+			return "", nil, err
+		}
+
+		buf.WriteString(", ")
+		buf.WriteString(fieldSQL)
+	}
+
+	vals = append(vals, startMS, endMS, intervalMS)
+	n := len(vals)
+	buf.WriteString(fmt.Sprintf(" FROM generate_series($%d::int8, $%d::int8, $%d::int8) AS bucket(t)", n-2, n-1, n))
+
+	// A left join keeps the points in time with no matching outputs.
+	buf.WriteString(" LEFT JOIN ")
+	buf.WriteString(pq.QuoteIdentifier("annotated_outputs"))
+	buf.WriteString(" AS out ON ")
+	if len(expr) > 0 {
+		buf.WriteString("(")
+		buf.WriteString(expr)
+		buf.WriteString(") AND ")
+	}
+	buf.WriteString("out.timespan @> bucket.t")
+
+	buf.WriteString(" GROUP BY 1")
+	for i := range sumBy {
+		buf.WriteString(", ")
+		buf.WriteString(strconv.Itoa(i + 4)) // 1-indexed, skipping the first 3 cols
+	}
+	buf.WriteString(" ORDER BY 1")
 	return buf.String(), vals, nil
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"chain/core/query/filter"
+	"chain/errors"
 	"chain/testutil"
 )
 
@@ -13,6 +14,9 @@ func TestConstructBalancesQuery(t *testing.T) {
 		predicate  string
 		sumBy      []string
 		values     []interface{}
+		asOfHeight uint64
+		after      BalancesAfter
+		limit      int
 		wantQuery  string
 		wantValues []interface{}
 	}{
@@ -42,6 +46,110 @@ func TestConstructBalancesQuery(t *testing.T) {
 			wantQuery:  `SELECT COALESCE(SUM(amount), 0), out."asset_tags"->>'currency' FROM "annotated_outputs" AS out WHERE (out."account_id" = $1) AND timespan @> $2::int8 GROUP BY 2`,
 			wantValues: []interface{}{`foo`, now},
 		},
+		{
+			predicate:  "account_id = $1",
+			sumBy:      []string{"asset_id"},
+			values:     []interface{}{"abc"},
+			asOfHeight: 7,
+			wantQuery:  `SELECT COALESCE(SUM(amount), 0), encode(out."asset_id", 'hex') FROM "annotated_outputs" AS out WHERE (out."account_id" = $1) AND block_height <= $3 AND (upper_inf(timespan) OR upper(timespan) > $2::int8 OR (upper(timespan) = $2::int8 AND NOT EXISTS (SELECT 1 FROM annotated_inputs AS inp JOIN annotated_txs AS tx ON tx.tx_hash = inp.tx_hash WHERE inp.spent_output_id = out.output_id AND tx.block_height <= $3))) GROUP BY 2`,
+			wantValues: []interface{}{`abc`, now, uint64(7)},
+		},
+		{
+			predicate:  "account_id = $1",
+			sumBy:      []string{"asset_tags.currency"},
+			values:     []interface{}{"foo"},
+			limit:      10,
+			wantQuery:  `SELECT COALESCE(SUM(amount), 0), out."asset_tags"->>'currency' FROM "annotated_outputs" AS out WHERE (out."account_id" = $1) AND timespan @> $2::int8 GROUP BY 2 ORDER BY (out."asset_tags"->>'currency') IS NOT NULL, COALESCE((out."asset_tags"->>'currency')::text, '') LIMIT 10`,
+			wantValues: []interface{}{`foo`, now},
+		},
+		{
+			sumBy:      []string{"asset_id", "asset_tags.currency"},
+			after:      BalancesAfter{strPtr("abcd"), nil},
+			limit:      10,
+			wantQuery:  `SELECT COALESCE(SUM(amount), 0), encode(out."asset_id", 'hex'), out."asset_tags"->>'currency' FROM "annotated_outputs" AS out WHERE timespan @> $1::int8 AND ((encode(out."asset_id", 'hex')) IS NOT NULL, COALESCE((encode(out."asset_id", 'hex'))::text, ''), (out."asset_tags"->>'currency') IS NOT NULL, COALESCE((out."asset_tags"->>'currency')::text, '')) > ($2::boolean, $3::text, $4::boolean, $5::text) GROUP BY 2, 3 ORDER BY (encode(out."asset_id", 'hex')) IS NOT NULL, COALESCE((encode(out."asset_id", 'hex'))::text, ''), (out."asset_tags"->>'currency') IS NOT NULL, COALESCE((out."asset_tags"->>'currency')::text, '') LIMIT 10`,
+			wantValues: []interface{}{now, true, "abcd", false, ""},
+		},
+	}
+
+	for i, tc := range testCases {
+		p, err := filter.Parse(tc.predicate, outputsTable, tc.values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr, err := filter.AsSQL(p, outputsTable, tc.values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields []filter.Field
+		for _, s := range tc.sumBy {
+			f, err := filter.ParseField(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields = append(fields, f)
+		}
+
+		query, values, err := constructBalancesQuery(expr, tc.values, fields, now, tc.asOfHeight, tc.after, tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query != tc.wantQuery {
+			t.Errorf("case %d: got\n%s\nwant\n%s", i, query, tc.wantQuery)
+		}
+		if !testutil.DeepEqual(values, tc.wantValues) {
+			t.Errorf("case %d: got %#v, want %#v", i, values, tc.wantValues)
+		}
+	}
+}
+
+func TestDecodeBalancesAfter(t *testing.T) {
+	cases := []struct {
+		str     string
+		n       int
+		want    BalancesAfter
+		wantErr error
+	}{
+		{str: `["a",null]`, n: 2, want: BalancesAfter{strPtr("a"), nil}},
+		{str: `["a",null]`, n: 1, wantErr: ErrBadAfter},
+		{str: `a:b`, n: 2, wantErr: ErrBadAfter},
+	}
+	for _, c := range cases {
+		got, err := DecodeBalancesAfter(c.str, c.n)
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("DecodeBalancesAfter(%q, %d) error = %v want %v", c.str, c.n, err, c.wantErr)
+			continue
+		}
+		if !testutil.DeepEqual(got, c.want) {
+			t.Errorf("DecodeBalancesAfter(%q, %d) = %v want %v", c.str, c.n, got, c.want)
+		}
+		if err == nil && got.String() != c.str {
+			t.Errorf("String() = %s want %s", got.String(), c.str)
+		}
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestConstructBalanceHistoryQuery(t *testing.T) {
+	start, end, interval := uint64(1000), uint64(5000), uint64(2000)
+	testCases := []struct {
+		predicate  string
+		sumBy      []string
+		values     []interface{}
+		wantQuery  string
+		wantValues []interface{}
+	}{
+		{
+			wantQuery:  `SELECT bucket.t, COUNT(out.output_id), COALESCE(SUM(out.amount), 0) FROM generate_series($1::int8, $2::int8, $3::int8) AS bucket(t) LEFT JOIN "annotated_outputs" AS out ON out.timespan @> bucket.t GROUP BY 1 ORDER BY 1`,
+			wantValues: []interface{}{start, end, interval},
+		},
+		{
+			predicate:  "account_id = $1",
+			sumBy:      []string{"asset_id", "asset_tags.currency"},
+			values:     []interface{}{"abc"},
+			wantQuery:  `SELECT bucket.t, COUNT(out.output_id), COALESCE(SUM(out.amount), 0), encode(out."asset_id", 'hex'), out."asset_tags"->>'currency' FROM generate_series($2::int8, $3::int8, $4::int8) AS bucket(t) LEFT JOIN "annotated_outputs" AS out ON (out."account_id" = $1) AND out.timespan @> bucket.t GROUP BY 1, 4, 5 ORDER BY 1`,
+			wantValues: []interface{}{`abc`, start, end, interval},
+		},
 	}
 
 	for i, tc := range testCases {
@@ -62,7 +170,7 @@ func TestConstructBalancesQuery(t *testing.T) {
 			fields = append(fields, f)
 		}
 
-		query, values, err := constructBalancesQuery(expr, tc.values, fields, now)
+		query, values, err := constructBalanceHistoryQuery(expr, tc.values, fields, start, end, interval)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -12,8 +12,14 @@ Expressions in a filter expression have the following forms:
   Form                     Type     Subexpression types
   expr1 "OR" expr2         bool     bool, bool
   expr1 "AND" expr2        bool     bool, bool
+  "NOT" "(" expr ")"       bool     bool
   ident "(" expr ")"       bool     list, bool
   expr1 "=" expr2          bool     any (must match)
+  expr1 "!=" expr2         bool     any (must match)
+  expr1 "<" expr2          bool     int, int
+  expr1 "<=" expr2         bool     int, int
+  expr1 ">" expr2          bool     int, int
+  expr1 ">=" expr2         bool     int, int
   expr "." ident           any      object
   "(" expr ")"             any      any
   ident                    any      n/a
@@ -31,6 +37,12 @@ Expressions in a filter expression have the following forms:
 The environment is a map from names to values. Identifier
 expressions get their values from the environment map.
 
+The ordering operators (<, <=, >, >=) also accept a timestamp
+attribute compared against a string holding a timestamp, such as
+"timestamp >= '2017-01-01T00:00:00Z'". Values nested in objects,
+such as tags and reference data, are compared as integers when
+used with an ordering operator.
+
 The form 'ident(expr)' is an existential quantifier. The environment
 value for 'ident' must be a list of subenvironments. The
 subexpression 'expr' is evaluated in each subenvironment, and if
@@ -40,5 +52,11 @@ expression as a whole is true.
 Filters are statically type-checked: if a subexpression doesn't have
 the appropriate type, Parse will return an error.
 
+A parsed predicate can be translated to SQL with AsSQL, or evaluated
+in memory against a decoded JSON object with Eval. Both follow SQL's
+treatment of null: a missing or null value makes any comparison
+involving it unknown, and only objects for which the predicate is
+true are selected.
+
 */
 package filter
@@ -0,0 +1,419 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"chain/errors"
+)
+
+// Eval evaluates p in memory against env, an object described by tbl,
+// and reports whether env satisfies the predicate. It is the
+// in-memory counterpart of AsSQL: the result for a given object is
+// the same as whether the object's row would be selected by the SQL
+// translation of p.
+//
+// The environment maps attribute names to values, as produced by
+// decoding the JSON representation of the object (such as an
+// annotated transaction or output) into a map[string]interface{}.
+// Environments named by existential quantifiers, such as inputs and
+// outputs, must hold lists of subenvironments.
+//
+// Like SQL, Eval uses three-valued logic. Missing and null attributes
+// are unknown; a comparison involving an unknown value is unknown,
+// and an object satisfies the predicate only if it evaluates to true.
+// Timestamps are compared as instants, and strings compared with
+// timestamps must hold RFC3339 timestamps.
+func Eval(p Predicate, tbl *SQLTable, env map[string]interface{}, values []interface{}) (ok bool, err error) {
+	defer func() {
+		r := recover()
+		if e, ok := r.(error); ok {
+			err = e
+		} else if r != nil {
+			panic(r)
+		}
+	}()
+
+	if p.expr == nil {
+		return true, nil
+	}
+	c := &evalContext{
+		values:        values,
+		selectorTypes: p.selectorTypes,
+		tbl:           tbl,
+		env:           env,
+	}
+	v, err := c.eval(p.expr)
+	if err != nil {
+		return false, err
+	}
+	return v == true, nil
+}
+
+type evalContext struct {
+	values        []interface{}
+	selectorTypes map[string]Type
+	tbl           *SQLTable
+	env           map[string]interface{}
+}
+
+// eval evaluates an expression to one of nil (the SQL NULL
+// value, or unknown), bool, string, int64, time.Time or, for
+// object attributes, a decoded JSON value.
+func (c *evalContext) eval(e expr) (interface{}, error) {
+	switch e := e.(type) {
+	case parenExpr:
+		return c.eval(e.inner)
+	case valueExpr:
+		switch e.typ {
+		case tokString:
+			return strings.Trim(e.value, "'"), nil
+		case tokInteger:
+			n, err := strconv.ParseInt(e.value, 0, 64)
+			if err != nil {
+				return nil, errors.WithDetailf(ErrBadFilter, "invalid integer: %s", e.value)
+			}
+			return n, nil
+		default:
+			return nil, errors.WithDetailf(ErrBadFilter, "value expr with invalid token type: %s", e.typ)
+		}
+	case placeholderExpr:
+		if e.num < 1 || e.num > len(c.values) {
+			return nil, errors.WithDetailf(ErrBadFilter, "unbound placeholder: $%d", e.num)
+		}
+		return placeholderValue(c.values[e.num-1])
+	case attrExpr:
+		col, ok := c.tbl.Columns[e.attr]
+		if !ok {
+			return nil, errors.WithDetailf(ErrBadFilter, "invalid attribute: %s", e.attr)
+		}
+		v := c.env[e.attr]
+		switch col.SQLType {
+		case SQLBool:
+			return asBool(v)
+		case SQLTimestamp:
+			return asTimestamp(v)
+		case SQLJSONB:
+			return v, nil
+		}
+		switch col.Type {
+		case Integer:
+			return asInteger(v)
+		case Bool:
+			return asBool(v)
+		}
+		return asText(v)
+	case selectorExpr:
+		path := jsonbPath(e)
+		selectorPath := strings.Join(path, ".")
+		base, path := path[0], path[1:]
+
+		col, ok := c.tbl.Columns[base]
+		if !ok {
+			return nil, errors.WithDetailf(ErrBadFilter, "invalid attribute: %s", base)
+		}
+		if col.SQLType != SQLJSONB {
+			return nil, errors.WithDetailf(ErrBadFilter, "cannot index on non-object attribute: %s", base)
+		}
+
+		// Walk the path the way the ->/->> operators do: indexing
+		// into anything other than an object yields null.
+		v := c.env[base]
+		for _, key := range path {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, nil
+			}
+			v = obj[key]
+		}
+
+		switch c.selectorTypes[selectorPath] {
+		case Integer:
+			return asInteger(v)
+		case Bool:
+			return asBool(v)
+		case Object:
+			return v, nil
+		}
+		return asText(v)
+	case notExpr:
+		v, err := c.eval(e.inner)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("NOT expects a bool operand, got %T", v)
+		}
+		return !b, nil
+	case binaryExpr:
+		switch e.op.name {
+		case "AND", "OR":
+			return c.evalLogical(e)
+		}
+
+		l, err := c.eval(e.l)
+		if err != nil {
+			return nil, err
+		}
+		r, err := c.eval(e.r)
+		if err != nil {
+			return nil, err
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		cmp, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch e.op.name {
+		case "=":
+			return cmp == 0, nil
+		case "!=":
+			return cmp != 0, nil
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		case ">=":
+			return cmp >= 0, nil
+		default:
+			panic(fmt.Errorf("unsupported operator: %s", e.op.name))
+		}
+	case envExpr:
+		fk, ok := c.tbl.ForeignKeys[e.ident]
+		if !ok {
+			return nil, errors.WithDetailf(ErrBadFilter, "invalid environment `%s`", e.ident)
+		}
+		subenvs, _ := c.env[e.ident].([]interface{})
+		for _, subenv := range subenvs {
+			m, ok := subenv.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("environment `%s` holds %T, want object", e.ident, subenv)
+			}
+			subCtx := &evalContext{
+				values:        c.values,
+				selectorTypes: c.selectorTypes,
+				tbl:           fk.Table,
+				env:           m,
+			}
+			v, err := subCtx.eval(e.expr)
+			if err != nil {
+				return nil, err
+			}
+			if v == true {
+				return true, nil
+			}
+		}
+		// Like SQL's EXISTS, a quantifier is never unknown.
+		return false, nil
+	default:
+		panic(fmt.Errorf("unrecognized expr type %T", e))
+	}
+}
+
+// evalLogical evaluates AND and OR using SQL's three-valued logic.
+func (c *evalContext) evalLogical(e binaryExpr) (interface{}, error) {
+	l, err := c.eval(e.l)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.eval(e.r)
+	if err != nil {
+		return nil, err
+	}
+
+	// The dominant value decides the result regardless of the other
+	// operand: false for AND, true for OR.
+	dominant := e.op.name == "OR"
+	if l == dominant || r == dominant {
+		return dominant, nil
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	return !dominant, nil
+}
+
+// compare compares two non-null scalar values, returning
+// -1, 0 or 1. Strings compared with timestamps or booleans
+// are converted as SQL would convert a literal.
+func compare(l, r interface{}) (int, error) {
+	switch lv := l.(type) {
+	case int64:
+		rv, ok := r.(int64)
+		if !ok {
+			return 0, fmt.Errorf("cannot compare integer with %T", r)
+		}
+		switch {
+		case lv < rv:
+			return -1, nil
+		case lv > rv:
+			return 1, nil
+		}
+		return 0, nil
+	case time.Time:
+		rv, err := asTimestamp(r)
+		if err != nil {
+			return 0, err
+		}
+		switch rt := rv.(time.Time); {
+		case lv.Before(rt):
+			return -1, nil
+		case lv.After(rt):
+			return 1, nil
+		}
+		return 0, nil
+	case bool:
+		rv, err := asBool(r)
+		if err != nil {
+			return 0, err
+		}
+		if lv == rv.(bool) {
+			return 0, nil
+		}
+		if !lv {
+			return -1, nil
+		}
+		return 1, nil
+	case string:
+		switch r.(type) {
+		case time.Time, bool:
+			cmp, err := compare(r, l)
+			return -cmp, err
+		}
+		rv, ok := r.(string)
+		if !ok {
+			return 0, fmt.Errorf("cannot compare string with %T", r)
+		}
+		return strings.Compare(lv, rv), nil
+	default:
+		return 0, fmt.Errorf("cannot compare %T values", l)
+	}
+}
+
+func placeholderValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return asInteger(uint64(v))
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return asInteger(v)
+	case json.Number:
+		return asInteger(v)
+	case string, bool:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+// asText converts a JSON value to its text representation,
+// as the ->> operator does.
+func asText(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+}
+
+// asInteger converts a JSON value to an integer, as
+// casting its text representation to bigint does.
+func asInteger(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		return v, nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("integer %d out of range", v)
+		}
+		return int64(v), nil
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v > math.MaxInt64 {
+			return nil, fmt.Errorf("invalid integer: %v", v)
+		}
+		return int64(v), nil
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer: %s", v)
+		}
+		return n, nil
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer: %q", v)
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("invalid integer: %v", v)
+	}
+}
+
+// asBool converts a value to a boolean, accepting the
+// string forms of boolean literals that Postgres accepts.
+func asBool(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "t", "true", "y", "yes", "on", "1":
+			return true, nil
+		case "f", "false", "n", "no", "off", "0":
+			return false, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid boolean: %v", v)
+}
+
+// asTimestamp converts a value to a time.Time. Strings
+// must hold RFC3339 timestamps.
+func asTimestamp(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case time.Time:
+		return v, nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %q", v)
+		}
+		return t, nil
+	default:
+		return nil, fmt.Errorf("invalid timestamp: %v", v)
+	}
+}
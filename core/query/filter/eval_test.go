@@ -0,0 +1,332 @@
+package filter
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"chain/database/pg/pgtest"
+	"chain/database/sql"
+	"chain/testutil"
+)
+
+// evalTestTxs are the transactions used to cross-check Eval
+// against the SQL translation of the filters in TestEvalMatchesSQL.
+var evalTestTxs = []string{`{
+	"id": "a1",
+	"ref": {
+		"buyer": {
+			"address": {"state": "CA", "city": "San Francisco", "street_number": 200},
+			"is_high_priority": true,
+			"credit_limit": 500
+		},
+		"txbankref": "1ab"
+	},
+	"position": 2,
+	"is_local": true,
+	"timestamp": "2017-01-01T00:00:00Z",
+	"inputs": [
+		{"a": "a", "b": "b", "type": "issue", "amount": 1500, "asset_id": "c001cafe", "account_tags": {}},
+		{"a": "x", "b": "b", "type": "spend", "amount": 1000, "asset_id": "beef"}
+	],
+	"outputs": [{"b": "b"}]
+}`, `{
+	"id": "a2",
+	"ref": {"buyer": {"address": {"state": "NY"}, "is_high_priority": false, "credit_limit": 100}},
+	"position": 1,
+	"is_local": false,
+	"timestamp": "2017-02-01T00:00:00Z",
+	"inputs": [{"a": "a", "b": "x", "type": "spend", "amount": 2000, "asset_id": "beef"}],
+	"outputs": []
+}`, `{
+	"id": "a3",
+	"ref": {"txbankref": "1ab", "buyer": "anonymous"},
+	"position": 0,
+	"is_local": false,
+	"timestamp": "2017-03-01T00:00:00Z",
+	"outputs": [{"b": "c"}, {}]
+}`, `{
+	"id": "a4",
+	"ref": null,
+	"position": 1
+}`}
+
+func TestEval(t *testing.T) {
+	env := decodeEnv(t, evalTestTxs[0])
+	testCases := []struct {
+		q      string
+		values []interface{}
+		want   bool
+	}{
+		{q: ``, want: true},
+		{q: `is_local`, want: true},
+		{q: `NOT (is_local)`, want: false},
+		{q: `position = 2`, want: true},
+		{q: `position != 2`, want: false},
+		{q: `position > 1 AND position <= $1`, values: []interface{}{json.Number("2")}, want: true},
+		{q: `id = $1`, values: []interface{}{"a1"}, want: true},
+		{q: `ref.buyer.address.state = 'CA' AND ref.buyer.address.city = 'San Francisco'`, want: true},
+		{q: `ref.buyer.address.street_number = 200`, want: true},
+		{q: `ref.buyer.credit_limit < 500`, want: false},
+		{q: `ref.buyer.is_high_priority`, want: true},
+		{q: `timestamp >= '2016-12-31T16:00:00-08:00'`, want: true},
+		{q: `timestamp < $1`, values: []interface{}{"2016-12-31T23:59:59Z"}, want: false},
+		{q: `inputs(type = 'issue' AND amount > 1000)`, want: true},
+		{q: `inputs(type = 'issue' AND amount > 1500)`, want: false},
+		{q: `inputs(asset_id = $1) AND outputs(b = $2)`, values: []interface{}{"beef", "b"}, want: true},
+		{q: `NOT (inputs(a = 'y'))`, want: true},
+
+		// Missing attributes are unknown, as NULL is in SQL.
+		{q: `ref.seller.name = 'bob'`, want: false},
+		{q: `NOT (ref.seller.name = 'bob')`, want: false},
+		{q: `ref.seller.name = 'bob' OR position = 2`, want: true},
+		{q: `ref.buyer.address.zip != '94107'`, want: false},
+	}
+
+	for _, tc := range testCases {
+		p, err := Parse(tc.q, transactionsSQLTable, tc.values)
+		if err != nil {
+			t.Fatalf("Parse(%q): %s", tc.q, err)
+		}
+		got, err := Eval(p, transactionsSQLTable, env, tc.values)
+		if err != nil {
+			t.Errorf("Eval(%q) error: %s", tc.q, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("Eval(%q) = %t, want %t", tc.q, got, tc.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	env := decodeEnv(t, evalTestTxs[0])
+	testCases := []struct {
+		q      string
+		values []interface{}
+	}{
+		{q: `timestamp > $1`, values: []interface{}{"yesterday"}},
+		{q: `ref.buyer.address.state = 5`},
+		{q: `ref.buyer.address.city`},
+	}
+
+	for _, tc := range testCases {
+		p, err := Parse(tc.q, transactionsSQLTable, tc.values)
+		if err != nil {
+			t.Fatalf("Parse(%q): %s", tc.q, err)
+		}
+		_, err = Eval(p, transactionsSQLTable, env, tc.values)
+		if err == nil {
+			t.Errorf("Eval(%q) got no error, want error", tc.q)
+		}
+	}
+}
+
+func TestEvalMatchesSQL(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+
+	var txEnvs []map[string]interface{}
+	for _, s := range evalTestTxs {
+		txEnvs = append(txEnvs, decodeEnv(t, s))
+	}
+
+	// Load the test transactions into temporary tables shadowing
+	// the annotated tables, and collect the objects of each table
+	// in the order they're inserted.
+	envs := make(map[*SQLTable][]map[string]interface{})
+	createEvalTestTable(ctx, t, db, transactionsSQLTable, "")
+	for name, fk := range transactionsSQLTable.ForeignKeys {
+		createEvalTestTable(ctx, t, db, fk.Table, fk.ForeignColumn)
+		for _, txEnv := range txEnvs {
+			subenvs, _ := txEnv[name].([]interface{})
+			for _, subenv := range subenvs {
+				m := subenv.(map[string]interface{})
+				insertEvalTestRow(ctx, t, db, fk.Table, len(envs[fk.Table]), m, fk.ForeignColumn, txEnv["id"])
+				envs[fk.Table] = append(envs[fk.Table], m)
+			}
+		}
+	}
+	for i, txEnv := range txEnvs {
+		insertEvalTestRow(ctx, t, db, transactionsSQLTable, i, txEnv, "", nil)
+	}
+	envs[transactionsSQLTable] = txEnvs
+
+	testCases := []struct {
+		q   string
+		tbl *SQLTable
+	}{
+		{q: ``, tbl: transactionsSQLTable},
+		{q: `is_local`, tbl: transactionsSQLTable},
+		{q: `asset_id = $1`, tbl: inputsSQLTable},
+		{q: `(asset_id = $1)`, tbl: inputsSQLTable},
+		{q: `ref.buyer.address.state = 'CA' AND ref.buyer.address.city = 'San Francisco'`, tbl: transactionsSQLTable},
+		{q: `ref.buyer.address.street_number = 200`, tbl: transactionsSQLTable},
+		{q: `ref.buyer.is_high_priority`, tbl: transactionsSQLTable},
+		{q: `position = 2`, tbl: transactionsSQLTable},
+		{q: `asset_id != $1`, tbl: inputsSQLTable},
+		{q: `amount > 1000 AND amount <= 2000`, tbl: inputsSQLTable},
+		{q: `ref.buyer.credit_limit >= 500`, tbl: transactionsSQLTable},
+		{q: `timestamp >= $1 AND $1 < (timestamp)`, tbl: transactionsSQLTable},
+		{q: `NOT (is_local OR position = 1)`, tbl: transactionsSQLTable},
+		{q: `inputs(a = 'a' AND b = 'b')`, tbl: transactionsSQLTable},
+		{q: `inputs(a = 'a') OR outputs(b = 'b')`, tbl: transactionsSQLTable},
+		{q: `inputs(a = 'a') AND ref.txbankref = '1ab'`, tbl: transactionsSQLTable},
+	}
+
+	values := []interface{}{"hey"}
+	for _, tc := range testCases {
+		p, err := Parse(tc.q, tc.tbl, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		where, err := AsSQL(p, tc.tbl, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q := fmt.Sprintf(`SELECT eval_row FROM %s AS %s`, tc.tbl.Name, tc.tbl.Alias)
+		if where != "" {
+			q += " WHERE " + where
+		}
+		q += " ORDER BY eval_row"
+		want, sqlErr := queryEvalTestRows(ctx, db, q, values[:p.Parameters]...)
+
+		var got []int
+		var evalErr error
+		for i, env := range envs[tc.tbl] {
+			ok, err := Eval(p, tc.tbl, env, values)
+			if err != nil {
+				evalErr = err
+				break
+			}
+			if ok {
+				got = append(got, i)
+			}
+		}
+
+		if (sqlErr != nil) != (evalErr != nil) {
+			t.Errorf("%q: SQL error %v, Eval error %v", tc.q, sqlErr, evalErr)
+			continue
+		}
+		if sqlErr == nil && !testutil.DeepEqual(got, want) {
+			t.Errorf("%q: Eval matched rows %v, SQL matched rows %v", tc.q, got, want)
+		}
+	}
+}
+
+func decodeEnv(t testing.TB, s string) map[string]interface{} {
+	var env map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	err := dec.Decode(&env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+var evalTestSQLTypes = map[SQLType]string{
+	SQLBool:      "boolean",
+	SQLText:      "text",
+	SQLBytea:     "bytea",
+	SQLJSONB:     "jsonb",
+	SQLInteger:   "integer",
+	SQLBigint:    "bigint",
+	SQLTimestamp: "timestamp with time zone",
+}
+
+func createEvalTestTable(ctx context.Context, t testing.TB, db *sql.Tx, tbl *SQLTable, fkCol string) {
+	var cols []string
+	for _, col := range tbl.Columns {
+		cols = append(cols, fmt.Sprintf(`"%s" %s`, col.Name, evalTestSQLTypes[col.SQLType]))
+	}
+	if fkCol != "" {
+		cols = append(cols, fmt.Sprintf(`"%s" bytea`, fkCol))
+	}
+	sort.Strings(cols)
+	q := fmt.Sprintf(`CREATE TEMP TABLE %s (eval_row integer, %s) ON COMMIT DROP`, tbl.Name, strings.Join(cols, ", "))
+	pgtest.Exec(ctx, db, t, q)
+}
+
+func insertEvalTestRow(ctx context.Context, t testing.TB, db *sql.Tx, tbl *SQLTable, row int, env map[string]interface{}, fkCol string, fkVal interface{}) {
+	names := []string{"eval_row"}
+	args := []interface{}{row}
+	add := func(name string, sqlType SQLType, v interface{}) {
+		names = append(names, `"`+name+`"`)
+		args = append(args, evalTestSQLValue(t, sqlType, v))
+	}
+	for attr, col := range tbl.Columns {
+		v, ok := env[attr]
+		if !ok {
+			continue
+		}
+		add(col.Name, col.SQLType, v)
+	}
+	if fkCol != "" {
+		add(fkCol, SQLBytea, fkVal)
+	}
+
+	var params []string
+	for i := range args {
+		params = append(params, fmt.Sprintf("$%d", i+1))
+	}
+	q := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`, tbl.Name, strings.Join(names, ", "), strings.Join(params, ", "))
+	pgtest.Exec(ctx, db, t, q, args...)
+}
+
+func evalTestSQLValue(t testing.TB, sqlType SQLType, v interface{}) interface{} {
+	if v == nil && sqlType != SQLJSONB {
+		return nil
+	}
+	switch sqlType {
+	case SQLBytea:
+		b, err := hex.DecodeString(v.(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	case SQLJSONB:
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	case SQLInteger, SQLBigint:
+		return v.(json.Number).String()
+	}
+	return v
+}
+
+// queryEvalTestRows runs q inside a savepoint, so that queries
+// that fail in the database don't abort the test transaction.
+func queryEvalTestRows(ctx context.Context, db *sql.Tx, q string, args ...interface{}) (rows []int, err error) {
+	_, err = db.Exec(ctx, `SAVEPOINT eval_test`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			db.Exec(ctx, `ROLLBACK TO SAVEPOINT eval_test`)
+		}
+	}()
+
+	res, err := db.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	for res.Next() {
+		var row int
+		err = res.Scan(&row)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, res.Err()
+}
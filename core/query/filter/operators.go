@@ -10,4 +10,19 @@ var binaryOps = map[string]*binaryOp{
 	"OR":  {1, "OR", "OR"},
 	"AND": {2, "AND", "AND"},
 	"=":   {3, "=", "="},
+	"!=":  {3, "!=", "<>"},
+	"<":   {3, "<", "<"},
+	"<=":  {3, "<=", "<="},
+	">":   {3, ">", ">"},
+	">=":  {3, ">=", ">="},
+}
+
+// isOrdering returns true if op compares its operands
+// by order rather than by equality.
+func (op *binaryOp) isOrdering() bool {
+	switch op.name {
+	case "<", "<=", ">", ">=":
+		return true
+	}
+	return false
 }
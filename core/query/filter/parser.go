@@ -188,6 +188,12 @@ func parseOperand(p *parser) expr {
 		expr := parseExpr(p)
 		p.parseLit(")")
 		return parenExpr{inner: expr}
+	case p.tok == tokKeyword && p.lit == "NOT":
+		p.next()
+		p.parseLit("(")
+		expr := parseExpr(p)
+		p.parseLit(")")
+		return notExpr{inner: parenExpr{inner: expr}}
 	case p.tok == tokString:
 		v := valueExpr{typ: p.tok, value: p.lit}
 		p.next()
@@ -118,6 +118,42 @@ func TestParseValid(t *testing.T) {
 				},
 			},
 		},
+		{
+			p: "amount >= 1000 AND amount < 2000",
+			expr: binaryExpr{
+				op: binaryOps["AND"],
+				l: binaryExpr{
+					op: binaryOps[">="],
+					l:  attrExpr{attr: "amount"},
+					r:  valueExpr{typ: tokInteger, value: "1000"},
+				},
+				r: binaryExpr{
+					op: binaryOps["<"],
+					l:  attrExpr{attr: "amount"},
+					r:  valueExpr{typ: tokInteger, value: "2000"},
+				},
+			},
+		},
+		{
+			p: "NOT (asset_id = $1 OR asset_alias != 'gold')",
+			expr: notExpr{
+				inner: parenExpr{
+					inner: binaryExpr{
+						op: binaryOps["OR"],
+						l: binaryExpr{
+							op: binaryOps["="],
+							l:  attrExpr{attr: "asset_id"},
+							r:  placeholderExpr{num: 1},
+						},
+						r: binaryExpr{
+							op: binaryOps["!="],
+							l:  attrExpr{attr: "asset_alias"},
+							r:  valueExpr{typ: tokString, value: "'gold'"},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for i, tc := range testCases {
@@ -146,6 +182,9 @@ func TestParseInvalid(t *testing.T) {
 		"an_identifier another_identifier",            // two identifiers w/o an operator (trailing garbage)
 		"inputs(account_tags.level = $1) or (1 == 1)", // lowercase 'or' (trailing garbage)
 		"reference.(recipient.email_address)`",        // expected ident, got paren expr
+		"NOT amount = 1",                              // NOT requires parens
+		"amount =< 1",                                 // =< is not an operator
+		"NOT (amount = 1",                             // unterminated NOT
 	}
 	for _, tc := range testCases {
 		expr, _, err := parse(tc)
@@ -186,7 +186,7 @@ func (s *scanner) Scan() (pos int, tok token, lit string) {
 	case isLetter(ch):
 		lit = s.scanIdentifier()
 		switch lit {
-		case "AND", "OR":
+		case "AND", "OR", "NOT":
 			tok = tokKeyword
 		default:
 			tok = tokIdent
@@ -205,6 +205,17 @@ func (s *scanner) Scan() (pos int, tok token, lit string) {
 			s.scanString()
 		case '.', '(', ')', '=':
 			tok = tokPunct
+		case '<', '>':
+			if s.ch == '=' {
+				s.next()
+			}
+			tok = tokPunct
+		case '!':
+			if s.ch != '=' {
+				s.error(pos, fmt.Sprintf("illegal character %q", ch))
+			}
+			s.next()
+			tok = tokPunct
 		case '$':
 			s.scanMantissa(10)
 			if s.offset-pos <= 1 {
@@ -54,6 +54,33 @@ func TestScannerValid(t *testing.T) {
 				{pos: 25, lit: "", tok: tokEOF},
 			},
 		},
+		{
+			input: []byte("amount >= 10 AND NOT (position != 0)"),
+			toks: []scannedTok{
+				{pos: 0, lit: "amount", tok: tokIdent},
+				{pos: 7, lit: ">=", tok: tokPunct},
+				{pos: 10, lit: "10", tok: tokInteger},
+				{pos: 13, lit: "AND", tok: tokKeyword},
+				{pos: 17, lit: "NOT", tok: tokKeyword},
+				{pos: 21, lit: "(", tok: tokPunct},
+				{pos: 22, lit: "position", tok: tokIdent},
+				{pos: 31, lit: "!=", tok: tokPunct},
+				{pos: 34, lit: "0", tok: tokInteger},
+				{pos: 35, lit: ")", tok: tokPunct},
+				{pos: 36, lit: "", tok: tokEOF},
+			},
+		},
+		{
+			input: []byte("1<2>3"),
+			toks: []scannedTok{
+				{pos: 0, lit: "1", tok: tokInteger},
+				{pos: 1, lit: "<", tok: tokPunct},
+				{pos: 2, lit: "2", tok: tokInteger},
+				{pos: 3, lit: ">", tok: tokPunct},
+				{pos: 4, lit: "3", tok: tokInteger},
+				{pos: 5, lit: "", tok: tokEOF},
+			},
+		},
 		{
 			input: []byte(`comme ci comme ça`),
 			toks: []scannedTok{
@@ -118,6 +145,10 @@ func TestScannerInvalid(t *testing.T) {
 			input: []byte(`hello\`),
 			err:   parseError{pos: 5, msg: `illegal character '\\'`},
 		},
+		{
+			input: []byte(`1 ! 2`),
+			err:   parseError{pos: 2, msg: `illegal character '!'`},
+		},
 		{
 			input: []byte(`'hello\''`),
 			err:   parseError{pos: 0, msg: `illegal backslash in string literal`},
@@ -227,8 +227,16 @@ func asSQL(c *sqlContext, filterExpr expr) error {
 				panic(fmt.Errorf("unknown type %s", typ))
 			}
 		}
+	case notExpr:
+		c.buf.WriteString("NOT ")
+		return asSQL(c, e.inner)
 	case binaryExpr:
-		err := asSQL(c, e.l)
+		operandAsSQL := asSQL
+		if e.op.isOrdering() && (isTimestampAttr(e.l, c.tbl) || isTimestampAttr(e.r, c.tbl)) {
+			operandAsSQL = asTimestampSQL
+		}
+
+		err := operandAsSQL(c, e.l)
 		if err != nil {
 			return err
 		}
@@ -237,7 +245,7 @@ func asSQL(c *sqlContext, filterExpr expr) error {
 		c.buf.WriteString(e.op.sqlOp)
 		c.buf.WriteRune(' ')
 
-		err = asSQL(c, e.r)
+		err = operandAsSQL(c, e.r)
 		if err != nil {
 			return err
 		}
@@ -284,3 +292,33 @@ func asSQL(c *sqlContext, filterExpr expr) error {
 	}
 	return nil
 }
+
+// asTimestampSQL translates an operand of an ordering comparison
+// involving a timestamp attribute. Timestamp attributes are compared
+// in their native SQL type rather than as text, and all other
+// operands are cast to timestamps.
+func asTimestampSQL(c *sqlContext, filterExpr expr) error {
+	switch e := filterExpr.(type) {
+	case parenExpr:
+		c.buf.WriteRune('(')
+		err := asTimestampSQL(c, e.inner)
+		if err != nil {
+			return err
+		}
+		c.buf.WriteRune(')')
+		return nil
+	case attrExpr:
+		col, ok := c.tbl.Columns[e.attr]
+		if ok && col.SQLType == SQLTimestamp {
+			c.writeCol(col.Name)
+			return nil
+		}
+	}
+
+	err := asSQL(c, filterExpr)
+	if err != nil {
+		return err
+	}
+	c.buf.WriteString("::timestamp with time zone")
+	return nil
+}
@@ -33,10 +33,11 @@ var (
 		Name:  "annotated_txs",
 		Alias: "txs",
 		Columns: map[string]*SQLColumn{
-			"id":       {Name: "tx_hash", Type: String, SQLType: SQLBytea},
-			"ref":      {Name: "ref", Type: Object, SQLType: SQLJSONB},
-			"position": {Name: "position", Type: Integer, SQLType: SQLInteger},
-			"is_local": {Name: "local", Type: Bool, SQLType: SQLBool},
+			"id":        {Name: "tx_hash", Type: String, SQLType: SQLBytea},
+			"ref":       {Name: "ref", Type: Object, SQLType: SQLJSONB},
+			"position":  {Name: "position", Type: Integer, SQLType: SQLInteger},
+			"is_local":  {Name: "local", Type: Bool, SQLType: SQLBool},
+			"timestamp": {Name: "timestamp", Type: String, SQLType: SQLTimestamp},
 		},
 		ForeignKeys: map[string]*SQLForeignKey{
 			"inputs":  {Table: inputsSQLTable, LocalColumn: "tx_hash", ForeignColumn: "tx_hash"},
@@ -132,6 +133,31 @@ func TestAsSQL(t *testing.T) {
 			tbl: transactionsSQLTable,
 			sql: `txs."position"::bigint = 2::bigint`,
 		},
+		{ // inequality
+			q:   `asset_id != $1`,
+			tbl: inputsSQLTable,
+			sql: `encode(inp."asset_id", 'hex') <> $1`,
+		},
+		{ // ordering comparisons on integers
+			q:   `amount > 1000 AND amount <= 2000`,
+			tbl: inputsSQLTable,
+			sql: `inp."amount" > 1000::bigint AND inp."amount" <= 2000::bigint`,
+		},
+		{ // ordering comparisons on arbitrary json
+			q:   `ref.buyer.credit_limit >= 500`,
+			tbl: transactionsSQLTable,
+			sql: `(txs."ref"->'buyer'->>'credit_limit')::bigint >= 500::bigint`,
+		},
+		{ // ordering comparisons on timestamps
+			q:   `timestamp >= $1 AND $1 < (timestamp)`,
+			tbl: transactionsSQLTable,
+			sql: `txs."timestamp" >= $1::timestamp with time zone AND $1::timestamp with time zone < (txs."timestamp")`,
+		},
+		{ // negation
+			q:   `NOT (is_local OR position = 1)`,
+			tbl: transactionsSQLTable,
+			sql: `NOT (txs."local" OR txs."position"::bigint = 1::bigint)`,
+		},
 		{ // simple environment
 			q:   `inputs(a = 'a' AND b = 'b')`,
 			tbl: transactionsSQLTable,
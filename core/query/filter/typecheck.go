@@ -1,6 +1,7 @@
 package filter
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -17,9 +18,14 @@ func knownType(t Type) bool {
 func valueTypes(vals []interface{}) ([]Type, error) {
 	valTypes := make([]Type, len(vals))
 	for i, val := range vals {
-		switch val.(type) {
+		switch val := val.(type) {
 		case int, uint, int32, uint32, int64, uint64:
 			valTypes[i] = Integer
+		case json.Number:
+			if _, err := val.Int64(); err != nil {
+				return nil, fmt.Errorf("unsupported non-integer value %s", val)
+			}
+			valTypes[i] = Integer
 		case string:
 			valTypes[i] = String
 		case bool:
@@ -90,10 +96,10 @@ func typeCheckExpr(expr expr, tbl *SQLTable, valTypes []Type, selectorTypes map[
 				return typ, fmt.Errorf("%s expects bool operands", e.op.name)
 			}
 			return Bool, nil
-		case "=":
-			// The = operand requires left and right types to be equal. If
-			// one of our types is known but the other is not, we need to
-			// coerce the untyped one to a matching type.
+		case "=", "!=":
+			// The = and != operands require left and right types to be
+			// equal. If one of our types is known but the other is not, we
+			// need to coerce the untyped one to a matching type.
 			if !knownType(leftTyp) && knownType(rightTyp) {
 				err := setType(e.l, rightTyp, selectorTypes)
 				if err != nil {
@@ -118,9 +124,47 @@ func typeCheckExpr(expr expr, tbl *SQLTable, valTypes []Type, selectorTypes map[
 				return typ, fmt.Errorf("%s expects operands of matching types", e.op.name)
 			}
 			return Bool, nil
+		case "<", "<=", ">", ">=":
+			// Ordering comparisons are defined on integers, and on
+			// timestamp attributes, which are compared against
+			// strings holding RFC3339 timestamps.
+			want := Integer
+			if isTimestampAttr(e.l, tbl) || isTimestampAttr(e.r, tbl) {
+				want = String
+			}
+			ok, err := assertType(e.l, leftTyp, want, selectorTypes)
+			if err != nil {
+				return typ, err
+			}
+			if ok {
+				ok, err = assertType(e.r, rightTyp, want, selectorTypes)
+				if err != nil {
+					return typ, err
+				}
+			}
+			if !ok && want == String {
+				return typ, fmt.Errorf("%s expects timestamps to be compared with strings", e.op.name)
+			}
+			if !ok {
+				return typ, fmt.Errorf("%s expects integer operands", e.op.name)
+			}
+			return Bool, nil
 		default:
 			panic(fmt.Errorf("unsupported operator: %s", e.op.name))
 		}
+	case notExpr:
+		typ, err = typeCheckExpr(e.inner, tbl, valTypes, selectorTypes)
+		if err != nil {
+			return typ, err
+		}
+		ok, err := assertType(e.inner, typ, Bool, selectorTypes)
+		if err != nil {
+			return typ, err
+		}
+		if !ok {
+			return typ, errors.New("NOT expects a bool operand")
+		}
+		return Bool, nil
 	case placeholderExpr:
 		if len(valTypes) == 0 {
 			return Any, nil
@@ -183,6 +227,19 @@ func typeCheckExpr(expr expr, tbl *SQLTable, valTypes []Type, selectorTypes map[
 	}
 }
 
+// isTimestampAttr returns true if expr refers to
+// an attribute of tbl with a timestamp SQL type.
+func isTimestampAttr(expr expr, tbl *SQLTable) bool {
+	switch e := expr.(type) {
+	case parenExpr:
+		return isTimestampAttr(e.inner, tbl)
+	case attrExpr:
+		col, ok := tbl.Columns[e.attr]
+		return ok && col.SQLType == SQLTimestamp
+	}
+	return false
+}
+
 func assertType(expr expr, got, want Type, selectorTypes map[string]Type) (bool, error) {
 	if !isType(got, want) { // type does not match
 		return false, nil
@@ -26,6 +26,12 @@ func TestTypeCheckInvalid(t *testing.T) {
 		{p: `position.huh`, err: errors.New("selector `.` can only be used on objects")},
 		{p: `ref.something = 'abc' OR ref.something = 123`, err: errors.New("\"ref.something\" used as both string and integer")},
 		{p: `ref.buyer.id = 'abc' OR ref.buyer = 'hello'`, err: errors.New("\"ref.buyer\" used as both object and string")},
+		{p: `'a' < 'b'`, err: errors.New("< expects integer operands")},
+		{p: `inputs(amount >= asset_id)`, err: errors.New(">= expects integer operands")},
+		{p: `ref.quantity > 1 OR ref.quantity = 'abc'`, err: errors.New("\"ref.quantity\" used as both integer and string")},
+		{p: `1 != 'hello world'`, err: errors.New("!= expects operands of matching types")},
+		{p: `timestamp > 1`, err: errors.New("> expects timestamps to be compared with strings")},
+		{p: `NOT (1)`, err: errors.New("NOT expects a bool operand")},
 	}
 
 	for _, tc := range testCases {
@@ -62,6 +68,13 @@ func TestTypeCheckValid(t *testing.T) {
 		{p: `ref.a_boolean_field AND ref.another_boolean_field`, typ: Bool},
 		{p: `$1`, valTypes: []Type{String}, typ: String},
 		{p: `$1 = $2`, valTypes: []Type{String, String}, typ: Bool},
+		{p: `position > 1 AND position <= $1`, valTypes: []Type{Integer}, typ: Bool},
+		{p: `ref.quantity >= 10`, typ: Bool},
+		{p: `inputs(account_tags.limit < amount)`, typ: Bool},
+		{p: `timestamp >= $1`, valTypes: []Type{String}, typ: Bool},
+		{p: `ref.state != 'CA'`, typ: Bool},
+		{p: `NOT (is_local)`, typ: Bool},
+		{p: `NOT (ref.a_boolean_field) AND NOT (position = 1)`, typ: Bool},
 	}
 
 	for _, tc := range testCases {
@@ -10,6 +10,7 @@ import (
 
 	"chain/core/query/filter"
 	"chain/errors"
+	"chain/protocol"
 	"chain/protocol/bc"
 )
 
@@ -47,7 +48,37 @@ func DecodeOutputsAfter(str string) (c *OutputsAfter, err error) {
 	}, nil
 }
 
-func (ind *Indexer) Outputs(ctx context.Context, filt string, vals []interface{}, timestampMS uint64, after *OutputsAfter, limit int) ([]*AnnotatedOutput, *OutputsAfter, error) {
+// MatchOutput reports whether out satisfies the output filter
+// predicate `filt`, evaluating it in memory rather than in the
+// database.
+func MatchOutput(filt string, vals []interface{}, out *AnnotatedOutput) (bool, error) {
+	p, err := filter.Parse(filt, outputsTable, vals)
+	if err != nil {
+		return false, err
+	}
+	if len(vals) != p.Parameters {
+		return false, ErrParameterCountMismatch
+	}
+	env, err := filterEnv(out)
+	if err != nil {
+		return false, err
+	}
+	return filter.Eval(p, outputsTable, env, vals)
+}
+
+// Outputs queries the outputs matching filt that were unspent at
+// timestampMS or, if asOfHeight is nonzero, that were unspent after
+// the block at height asOfHeight. Queries by height reflect the
+// blockchain's history exactly, whatever the blocks' timestamps.
+func (ind *Indexer) Outputs(ctx context.Context, filt string, vals []interface{}, timestampMS, asOfHeight uint64, after *OutputsAfter, limit int) ([]*AnnotatedOutput, *OutputsAfter, error) {
+	if asOfHeight > 0 {
+		var err error
+		timestampMS, err = ind.heightTimestamp(ctx, asOfHeight)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	p, err := filter.Parse(filt, outputsTable, vals)
 	if err != nil {
 		return nil, nil, err
@@ -59,7 +90,7 @@ func (ind *Indexer) Outputs(ctx context.Context, filt string, vals []interface{}
 	if err != nil {
 		return nil, nil, err
 	}
-	queryStr, queryArgs := constructOutputsQuery(expr, vals, timestampMS, after, limit)
+	queryStr, queryArgs := constructOutputsQuery(expr, vals, timestampMS, asOfHeight, after, limit)
 	rows, err := ind.db.Query(ctx, queryStr, queryArgs...)
 	if err != nil {
 		return nil, nil, err
@@ -107,6 +138,7 @@ func (ind *Indexer) Outputs(ctx context.Context, filt string, vals []interface{}
 		}
 
 		out.TransactionID = txID
+		out.Contract = buildAnnotatedContract(out.ControlProgram)
 
 		// Set nullable fields.
 		if accountID != nil {
@@ -130,7 +162,7 @@ func (ind *Indexer) Outputs(ctx context.Context, filt string, vals []interface{}
 	return outputs, &newAfter, nil
 }
 
-func constructOutputsQuery(where string, vals []interface{}, timestampMS uint64, after *OutputsAfter, limit int) (string, []interface{}) {
+func constructOutputsQuery(where string, vals []interface{}, timestampMS, asOfHeight uint64, after *OutputsAfter, limit int) (string, []interface{}) {
 	var buf bytes.Buffer
 
 	buf.WriteString("SELECT ")
@@ -148,9 +180,7 @@ func constructOutputsQuery(where string, vals []interface{}, timestampMS uint64,
 		buf.WriteString(") AND ")
 	}
 
-	vals = append(vals, timestampMS)
-	timestampValIndex := len(vals)
-	buf.WriteString(fmt.Sprintf("timespan @> $%d::int8", timestampValIndex))
+	vals = writeUnspentCond(&buf, vals, timestampMS, asOfHeight)
 
 	if after != nil {
 		vals = append(vals, after.lastBlockHeight)
@@ -169,3 +199,51 @@ func constructOutputsQuery(where string, vals []interface{}, timestampMS uint64,
 
 	return buf.String(), vals
 }
+
+// writeUnspentCond writes to buf the condition selecting the
+// annotated outputs that were unspent at timestampMS or, if
+// asOfHeight is nonzero, after the block at height asOfHeight,
+// whose timestamp must be timestampMS. It returns vals with the
+// condition's parameters appended.
+//
+// Consecutive blocks may share a timestamp, so the timespans alone
+// can't tell whether an output whose timespan ends at the block's
+// timestamp was spent in that block or in a later one. For those
+// outputs, the height of the spending transaction decides.
+func writeUnspentCond(buf *bytes.Buffer, vals []interface{}, timestampMS, asOfHeight uint64) []interface{} {
+	vals = append(vals, timestampMS)
+	timestampValIndex := len(vals)
+	if asOfHeight == 0 {
+		buf.WriteString(fmt.Sprintf("timespan @> $%d::int8", timestampValIndex))
+		return vals
+	}
+
+	vals = append(vals, asOfHeight)
+	heightValIndex := len(vals)
+	buf.WriteString(fmt.Sprintf("block_height <= $%d AND ", heightValIndex))
+	buf.WriteString(fmt.Sprintf("(upper_inf(timespan) OR upper(timespan) > $%d::int8", timestampValIndex))
+	buf.WriteString(fmt.Sprintf(" OR (upper(timespan) = $%d::int8 AND NOT EXISTS (", timestampValIndex))
+	buf.WriteString("SELECT 1 FROM annotated_inputs AS inp JOIN annotated_txs AS tx ON tx.tx_hash = inp.tx_hash")
+	buf.WriteString(fmt.Sprintf(" WHERE inp.spent_output_id = out.output_id AND tx.block_height <= $%d)))", heightValIndex))
+	return vals
+}
+
+// heightTimestamp returns the timestamp of the block at height,
+// waiting until the block's transactions have been indexed.
+func (ind *Indexer) heightTimestamp(ctx context.Context, height uint64) (uint64, error) {
+	if height > ind.c.Height() {
+		return 0, errors.WithDetailf(protocol.ErrTheDistantFuture, "no block at height %d", height)
+	}
+	b, err := ind.c.GetBlock(ctx, height)
+	if err != nil {
+		return 0, errors.Wrapf(err, "getting block %d", height)
+	}
+	if ind.pinStore != nil {
+		select {
+		case <-ind.pinStore.PinWaiter(TxPinName, height):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	return b.TimestampMS, nil
+}
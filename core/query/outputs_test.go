@@ -57,7 +57,7 @@ func TestOutputsAfter(t *testing.T) {
 
 	const q = `asset_id = 'deadbeef'`
 	indexer := NewIndexer(db, &protocol.Chain{}, nil)
-	results, after, err := indexer.Outputs(ctx, q, nil, 25, nil, 2)
+	results, after, err := indexer.Outputs(ctx, q, nil, 25, 0, nil, 2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -68,7 +68,7 @@ func TestOutputsAfter(t *testing.T) {
 		t.Errorf("got after=%q want 1:1:1", after.String())
 	}
 
-	results, after, err = indexer.Outputs(ctx, q, nil, 25, after, 2)
+	results, after, err = indexer.Outputs(ctx, q, nil, 25, 0, after, 2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -88,6 +88,7 @@ func TestConstructOutputsQuery(t *testing.T) {
 		filter     string
 		values     []interface{}
 		after      *OutputsAfter
+		asOfHeight uint64
 		wantQuery  string
 		wantValues []interface{}
 	}{
@@ -113,6 +114,17 @@ func TestConstructOutputsQuery(t *testing.T) {
 			wantQuery:  `SELECT block_height, tx_pos, output_index, tx_hash, output_id, type, purpose, asset_id, asset_alias, asset_definition, asset_tags, asset_local, amount, account_id, account_alias, account_tags, control_program, reference_data, local FROM "annotated_outputs" AS out WHERE (encode(out."asset_id", 'hex') = $1 AND out."account_id" = 'abc') AND timespan @> $2::int8 AND (block_height, tx_pos, output_index) < ($3, $4, $5) ORDER BY block_height DESC, tx_pos DESC, output_index DESC LIMIT 10`,
 			wantValues: []interface{}{`foo`, nowMillis, uint64(15), uint32(17), uint32(19)},
 		},
+		{
+			filter:     "account_id = 'abc'",
+			asOfHeight: 5,
+			after: &OutputsAfter{
+				lastBlockHeight: 4,
+				lastTxPos:       1,
+				lastIndex:       0,
+			},
+			wantQuery:  `SELECT block_height, tx_pos, output_index, tx_hash, output_id, type, purpose, asset_id, asset_alias, asset_definition, asset_tags, asset_local, amount, account_id, account_alias, account_tags, control_program, reference_data, local FROM "annotated_outputs" AS out WHERE (out."account_id" = 'abc') AND block_height <= $2 AND (upper_inf(timespan) OR upper(timespan) > $1::int8 OR (upper(timespan) = $1::int8 AND NOT EXISTS (SELECT 1 FROM annotated_inputs AS inp JOIN annotated_txs AS tx ON tx.tx_hash = inp.tx_hash WHERE inp.spent_output_id = out.output_id AND tx.block_height <= $2))) AND (block_height, tx_pos, output_index) < ($3, $4, $5) ORDER BY block_height DESC, tx_pos DESC, output_index DESC LIMIT 10`,
+			wantValues: []interface{}{nowMillis, uint64(5), uint64(4), uint32(1), uint32(0)},
+		},
 	}
 
 	for i, tc := range testCases {
@@ -124,7 +136,7 @@ func TestConstructOutputsQuery(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		query, values := constructOutputsQuery(expr, tc.values, nowMillis, tc.after, 10)
+		query, values := constructOutputsQuery(expr, tc.values, nowMillis, tc.asOfHeight, tc.after, 10)
 		if query != tc.wantQuery {
 			t.Errorf("case %d: got %s want %s", i, query, tc.wantQuery)
 		}
@@ -3,6 +3,7 @@ package query_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
@@ -15,7 +16,10 @@ import (
 	"chain/core/pin"
 	"chain/core/query"
 	"chain/core/query/filter"
+	"chain/core/txbuilder"
 	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol"
 	"chain/protocol/bc"
 	"chain/protocol/prottest"
 	"chain/testutil"
@@ -176,7 +180,7 @@ func TestQueryOutputs(t *testing.T) {
 	}
 
 	for i, tc := range cases {
-		outputs, _, err := indexer.Outputs(ctx, tc.filter, tc.values, bc.Millis(tc.when), nil, 1000)
+		outputs, _, err := indexer.Outputs(ctx, tc.filter, tc.values, bc.Millis(tc.when), 0, nil, 1000)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -314,7 +318,7 @@ func TestQueryBalances(t *testing.T) {
 			fields = append(fields, f)
 		}
 
-		balances, err := indexer.Balances(ctx, tc.predicate, tc.values, fields, bc.Millis(tc.when))
+		balances, _, err := indexer.Balances(ctx, tc.predicate, tc.values, fields, bc.Millis(tc.when), 0, nil, 0)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -330,6 +334,180 @@ func TestQueryBalances(t *testing.T) {
 	}
 }
 
+func TestQueryBalanceHistory(t *testing.T) {
+	ctx, indexer, time1, time2, acct1, _, asset1, asset2 := setupQueryTest(t)
+
+	f, err := filter.ParseField("asset_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	startMS, endMS := bc.Millis(time1), bc.Millis(time2)
+	buckets, err := indexer.BalanceHistory(ctx, "account_id = $1", []interface{}{acct1}, []filter.Field{f}, startMS, endMS, endMS-startMS)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	want := `[
+		{"timestamp": "` + time.Unix(0, int64(startMS)*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano) + `", "balances": []},
+		{"timestamp": "` + time.Unix(0, int64(endMS)*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano) + `", "balances": [
+			{"sum_by": {"asset_id": "` + asset1.String() + `"}, "amount": 867},
+			{"sum_by": {"asset_id": "` + asset2.String() + `"}, "amount": 100}
+		]}
+	]`
+	var wantJSON interface{}
+	err = json.Unmarshal([]byte(want), &wantJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := jsonRT(t, buckets)
+
+	// The order of the groups within a bucket is unspecified.
+	if items := got.([]interface{}); len(items) == 2 {
+		balances := items[1].(map[string]interface{})["balances"].([]interface{})
+		if len(balances) == 2 && balances[0].(map[string]interface{})["amount"].(float64) != 867 {
+			balances[0], balances[1] = balances[1], balances[0]
+		}
+	}
+	if !testutil.DeepEqual(got, wantJSON) {
+		t.Errorf("got:\n%s\nwant:\n%s", spew.Sdump(got), spew.Sdump(wantJSON))
+	}
+}
+
+func TestQueryBalancesPagination(t *testing.T) {
+	ctx, indexer, _, time2, _, _, asset1, asset2 := setupQueryTest(t)
+
+	f, err := filter.ParseField("asset_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sumBy := []filter.Field{f}
+
+	// Page through the balances one at a time.
+	var (
+		got   []interface{}
+		after query.BalancesAfter
+	)
+	for i := 0; i < 3; i++ {
+		var page []interface{}
+		page, after, err = indexer.Balances(ctx, "", nil, sumBy, bc.Millis(time2), 0, after, 1)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		got = append(got, page...)
+		if len(page) < 1 {
+			break
+		}
+	}
+
+	first, second := asset1.String(), asset2.String()
+	firstAmount, secondAmount := 867, 100
+	if second < first {
+		first, second = second, first
+		firstAmount, secondAmount = secondAmount, firstAmount
+	}
+	want := fmt.Sprintf(`[{"sum_by": {"asset_id": %q}, "amount": %d}, {"sum_by": {"asset_id": %q}, "amount": %d}]`,
+		first, firstAmount, second, secondAmount)
+	var wantJSON []interface{}
+	err = json.Unmarshal([]byte(want), &wantJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !testutil.DeepEqual(jsonRT(t, got), wantJSON) {
+		t.Errorf("paged balances = %v want %v", jsonRT(t, got), wantJSON)
+	}
+}
+
+func TestQueryAsOfHeight(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	pinStore := pin.NewStore(db)
+	coretest.CreatePins(ctx, t, pinStore)
+	indexer := query.NewIndexer(db, c, pinStore)
+	accounts := account.NewManager(db, c, pinStore)
+	assets := asset.NewRegistry(db, c, pinStore)
+	indexer.RegisterAnnotator(accounts.AnnotateTxs)
+	indexer.RegisterAnnotator(assets.AnnotateTxs)
+	go assets.ProcessBlocks(ctx)
+	go accounts.ProcessBlocks(ctx)
+	go indexer.ProcessBlocks(ctx)
+
+	acct1 := coretest.CreateAccount(ctx, t, accounts, "", nil)
+	acct2 := coretest.CreateAccount(ctx, t, accounts, "", nil)
+	asset1 := coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+
+	g := generator.New(c, nil, db)
+	coretest.IssueAssets(ctx, t, c, g, assets, accounts, asset1, 867, acct1)
+	issueBlock := prottest.MakeBlock(t, c, g.PendingTxs())
+	<-pinStore.AllWaiter(issueBlock.Height)
+
+	// Transfer the assets in a block with the same timestamp
+	// as the issuance, so timestamps can't tell them apart.
+	coretest.Transfer(ctx, t, c, g, []txbuilder.Action{
+		accounts.NewSpendAction(bc.AssetAmount{AssetID: asset1, Amount: 867}, acct1, nil, nil),
+		accounts.NewControlAction(bc.AssetAmount{AssetID: asset1, Amount: 867}, acct2, nil),
+	})
+	prev, snapshot := c.State()
+	transferBlock, snapshot, err := c.GenerateBlock(ctx, prev, snapshot, issueBlock.Time(), g.PendingTxs())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.CommitBlock(ctx, transferBlock, snapshot)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	<-pinStore.PinWaiter(query.TxPinName, transferBlock.Height)
+
+	cases := []struct {
+		height uint64
+		want   map[string]uint64 // account ID -> balance
+	}{
+		{issueBlock.Height - 1, map[string]uint64{}},
+		{issueBlock.Height, map[string]uint64{acct1: 867}},
+		{transferBlock.Height, map[string]uint64{acct2: 867}},
+	}
+	f, err := filter.ParseField("account_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sumBy := []filter.Field{f}
+
+	for _, tc := range cases {
+		balances, _, err := indexer.Balances(ctx, "asset_id = $1", []interface{}{asset1.String()}, sumBy, 0, tc.height, nil, 0)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		got := make(map[string]uint64)
+		items, _ := jsonRT(t, balances).([]interface{})
+		for _, b := range items {
+			b := b.(map[string]interface{})
+			acct := b["sum_by"].(map[string]interface{})["account_id"].(string)
+			got[acct] = uint64(b["amount"].(float64))
+		}
+		if !testutil.DeepEqual(got, tc.want) {
+			t.Errorf("balances as of height %d = %v, want %v", tc.height, got, tc.want)
+		}
+
+		outputs, _, err := indexer.Outputs(ctx, "asset_id = $1", []interface{}{asset1.String()}, 0, tc.height, nil, 1000)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if len(outputs) != len(tc.want) {
+			t.Errorf("got %d outputs as of height %d, want %d", len(outputs), tc.height, len(tc.want))
+		}
+		for _, out := range outputs {
+			if out.Amount != tc.want[out.AccountID] {
+				t.Errorf("output as of height %d: account %s amount %d, want %d", tc.height, out.AccountID, out.Amount, tc.want[out.AccountID])
+			}
+		}
+	}
+
+	_, _, err = indexer.Balances(ctx, "", nil, sumBy, 0, transferBlock.Height+1, nil, 0)
+	if errors.Root(err) != protocol.ErrTheDistantFuture {
+		t.Errorf("balances as of future height: got error %v, want %v", err, protocol.ErrTheDistantFuture)
+	}
+}
+
 // jsonRT does a JSON round trip -- it marshals v
 // then unmarshals the resutling JSON into an interface{}.
 // This normalizes the types so it can be more easily compared
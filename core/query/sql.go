@@ -1,6 +1,9 @@
 package query
 
 import (
+	"bytes"
+	"encoding/json"
+
 	"chain/core/query/filter"
 )
 
@@ -90,3 +93,18 @@ var (
 		},
 	}
 )
+
+// filterEnv returns the environment for evaluating a filter
+// in memory against v, an annotated object, by decoding its
+// JSON representation.
+func filterEnv(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var env map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	err = dec.Decode(&env)
+	return env, err
+}
@@ -55,6 +55,16 @@ func ValidateTransactionFilter(filt string) error {
 	return err
 }
 
+// TransactionFilterParameters returns the number of
+// parameter values the transaction filter `filt` uses.
+func TransactionFilterParameters(filt string) (int, error) {
+	p, err := filter.Parse(filt, transactionsTable, nil)
+	if err != nil {
+		return 0, err
+	}
+	return p.Parameters, nil
+}
+
 // LookupTxAfter looks up the transaction `after` for the provided time range.
 func (ind *Indexer) LookupTxAfter(ctx context.Context, begin, end uint64) (TxAfter, error) {
 	const q = `
@@ -97,6 +107,55 @@ func (ind *Indexer) Transactions(ctx context.Context, filt string, vals []interf
 	return ind.fetchTransactions(ctx, queryStr, queryArgs, after, limit)
 }
 
+// TransactionsSince returns, in ascending order, the transactions
+// matching the filter predicate `filt` that come after `after`,
+// up to and including block after.StopBlockHeight. Unlike an
+// ascending call to Transactions, it doesn't wait for matching
+// transactions to be indexed.
+func (ind *Indexer) TransactionsSince(ctx context.Context, filt string, vals []interface{}, after TxAfter, limit int) ([]*AnnotatedTx, *TxAfter, error) {
+	p, err := filter.Parse(filt, transactionsTable, vals)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(vals) != p.Parameters {
+		return nil, nil, ErrParameterCountMismatch
+	}
+	expr, err := filter.AsSQL(p, transactionsTable, vals)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "converting to SQL")
+	}
+
+	queryStr, queryArgs := constructTransactionsQuery(expr, vals, after, true, limit)
+	return ind.fetchTransactions(ctx, queryStr, queryArgs, after, limit)
+}
+
+// MatchTransaction reports whether tx satisfies the transaction
+// filter predicate `filt`, evaluating it in memory rather than
+// in the database.
+func MatchTransaction(filt string, vals []interface{}, tx *AnnotatedTx) (bool, error) {
+	p, err := filter.Parse(filt, transactionsTable, vals)
+	if err != nil {
+		return false, err
+	}
+	if len(vals) != p.Parameters {
+		return false, ErrParameterCountMismatch
+	}
+	env, err := filterEnv(tx)
+	if err != nil {
+		return false, err
+	}
+
+	// Outputs annotated as part of a transaction omit the
+	// transaction ID, but annotated_outputs records it.
+	outs, _ := env["outputs"].([]interface{})
+	for _, out := range outs {
+		if out, ok := out.(map[string]interface{}); ok {
+			out["transaction_id"] = tx.ID.String()
+		}
+	}
+	return filter.Eval(p, transactionsTable, env, vals)
+}
+
 // If asc is true, the transactions will be returned from "in front" of the `after`
 // param (e.g., the oldest transaction immediately after the `after` param,
 // followed by the second oldest, etc) in ascending order.
@@ -4,11 +4,13 @@ import (
 	"context"
 	"math"
 	"testing"
+	"time"
 
 	"chain/core/query/filter"
 	"chain/database/pg/pgtest"
 	"chain/errors"
 	"chain/protocol"
+	"chain/protocol/bc"
 	"chain/testutil"
 )
 
@@ -131,3 +133,56 @@ EXISTS(SELECT 1 FROM annotated_outputs AS out WHERE out."tx_hash" = txs."tx_hash
 		}
 	}
 }
+
+func TestMatchTransaction(t *testing.T) {
+	tx := &AnnotatedTx{
+		ID:            bc.Hash{1},
+		Timestamp:     time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC),
+		BlockHeight:   10,
+		ReferenceData: raw(`{"corporate": "corp", "priority": 2}`),
+		IsLocal:       true,
+		Inputs: []*AnnotatedInput{{
+			Type:      "issue",
+			AssetID:   bc.AssetID{2},
+			Amount:    100,
+			AccountID: "acc123",
+		}},
+		Outputs: []*AnnotatedOutput{{
+			Type:        "control",
+			AssetID:     bc.AssetID{2},
+			Amount:      100,
+			AccountTags: raw(`{"branch": "NYC1"}`),
+		}},
+	}
+
+	testCases := []struct {
+		filter string
+		values []interface{}
+		want   bool
+	}{
+		{filter: ``, want: true},
+		{filter: `is_local = 'yes' AND block_height >= 10`, want: true},
+		{filter: `timestamp < '2017-02-01T00:00:00Z'`, want: false},
+		{filter: `reference_data.corporate = $1 AND reference_data.priority > 1`, values: []interface{}{"corp"}, want: true},
+		{filter: `inputs(type = 'issue' AND asset_id = $1)`, values: []interface{}{bc.AssetID{2}.String()}, want: true},
+		{filter: `inputs(account_id = 'acc456')`, want: false},
+		{filter: `outputs(account_tags.branch = 'NYC1' AND transaction_id = $1)`, values: []interface{}{tx.ID.String()}, want: true},
+		{filter: `NOT (outputs(account_alias = 'alice'))`, want: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := MatchTransaction(tc.filter, tc.values, tx)
+		if err != nil {
+			t.Errorf("MatchTransaction(%q) error: %s", tc.filter, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("MatchTransaction(%q) = %t, want %t", tc.filter, got, tc.want)
+		}
+	}
+
+	_, err := MatchTransaction(`block_height = $1`, nil, tx)
+	if errors.Root(err) != ErrParameterCountMismatch {
+		t.Errorf("MatchTransaction with missing value: got error %v, want %v", err, ErrParameterCountMismatch)
+	}
+}
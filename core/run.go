@@ -9,6 +9,7 @@ import (
 	"chain/core/accesstoken"
 	"chain/core/account"
 	"chain/core/asset"
+	"chain/core/blocksigner"
 	"chain/core/config"
 	"chain/core/fetch"
 	"chain/core/generator"
@@ -69,6 +70,24 @@ func GeneratorRemote(client *rpc.Client) RunOption {
 	}
 }
 
+// BlockPeers configures the launched Core to fetch blocks and
+// snapshots from the provided peers, as well as from the remote
+// generator. Peers may be other Cores on the same blockchain, or
+// block caches. The Core downloads from whichever peers are
+// healthy, so it keeps up even if the generator is slow or
+// unreachable.
+func BlockPeers(clients ...*rpc.Client) RunOption {
+	return func(a *API) { a.blockPeers = append(a.blockPeers, clients...) }
+}
+
+// SignerPeers configures the launched Core to exchange the block
+// headers its block signer was asked to sign with the provided
+// peers, other members of the federation, and to check them all
+// for evidence that the generator equivocated.
+func SignerPeers(clients ...*rpc.Client) RunOption {
+	return func(a *API) { a.signerPeers = append(a.signerPeers, clients...) }
+}
+
 // IndexTransactions configures whether or not transactions should be
 // annotated and indexed for the query engine.
 func IndexTransactions(b bool) RunOption {
@@ -160,9 +179,17 @@ func Run(
 	if a.remoteGenerator == nil && a.generator == nil {
 		return nil, errors.New("no generator configured")
 	}
+	if a.remoteGenerator != nil {
+		a.fetchPeers = []*fetch.Peer{{Client: a.remoteGenerator}}
+		for _, client := range a.blockPeers {
+			a.fetchPeers = append(a.fetchPeers, &fetch.Peer{Client: client})
+		}
+	}
 
 	if a.indexTxs {
 		go pinStore.Listen(ctx, query.TxPinName, dbURL)
+		go pinStore.Listen(ctx, txfeed.WebhookPinName, dbURL)
+		a.txFeedWebhooks = txfeed.NewDispatcher(a.txFeeds, a.indexer, c, pinStore)
 		a.indexer.RegisterAnnotator(a.assets.AnnotateTxs)
 		a.indexer.RegisterAnnotator(a.accounts.AnnotateTxs)
 		a.assets.IndexAssets(a.indexer)
@@ -189,11 +216,11 @@ func Run(
 // becomes leader of the Core.
 func (a *API) lead(ctx context.Context) {
 	if !a.config.IsGenerator {
-		fetch.Init(ctx, a.remoteGenerator)
-		// If don't have any blocks, bootstrap from the generator's
-		// latest snapshot.
+		fetch.Init(ctx, a.fetchPeers)
+		// If don't have any blocks, bootstrap from the latest
+		// snapshot of the generator or another peer.
 		if a.chain.Height() == 0 {
-			fetch.BootstrapSnapshot(ctx, a.chain, a.store, a.remoteGenerator, a.healthSetter("fetch"))
+			fetch.BootstrapSnapshot(ctx, a.chain, a.store, a.fetchPeers, a.healthSetter("fetch"))
 		}
 	}
 
@@ -210,6 +237,9 @@ func (a *API) lead(ctx context.Context) {
 		pinHeight = pinHeight - 1
 	}
 	pins := []string{account.PinName, account.ExpirePinName, account.DeleteSpentsPinName, asset.PinName, query.TxPinName}
+	if a.indexTxs {
+		pins = append(pins, txfeed.WebhookPinName)
+	}
 	for _, p := range pins {
 		err = a.pinStore.CreatePin(ctx, p, pinHeight)
 		if err != nil {
@@ -220,11 +250,15 @@ func (a *API) lead(ctx context.Context) {
 	if a.config.IsGenerator {
 		go a.generator.Generate(ctx, blockPeriod, a.healthSetter("generator"), recoveredBlock, recoveredSnapshot)
 	} else {
-		go fetch.Fetch(ctx, a.chain, a.remoteGenerator, a.healthSetter("fetch"), recoveredBlock, recoveredSnapshot)
+		go fetch.Fetch(ctx, a.chain, a.fetchPeers, a.healthSetter("fetch"), recoveredBlock, recoveredSnapshot)
+	}
+	if len(a.signerPeers) > 0 {
+		go blocksigner.WatchEquivocation(ctx, a.db, a.chain, a.signerPeers, a.healthSetter("equivocation"))
 	}
 	go a.accounts.ProcessBlocks(ctx)
 	go a.assets.ProcessBlocks(ctx)
 	if a.indexTxs {
 		go a.indexer.ProcessBlocks(ctx)
+		go a.txFeedWebhooks.ProcessBlocks(ctx)
 	}
 }
@@ -179,7 +179,21 @@ CREATE TABLE account_control_programs (
     key_index bigint NOT NULL,
     control_program bytea NOT NULL,
     change boolean NOT NULL,
-    expires_at timestamp with time zone
+    expires_at timestamp with time zone,
+    signer_version integer DEFAULT 1 NOT NULL
+);
+
+
+--
+-- Name: account_spends; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE account_spends (
+    account_id text NOT NULL,
+    asset_id bytea NOT NULL,
+    tx_hash bytea NOT NULL,
+    amount bigint NOT NULL,
+    spent_at timestamp with time zone NOT NULL
 );
 
 
@@ -198,7 +212,8 @@ CREATE TABLE account_utxos (
     source_id bytea NOT NULL,
     source_pos bigint NOT NULL,
     ref_data_hash bytea NOT NULL,
-    change boolean NOT NULL
+    change boolean NOT NULL,
+    signer_version integer DEFAULT 1 NOT NULL
 );
 
 
@@ -209,7 +224,8 @@ CREATE TABLE account_utxos (
 CREATE TABLE accounts (
     account_id text NOT NULL,
     tags jsonb,
-    alias text
+    alias text,
+    policy jsonb
 );
 
 
@@ -464,7 +480,31 @@ CREATE TABLE mockhsm (
     prv bytea NOT NULL,
     alias text,
     sort_id bigint DEFAULT nextval('mockhsm_sort_id_seq'::regclass) NOT NULL,
-    key_type text DEFAULT 'chain_kd'::text NOT NULL
+    key_type text DEFAULT 'chain_kd'::text NOT NULL,
+    encrypted boolean DEFAULT false NOT NULL
+);
+
+
+--
+-- Name: mockhsm_keyring; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE mockhsm_keyring (
+    singleton boolean DEFAULT true NOT NULL,
+    sealed_key bytea NOT NULL,
+    CONSTRAINT mockhsm_keyring_singleton CHECK (singleton)
+);
+
+
+--
+-- Name: next_consensus_program; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE next_consensus_program (
+    singleton boolean DEFAULT true NOT NULL,
+    program bytea NOT NULL,
+    signers bytea,
+    CONSTRAINT next_consensus_program_singleton CHECK (singleton)
 );
 
 
@@ -488,6 +528,21 @@ CREATE TABLE signed_blocks (
 );
 
 
+--
+-- Name: signer_headers; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE signer_headers (
+    block_height bigint NOT NULL,
+    block_hash bytea NOT NULL,
+    pubkey bytea NOT NULL,
+    header bytea NOT NULL,
+    signature bytea,
+    rejection text,
+    recorded_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
 --
 -- Name: signers; Type: TABLE; Schema: public; Owner: -
 --
@@ -498,7 +553,8 @@ CREATE TABLE signers (
     key_index bigint NOT NULL,
     quorum integer NOT NULL,
     client_token text,
-    xpubs bytea[] NOT NULL
+    xpubs bytea[] NOT NULL,
+    version integer DEFAULT 1 NOT NULL
 );
 
 
@@ -521,6 +577,19 @@ CREATE SEQUENCE signers_key_index_seq
 ALTER SEQUENCE signers_key_index_seq OWNED BY signers.key_index;
 
 
+--
+-- Name: signer_versions; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE signer_versions (
+    signer_id text NOT NULL,
+    version integer NOT NULL,
+    xpubs bytea[] NOT NULL,
+    quorum integer NOT NULL,
+    retired_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
 --
 -- Name: snapshots; Type: TABLE; Schema: public; Owner: -
 --
@@ -552,7 +621,9 @@ CREATE TABLE txfeeds (
     alias text,
     filter text,
     after text,
-    client_token text
+    client_token text,
+    webhook_url text,
+    webhook_secret text
 );
 
 
@@ -587,6 +658,14 @@ ALTER TABLE ONLY accounts
     ADD CONSTRAINT account_tags_pkey PRIMARY KEY (account_id);
 
 
+--
+-- Name: account_spends_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY account_spends
+    ADD CONSTRAINT account_spends_pkey PRIMARY KEY (tx_hash, account_id, asset_id);
+
+
 --
 -- Name: account_utxos_output_id_key; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -755,6 +834,14 @@ ALTER TABLE ONLY mockhsm
     ADD CONSTRAINT mockhsm_alias_key UNIQUE (alias);
 
 
+--
+-- Name: mockhsm_keyring_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY mockhsm_keyring
+    ADD CONSTRAINT mockhsm_keyring_pkey PRIMARY KEY (singleton);
+
+
 --
 -- Name: mockhsm_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -763,6 +850,14 @@ ALTER TABLE ONLY mockhsm
     ADD CONSTRAINT mockhsm_pkey PRIMARY KEY (pub);
 
 
+--
+-- Name: next_consensus_program_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY next_consensus_program
+    ADD CONSTRAINT next_consensus_program_pkey PRIMARY KEY (singleton);
+
+
 --
 -- Name: query_blocks_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -771,6 +866,22 @@ ALTER TABLE ONLY query_blocks
     ADD CONSTRAINT query_blocks_pkey PRIMARY KEY (height);
 
 
+--
+-- Name: signer_headers_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY signer_headers
+    ADD CONSTRAINT signer_headers_pkey PRIMARY KEY (block_height, block_hash, pubkey);
+
+
+--
+-- Name: signer_versions_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY signer_versions
+    ADD CONSTRAINT signer_versions_pkey PRIMARY KEY (signer_id, version);
+
+
 --
 -- Name: signers_client_token_key; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -835,6 +946,20 @@ ALTER TABLE ONLY txfeeds
     ADD CONSTRAINT txfeeds_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: account_spends_account_id_asset_id_spent_at_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX account_spends_account_id_asset_id_spent_at_idx ON account_spends USING btree (account_id, asset_id, spent_at);
+
+
+--
+-- Name: account_utxos_account_id_signer_version_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX account_utxos_account_id_signer_version_idx ON account_utxos USING btree (account_id, signer_version);
+
+
 --
 -- Name: account_utxos_asset_id_account_id_confirmed_in_idx; Type: INDEX; Schema: public; Owner: -
 --
@@ -884,6 +1009,13 @@ CREATE INDEX query_blocks_timestamp_idx ON query_blocks USING btree ("timestamp"
 CREATE UNIQUE INDEX signed_blocks_block_height_idx ON signed_blocks USING btree (block_height);
 
 
+--
+-- Name: signer_headers_recorded_at_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX signer_headers_recorded_at_idx ON signer_headers USING btree (recorded_at);
+
+
 --
 -- Name: signers_type_id_idx; Type: INDEX; Schema: public; Owner: -
 --
@@ -901,3 +1033,10 @@ insert into migrations (filename, hash) values ('2017-02-16.0.query.spent-output
 insert into migrations (filename, hash) values ('2017-02-28.0.core.remove-outpoints.sql', '067638e2a826eac70d548f2d6bb234660f3200064072baf42db741456ecf8deb');
 insert into migrations (filename, hash) values ('2017-03-02.0.core.add-output-source-info.sql', 'f44c7cfbff346f6f797d497910c0a76f2a7600ca8b5be4fe4e4a04feaf32e0df');
 insert into migrations (filename, hash) values ('2017-03-09.0.core.account-utxos-change.sql', 'a99e0e41be3da126a8c47151454098669334bf7e30de6cd539ba535add4e85d1');
+insert into migrations (filename, hash) values ('2017-03-13.0.core.txfeed-webhooks.sql', 'afe87b32d1be46e897057b33a96563709adc539a33047feae32b5435edaa6767');
+insert into migrations (filename, hash) values ('2017-03-14.0.account.spending-policies.sql', '3d7945baac6d28db5926e6f58fbff5204207bdf628bffc9f8c7695f55c08bc62');
+insert into migrations (filename, hash) values ('2017-03-15.0.signers.key-rotation.sql', 'f2e44dd46568e90bfc39924566c72c9c64e46c5d71a67a666911c4442cf1417b');
+insert into migrations (filename, hash) values ('2017-03-16.0.core.next-consensus-program.sql', '8cf8ac0cd5b5e898970ec8dab29ea450dc628d9ac838105dcc4e5944f7246a96');
+insert into migrations (filename, hash) values ('2017-03-17.0.signer.signer-headers.sql', '8f1df826ca4b3fca0cb4269bb0e9fdb6276ae3fd3cf92a02f7679d09d2853310');
+insert into migrations (filename, hash) values ('2017-03-20.0.core.mockhsm-encryption.sql', '77ac01ad5d9332f8ff65bfbd40435a54dfd342757cba59fd073199f8cee89e3e');
+insert into migrations (filename, hash) values ('2017-03-21.0.core.next-consensus-signers.sql', '7b93b02f1e82c1025f6c8dff5bd5df4966d7f6a5de3213d9f80df16ee6014951');
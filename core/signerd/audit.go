@@ -0,0 +1,123 @@
+package signerd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// An AuditEntry records one decision by the signer
+// to sign a block or to refuse.
+type AuditEntry struct {
+	Time      time.Time          `json:"time"`
+	RequestID string             `json:"request_id,omitempty"`
+	Client    string             `json:"client"`
+	Pubkey    chainjson.HexBytes `json:"pubkey"`
+	Height    uint64             `json:"height"`
+	BlockHash bc.Hash            `json:"block_hash"`
+	Signed    bool               `json:"signed"`
+	Reason    string             `json:"reason,omitempty"`
+}
+
+// AuditLog is an append-only file of signing decisions,
+// one JSON AuditEntry per line.
+//
+// The Server records each decision, and syncs it to disk,
+// before it responds, so the log holds every signature
+// the signer has handed out. The Server also reads the log
+// when it starts, to recover which blocks it has signed.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// OpenAuditLog opens the audit log at path,
+// creating it if it doesn't exist.
+//
+// It removes an incomplete last line, left by a crash
+// partway through a write, so that new entries start on
+// a line of their own. The decision it recorded was never
+// acted on.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "reading audit log")
+	}
+	if n := bytes.LastIndexByte(data, '\n') + 1; n < len(data) {
+		err = os.Truncate(path, int64(n))
+		if err != nil {
+			return nil, errors.Wrap(err, "truncating audit log")
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening audit log")
+	}
+	return &AuditLog{path: path, f: f}, nil
+}
+
+// Record appends e to the log and syncs it to disk.
+func (l *AuditLog) Record(e *AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.f.Write(line)
+	if err != nil {
+		return errors.Wrap(err, "writing audit log")
+	}
+	return errors.Wrap(l.f.Sync(), "syncing audit log")
+}
+
+// Entries reads all the entries in the log.
+func (l *AuditLog) Entries() ([]*AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening audit log")
+	}
+	defer f.Close()
+	return readAuditEntries(f)
+}
+
+// Close closes the log file.
+func (l *AuditLog) Close() error {
+	return l.f.Close()
+}
+
+// readAuditEntries reads the entries from r.
+func readAuditEntries(r io.Reader) ([]*AuditEntry, error) {
+	var entries []*AuditEntry
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return entries, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrap(err, "reading audit log")
+		}
+		e := new(AuditEntry)
+		err = json.Unmarshal(line, e)
+		if err != nil {
+			return nil, errors.Wrapf(err, "audit log line %d", n)
+		}
+		entries = append(entries, e)
+	}
+}
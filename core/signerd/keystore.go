@@ -0,0 +1,165 @@
+package signerd
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"chain/crypto/ed25519"
+	"chain/crypto/passphrase"
+	"chain/errors"
+)
+
+// ErrNoKey is returned by a KeyStore asked to
+// sign with a key it doesn't have.
+var ErrNoKey = errors.New("key not found")
+
+// A KeyStore holds block signing keys. Private keys never
+// leave it; it only hands out public keys and signatures.
+type KeyStore interface {
+	// CreateKey makes a new key pair
+	// and returns its public key.
+	CreateKey(ctx context.Context) (ed25519.PublicKey, error)
+
+	// PublicKeys returns the public keys
+	// of all the keys in the store.
+	PublicKeys(ctx context.Context) ([]ed25519.PublicKey, error)
+
+	// Sign signs msg with the private key for pub.
+	// It returns ErrNoKey if the store has no such key.
+	Sign(ctx context.Context, pub ed25519.PublicKey, msg []byte) ([]byte, error)
+}
+
+const keyFileExt = ".key"
+
+// FileStore is a KeyStore that keeps each key in a file in one
+// directory, encrypted with a passphrase as in package passphrase.
+// Each file is named for the hex of its public key.
+//
+// It decrypts the keys when it's opened and keeps them in memory.
+type FileStore struct {
+	dir        string
+	passphrase []byte
+
+	mu   sync.Mutex
+	keys map[string]ed25519.PrivateKey // by string(pub)
+}
+
+// OpenFileStore opens the file store in dir, creating the
+// directory if it doesn't exist, and decrypts the keys in it
+// with passphrase.
+func OpenFileStore(dir string, pass []byte) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "making key directory")
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"+keyFileExt))
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	s := &FileStore{
+		dir:        dir,
+		passphrase: pass,
+		keys:       make(map[string]ed25519.PrivateKey),
+	}
+	for _, name := range names {
+		pub, err := hex.DecodeString(strings.TrimSuffix(filepath.Base(name), keyFileExt))
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			continue // not one of ours
+		}
+		sealed, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading key file")
+		}
+		prv, err := passphrase.Open(sealed, pass)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decrypting %s", name)
+		}
+		if len(prv) != ed25519.PrivateKeySize || !bytes.Equal(ed25519.PrivateKey(prv).Public().(ed25519.PublicKey), pub) {
+			return nil, errors.Wrapf(errors.New("key doesn't match file name"), "decrypting %s", name)
+		}
+		s.keys[string(pub)] = prv
+	}
+	return s, nil
+}
+
+// CreateKey makes a new key pair and saves it, encrypted,
+// in its own file.
+func (s *FileStore) CreateKey(ctx context.Context) (ed25519.PublicKey, error) {
+	pub, prv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	sealed, err := passphrase.Seal(prv, s.passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = writeFileAtomic(filepath.Join(s.dir, hex.EncodeToString(pub)+keyFileExt), sealed)
+	if err != nil {
+		return nil, err
+	}
+	s.keys[string(pub)] = prv
+	return pub, nil
+}
+
+// PublicKeys returns the public keys in s, in sorted order.
+func (s *FileStore) PublicKeys(ctx context.Context) ([]ed25519.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedKeys(s.keys), nil
+}
+
+// Sign signs msg with the private key for pub.
+func (s *FileStore) Sign(ctx context.Context, pub ed25519.PublicKey, msg []byte) ([]byte, error) {
+	s.mu.Lock()
+	prv, ok := s.keys[string(pub)]
+	s.mu.Unlock()
+	if !ok {
+		return nil, errors.WithDetailf(ErrNoKey, "pubkey %x", []byte(pub))
+	}
+	return ed25519.Sign(prv, msg), nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames
+// it to name, so that name never holds a partial key.
+func writeFileAtomic(name string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), ".tmp")
+	if err != nil {
+		return errors.Wrap(err, "creating key file")
+	}
+	defer os.Remove(f.Name()) // no-op after a successful rename
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrap(err, "writing key file")
+	}
+	return errors.Wrap(os.Rename(f.Name(), name), "renaming key file")
+}
+
+func sortedKeys(keys map[string]ed25519.PrivateKey) []ed25519.PublicKey {
+	var strs []string
+	for pub := range keys {
+		strs = append(strs, pub)
+	}
+	sort.Strings(strs)
+	pubs := make([]ed25519.PublicKey, 0, len(strs))
+	for _, pub := range strs {
+		pubs = append(pubs, ed25519.PublicKey(pub))
+	}
+	return pubs
+}
@@ -0,0 +1,99 @@
+package signerd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"chain/crypto/ed25519"
+	"chain/crypto/passphrase"
+	"chain/errors"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "signerd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := OpenFileStore(dir, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := s.CreateKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenFileStore(dir, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubs, err := s.PublicKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pubs) != 1 || string(pubs[0]) != string(pub) {
+		t.Fatalf("PublicKeys() = %x, want [%x]", pubs, pub)
+	}
+	msg := []byte("message")
+	sig, err := s.Sign(ctx, pub, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(pub, msg, sig) {
+		t.Error("signature doesn't verify")
+	}
+
+	other, _, _ := ed25519.GenerateKey(nil)
+	_, err = s.Sign(ctx, other, msg)
+	if errors.Root(err) != ErrNoKey {
+		t.Errorf("Sign(unknown key) error = %v, want %v", err, ErrNoKey)
+	}
+
+	_, err = OpenFileStore(dir, []byte("wrong"))
+	if errors.Root(err) != passphrase.ErrWrongPassphrase {
+		t.Errorf("OpenFileStore(wrong passphrase) error = %v, want %v", err, passphrase.ErrWrongPassphrase)
+	}
+}
+
+func TestPKCS11Store(t *testing.T) {
+	ctx := context.Background()
+	token := NewSoftToken("1234")
+
+	bad := NewPKCS11Store(token, "0000", "block")
+	_, err := bad.CreateKey(ctx)
+	if errors.Root(err) != ErrBadPIN {
+		t.Fatalf("CreateKey(wrong PIN) error = %v, want %v", err, ErrBadPIN)
+	}
+
+	s := NewPKCS11Store(token, "1234", "block")
+	pub, err := s.CreateKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewPKCS11Store(token, "1234", "other")
+	_, err = other.CreateKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubs, err := s.PublicKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pubs) != 1 || string(pubs[0]) != string(pub) {
+		t.Fatalf("PublicKeys() = %x, want [%x]", pubs, pub)
+	}
+	msg := []byte("message")
+	sig, err := s.Sign(ctx, pub, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(pub, msg, sig) {
+		t.Error("signature doesn't verify")
+	}
+}
@@ -0,0 +1,179 @@
+package signerd
+
+import (
+	"context"
+	"sync"
+
+	"chain/crypto/ed25519"
+	"chain/errors"
+)
+
+var (
+	// ErrNotLoggedIn is returned by a PKCS11Token used
+	// before a successful Login (CKR_USER_NOT_LOGGED_IN).
+	ErrNotLoggedIn = errors.New("user not logged in")
+
+	// ErrBadPIN is returned by a PKCS11Token
+	// given the wrong PIN (CKR_PIN_INCORRECT).
+	ErrBadPIN = errors.New("incorrect PIN")
+)
+
+// PKCS11Token is the part of a PKCS#11 token that PKCS11Store
+// uses: logging in as the normal user (C_Login), generating an
+// Ed25519 key pair with a label (C_GenerateKeyPair with
+// CKM_EC_EDWARDS_KEY_PAIR_GEN), finding the public keys with a
+// label (C_FindObjects), and signing (C_Sign with CKM_EDDSA).
+//
+// A binding to a PKCS#11 library, such as SoftHSM's, can
+// implement it. SoftToken implements it in memory, for tests
+// and development without any hardware.
+type PKCS11Token interface {
+	Login(pin string) error
+	GenerateKeyPair(label string) (ed25519.PublicKey, error)
+	FindKeys(label string) ([]ed25519.PublicKey, error)
+	Sign(pub ed25519.PublicKey, msg []byte) ([]byte, error)
+}
+
+// PKCS11Store is a KeyStore backed by a PKCS#11 token.
+// It uses the keys on the token with its label.
+type PKCS11Store struct {
+	token PKCS11Token
+	pin   string
+	label string
+
+	// PKCS#11 sessions aren't safe for concurrent use,
+	// so mu serializes calls to the token.
+	mu       sync.Mutex
+	loggedIn bool
+}
+
+// NewPKCS11Store returns a key store for the keys on token
+// labeled label. It logs in with pin on first use.
+func NewPKCS11Store(token PKCS11Token, pin, label string) *PKCS11Store {
+	return &PKCS11Store{token: token, pin: pin, label: label}
+}
+
+// login must be called with s.mu held.
+func (s *PKCS11Store) login() error {
+	if s.loggedIn {
+		return nil
+	}
+	err := s.token.Login(s.pin)
+	if err != nil {
+		return errors.Wrap(err, "logging in to token")
+	}
+	s.loggedIn = true
+	return nil
+}
+
+// CreateKey generates a key pair on the token.
+func (s *PKCS11Store) CreateKey(ctx context.Context) (ed25519.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.login()
+	if err != nil {
+		return nil, err
+	}
+	pub, err := s.token.GenerateKeyPair(s.label)
+	return pub, errors.Wrap(err, "generating key pair")
+}
+
+// PublicKeys returns the public keys on the token with s's label.
+func (s *PKCS11Store) PublicKeys(ctx context.Context) ([]ed25519.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.login()
+	if err != nil {
+		return nil, err
+	}
+	pubs, err := s.token.FindKeys(s.label)
+	return pubs, errors.Wrap(err, "finding keys")
+}
+
+// Sign signs msg on the token with the private key for pub.
+func (s *PKCS11Store) Sign(ctx context.Context, pub ed25519.PublicKey, msg []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.login()
+	if err != nil {
+		return nil, err
+	}
+	return s.token.Sign(pub, msg)
+}
+
+// SoftToken is a PKCS11Token that keeps its keys in memory.
+// It stands in for a software HSM, such as SoftHSM, in tests
+// and development. Its keys don't outlive it.
+type SoftToken struct {
+	pin string
+
+	mu       sync.Mutex
+	loggedIn bool
+	keys     map[string]softKey // by string(pub)
+}
+
+type softKey struct {
+	label string
+	prv   ed25519.PrivateKey
+}
+
+// NewSoftToken returns an empty token whose user PIN is pin.
+func NewSoftToken(pin string) *SoftToken {
+	return &SoftToken{pin: pin, keys: make(map[string]softKey)}
+}
+
+// Login logs in to t if pin is its user PIN.
+func (t *SoftToken) Login(pin string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if pin != t.pin {
+		return ErrBadPIN
+	}
+	t.loggedIn = true
+	return nil
+}
+
+// GenerateKeyPair makes a key pair labeled label.
+func (t *SoftToken) GenerateKeyPair(label string) (ed25519.PublicKey, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.loggedIn {
+		return nil, ErrNotLoggedIn
+	}
+	pub, prv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	t.keys[string(pub)] = softKey{label: label, prv: prv}
+	return pub, nil
+}
+
+// FindKeys returns the public keys labeled label.
+func (t *SoftToken) FindKeys(label string) ([]ed25519.PublicKey, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.loggedIn {
+		return nil, ErrNotLoggedIn
+	}
+	keys := make(map[string]ed25519.PrivateKey)
+	for pub, k := range t.keys {
+		if k.label == label {
+			keys[pub] = k.prv
+		}
+	}
+	return sortedKeys(keys), nil
+}
+
+// Sign signs msg with the private key for pub.
+func (t *SoftToken) Sign(pub ed25519.PublicKey, msg []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.loggedIn {
+		return nil, ErrNotLoggedIn
+	}
+	k, ok := t.keys[string(pub)]
+	if !ok {
+		return nil, errors.WithDetailf(ErrNoKey, "pubkey %x", []byte(pub))
+	}
+	return ed25519.Sign(k.prv, msg), nil
+}
@@ -0,0 +1,214 @@
+// Package signerd implements a block signing service for
+// Chain Core signers. It serves the /sign-block request a Core
+// makes of the block HSM at its configured BlockHSMURL, signs
+// with keys from a pluggable KeyStore, and records every
+// decision to sign or refuse in an AuditLog.
+//
+// The service signs at most one block at each height with each
+// key, and never a block lower than one it signed before, even
+// if the Core asking is compromised.
+package signerd
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"chain/crypto/ed25519"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+)
+
+var (
+	// ErrConflict is returned when asked to sign a block at
+	// a height where the key already signed a different block.
+	ErrConflict = errors.New("already signed a different block at this height")
+
+	// ErrRollback is returned when asked to sign a block lower
+	// than the highest block the key has signed.
+	ErrRollback = errors.New("already signed a higher block")
+
+	errUnauthorized = errors.New("unauthorized")
+)
+
+// Server is an http.Handler that serves /sign-block.
+type Server struct {
+	keys   KeyStore
+	audit  *AuditLog
+	tokens map[string]string // secret by token ID
+	mux    *http.ServeMux
+
+	mu     sync.Mutex // serializes signing decisions
+	signed map[string]signedBlock
+}
+
+// signedBlock is the highest block a key has signed.
+type signedBlock struct {
+	height uint64
+	hash   bc.Hash
+}
+
+// NewServer returns a Server that signs with the keys in keys
+// and records its decisions in audit. It reads audit to find
+// the blocks it signed before.
+//
+// Clients must authenticate with HTTP basic auth using one of
+// accessTokens, each in the form "id:secret". If accessTokens
+// is empty, any client may ask for signatures.
+func NewServer(keys KeyStore, audit *AuditLog, accessTokens []string) (*Server, error) {
+	s := &Server{
+		keys:   keys,
+		audit:  audit,
+		mux:    http.NewServeMux(),
+		signed: make(map[string]signedBlock),
+	}
+	if len(accessTokens) > 0 {
+		s.tokens = make(map[string]string)
+		for _, tok := range accessTokens {
+			parts := strings.SplitN(tok, ":", 2)
+			if len(parts) != 2 {
+				return nil, errors.New("access token must be id:secret")
+			}
+			s.tokens[parts[0]] = parts[1]
+		}
+	}
+
+	entries, err := audit.Entries()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Signed {
+			s.noteSigned(ed25519.PublicKey(e.Pubkey), e.Height, e.BlockHash)
+		}
+	}
+
+	h, err := httpjson.Handler(s.signBlock, writeHTTPError)
+	if err != nil {
+		return nil, err
+	}
+	s.mux.Handle("/sign-block", h)
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !s.authenticate(req) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="signerd"`)
+		writeHTTPError(req.Context(), w, errUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, req)
+}
+
+func (s *Server) authenticate(req *http.Request) bool {
+	if s.tokens == nil {
+		return true
+	}
+	id, secret, ok := req.BasicAuth()
+	if !ok {
+		return false
+	}
+	want, ok := s.tokens[id]
+	return ok && subtle.ConstantTimeCompare([]byte(secret), []byte(want)) == 1
+}
+
+type signBlockReq struct {
+	Block  *bc.BlockHeader    `json:"block"`
+	Pubkey chainjson.HexBytes `json:"pubkey"`
+}
+
+// signBlock is the httpjson handler for /sign-block. It
+// responds with the signature of req.Pubkey on the hash of
+// req.Block, or an error if it refuses.
+func (s *Server) signBlock(ctx context.Context, req signBlockReq) ([]byte, error) {
+	if req.Block == nil || len(req.Pubkey) != ed25519.PublicKeySize {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "block and pubkey are required")
+	}
+	pub := ed25519.PublicKey(req.Pubkey)
+	hash := req.Block.Hash()
+
+	e := &AuditEntry{
+		Time:      time.Now().UTC(),
+		Pubkey:    req.Pubkey,
+		Height:    req.Block.Height,
+		BlockHash: hash,
+	}
+	if r := httpjson.Request(ctx); r != nil {
+		e.RequestID = r.Header.Get("Request-ID")
+		e.Client = r.RemoteAddr
+		if id, _, ok := r.BasicAuth(); ok {
+			e.Client = id + "@" + r.RemoteAddr
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sig, err := s.decide(ctx, pub, req.Block.Height, hash)
+	if err != nil {
+		e.Reason = err.Error()
+		rerr := s.audit.Record(e)
+		if rerr != nil {
+			log.Error(ctx, rerr)
+		}
+		return nil, err
+	}
+
+	// Record the signature before handing it out.
+	e.Signed = true
+	err = s.audit.Record(e)
+	if err != nil {
+		return nil, err
+	}
+	s.noteSigned(pub, req.Block.Height, hash)
+	return sig, nil
+}
+
+// decide signs the block with the given height and hash, or
+// returns the reason it won't. It must be called with s.mu held.
+func (s *Server) decide(ctx context.Context, pub ed25519.PublicKey, height uint64, hash bc.Hash) ([]byte, error) {
+	if last, ok := s.signed[string(pub)]; ok {
+		if height < last.height {
+			return nil, errors.WithDetailf(ErrRollback, "signed height %d", last.height)
+		}
+		if height == last.height && hash != last.hash {
+			return nil, errors.WithDetailf(ErrConflict, "signed block %s", last.hash)
+		}
+	}
+	return s.keys.Sign(ctx, pub, hash[:])
+}
+
+func (s *Server) noteSigned(pub ed25519.PublicKey, height uint64, hash bc.Hash) {
+	if last, ok := s.signed[string(pub)]; !ok || height > last.height {
+		s.signed[string(pub)] = signedBlock{height: height, hash: hash}
+	}
+}
+
+func writeHTTPError(ctx context.Context, w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch errors.Root(err) {
+	case httpjson.ErrBadRequest:
+		status = http.StatusBadRequest
+	case errUnauthorized:
+		status = http.StatusUnauthorized
+	case ErrNoKey:
+		status = http.StatusNotFound
+	case ErrConflict, ErrRollback:
+		status = http.StatusConflict
+	}
+	if status == http.StatusInternalServerError {
+		log.Error(ctx, err)
+	}
+
+	body := map[string]string{"message": errors.Root(err).Error()}
+	if detail := errors.Detail(err); detail != "" {
+		body["detail"] = detail
+	}
+	httpjson.Write(ctx, w, status, body)
+}
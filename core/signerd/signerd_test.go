@@ -0,0 +1,178 @@
+package signerd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"chain/core/rpc"
+	"chain/crypto/ed25519"
+	chainjson "chain/encoding/json"
+	"chain/protocol/bc"
+)
+
+func TestSignBlock(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "signerd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	auditPath := filepath.Join(dir, "audit.log")
+
+	keys := NewPKCS11Store(NewSoftToken("1234"), "1234", "block")
+	pub, err := keys.CreateKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit, err := OpenAuditLog(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(keys, audit, []string{"core:secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	// Sign the way cored's remoteHSM asks.
+	client := &rpc.Client{BaseURL: srv.URL, AccessToken: "core:secret"}
+	b2 := &bc.BlockHeader{Height: 2, TimestampMS: 1}
+	var sig []byte
+	err = client.Call(ctx, "/sign-block", signBlockReq{Block: b2, Pubkey: chainjson.HexBytes(pub)}, &sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := b2.Hash()
+	if !ed25519.Verify(pub, hash[:], sig) {
+		t.Fatal("signature doesn't verify")
+	}
+
+	other, _, _ := ed25519.GenerateKey(nil)
+	cases := []struct {
+		name   string
+		token  string
+		block  *bc.BlockHeader
+		pubkey ed25519.PublicKey
+		want   int
+	}{
+		{"same block again", "core:secret", b2, pub, http.StatusOK},
+		{"conflicting block", "core:secret", &bc.BlockHeader{Height: 2, TimestampMS: 2}, pub, http.StatusConflict},
+		{"rollback", "core:secret", &bc.BlockHeader{Height: 1}, pub, http.StatusConflict},
+		{"next block", "core:secret", &bc.BlockHeader{Height: 3}, pub, http.StatusOK},
+		{"unknown key", "core:secret", &bc.BlockHeader{Height: 4}, other, http.StatusNotFound},
+		{"no pubkey", "core:secret", &bc.BlockHeader{Height: 4}, nil, http.StatusBadRequest},
+		{"bad token", "core:wrong", &bc.BlockHeader{Height: 4}, pub, http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		got := postSignBlock(t, srv.URL, c.token, c.block, c.pubkey)
+		if got != c.want {
+			t.Errorf("%s: status = %d, want %d", c.name, got, c.want)
+		}
+	}
+
+	entries, err := audit.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signed, refused int
+	for _, e := range entries {
+		if e.Signed {
+			signed++
+		} else {
+			refused++
+		}
+	}
+	// The bad requests never reach a signing decision.
+	if signed != 3 || refused != 3 {
+		t.Errorf("audit log has %d signed and %d refused, want 3 and 3", signed, refused)
+	}
+	audit.Close()
+
+	// A restarted server must remember what it signed.
+	audit, err = OpenAuditLog(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+	s, err = NewServer(keys, audit, []string{"core:secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv2 := httptest.NewServer(s)
+	defer srv2.Close()
+	got := postSignBlock(t, srv2.URL, "core:secret", &bc.BlockHeader{Height: 3, TimestampMS: 9}, pub)
+	if got != http.StatusConflict {
+		t.Errorf("after restart, conflicting block status = %d, want %d", got, http.StatusConflict)
+	}
+}
+
+func TestOpenAuditLogTornWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signerd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.Record(&AuditEntry{Height: 1, Signed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`{"height":2,"sig`))
+	f.Close()
+
+	l, err = OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	err = l.Record(&AuditEntry{Height: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := l.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Height != 1 || entries[1].Height != 3 {
+		t.Errorf("entries = %+v, want heights 1 and 3", entries)
+	}
+}
+
+func postSignBlock(t *testing.T, url, token string, b *bc.BlockHeader, pub ed25519.PublicKey) int {
+	body, err := json.Marshal(signBlockReq{Block: b, Pubkey: chainjson.HexBytes(pub)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", url+"/sign-block", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.SplitN(token, ":", 2)
+	req.SetBasicAuth(parts[0], parts[1])
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
@@ -59,6 +59,10 @@ type Signer struct {
 	XPubs    []chainkd.XPub
 	Quorum   int
 	KeyIndex uint64
+
+	// Version counts the key rotations of the signer,
+	// starting at 1 for the keys it was created with.
+	Version int
 }
 
 // Path returns the complete path for derived keys
@@ -75,28 +79,42 @@ func Path(s *Signer, ks keySpace, itemIndexes ...uint64) [][]byte {
 	return path
 }
 
-// Create creates and stores a Signer in the database
-func Create(ctx context.Context, db pg.DB, typ string, xpubs []chainkd.XPub, quorum int, clientToken string) (*Signer, error) {
+// checkKeys sorts xpubs and checks that they
+// and quorum are suitable for a signer.
+func checkKeys(xpubs []chainkd.XPub, quorum int) error {
 	if len(xpubs) == 0 {
-		return nil, errors.Wrap(ErrNoXPubs)
+		return errors.Wrap(ErrNoXPubs)
 	}
 
 	sort.Sort(sortKeys(xpubs)) // this transforms the input slice
 	for i := 1; i < len(xpubs); i++ {
 		if bytes.Equal(xpubs[i][:], xpubs[i-1][:]) {
-			return nil, errors.WithDetailf(ErrDupeXPub, "duplicated key=%x", xpubs[i])
+			return errors.WithDetailf(ErrDupeXPub, "duplicated key=%x", xpubs[i])
 		}
 	}
 
 	if quorum == 0 || quorum > len(xpubs) {
-		return nil, errors.Wrap(ErrBadQuorum)
+		return errors.Wrap(ErrBadQuorum)
 	}
+	return nil
+}
 
+func xpubsToBytes(xpubs []chainkd.XPub) [][]byte {
 	var xpubBytes [][]byte
 	for _, key := range xpubs {
 		key := key
 		xpubBytes = append(xpubBytes, key[:])
 	}
+	return xpubBytes
+}
+
+// Create creates and stores a Signer in the database
+func Create(ctx context.Context, db pg.DB, typ string, xpubs []chainkd.XPub, quorum int, clientToken string) (*Signer, error) {
+	err := checkKeys(xpubs, quorum)
+	if err != nil {
+		return nil, err
+	}
+	xpubBytes := xpubsToBytes(xpubs)
 
 	nullToken := sql.NullString{
 		String: clientToken,
@@ -113,7 +131,7 @@ func Create(ctx context.Context, db pg.DB, typ string, xpubs []chainkd.XPub, quo
 		id       string
 		keyIndex uint64
 	)
-	err := db.QueryRow(ctx, q, typeIDMap[typ], typ, pq.ByteaArray(xpubBytes), quorum, nullToken).
+	err = db.QueryRow(ctx, q, typeIDMap[typ], typ, pq.ByteaArray(xpubBytes), quorum, nullToken).
 		Scan(&id, &keyIndex)
 	if err == sql.ErrNoRows && clientToken != "" {
 		return findByClientToken(ctx, db, clientToken)
@@ -128,9 +146,74 @@ func Create(ctx context.Context, db pg.DB, typ string, xpubs []chainkd.XPub, quo
 		XPubs:    xpubs,
 		Quorum:   quorum,
 		KeyIndex: keyIndex,
+		Version:  1,
 	}, nil
 }
 
+// Rotate replaces the keys and quorum of the signer of type typ
+// with the given id, making a new version of the signer. The keys
+// of the earlier versions remain available through FindVersion,
+// for spending what they control. It returns the updated Signer.
+func Rotate(ctx context.Context, db pg.DB, typ, id string, xpubs []chainkd.XPub, quorum int) (*Signer, error) {
+	err := checkKeys(xpubs, quorum)
+	if err != nil {
+		return nil, err
+	}
+
+	const q = `
+		WITH old AS (
+			SELECT id, version, xpubs, quorum FROM signers
+			WHERE id=$1 AND type=$2 FOR UPDATE
+		), retired AS (
+			INSERT INTO signer_versions (signer_id, version, xpubs, quorum)
+			SELECT id, version, xpubs, quorum FROM old
+		)
+		UPDATE signers SET xpubs=$3, quorum=$4, version=old.version+1
+		FROM old WHERE signers.id=old.id
+		RETURNING signers.key_index, signers.version
+	`
+	s := &Signer{ID: id, Type: typ, XPubs: xpubs, Quorum: quorum}
+	err = db.QueryRow(ctx, q, id, typ, pq.ByteaArray(xpubsToBytes(xpubs)), quorum).Scan(&s.KeyIndex, &s.Version)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "%s id: %s", typ, id)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return s, nil
+}
+
+// FindVersion retrieves the given version of a Signer
+// from the database, using the type and id.
+func FindVersion(ctx context.Context, db pg.DB, typ, id string, version int) (*Signer, error) {
+	s, err := Find(ctx, db, typ, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Version == version {
+		return s, nil
+	}
+
+	const q = `
+		SELECT xpubs, quorum FROM signer_versions
+		WHERE signer_id=$1 AND version=$2
+	`
+	var xpubBytes [][]byte
+	err = db.QueryRow(ctx, q, id, version).Scan((*pq.ByteaArray)(&xpubBytes), &s.Quorum)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "%s id: %s version: %d", typ, id, version)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	s.XPubs, err = ConvertKeys(xpubBytes)
+	if err != nil {
+		return nil, errors.WithDetail(errors.New("bad xpub in databse"), errors.Detail(err))
+	}
+	s.Version = version
+	return s, nil
+}
+
 func New(id, typ string, xpubs [][]byte, quorum int, keyIndex uint64) (*Signer, error) {
 	keys, err := ConvertKeys(xpubs)
 	if err != nil {
@@ -147,7 +230,7 @@ func New(id, typ string, xpubs [][]byte, quorum int, keyIndex uint64) (*Signer,
 
 func findByClientToken(ctx context.Context, db pg.DB, clientToken string) (*Signer, error) {
 	const q = `
-		SELECT id, type, xpubs, quorum, key_index
+		SELECT id, type, xpubs, quorum, key_index, version
 		FROM signers WHERE client_token=$1
 	`
 
@@ -156,7 +239,7 @@ func findByClientToken(ctx context.Context, db pg.DB, clientToken string) (*Sign
 		xpubBytes [][]byte
 	)
 	err := db.QueryRow(ctx, q, clientToken).
-		Scan(&s.ID, &s.Type, (*pq.ByteaArray)(&xpubBytes), &s.Quorum, &s.KeyIndex)
+		Scan(&s.ID, &s.Type, (*pq.ByteaArray)(&xpubBytes), &s.Quorum, &s.KeyIndex, &s.Version)
 	if err != nil {
 		return nil, errors.Wrap(err)
 	}
@@ -175,7 +258,7 @@ func findByClientToken(ctx context.Context, db pg.DB, clientToken string) (*Sign
 // using the type and id.
 func Find(ctx context.Context, db pg.DB, typ, id string) (*Signer, error) {
 	const q = `
-		SELECT id, type, xpubs, quorum, key_index
+		SELECT id, type, xpubs, quorum, key_index, version
 		FROM signers WHERE id=$1
 	`
 
@@ -189,6 +272,7 @@ func Find(ctx context.Context, db pg.DB, typ, id string) (*Signer, error) {
 		(*pq.ByteaArray)(&xpubBytes),
 		&s.Quorum,
 		&s.KeyIndex,
+		&s.Version,
 	)
 	if err == sql.ErrNoRows {
 		return nil, errors.Wrap(pg.ErrUserInputNotFound)
@@ -215,14 +299,14 @@ func Find(ctx context.Context, db pg.DB, typ, id string) (*Signer, error) {
 // the provided type.
 func List(ctx context.Context, db pg.DB, typ, prev string, limit int) ([]*Signer, string, error) {
 	const q = `
-		SELECT id, type, xpubs, quorum, key_index
+		SELECT id, type, xpubs, quorum, key_index, version
 		FROM signers WHERE type=$1 AND ($2='' OR $2<id)
 		ORDER BY id ASC LIMIT $3
 	`
 
 	var signers []*Signer
 	err := pg.ForQueryRows(ctx, db, q, typ, prev, limit,
-		func(id, typ string, xpubs pq.ByteaArray, quorum int, keyIndex uint64) error {
+		func(id, typ string, xpubs pq.ByteaArray, quorum int, keyIndex uint64, version int) error {
 			keys, err := ConvertKeys(xpubs)
 			if err != nil {
 				return errors.WithDetail(errors.New("bad xpub in databse"), errors.Detail(err))
@@ -234,6 +318,7 @@ func List(ctx context.Context, db pg.DB, typ, prev string, limit int) ([]*Signer
 				XPubs:    keys,
 				Quorum:   quorum,
 				KeyIndex: keyIndex,
+				Version:  version,
 			})
 			return nil
 		},
@@ -237,6 +237,59 @@ func TestList(t *testing.T) {
 	}
 }
 
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+
+	s1 := createFixture(ctx, db, t)
+
+	_, err := Rotate(ctx, db, s1.Type, s1.ID, []chainkd.XPub{dummyXPub}, 2)
+	if errors.Root(err) != ErrBadQuorum {
+		t.Errorf("Rotate with bad quorum = %v want %v", err, ErrBadQuorum)
+	}
+	_, err = Rotate(ctx, db, "account", "nonexistent", []chainkd.XPub{dummyXPub}, 1)
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("Rotate nonexistent = %v want %v", err, pg.ErrUserInputNotFound)
+	}
+
+	s2, err := Rotate(ctx, db, s1.Type, s1.ID, []chainkd.XPub{dummyXPub}, 1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	want := &Signer{
+		ID:       s1.ID,
+		Type:     s1.Type,
+		XPubs:    []chainkd.XPub{dummyXPub},
+		Quorum:   1,
+		KeyIndex: s1.KeyIndex,
+		Version:  2,
+	}
+	if !testutil.DeepEqual(s2, want) {
+		t.Errorf("Rotate() = %+v want %+v", s2, want)
+	}
+
+	got, err := Find(ctx, db, s1.Type, s1.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !testutil.DeepEqual(got, want) {
+		t.Errorf("Find() = %+v want %+v", got, want)
+	}
+
+	got, err = FindVersion(ctx, db, s1.Type, s1.ID, 1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !testutil.DeepEqual(got, s1) {
+		t.Errorf("FindVersion(1) = %+v want %+v", got, s1)
+	}
+
+	_, err = FindVersion(ctx, db, s1.Type, s1.ID, 3)
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("FindVersion(3) = %v want %v", err, pg.ErrUserInputNotFound)
+	}
+}
+
 var clientTokenCounter = createCounter()
 
 func createFixture(ctx context.Context, db pg.DB, t testing.TB) *Signer {
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"chain/core/account"
+	"chain/core/leader"
+	"chain/core/txbuilder"
+	"chain/errors"
+	"chain/net/http/reqid"
+	"chain/protocol/bc"
+	"chain/protocol/state"
+	"chain/protocol/validation"
+)
+
+type simulateResponse struct {
+	Template        *txbuilder.Template      `json:"template"`
+	BalanceChanges  []*account.BalanceChange `json:"balance_changes"`
+	ValidationError *detailedError           `json:"validation_error,omitempty"`
+}
+
+// POST /simulate-transaction
+//
+// simulate builds each transaction, as build does, but without
+// holding reservations, and predicts what would happen if it
+// were signed and submitted now.
+func (a *API) simulate(ctx context.Context, buildReqs []*buildRequest) (interface{}, error) {
+	// As in build, only the leader has the current reservations,
+	// and only the leader has the current state.
+	if a.leader.State() != leader.Leading {
+		var resp interface{}
+		err := a.forwardToLeader(ctx, "/simulate-transaction", buildReqs, &resp)
+		return resp, err
+	}
+
+	responses := make([]interface{}, len(buildReqs))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := 0; i < len(responses); i++ {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			resp, err := a.simulateSingle(subctx, buildReqs[i])
+			if err != nil {
+				responses[i] = err
+			} else {
+				responses[i] = resp
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	return responses, nil
+}
+
+func (a *API) simulateSingle(ctx context.Context, req *buildRequest) (*simulateResponse, error) {
+	tpl, err := a.buildWith(ctx, req, txbuilder.BuildDryRun)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := a.accounts.BalanceChanges(ctx, tpl.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	resp := &simulateResponse{
+		Template:       tpl,
+		BalanceChanges: changes,
+	}
+	err = a.checkUnsignedTx(tpl.Transaction)
+	if err != nil {
+		body, _ := errInfo(err)
+		resp.ValidationError = &body
+	}
+	return resp, nil
+}
+
+// checkUnsignedTx checks whether tx, once signed, would be valid,
+// and would apply to a copy of the current state.
+func (a *API) checkUnsignedTx(tx *bc.Tx) error {
+	err := validation.CheckTxWellFormedUnsigned(tx)
+	if err == nil {
+		block, snapshot := a.chain.State()
+		snapshot = state.Copy(snapshot)
+		err = validation.ConfirmTx(snapshot, a.chain.InitialBlockHash, block.Version, bc.Millis(time.Now()), tx)
+		if err == nil {
+			err = validation.ApplyTx(snapshot, tx)
+		}
+	}
+	if errors.Root(err) == validation.ErrBadTx {
+		return errors.Sub(txbuilder.ErrRejected, err)
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"chain/core/txbuilder"
+	"chain/errors"
+	"chain/log"
+	"chain/net/http/httpjson"
+)
+
+// templateFunc handles a request whose body is a stream of
+// templates in the binary encoding. Other parameters of the
+// request come from its URL query.
+type templateFunc func(ctx context.Context, req *http.Request, tpls []*txbuilder.Template) (interface{}, error)
+
+// acceptTemplates returns a handler that calls f for requests
+// whose bodies are in txbuilder.TemplateMediaType, and
+// passes all other requests to h.
+//
+// If the client accepts the media type, and f returns only
+// templates, the response is in the binary encoding too;
+// otherwise it's JSON, as from h.
+func (a *API) acceptTemplates(h http.Handler, f templateFunc) http.Handler {
+	if a.config == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if mediaType != txbuilder.TemplateMediaType {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		ctx := httpjson.WithRequest(req.Context(), req)
+		tpls, err := readTemplates(req.Body)
+		if err != nil {
+			WriteHTTPError(ctx, w, err)
+			return
+		}
+		resp, err := f(ctx, req, tpls)
+		if err != nil {
+			WriteHTTPError(ctx, w, err)
+			return
+		}
+		if out, ok := templateList(resp); ok && acceptsTemplates(req) {
+			writeTemplates(ctx, w, out)
+			return
+		}
+		httpjson.Write(ctx, w, 200, resp)
+	})
+}
+
+func readTemplates(r io.Reader) ([]*txbuilder.Template, error) {
+	br := bufio.NewReader(r)
+	var tpls []*txbuilder.Template
+	for {
+		tpl, err := txbuilder.ReadTemplate(br)
+		if err == io.EOF {
+			return tpls, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading template %d", len(tpls))
+		}
+		tpls = append(tpls, tpl)
+	}
+}
+
+func writeTemplates(ctx context.Context, w http.ResponseWriter, tpls []*txbuilder.Template) {
+	w.Header().Set("Content-Type", txbuilder.TemplateMediaType)
+	w.WriteHeader(200)
+	for _, tpl := range tpls {
+		_, err := tpl.WriteTo(w)
+		if err != nil {
+			log.Error(ctx, err)
+			return
+		}
+	}
+}
+
+// templateList returns the templates in resp, and whether
+// it's a batch response made up only of templates.
+func templateList(resp interface{}) ([]*txbuilder.Template, bool) {
+	items, ok := resp.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	tpls := make([]*txbuilder.Template, 0, len(items))
+	for _, item := range items {
+		tpl, ok := item.(*txbuilder.Template)
+		if !ok {
+			return nil, false
+		}
+		tpls = append(tpls, tpl)
+	}
+	return tpls, true
+}
+
+func acceptsTemplates(req *http.Request) bool {
+	for _, h := range req.Header["Accept"] {
+		for _, s := range strings.Split(h, ",") {
+			mediaType, _, err := mime.ParseMediaType(s)
+			if err == nil && mediaType == txbuilder.TemplateMediaType {
+				return true
+			}
+		}
+	}
+	return false
+}
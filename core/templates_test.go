@@ -0,0 +1,83 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"chain/core/config"
+	"chain/core/txbuilder"
+)
+
+func TestAcceptTemplates(t *testing.T) {
+	a := &API{config: new(config.Config)}
+	jsonCalled := false
+	h := a.acceptTemplates(
+		http.HandlerFunc(func(http.ResponseWriter, *http.Request) { jsonCalled = true }),
+		func(ctx context.Context, req *http.Request, tpls []*txbuilder.Template) (interface{}, error) {
+			resp := make([]interface{}, 0, len(tpls))
+			for _, tpl := range tpls {
+				tpl.Local = true
+				resp = append(resp, tpl)
+			}
+			return resp, nil
+		},
+	)
+
+	tpl := &txbuilder.Template{SigningInstructions: []*txbuilder.SigningInstruction{}}
+	var body bytes.Buffer
+	tpl.WriteTo(&body)
+	tpl.WriteTo(&body)
+
+	req := httptest.NewRequest("POST", "/submit-transaction", bytes.NewReader(body.Bytes()))
+	req.Header.Set("Content-Type", txbuilder.TemplateMediaType)
+	req.Header.Set("Accept", "application/json, "+txbuilder.TemplateMediaType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if jsonCalled {
+		t.Fatal("JSON handler called for binary request")
+	}
+	if rec.Code != 200 {
+		t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != txbuilder.TemplateMediaType {
+		t.Fatalf("got Content-Type %q, want %q", got, txbuilder.TemplateMediaType)
+	}
+	for i := 0; i < 2; i++ {
+		got, err := txbuilder.ReadTemplate(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Local {
+			t.Errorf("template %d not local", i)
+		}
+	}
+	if rec.Body.Len() > 0 {
+		t.Errorf("got %d extra bytes", rec.Body.Len())
+	}
+
+	req = httptest.NewRequest("POST", "/submit-transaction", bytes.NewReader(body.Bytes()))
+	req.Header.Set("Content-Type", txbuilder.TemplateMediaType)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+		t.Errorf("without Accept, got Content-Type %q, want JSON", got)
+	}
+
+	req = httptest.NewRequest("POST", "/submit-transaction", bytes.NewReader([]byte{0xff}))
+	req.Header.Set("Content-Type", txbuilder.TemplateMediaType)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != 400 {
+		t.Errorf("with bad body, got status %d, want 400", rec.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/submit-transaction", bytes.NewReader([]byte("{}")))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if !jsonCalled {
+		t.Error("JSON handler not called for JSON request")
+	}
+}
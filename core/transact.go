@@ -3,10 +3,12 @@ package core
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 	"sync"
 	"time"
 
 	"chain/core/fetch"
+	"chain/core/generator"
 	"chain/core/leader"
 	"chain/core/txbuilder"
 	"chain/database/pg"
@@ -19,23 +21,41 @@ import (
 
 var defaultTxTTL = 5 * time.Minute
 
+type buildFunc func(context.Context, *bc.TxData, []txbuilder.Action, time.Time) (*txbuilder.Template, error)
+
 func (a *API) actionDecoder(action string) (func([]byte) (txbuilder.Action, error), bool) {
 	var decoder func([]byte) (txbuilder.Action, error)
 	switch action {
 	case "control_account":
 		decoder = a.accounts.DecodeControlAction
+	case "control_escrow":
+		decoder = txbuilder.DecodeControlEscrowAction
+	case "control_hashlock":
+		decoder = txbuilder.DecodeControlHashLockAction
 	case "control_program":
 		decoder = txbuilder.DecodeControlProgramAction
 	case "control_receiver":
 		decoder = txbuilder.DecodeControlReceiverAction
+	case "control_timelock":
+		decoder = txbuilder.DecodeControlTimeLockAction
 	case "issue":
 		decoder = a.assets.DecodeIssueAction
+	case "offer":
+		decoder = a.accounts.DecodeOfferAction
 	case "retire":
 		decoder = txbuilder.DecodeRetireAction
 	case "spend_account":
 		decoder = a.accounts.DecodeSpendAction
 	case "spend_account_unspent_output":
 		decoder = a.accounts.DecodeSpendUTXOAction
+	case "spend_escrow":
+		decoder = txbuilder.DecodeSpendEscrowAction(a.reserveOutput)
+	case "spend_hashlock":
+		decoder = txbuilder.DecodeSpendHashLockAction(a.reserveOutput)
+	case "spend_timelock":
+		decoder = txbuilder.DecodeSpendTimeLockAction(a.reserveOutput)
+	case "sweep_account":
+		decoder = a.accounts.DecodeSweepAction
 	case "set_transaction_reference_data":
 		decoder = txbuilder.DecodeSetTxRefDataAction
 	default:
@@ -45,6 +65,12 @@ func (a *API) actionDecoder(action string) (func([]byte) (txbuilder.Action, erro
 }
 
 func (a *API) buildSingle(ctx context.Context, req *buildRequest) (*txbuilder.Template, error) {
+	return a.buildWith(ctx, req, txbuilder.Build)
+}
+
+// buildWith builds the actions in req with build, which is
+// txbuilder.Build or txbuilder.BuildDryRun.
+func (a *API) buildWith(ctx context.Context, req *buildRequest, build buildFunc) (*txbuilder.Template, error) {
 	err := a.filterAliases(ctx, req)
 	if err != nil {
 		return nil, err
@@ -78,7 +104,7 @@ func (a *API) buildSingle(ctx context.Context, req *buildRequest) (*txbuilder.Te
 		ttl = defaultTxTTL
 	}
 	maxTime := time.Now().Add(ttl)
-	tpl, err := txbuilder.Build(ctx, req.Tx, actions, maxTime)
+	tpl, err := build(ctx, req.Tx, actions, maxTime)
 	if errors.Root(err) == txbuilder.ErrAction {
 		err = errors.WithData(err, "actions", errInfoBodyList(errors.Data(err)["actions"].([]error)))
 	}
@@ -266,8 +292,16 @@ func (a *API) waitForTxInBlock(ctx context.Context, tx *bc.Tx, height uint64) (u
 				return 0, errors.Wrap(txbuilder.ErrRejected, "transaction max time exceeded")
 			}
 
-			// might still be in pool or might be rejected; we can't
-			// tell definitively until its max time elapses.
+			// If the generator rejected the tx, report why. Otherwise
+			// it might still be in the pool, or might have been
+			// forgotten by the generator; we can't tell definitively
+			// until its max time elapses.
+			status, err := a.txStatus(ctx, tx.ID)
+			if err != nil {
+				log.Error(ctx, err, "checking transaction status")
+			} else if status.Status == generator.StatusRejected {
+				return 0, errors.WithDetail(txbuilder.ErrRejected, status.Reason)
+			}
 
 			// Re-insert into the pool in case it was dropped.
 			err = txbuilder.FinalizeTx(ctx, a.chain, a.submitter, tx)
@@ -324,3 +358,13 @@ func (a *API) submit(ctx context.Context, x submitArg) (interface{}, error) {
 	wg.Wait()
 	return responses, nil
 }
+
+// submitTemplates is submit for templates in the binary
+// encoding, with wait_until given in the URL query.
+func (a *API) submitTemplates(ctx context.Context, req *http.Request, tpls []*txbuilder.Template) (interface{}, error) {
+	x := submitArg{WaitUntil: req.URL.Query().Get("wait_until")}
+	for _, tpl := range tpls {
+		x.Transactions = append(x.Transactions, *tpl)
+	}
+	return a.submit(ctx, x)
+}
@@ -21,6 +21,7 @@ type TemplateBuilder struct {
 	minTime             time.Time
 	maxTime             time.Time
 	referenceData       []byte
+	allowAdditional     bool
 	rollbacks           []func()
 	callbacks           []func() error
 }
@@ -54,6 +55,13 @@ func (b *TemplateBuilder) RestrictMaxTime(t time.Time) {
 	}
 }
 
+// AllowAdditionalActions makes the template allow additional
+// actions (see Template.AllowAdditional), so that signatures
+// commit to its details rather than to the whole transaction.
+func (b *TemplateBuilder) AllowAdditionalActions() {
+	b.allowAdditional = true
+}
+
 func (b *TemplateBuilder) MaxTime() time.Time {
 	return b.maxTime
 }
@@ -75,6 +83,29 @@ func (b *TemplateBuilder) OnBuild(buildFn func() error) {
 	b.callbacks = append(b.callbacks, buildFn)
 }
 
+// Outputs returns the outputs of the transaction being built:
+// those of the base transaction, if any, followed by those
+// added by actions so far.
+func (b *TemplateBuilder) Outputs() []*bc.TxOutput {
+	var outs []*bc.TxOutput
+	if b.base != nil {
+		outs = append(outs, b.base.Outputs...)
+	}
+	return append(outs, b.outputs...)
+}
+
+// ReferenceData returns the reference data of the
+// transaction being built, if any.
+func (b *TemplateBuilder) ReferenceData() []byte {
+	if len(b.referenceData) > 0 {
+		return b.referenceData
+	}
+	if b.base != nil {
+		return b.base.ReferenceData
+	}
+	return nil
+}
+
 func (b *TemplateBuilder) setReferenceData(data []byte) error {
 	if b.base != nil && len(b.base.ReferenceData) != 0 && !bytes.Equal(b.base.ReferenceData, data) {
 		return errors.Wrap(ErrBadRefData)
@@ -101,7 +132,7 @@ func (b *TemplateBuilder) Build() (*Template, *bc.TxData, error) {
 		}
 	}
 
-	tpl := &Template{}
+	tpl := &Template{AllowAdditional: b.allowAdditional}
 	tx := b.base
 	if tx == nil {
 		tx = &bc.TxData{
@@ -132,8 +163,8 @@ func (b *TemplateBuilder) Build() (*Template, *bc.TxData, error) {
 		instruction.Position = uint32(len(tx.Inputs))
 
 		// Empty signature arrays should be serialized as empty arrays, not null.
-		if instruction.SignatureWitnesses == nil {
-			instruction.SignatureWitnesses = []*signatureWitness{}
+		if instruction.WitnessComponents == nil {
+			instruction.WitnessComponents = []WitnessComponent{}
 		}
 		tpl.SigningInstructions = append(tpl.SigningInstructions, instruction)
 		tx.Inputs = append(tx.Inputs, in)
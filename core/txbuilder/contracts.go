@@ -0,0 +1,275 @@
+package txbuilder
+
+import (
+	"bytes"
+	"context"
+	stdjson "encoding/json"
+	"time"
+
+	"chain/crypto/ed25519"
+	"chain/crypto/sha3pool"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vmutil"
+)
+
+// ErrBadContract is returned by the contract actions when the
+// contract terms are invalid, or when the output being spent, or
+// the keys or preimage given, don't match its contract.
+var ErrBadContract = errors.New("bad contract")
+
+// OutputReserver reserves the unspent output with the given ID
+// until exp, so no other build can spend it, and returns its
+// spend commitment along with a function that cancels the
+// reservation.
+type OutputReserver func(ctx context.Context, outputID bc.Hash, exp time.Time) (sc *bc.SpendCommitment, cancel func(), err error)
+
+func (k keyID) publicKey() ed25519.PublicKey {
+	path := make([][]byte, 0, len(k.DerivationPath))
+	for _, p := range k.DerivationPath {
+		path = append(path, p)
+	}
+	return k.XPub.Derive(path).PublicKey()
+}
+
+func publicKeys(keys []keyID) []ed25519.PublicKey {
+	pubkeys := make([]ed25519.PublicKey, 0, len(keys))
+	for _, k := range keys {
+		pubkeys = append(pubkeys, k.publicKey())
+	}
+	return pubkeys
+}
+
+func DecodeControlEscrowAction(data []byte) (Action, error) {
+	a := new(controlEscrowAction)
+	err := stdjson.Unmarshal(data, a)
+	return a, err
+}
+
+type controlEscrowAction struct {
+	bc.AssetAmount
+	Buyer         *keyID   `json:"buyer"`
+	Seller        *keyID   `json:"seller"`
+	Agent         *keyID   `json:"agent"`
+	ReferenceData json.Map `json:"reference_data"`
+}
+
+func (a *controlEscrowAction) Build(ctx context.Context, b *TemplateBuilder) error {
+	var missing []string
+	if a.Buyer == nil {
+		missing = append(missing, "buyer")
+	}
+	if a.Seller == nil {
+		missing = append(missing, "seller")
+	}
+	if a.Agent == nil {
+		missing = append(missing, "agent")
+	}
+	if a.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if len(missing) > 0 {
+		return MissingFieldsError(missing...)
+	}
+
+	prog, err := vmutil.EscrowProgram(a.Buyer.publicKey(), a.Seller.publicKey(), a.Agent.publicKey())
+	if err != nil {
+		return errors.Sub(ErrBadContract, err)
+	}
+	out := bc.NewTxOutput(a.AssetID, a.Amount, prog, a.ReferenceData)
+	return b.AddOutput(out)
+}
+
+func DecodeControlTimeLockAction(data []byte) (Action, error) {
+	a := new(controlTimeLockAction)
+	err := stdjson.Unmarshal(data, a)
+	return a, err
+}
+
+type controlTimeLockAction struct {
+	bc.AssetAmount
+	Keys          []keyID   `json:"keys"`
+	Quorum        int       `json:"quorum"`
+	MinTime       time.Time `json:"min_time"`
+	ReferenceData json.Map  `json:"reference_data"`
+}
+
+func (a *controlTimeLockAction) Build(ctx context.Context, b *TemplateBuilder) error {
+	var missing []string
+	if len(a.Keys) == 0 {
+		missing = append(missing, "keys")
+	}
+	if a.MinTime.IsZero() {
+		missing = append(missing, "min_time")
+	}
+	if a.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if len(missing) > 0 {
+		return MissingFieldsError(missing...)
+	}
+
+	prog, err := vmutil.TimeLockProgram(publicKeys(a.Keys), a.Quorum, bc.Millis(a.MinTime))
+	if err != nil {
+		return errors.Sub(ErrBadContract, err)
+	}
+	out := bc.NewTxOutput(a.AssetID, a.Amount, prog, a.ReferenceData)
+	return b.AddOutput(out)
+}
+
+func DecodeControlHashLockAction(data []byte) (Action, error) {
+	a := new(controlHashLockAction)
+	err := stdjson.Unmarshal(data, a)
+	return a, err
+}
+
+type controlHashLockAction struct {
+	bc.AssetAmount
+	Keys          []keyID       `json:"keys"`
+	Quorum        int           `json:"quorum"`
+	Hash          json.HexBytes `json:"hash"`
+	ReferenceData json.Map      `json:"reference_data"`
+}
+
+func (a *controlHashLockAction) Build(ctx context.Context, b *TemplateBuilder) error {
+	var missing []string
+	if len(a.Keys) == 0 {
+		missing = append(missing, "keys")
+	}
+	if len(a.Hash) == 0 {
+		missing = append(missing, "hash")
+	}
+	if a.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if len(missing) > 0 {
+		return MissingFieldsError(missing...)
+	}
+
+	prog, err := vmutil.HashLockProgram(publicKeys(a.Keys), a.Quorum, a.Hash)
+	if err != nil {
+		return errors.Sub(ErrBadContract, err)
+	}
+	out := bc.NewTxOutput(a.AssetID, a.Amount, prog, a.ReferenceData)
+	return b.AddOutput(out)
+}
+
+// DecodeSpendEscrowAction returns a decoder for actions
+// spending escrow contract outputs, reserving them with reserve.
+func DecodeSpendEscrowAction(reserve OutputReserver) func([]byte) (Action, error) {
+	return spendContractDecoder(reserve, vmutil.EscrowContract)
+}
+
+// DecodeSpendTimeLockAction returns a decoder for actions
+// spending timelock contract outputs, reserving them with reserve.
+func DecodeSpendTimeLockAction(reserve OutputReserver) func([]byte) (Action, error) {
+	return spendContractDecoder(reserve, vmutil.TimeLockContract)
+}
+
+// DecodeSpendHashLockAction returns a decoder for actions
+// spending hashlock contract outputs, reserving them with reserve.
+func DecodeSpendHashLockAction(reserve OutputReserver) func([]byte) (Action, error) {
+	return spendContractDecoder(reserve, vmutil.HashLockContract)
+}
+
+func spendContractDecoder(reserve OutputReserver, contractType string) func([]byte) (Action, error) {
+	return func(data []byte) (Action, error) {
+		a := &spendContractAction{reserve: reserve, contractType: contractType}
+		err := stdjson.Unmarshal(data, a)
+		return a, err
+	}
+}
+
+type spendContractAction struct {
+	reserve      OutputReserver
+	contractType string
+
+	OutputID      *bc.Hash      `json:"output_id"`
+	Keys          []keyID       `json:"keys"`
+	Preimage      json.HexBytes `json:"preimage"`
+	ReferenceData json.Map      `json:"reference_data"`
+}
+
+func (a *spendContractAction) Build(ctx context.Context, b *TemplateBuilder) error {
+	var missing []string
+	if a.OutputID == nil {
+		missing = append(missing, "output_id")
+	}
+	if len(a.Keys) == 0 {
+		missing = append(missing, "keys")
+	}
+	if a.contractType == vmutil.HashLockContract && len(a.Preimage) == 0 {
+		missing = append(missing, "preimage")
+	}
+	if len(missing) > 0 {
+		return MissingFieldsError(missing...)
+	}
+
+	sc, cancel, err := a.reserve(ctx, *a.OutputID, b.MaxTime())
+	if err != nil {
+		return err
+	}
+	b.OnRollback(cancel)
+
+	c, err := vmutil.ParseContractProgram(sc.ControlProgram)
+	if err != nil || c.Type != a.contractType {
+		return errors.WithDetailf(ErrBadContract, "output %s is not a %s contract", a.OutputID, a.contractType)
+	}
+	keys, err := contractKeys(c, a.Keys)
+	if err != nil {
+		return err
+	}
+
+	sigInst := &SigningInstruction{AssetAmount: sc.AssetAmount}
+	switch c.Type {
+	case vmutil.TimeLockContract:
+		b.RestrictMinTime(time.Unix(0, int64(c.MinTimeMS)*int64(time.Millisecond)))
+	case vmutil.HashLockContract:
+		var h bc.Hash
+		sha3pool.Sum256(h[:], a.Preimage)
+		if !bytes.Equal(h[:], c.Hash) {
+			return errors.WithDetail(ErrBadContract, "preimage does not match the contract hash")
+		}
+		sigInst.AddWitnessPreimage(h, a.Preimage)
+	}
+	sigInst.WitnessComponents = append(sigInst.WitnessComponents, &SignatureWitness{
+		Quorum: c.Quorum,
+		Keys:   keys,
+	})
+
+	txInput := bc.NewSpendInput(nil, sc.SourceID, sc.AssetID, sc.Amount, sc.SourcePosition, sc.ControlProgram, sc.RefDataHash, a.ReferenceData)
+	return b.AddInput(txInput, sigInst)
+}
+
+// contractKeys returns the keys in the order of the contract's
+// pubkeys, as CHECKMULTISIG requires of the signatures they make.
+// Each of keys must derive one of the contract's pubkeys, and
+// there must be enough of them to meet the contract's quorum.
+func contractKeys(c *vmutil.Contract, keys []keyID) ([]keyID, error) {
+	found := make([]*keyID, len(c.Pubkeys))
+	for i, k := range keys {
+		pub := k.publicKey()
+		var ok bool
+		for j, cpub := range c.Pubkeys {
+			if bytes.Equal(pub, cpub) {
+				found[j] = &keys[i]
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, errors.WithDetailf(ErrBadContract, "key %d is not one of the contract's keys", i)
+		}
+	}
+	var result []keyID
+	for _, k := range found {
+		if k != nil {
+			result = append(result, *k)
+		}
+	}
+	if len(result) < c.Quorum {
+		return nil, errors.WithDetailf(ErrBadContract, "contract needs %d keys, got %d", c.Quorum, len(result))
+	}
+	return result, nil
+}
@@ -0,0 +1,159 @@
+package txbuilder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/crypto/ed25519/chainkd"
+	"chain/crypto/sha3pool"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/validation"
+	"chain/protocol/vm"
+	"chain/testutil"
+)
+
+func TestContractActions(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		xprvs []chainkd.XPrv
+		keys  []keyID
+	)
+	path := []json.HexBytes{{1, 2, 3}}
+	for i := 0; i < 3; i++ {
+		xprv, xpub, err := chainkd.NewXKeys(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xprvs = append(xprvs, xprv)
+		keys = append(keys, keyID{XPub: xpub, DerivationPath: path})
+	}
+	signFn := func(_ context.Context, xpub chainkd.XPub, path [][]byte, data [32]byte) ([]byte, error) {
+		for _, xprv := range xprvs {
+			if xprv.XPub() == xpub {
+				return xprv.Derive(path).Sign(data[:]), nil
+			}
+		}
+		return nil, errors.New("unknown key")
+	}
+
+	preimage := []byte("open sesame")
+	var hash [32]byte
+	sha3pool.Sum256(hash[:], preimage)
+
+	assetAmount := bc.AssetAmount{AssetID: bc.AssetID{1}, Amount: 5}
+	cases := []struct {
+		control Action
+		spend   func(OutputReserver) func([]byte) (Action, error)
+		data    string
+	}{{
+		control: &controlEscrowAction{AssetAmount: assetAmount, Buyer: &keys[0], Seller: &keys[1], Agent: &keys[2]},
+		spend:   DecodeSpendEscrowAction,
+		data:    `{}`,
+	}, {
+		control: &controlTimeLockAction{AssetAmount: assetAmount, Keys: keys[1:], Quorum: 1, MinTime: time.Now().Add(-time.Hour)},
+		spend:   DecodeSpendTimeLockAction,
+		data:    `{}`,
+	}, {
+		control: &controlHashLockAction{AssetAmount: assetAmount, Keys: keys, Quorum: 2, Hash: hash[:]},
+		spend:   DecodeSpendHashLockAction,
+		data:    `{"preimage": "6f70656e20736573616d65"}`,
+	}}
+
+	for i, c := range cases {
+		maxTime := time.Now().Add(time.Minute)
+		tpl, err := Build(ctx, nil, []Action{c.control}, maxTime)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		out := tpl.Transaction.Outputs[0]
+		reserve := func(context.Context, bc.Hash, time.Time) (*bc.SpendCommitment, func(), error) {
+			sc := &bc.SpendCommitment{
+				AssetAmount:    out.AssetAmount,
+				SourceID:       bc.Hash{byte(i)},
+				VMVersion:      1,
+				ControlProgram: out.ControlProgram,
+			}
+			return sc, func() {}, nil
+		}
+
+		spend, err := c.spend(reserve)([]byte(c.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Give the keys out of order; the action
+		// puts them in the contract's order.
+		spend.(*spendContractAction).OutputID = &bc.Hash{}
+		spend.(*spendContractAction).Keys = []keyID{keys[2], keys[1]}
+		actions := []Action{spend, newControlProgramAction(assetAmount, []byte{byte(vm.OP_TRUE)})}
+		tpl, err = Build(ctx, nil, actions, maxTime)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = Sign(ctx, tpl, []chainkd.XPub{keys[1].XPub, keys[2].XPub}, signFn)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = vm.Verify(validation.InputVMContext(tpl.Transaction, 0))
+		if err != nil {
+			t.Errorf("case %d: spending contract: %v", i, err)
+		}
+	}
+}
+
+func TestSpendContractErrors(t *testing.T) {
+	ctx := context.Background()
+	_, xpub, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := keyID{XPub: xpub}
+	_, other, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hash [32]byte
+	sha3pool.Sum256(hash[:], []byte("preimage"))
+	control := &controlHashLockAction{
+		AssetAmount: bc.AssetAmount{AssetID: bc.AssetID{1}, Amount: 5},
+		Keys:        []keyID{key},
+		Quorum:      1,
+		Hash:        hash[:],
+	}
+	tpl, err := Build(ctx, nil, []Action{control}, time.Now().Add(time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	out := tpl.Transaction.Outputs[0]
+	var canceled int
+	reserve := func(context.Context, bc.Hash, time.Time) (*bc.SpendCommitment, func(), error) {
+		sc := &bc.SpendCommitment{AssetAmount: out.AssetAmount, VMVersion: 1, ControlProgram: out.ControlProgram}
+		return sc, func() { canceled++ }, nil
+	}
+
+	cases := []*spendContractAction{
+		// wrong contract type
+		{contractType: "timelock", Keys: []keyID{key}},
+		// wrong key
+		{contractType: "hashlock", Keys: []keyID{{XPub: other}}, Preimage: []byte("preimage")},
+		// wrong preimage
+		{contractType: "hashlock", Keys: []keyID{key}, Preimage: []byte("wrong")},
+	}
+	for i, a := range cases {
+		a.reserve = reserve
+		a.OutputID = &bc.Hash{}
+		canceled = 0
+		_, err := Build(ctx, nil, []Action{a}, time.Now().Add(time.Minute))
+		errs := errors.Data(err)["actions"].([]error)
+		if len(errs) != 1 || errors.Root(errs[0]) != ErrBadContract {
+			t.Errorf("case %d: err = %v want %v", i, err, ErrBadContract)
+		}
+		if canceled != 1 {
+			t.Errorf("case %d: canceled reservation %d times, want 1", i, canceled)
+		}
+	}
+}
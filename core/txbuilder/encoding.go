@@ -0,0 +1,372 @@
+package txbuilder
+
+import (
+	"bytes"
+	"io"
+
+	"chain/encoding/blockchain"
+	"chain/encoding/bufpool"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// TemplateMediaType is the media type of the binary
+// encoding of templates. A stream of templates in this
+// encoding is simply their encodings, one after another.
+const TemplateMediaType = "application/vnd.chain.template"
+
+// templateVersion is the version of the binary
+// encoding that WriteTo writes.
+const templateVersion = 1
+
+// Bits of the flags field of the binary encoding.
+const (
+	flagLocal = 1 << iota
+	flagAllowAdditional
+)
+
+// ErrTemplateEncoding is returned by ReadTemplate for
+// malformed or unsupported binary encodings.
+var ErrTemplateEncoding = errors.New("bad template encoding")
+
+// WriteTo writes the binary encoding of t to w:
+//
+//	version              varint63
+//	flags                varint63 (1 local, 2 allow additional actions)
+//	raw transaction      varstr31 (empty for none)
+//	signing instructions varint31 count, then each as an extensible string:
+//	  position           varint31
+//	  asset ID           32 bytes
+//	  amount             varint63
+//	  witness components varint31 count, then each:
+//	    type             varstr31
+//	    fields           extensible string
+//
+// The fields of each type of component are:
+//
+//	data      value (varstr31)
+//	preimage  hash (32 bytes), preimage (varstr31)
+//	signature quorum (varint31); keys (varint31 count, then
+//	          for each the 64-byte xpub and the derivation
+//	          path as a varstr list); program (varstr31);
+//	          signatures (varstr list)
+//	predicate program (varstr31), then its own witness
+//	          components, encoded as above
+//
+// Readers ignore the suffixes of extensible strings, so later
+// versions of the encoding can add fields at the ends of them.
+func (t *Template) WriteTo(w io.Writer) (int64, error) {
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+	err := t.writeTo(buf)
+	if err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
+
+// MarshalBinary returns the binary encoding of t,
+// as written by WriteTo.
+func (t *Template) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := t.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary decodes a template from its binary
+// encoding, as written by WriteTo.
+func (t *Template) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	tpl, err := ReadTemplate(r)
+	if err == io.EOF {
+		err = errors.Sub(ErrTemplateEncoding, io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return err
+	}
+	if r.Len() > 0 {
+		return errors.WithDetailf(ErrTemplateEncoding, "%d trailing bytes", r.Len())
+	}
+	*t = *tpl
+	return nil
+}
+
+// The write functions below write only to buffers,
+// so the only errors they return are range errors.
+
+func (t *Template) writeTo(w io.Writer) error {
+	var flags uint64
+	if t.Local {
+		flags |= flagLocal
+	}
+	if t.AllowAdditional {
+		flags |= flagAllowAdditional
+	}
+	blockchain.WriteVarint63(w, templateVersion)
+	blockchain.WriteVarint63(w, flags)
+
+	var raw bytes.Buffer
+	if t.Transaction != nil {
+		t.Transaction.WriteTo(&raw)
+	}
+	blockchain.WriteVarstr31(w, raw.Bytes())
+
+	blockchain.WriteVarint31(w, uint64(len(t.SigningInstructions)))
+	for i, si := range t.SigningInstructions {
+		_, err := blockchain.WriteExtensibleString(w, nil, si.writeTo)
+		if err != nil {
+			return errors.WithDetailf(err, "signing instruction %d", i)
+		}
+	}
+	return nil
+}
+
+func (si *SigningInstruction) writeTo(w io.Writer) error {
+	blockchain.WriteVarint31(w, uint64(si.Position))
+	w.Write(si.AssetID[:])
+	_, err := blockchain.WriteVarint63(w, si.Amount)
+	if err != nil {
+		return errors.Wrap(err, "amount")
+	}
+	return writeComponents(w, si.WitnessComponents)
+}
+
+func writeComponents(w io.Writer, components []WitnessComponent) error {
+	blockchain.WriteVarint31(w, uint64(len(components)))
+	for i, c := range components {
+		blockchain.WriteVarstr31(w, []byte(c.componentType()))
+		_, err := blockchain.WriteExtensibleString(w, nil, c.writeTo)
+		if err != nil {
+			return errors.WithDetailf(err, "witness component %d", i)
+		}
+	}
+	return nil
+}
+
+func (dw *DataWitness) writeTo(w io.Writer) error {
+	_, err := blockchain.WriteVarstr31(w, dw.Value)
+	return err
+}
+
+func (pw *PreimageWitness) writeTo(w io.Writer) error {
+	w.Write(pw.Hash[:])
+	_, err := blockchain.WriteVarstr31(w, pw.Preimage)
+	return err
+}
+
+func (sw *SignatureWitness) writeTo(w io.Writer) error {
+	_, err := blockchain.WriteVarint31(w, uint64(sw.Quorum))
+	if err != nil {
+		return errors.Wrap(err, "quorum")
+	}
+	blockchain.WriteVarint31(w, uint64(len(sw.Keys)))
+	for _, k := range sw.Keys {
+		w.Write(k.XPub[:])
+		blockchain.WriteVarstrList(w, byteSlices(k.DerivationPath))
+	}
+	blockchain.WriteVarstr31(w, sw.Program)
+	blockchain.WriteVarstrList(w, byteSlices(sw.Sigs))
+	return nil
+}
+
+func (pw *PredicateWitness) writeTo(w io.Writer) error {
+	blockchain.WriteVarstr31(w, pw.Program)
+	return writeComponents(w, pw.Components)
+}
+
+// ReadTemplate reads a template in the binary encoding
+// written by WriteTo. It returns io.EOF if r is at the
+// end of its data, for reading streams of templates.
+func ReadTemplate(r io.Reader) (*Template, error) {
+	version, n, err := blockchain.ReadVarint63(r)
+	if err == io.EOF && n == 0 {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, errors.Sub(ErrTemplateEncoding, err)
+	}
+	if version != templateVersion {
+		return nil, errors.WithDetailf(ErrTemplateEncoding, "unknown template version %d", version)
+	}
+	t := new(Template)
+	err = t.readFrom(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && errors.Root(err) != ErrBadWitnessComponent {
+		err = errors.Sub(ErrTemplateEncoding, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Template) readFrom(r io.Reader) error {
+	flags, _, err := blockchain.ReadVarint63(r)
+	if err != nil {
+		return err
+	}
+	t.Local = flags&flagLocal != 0
+	t.AllowAdditional = flags&flagAllowAdditional != 0
+
+	raw, _, err := blockchain.ReadVarstr31(r)
+	if err != nil {
+		return err
+	}
+	if len(raw) > 0 {
+		var tx bc.TxData
+		err = tx.Scan(raw)
+		if err != nil {
+			return errors.Wrap(err, "reading raw transaction")
+		}
+		t.Transaction = bc.NewTx(tx)
+	}
+
+	count, _, err := blockchain.ReadVarint31(r)
+	if err != nil {
+		return err
+	}
+	t.SigningInstructions = make([]*SigningInstruction, 0)
+	for i := uint32(0); i < count; i++ {
+		si := new(SigningInstruction)
+		_, _, err = blockchain.ReadExtensibleString(r, si.readFrom)
+		if err != nil {
+			return errors.WithDetailf(err, "signing instruction %d", i)
+		}
+		t.SigningInstructions = append(t.SigningInstructions, si)
+	}
+	return nil
+}
+
+func (si *SigningInstruction) readFrom(r io.Reader) (err error) {
+	si.Position, _, err = blockchain.ReadVarint31(r)
+	if err != nil {
+		return err
+	}
+	_, err = io.ReadFull(r, si.AssetID[:])
+	if err != nil {
+		return err
+	}
+	si.Amount, _, err = blockchain.ReadVarint63(r)
+	if err != nil {
+		return err
+	}
+	si.WitnessComponents, err = readComponents(r, 0)
+	return err
+}
+
+// maxPredicateDepth limits how deeply predicate
+// components may nest, in JSON as in the binary encoding.
+const maxPredicateDepth = 16
+
+func readComponents(r io.Reader, depth int) ([]WitnessComponent, error) {
+	count, _, err := blockchain.ReadVarint31(r)
+	if err != nil {
+		return nil, err
+	}
+	components := make([]WitnessComponent, 0)
+	for i := uint32(0); i < count; i++ {
+		typ, _, err := blockchain.ReadVarstr31(r)
+		if err != nil {
+			return nil, err
+		}
+		c, ok := newWitnessComponent(string(typ))
+		if !ok {
+			return nil, errors.WithDetailf(ErrBadWitnessComponent, "witness component %d has unknown type '%s'", i, typ)
+		}
+		read := c.readFrom
+		if pw, ok := c.(*PredicateWitness); ok {
+			if depth >= maxPredicateDepth {
+				return nil, errors.WithDetailf(ErrBadWitnessComponent, "predicate components nested more than %d deep", maxPredicateDepth)
+			}
+			read = func(r io.Reader) error { return pw.readNested(r, depth+1) }
+		}
+		_, _, err = blockchain.ReadExtensibleString(r, read)
+		if err != nil {
+			return nil, err
+		}
+		components = append(components, c)
+	}
+	return components, nil
+}
+
+func (dw *DataWitness) readFrom(r io.Reader) (err error) {
+	dw.Value, _, err = blockchain.ReadVarstr31(r)
+	return err
+}
+
+func (pw *PreimageWitness) readFrom(r io.Reader) (err error) {
+	_, err = io.ReadFull(r, pw.Hash[:])
+	if err != nil {
+		return err
+	}
+	pw.Preimage, _, err = blockchain.ReadVarstr31(r)
+	return err
+}
+
+func (sw *SignatureWitness) readFrom(r io.Reader) error {
+	quorum, _, err := blockchain.ReadVarint31(r)
+	if err != nil {
+		return err
+	}
+	sw.Quorum = int(quorum)
+	count, _, err := blockchain.ReadVarint31(r)
+	if err != nil {
+		return err
+	}
+	sw.Keys = make([]keyID, 0)
+	for i := uint32(0); i < count; i++ {
+		var k keyID
+		_, err = io.ReadFull(r, k.XPub[:])
+		if err != nil {
+			return err
+		}
+		path, _, err := blockchain.ReadVarstrList(r)
+		if err != nil {
+			return err
+		}
+		k.DerivationPath = hexBytesList(path)
+		sw.Keys = append(sw.Keys, k)
+	}
+	sw.Program, _, err = blockchain.ReadVarstr31(r)
+	if err != nil {
+		return err
+	}
+	sigs, _, err := blockchain.ReadVarstrList(r)
+	if err != nil {
+		return err
+	}
+	sw.Sigs = hexBytesList(sigs)
+	return nil
+}
+
+func (pw *PredicateWitness) readFrom(r io.Reader) error {
+	return pw.readNested(r, 1)
+}
+
+func (pw *PredicateWitness) readNested(r io.Reader, depth int) (err error) {
+	pw.Program, _, err = blockchain.ReadVarstr31(r)
+	if err != nil {
+		return err
+	}
+	pw.Components, err = readComponents(r, depth)
+	return err
+}
+
+func byteSlices(l []chainjson.HexBytes) [][]byte {
+	res := make([][]byte, 0, len(l))
+	for _, b := range l {
+		res = append(res, b)
+	}
+	return res
+}
+
+func hexBytesList(l [][]byte) []chainjson.HexBytes {
+	res := make([]chainjson.HexBytes, 0, len(l))
+	for _, b := range l {
+		res = append(res, b)
+	}
+	return res
+}
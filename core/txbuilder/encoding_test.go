@@ -0,0 +1,161 @@
+package txbuilder
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+
+	"chain/encoding/blockchain"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/testutil"
+)
+
+func encodingTestTemplate() *Template {
+	return &Template{
+		Transaction: bc.NewTx(bc.TxData{
+			Version: 1,
+			Inputs: []*bc.TxInput{
+				bc.NewSpendInput(nil, bc.Hash{}, bc.AssetID{1}, 123, 0, []byte{1}, bc.Hash{}, nil),
+			},
+			Outputs: []*bc.TxOutput{
+				bc.NewTxOutput(bc.AssetID{1}, 123, []byte{10, 11, 12}, nil),
+			},
+			MinTime: 1,
+			MaxTime: 2,
+		}),
+		SigningInstructions: []*SigningInstruction{{
+			Position: 0,
+			AssetAmount: bc.AssetAmount{
+				AssetID: bc.AssetID{1},
+				Amount:  123,
+			},
+			WitnessComponents: []WitnessComponent{
+				&DataWitness{Value: []byte{1}},
+				&PreimageWitness{Hash: bc.Hash{2}, Preimage: []byte{3}},
+				&SignatureWitness{
+					Quorum: 1,
+					Keys: []keyID{{
+						XPub:           testutil.TestXPub,
+						DerivationPath: []chainjson.HexBytes{{5, 6, 7}},
+					}},
+					Program: []byte{0x51},
+					Sigs:    []chainjson.HexBytes{{8, 9, 10}},
+				},
+				&PredicateWitness{
+					Program: []byte{0x51},
+					Components: []WitnessComponent{
+						&DataWitness{Value: []byte{4}},
+						&PredicateWitness{Program: []byte{0x51}, Components: []WitnessComponent{}},
+					},
+				},
+			},
+		}},
+		AllowAdditional: true,
+	}
+}
+
+func TestTemplateBinary(t *testing.T) {
+	tpl := encodingTestTemplate()
+	b, err := tpl.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Template
+	err = got.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !testutil.DeepEqual(tpl, &got) {
+		t.Errorf("got:\n%s\nwant:\n%s", spew.Sdump(&got), spew.Sdump(tpl))
+	}
+
+	wantJSON, err := json.Marshal(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, err := json.Marshal(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("got JSON %s, want %s", gotJSON, wantJSON)
+	}
+
+	err = got.UnmarshalBinary(append(b, 0))
+	if errors.Root(err) != ErrTemplateEncoding {
+		t.Errorf("with trailing byte, got error %v, want %v", err, ErrTemplateEncoding)
+	}
+	err = got.UnmarshalBinary(b[:len(b)-1])
+	if errors.Root(err) != ErrTemplateEncoding {
+		t.Errorf("truncated, got error %v, want %v", err, ErrTemplateEncoding)
+	}
+}
+
+func TestReadTemplateStream(t *testing.T) {
+	tpls := []*Template{encodingTestTemplate(), {
+		SigningInstructions: []*SigningInstruction{},
+		Local:               true,
+	}}
+	var buf bytes.Buffer
+	for _, tpl := range tpls {
+		_, err := tpl.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []*Template
+	for {
+		tpl, err := ReadTemplate(&buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, tpl)
+	}
+	if !testutil.DeepEqual(got, tpls) {
+		t.Errorf("got:\n%s\nwant:\n%s", spew.Sdump(got), spew.Sdump(tpls))
+	}
+}
+
+func TestReadTemplateErrors(t *testing.T) {
+	var version bytes.Buffer
+	blockchain.WriteVarint63(&version, templateVersion+1)
+
+	var component bytes.Buffer
+	blockchain.WriteVarint63(&component, templateVersion)
+	blockchain.WriteVarint63(&component, 0)
+	blockchain.WriteVarstr31(&component, nil)
+	blockchain.WriteVarint31(&component, 1)
+	blockchain.WriteExtensibleString(&component, nil, func(w io.Writer) error {
+		blockchain.WriteVarint31(w, 0)
+		w.Write(make([]byte, 32))
+		blockchain.WriteVarint63(w, 0)
+		blockchain.WriteVarint31(w, 1)
+		blockchain.WriteVarstr31(w, []byte("unknown"))
+		return nil
+	})
+
+	cases := []struct {
+		data []byte
+		want error
+	}{
+		{version.Bytes(), ErrTemplateEncoding},
+		{[]byte{templateVersion}, ErrTemplateEncoding},
+		{component.Bytes(), ErrBadWitnessComponent},
+	}
+	for i, c := range cases {
+		_, err := ReadTemplate(bytes.NewReader(c.data))
+		if errors.Root(err) != c.want {
+			t.Errorf("case %d: got error %v, want %v", i, err, c.want)
+		}
+	}
+}
@@ -28,15 +28,34 @@ var (
 // The final party must ensure that the transaction is
 // balanced before calling finalize.
 func Build(ctx context.Context, tx *bc.TxData, actions []Action, maxTime time.Time) (*Template, error) {
-	builder := TemplateBuilder{
+	builder := &TemplateBuilder{
 		base:    tx,
 		maxTime: maxTime,
 	}
+	return build(ctx, builder, actions)
+}
+
+// BuildDryRun is like Build, but it rolls back the side effects
+// of building the actions, such as reserving outputs, even if
+// building succeeds. The template it returns is for inspecting
+// the transaction; others may spend its inputs at any time.
+func BuildDryRun(ctx context.Context, tx *bc.TxData, actions []Action, maxTime time.Time) (*Template, error) {
+	builder := &TemplateBuilder{
+		base:    tx,
+		maxTime: maxTime,
+	}
+	tpl, err := build(ctx, builder, actions)
+	if err == nil {
+		builder.rollback()
+	}
+	return tpl, err
+}
 
+func build(ctx context.Context, builder *TemplateBuilder, actions []Action) (*Template, error) {
 	// Build all of the actions, updating the builder.
 	var errs []error
 	for i, action := range actions {
-		err := action.Build(ctx, &builder)
+		err := action.Build(ctx, builder)
 		if err != nil {
 			err = errors.WithData(err, "index", i)
 			errs = append(errs, err)
@@ -67,8 +86,8 @@ func Build(ctx context.Context, tx *bc.TxData, actions []Action, maxTime time.Ti
 
 func Sign(ctx context.Context, tpl *Template, xpubs []chainkd.XPub, signFn SignFunc) error {
 	for i, sigInst := range tpl.SigningInstructions {
-		for j, sw := range sigInst.SignatureWitnesses {
-			err := sw.sign(ctx, tpl, uint32(i), xpubs, signFn)
+		for j, c := range sigInst.WitnessComponents {
+			err := c.sign(ctx, tpl, uint32(i), xpubs, signFn)
 			if err != nil {
 				return errors.WithDetailf(err, "adding signature(s) to witness component %d of input %d", j, i)
 			}
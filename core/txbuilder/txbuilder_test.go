@@ -68,7 +68,7 @@ func TestBuild(t *testing.T) {
 			ReferenceData: []byte("xyz"),
 		}),
 		SigningInstructions: []*SigningInstruction{{
-			SignatureWitnesses: []*signatureWitness{},
+			WitnessComponents: []WitnessComponent{},
 		}},
 	}
 
@@ -97,6 +97,41 @@ func TestBuild(t *testing.T) {
 	}
 }
 
+type rollbackAction struct {
+	testAction
+	rolledBack *bool
+}
+
+func (a rollbackAction) Build(ctx context.Context, b *TemplateBuilder) error {
+	b.OnRollback(func() { *a.rolledBack = true })
+	return a.testAction.Build(ctx, b)
+}
+
+func TestBuildDryRun(t *testing.T) {
+	ctx := context.Background()
+	var rolledBack bool
+	actions := []Action{rollbackAction{testAction(bc.AssetAmount{AssetID: [32]byte{1}, Amount: 5}), &rolledBack}}
+
+	_, err := Build(ctx, nil, actions, time.Now().Add(time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if rolledBack {
+		t.Error("Build rolled back a successful build")
+	}
+
+	tpl, err := BuildDryRun(ctx, nil, actions, time.Now().Add(time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !rolledBack {
+		t.Error("BuildDryRun didn't roll back")
+	}
+	if len(tpl.Transaction.Inputs) != 1 {
+		t.Errorf("BuildDryRun got %d inputs want 1", len(tpl.Transaction.Inputs))
+	}
+}
+
 func TestMaterializeWitnesses(t *testing.T) {
 	var initialBlockHash bc.Hash
 	privkey, pubkey, err := chainkd.NewXKeys(nil)
@@ -127,8 +162,8 @@ func TestMaterializeWitnesses(t *testing.T) {
 	tpl := &Template{
 		Transaction: unsigned,
 		SigningInstructions: []*SigningInstruction{{
-			SignatureWitnesses: []*signatureWitness{
-				&signatureWitness{
+			WitnessComponents: []WitnessComponent{
+				&SignatureWitness{
 					Quorum: 1,
 					Keys: []keyID{{
 						XPub:           pubkey,
@@ -206,8 +241,8 @@ func TestSignatureWitnessMaterialize(t *testing.T) {
 
 	// Test with more signatures than required, in correct order
 	tpl.SigningInstructions = []*SigningInstruction{{
-		SignatureWitnesses: []*signatureWitness{
-			&signatureWitness{
+		WitnessComponents: []WitnessComponent{
+			&SignatureWitness{
 				Quorum: 2,
 				Keys: []keyID{
 					{
@@ -238,7 +273,7 @@ func TestSignatureWitnessMaterialize(t *testing.T) {
 	}
 
 	// Test with exact amount of signatures required, in correct order
-	component := tpl.SigningInstructions[0].SignatureWitnesses[0]
+	component := tpl.SigningInstructions[0].WitnessComponents[0].(*SignatureWitness)
 	component.Sigs = []json.HexBytes{sig1, sig2}
 	err = materializeWitnesses(tpl)
 	if err != nil {
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	chainjson "chain/encoding/json"
-	"chain/errors"
 	"chain/protocol/bc"
 )
 
@@ -37,17 +36,14 @@ func (t *Template) Hash(idx uint32) bc.Hash {
 type SigningInstruction struct {
 	Position uint32 `json:"position"`
 	bc.AssetAmount
-	SignatureWitnesses []*signatureWitness `json:"witness_components,omitempty"`
+	WitnessComponents []WitnessComponent `json:"witness_components,omitempty"`
 }
 
 func (si *SigningInstruction) UnmarshalJSON(b []byte) error {
 	var pre struct {
 		bc.AssetAmount
-		Position           uint32 `json:"position"`
-		SignatureWitnesses []struct {
-			Type string
-			signatureWitness
-		} `json:"witness_components"`
+		Position          uint32            `json:"position"`
+		WitnessComponents []json.RawMessage `json:"witness_components"`
 	}
 	err := json.Unmarshal(b, &pre)
 	if err != nil {
@@ -56,14 +52,8 @@ func (si *SigningInstruction) UnmarshalJSON(b []byte) error {
 
 	si.AssetAmount = pre.AssetAmount
 	si.Position = pre.Position
-	si.SignatureWitnesses = make([]*signatureWitness, 0, len(pre.SignatureWitnesses))
-	for i, w := range pre.SignatureWitnesses {
-		if w.Type != "signature" {
-			return errors.WithDetailf(ErrBadWitnessComponent, "witness component %d has unknown type '%s'", i, w.Type)
-		}
-		si.SignatureWitnesses = append(si.SignatureWitnesses, &w.signatureWitness)
-	}
-	return nil
+	si.WitnessComponents, err = decodeWitnessComponents(pre.WitnessComponents, 0)
+	return err
 }
 
 type Action interface {
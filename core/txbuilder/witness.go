@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 
 	"chain/crypto/ed25519/chainkd"
 	"chain/crypto/sha3pool"
@@ -37,9 +38,12 @@ func materializeWitnesses(txTemplate *Template) error {
 			return errors.WithDetailf(ErrBadTxInputIdx, "signing instruction %d references missing tx input %d", i, sigInst.Position)
 		}
 
+		// Components materialize in order, each appending to the
+		// arguments of the ones before it, so a component sees
+		// everything before it as input to its own program.
 		var witness [][]byte
-		for j, sw := range sigInst.SignatureWitnesses {
-			err := sw.materialize(txTemplate, sigInst.Position, &witness)
+		for j, c := range sigInst.WitnessComponents {
+			err := c.materialize(txTemplate, sigInst.Position, &witness)
 			if err != nil {
 				return errors.WithDetailf(err, "error in witness component %d of input %d", j, i)
 			}
@@ -51,8 +55,212 @@ func materializeWitnesses(txTemplate *Template) error {
 	return nil
 }
 
+// WitnessComponent is one part of the witness of an input:
+// a signature, a piece of data, or a program with its own
+// arguments. Its type is one of those in witnessComponentTypes.
+type WitnessComponent interface {
+	// componentType returns the type under which
+	// the component is registered.
+	componentType() string
+
+	// sign adds any signatures the component
+	// can make with xpubs.
+	sign(ctx context.Context, tpl *Template, index uint32, xpubs []chainkd.XPub, signFn SignFunc) error
+
+	// materialize appends the component's arguments to args.
+	materialize(tpl *Template, index uint32, args *[][]byte) error
+
+	writeTo(io.Writer) error
+	readFrom(io.Reader) error
+}
+
+// witnessComponentTypes maps the type of each kind of
+// witness component to a function returning a new one.
+var witnessComponentTypes = map[string]func() WitnessComponent{
+	"data":      func() WitnessComponent { return new(DataWitness) },
+	"preimage":  func() WitnessComponent { return new(PreimageWitness) },
+	"signature": func() WitnessComponent { return new(SignatureWitness) },
+	"predicate": func() WitnessComponent { return new(PredicateWitness) },
+}
+
+func newWitnessComponent(typ string) (WitnessComponent, bool) {
+	f, ok := witnessComponentTypes[typ]
+	if !ok {
+		return nil, false
+	}
+	return f(), true
+}
+
+// decodeWitnessComponents decodes the JSON of a list of
+// witness components, using the type of each to find
+// what to decode it into. Depth counts the predicate
+// components the list is nested in.
+func decodeWitnessComponents(raw []json.RawMessage, depth int) ([]WitnessComponent, error) {
+	components := make([]WitnessComponent, 0, len(raw))
+	for i, b := range raw {
+		var pre struct {
+			Type string
+		}
+		err := json.Unmarshal(b, &pre)
+		if err != nil {
+			return nil, err
+		}
+		c, ok := newWitnessComponent(pre.Type)
+		if !ok {
+			return nil, errors.WithDetailf(ErrBadWitnessComponent, "witness component %d has unknown type '%s'", i, pre.Type)
+		}
+		if pw, ok := c.(*PredicateWitness); ok {
+			if depth >= maxPredicateDepth {
+				return nil, errors.WithDetailf(ErrBadWitnessComponent, "predicate components nested more than %d deep", maxPredicateDepth)
+			}
+			err = pw.decodeNested(b, depth+1)
+		} else {
+			err = json.Unmarshal(b, c)
+		}
+		if err != nil {
+			return nil, err
+		}
+		components = append(components, c)
+	}
+	return components, nil
+}
+
+type (
+	// DataWitness is a witness component
+	// that pushes a single argument.
+	DataWitness struct {
+		Value chainjson.HexBytes `json:"value"`
+	}
+
+	// PreimageWitness is a witness component that pushes
+	// the preimage of a hash, as for a hashlock contract.
+	// Hash lets the party that builds the template leave
+	// Preimage for whoever knows it to fill in.
+	PreimageWitness struct {
+		Hash     bc.Hash            `json:"hash"`
+		Preimage chainjson.HexBytes `json:"preimage"`
+	}
+
+	// PredicateWitness is a witness component for a program
+	// run with CHECKPREDICATE. It pushes the arguments of its
+	// own components, then their number, then Program, as a
+	// control program calling CHECKPREDICATE expects.
+	PredicateWitness struct {
+		Program    chainjson.HexBytes `json:"program"`
+		Components []WitnessComponent `json:"witness_components"`
+	}
+)
+
+func (dw *DataWitness) componentType() string { return "data" }
+
+func (dw *DataWitness) sign(context.Context, *Template, uint32, []chainkd.XPub, SignFunc) error {
+	return nil
+}
+
+func (dw *DataWitness) materialize(tpl *Template, index uint32, args *[][]byte) error {
+	*args = append(*args, dw.Value)
+	return nil
+}
+
+func (dw DataWitness) MarshalJSON() ([]byte, error) {
+	obj := struct {
+		Type  string             `json:"type"`
+		Value chainjson.HexBytes `json:"value"`
+	}{"data", dw.Value}
+	return json.Marshal(obj)
+}
+
+func (pw *PreimageWitness) componentType() string { return "preimage" }
+
+func (pw *PreimageWitness) sign(context.Context, *Template, uint32, []chainkd.XPub, SignFunc) error {
+	return nil
+}
+
+func (pw *PreimageWitness) materialize(tpl *Template, index uint32, args *[][]byte) error {
+	if len(pw.Preimage) == 0 {
+		// Not filled in yet; like a missing signature,
+		// this leaves the witness incomplete.
+		return nil
+	}
+	var h bc.Hash
+	sha3pool.Sum256(h[:], pw.Preimage)
+	if h != pw.Hash {
+		return errors.WithDetailf(ErrBadWitnessComponent, "preimage does not match hash %s", pw.Hash)
+	}
+	*args = append(*args, pw.Preimage)
+	return nil
+}
+
+func (pw PreimageWitness) MarshalJSON() ([]byte, error) {
+	obj := struct {
+		Type     string             `json:"type"`
+		Hash     bc.Hash            `json:"hash"`
+		Preimage chainjson.HexBytes `json:"preimage"`
+	}{"preimage", pw.Hash, pw.Preimage}
+	return json.Marshal(obj)
+}
+
+func (pw *PredicateWitness) componentType() string { return "predicate" }
+
+func (pw *PredicateWitness) sign(ctx context.Context, tpl *Template, index uint32, xpubs []chainkd.XPub, signFn SignFunc) error {
+	for i, c := range pw.Components {
+		err := c.sign(ctx, tpl, index, xpubs, signFn)
+		if err != nil {
+			return errors.WithDetailf(err, "nested witness component %d", i)
+		}
+	}
+	return nil
+}
+
+func (pw *PredicateWitness) materialize(tpl *Template, index uint32, args *[][]byte) error {
+	var nested [][]byte
+	for i, c := range pw.Components {
+		err := c.materialize(tpl, index, &nested)
+		if err != nil {
+			return errors.WithDetailf(err, "nested witness component %d", i)
+		}
+	}
+	*args = append(*args, nested...)
+	*args = append(*args, vm.Int64Bytes(int64(len(nested))), pw.Program)
+	return nil
+}
+
+func (pw PredicateWitness) MarshalJSON() ([]byte, error) {
+	components := pw.Components
+	if components == nil {
+		components = []WitnessComponent{}
+	}
+	obj := struct {
+		Type       string             `json:"type"`
+		Program    chainjson.HexBytes `json:"program"`
+		Components []WitnessComponent `json:"witness_components"`
+	}{"predicate", pw.Program, components}
+	return json.Marshal(obj)
+}
+
+func (pw *PredicateWitness) UnmarshalJSON(b []byte) error {
+	return pw.decodeNested(b, 1)
+}
+
+func (pw *PredicateWitness) decodeNested(b []byte, depth int) error {
+	var pre struct {
+		Program    chainjson.HexBytes `json:"program"`
+		Components []json.RawMessage  `json:"witness_components"`
+	}
+	err := json.Unmarshal(b, &pre)
+	if err != nil {
+		return err
+	}
+	pw.Program = pre.Program
+	pw.Components, err = decodeWitnessComponents(pre.Components, depth)
+	return err
+}
+
 type (
-	signatureWitness struct {
+	// SignatureWitness is a witness component for a multisig
+	// program, like those of accounts, that checks signatures
+	// of a predicate, then runs the predicate.
+	SignatureWitness struct {
 		// Quorum is the number of signatures required.
 		Quorum int `json:"quorum"`
 
@@ -87,7 +295,7 @@ var ErrEmptyProgram = errors.New("empty signature program")
 //  - the mintime and maxtime of the transaction (if non-zero)
 //  - the outputID and (if non-empty) reference data of the current input
 //  - the assetID, amount, control program, and (if non-empty) reference data of each output.
-func (sw *signatureWitness) sign(ctx context.Context, tpl *Template, index uint32, xpubs []chainkd.XPub, signFn SignFunc) error {
+func (sw *SignatureWitness) sign(ctx context.Context, tpl *Template, index uint32, xpubs []chainkd.XPub, signFn SignFunc) error {
 	// Compute the predicate to sign. This is either a
 	// txsighash program if tpl.AllowAdditional is false (i.e., the tx is complete
 	// and no further changes are allowed) or a program enforcing
@@ -189,7 +397,9 @@ func buildSigProgram(tpl *Template, index uint32) []byte {
 	return program
 }
 
-func (sw signatureWitness) materialize(tpl *Template, index uint32, args *[][]byte) error {
+func (sw *SignatureWitness) componentType() string { return "signature" }
+
+func (sw *SignatureWitness) materialize(tpl *Template, index uint32, args *[][]byte) error {
 	// This is the value of N for the CHECKPREDICATE call. The code
 	// assumes that everything already in the arg list before this call
 	// to Materialize is input to the signature program, so N is
@@ -207,7 +417,7 @@ func (sw signatureWitness) materialize(tpl *Template, index uint32, args *[][]by
 	return nil
 }
 
-func (sw signatureWitness) MarshalJSON() ([]byte, error) {
+func (sw SignatureWitness) MarshalJSON() ([]byte, error) {
 	obj := struct {
 		Type   string               `json:"type"`
 		Quorum int                  `json:"quorum"`
@@ -222,7 +432,7 @@ func (sw signatureWitness) MarshalJSON() ([]byte, error) {
 	return json.Marshal(obj)
 }
 
-// AddWitnessKeys adds a signatureWitness with the given quorum and
+// AddWitnessKeys adds a SignatureWitness with the given quorum and
 // list of keys derived by applying the derivation path to each of the
 // xpubs.
 func (si *SigningInstruction) AddWitnessKeys(xpubs []chainkd.XPub, path [][]byte, quorum int) {
@@ -236,9 +446,21 @@ func (si *SigningInstruction) AddWitnessKeys(xpubs []chainkd.XPub, path [][]byte
 		keyIDs = append(keyIDs, keyID{xpub, hexPath})
 	}
 
-	sw := &signatureWitness{
+	sw := &SignatureWitness{
 		Quorum: quorum,
 		Keys:   keyIDs,
 	}
-	si.SignatureWitnesses = append(si.SignatureWitnesses, sw)
+	si.WitnessComponents = append(si.WitnessComponents, sw)
+}
+
+// AddWitnessData adds a DataWitness with the given value.
+func (si *SigningInstruction) AddWitnessData(value []byte) {
+	si.WitnessComponents = append(si.WitnessComponents, &DataWitness{Value: value})
+}
+
+// AddWitnessPreimage adds a PreimageWitness for hash with the
+// given preimage, which may be left empty for another party
+// to fill in before the template is signed.
+func (si *SigningInstruction) AddWitnessPreimage(hash bc.Hash, preimage []byte) {
+	si.WitnessComponents = append(si.WitnessComponents, &PreimageWitness{Hash: hash, Preimage: preimage})
 }
@@ -8,7 +8,9 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 
+	"chain/crypto/sha3pool"
 	chainjson "chain/encoding/json"
+	"chain/errors"
 	"chain/protocol/bc"
 	"chain/protocol/vm"
 	"chain/testutil"
@@ -47,8 +49,10 @@ func TestWitnessJSON(t *testing.T) {
 			Amount:  21,
 		},
 		Position: 17,
-		SignatureWitnesses: []*signatureWitness{
-			&signatureWitness{
+		WitnessComponents: []WitnessComponent{
+			&DataWitness{Value: []byte{1}},
+			&PreimageWitness{Hash: bc.Hash{2}, Preimage: []byte{3}},
+			&SignatureWitness{
 				Quorum: 4,
 				Keys: []keyID{{
 					XPub:           testutil.TestXPub,
@@ -56,6 +60,12 @@ func TestWitnessJSON(t *testing.T) {
 				}},
 				Sigs: []chainjson.HexBytes{{8, 9, 10}},
 			},
+			&PredicateWitness{
+				Program: []byte{0x51},
+				Components: []WitnessComponent{
+					&DataWitness{Value: []byte{4}},
+				},
+			},
 		},
 	}
 
@@ -74,3 +84,87 @@ func TestWitnessJSON(t *testing.T) {
 		t.Errorf("got:\n%s\nwant:\n%s\nJSON was: %s", spew.Sdump(&got), spew.Sdump(si), string(b))
 	}
 }
+
+func TestWitnessJSONUnknownType(t *testing.T) {
+	for _, b := range []string{
+		`{"witness_components": [{"type": "bogus"}]}`,
+		`{"witness_components": [{"type": "predicate", "witness_components": [{"type": "bogus"}]}]}`,
+	} {
+		var si SigningInstruction
+		err := json.Unmarshal([]byte(b), &si)
+		if errors.Root(err) != ErrBadWitnessComponent {
+			t.Errorf("unmarshal %s: got error %v, want %v", b, err, ErrBadWitnessComponent)
+		}
+	}
+}
+
+func TestWitnessJSONTooDeep(t *testing.T) {
+	nest := func(depth int) []byte {
+		b := `{"type": "data", "value": ""}`
+		for i := 0; i < depth; i++ {
+			b = `{"type": "predicate", "program": "51", "witness_components": [` + b + `]}`
+		}
+		return []byte(`{"witness_components": [` + b + `]}`)
+	}
+
+	var si SigningInstruction
+	err := json.Unmarshal(nest(maxPredicateDepth), &si)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(nest(maxPredicateDepth+1), &si)
+	if errors.Root(err) != ErrBadWitnessComponent {
+		t.Errorf("got error %v, want %v", err, ErrBadWitnessComponent)
+	}
+}
+
+func TestMaterializeComponents(t *testing.T) {
+	preimage := []byte("preimage")
+	var hash bc.Hash
+	sha3pool.Sum256(hash[:], preimage)
+	tpl := &Template{
+		Transaction: bc.NewTx(bc.TxData{
+			Inputs: []*bc.TxInput{
+				bc.NewSpendInput(nil, bc.Hash{}, bc.AssetID{}, 123, 0, nil, bc.Hash{}, nil),
+			},
+		}),
+		SigningInstructions: []*SigningInstruction{{
+			WitnessComponents: []WitnessComponent{
+				&DataWitness{Value: []byte{1}},
+				&PreimageWitness{Hash: hash, Preimage: preimage},
+				&PredicateWitness{
+					Program: []byte{0x51},
+					Components: []WitnessComponent{
+						&DataWitness{Value: []byte{2}},
+						&DataWitness{Value: []byte{3}},
+					},
+				},
+				&SignatureWitness{
+					Quorum:  1,
+					Program: []byte{0x52},
+					Sigs:    []chainjson.HexBytes{{4}},
+				},
+			},
+		}},
+	}
+	err := materializeWitnesses(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]byte{
+		{1},
+		preimage,
+		{2}, {3}, vm.Int64Bytes(2), {0x51},
+		vm.Int64Bytes(6), {4}, {0x52},
+	}
+	got := tpl.Transaction.Inputs[0].Arguments()
+	if !testutil.DeepEqual(got, want) {
+		t.Errorf("got witness %x, want %x", got, want)
+	}
+
+	tpl.SigningInstructions[0].WitnessComponents[1] = &PreimageWitness{Hash: hash, Preimage: []byte("wrong")}
+	err = materializeWitnesses(tpl)
+	if errors.Root(err) != ErrBadWitnessComponent {
+		t.Errorf("with wrong preimage, got error %v, want %v", err, ErrBadWitnessComponent)
+	}
+}
@@ -11,7 +11,7 @@ import (
 // Query queries the Chain Core for txfeeds matching the query.
 func (t *Tracker) Query(ctx context.Context, after string, limit int) ([]*TxFeed, string, error) {
 	const baseQ = `
-		SELECT id, alias, filter, after FROM txfeeds
+		SELECT id, alias, filter, after, COALESCE(webhook_url, '') FROM txfeeds
 		WHERE ($1='' OR id < $1) ORDER BY id DESC LIMIT %d
 	`
 	rows, err := t.DB.Query(ctx, fmt.Sprintf(baseQ, limit), after)
@@ -26,7 +26,7 @@ func (t *Tracker) Query(ctx context.Context, after string, limit int) ([]*TxFeed
 			feed  TxFeed
 			alias sql.NullString
 		)
-		err := rows.Scan(&feed.ID, &alias, &feed.Filter, &feed.After)
+		err := rows.Scan(&feed.ID, &alias, &feed.Filter, &feed.After, &feed.WebhookURL)
 		if err != nil {
 			return nil, "", errors.Wrap(err, "scanning txfeed row")
 		}
@@ -5,13 +5,17 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"net/url"
 
 	"chain/core/query"
 	"chain/database/pg"
 	"chain/errors"
 )
 
-var ErrDuplicateAlias = errors.New("duplicate feed alias")
+var (
+	ErrDuplicateAlias = errors.New("duplicate feed alias")
+	ErrBadWebhook     = errors.New("invalid feed webhook")
+)
 
 type Tracker struct {
 	DB pg.DB
@@ -22,14 +26,26 @@ type TxFeed struct {
 	Alias  *string `json:"alias"`
 	Filter string  `json:"filter,omitempty"`
 	After  string  `json:"after,omitempty"`
+
+	// WebhookURL, if set, is the URL that matching transactions
+	// are pushed to. Each delivery is signed with WebhookSecret,
+	// which is never returned to clients.
+	WebhookURL    string `json:"webhook_url,omitempty"`
+	WebhookSecret string `json:"-"`
 }
 
-func (t *Tracker) Create(ctx context.Context, alias, fil, after string, clientToken string) (*TxFeed, error) {
+func (t *Tracker) Create(ctx context.Context, alias, fil, after, webhookURL, webhookSecret string, clientToken string) (*TxFeed, error) {
 	// Validate the filter.
 	err := query.ValidateTransactionFilter(fil)
 	if err != nil {
 		return nil, err
 	}
+	if webhookURL != "" {
+		err = validateWebhook(fil, webhookURL, webhookSecret)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	var ptrAlias *string
 	if alias != "" {
@@ -37,20 +53,45 @@ func (t *Tracker) Create(ctx context.Context, alias, fil, after string, clientTo
 	}
 
 	feed := &TxFeed{
-		Alias:  ptrAlias,
-		Filter: fil,
-		After:  after,
+		Alias:         ptrAlias,
+		Filter:        fil,
+		After:         after,
+		WebhookURL:    webhookURL,
+		WebhookSecret: webhookSecret,
 	}
 	return insertTxFeed(ctx, t.DB, feed, clientToken)
 }
 
+// validateWebhook checks that a feed with the filter fil
+// can push transactions to webhookURL.
+func validateWebhook(fil, webhookURL, webhookSecret string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.WithDetailf(ErrBadWebhook, "webhook URL %q must be an absolute http or https URL", webhookURL)
+	}
+	if webhookSecret == "" {
+		return errors.WithDetail(ErrBadWebhook, "a webhook secret is required to sign deliveries")
+	}
+
+	// Webhook deliveries evaluate the filter without parameter
+	// values, so the filter can't use placeholders.
+	n, err := query.TransactionFilterParameters(fil)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errors.WithDetail(ErrBadWebhook, "webhook feed filters cannot use placeholders")
+	}
+	return nil
+}
+
 // insertTxFeed adds the txfeed to the database. If the txfeed has a client token,
 // and there already exists a txfeed with that client token, insertTxFeed will
 // lookup and return the existing txfeed instead.
 func insertTxFeed(ctx context.Context, db pg.DB, feed *TxFeed, clientToken string) (*TxFeed, error) {
 	const q = `
-		INSERT INTO txfeeds (alias, filter, after, client_token)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO txfeeds (alias, filter, after, client_token, webhook_url, webhook_secret)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		ON CONFLICT (client_token) DO NOTHING
 		RETURNING id
 	`
@@ -65,9 +106,12 @@ func insertTxFeed(ctx context.Context, db pg.DB, feed *TxFeed, clientToken strin
 		Valid:  clientToken != "",
 	}
 
+	webhookURL := sql.NullString{String: feed.WebhookURL, Valid: feed.WebhookURL != ""}
+	webhookSecret := sql.NullString{String: feed.WebhookSecret, Valid: feed.WebhookURL != ""}
+
 	err := db.QueryRow(
 		ctx, q, alias, feed.Filter, feed.After,
-		nullToken).Scan(&feed.ID)
+		nullToken, webhookURL, webhookSecret).Scan(&feed.ID)
 
 	if pg.IsUniqueViolation(err) {
 		return nil, errors.WithDetail(ErrDuplicateAlias, "a transaction feed with the provided alias already exists")
@@ -87,7 +131,8 @@ func insertTxFeed(ctx context.Context, db pg.DB, feed *TxFeed, clientToken strin
 
 func txfeedByClientToken(ctx context.Context, db pg.DB, clientToken string) (*TxFeed, error) {
 	const q = `
-		SELECT id, alias, filter, after
+		SELECT id, alias, filter, after,
+			COALESCE(webhook_url, ''), COALESCE(webhook_secret, '')
 		FROM txfeeds
 		WHERE client_token=$1
 	`
@@ -96,7 +141,7 @@ func txfeedByClientToken(ctx context.Context, db pg.DB, clientToken string) (*Tx
 		feed  TxFeed
 		alias sql.NullString
 	)
-	err := db.QueryRow(ctx, q, clientToken).Scan(&feed.ID, &alias, &feed.Filter, &feed.After)
+	err := db.QueryRow(ctx, q, clientToken).Scan(&feed.ID, &alias, &feed.Filter, &feed.After, &feed.WebhookURL, &feed.WebhookSecret)
 	if err != nil {
 		return nil, err
 	}
@@ -112,7 +157,8 @@ func (t *Tracker) Find(ctx context.Context, id, alias string) (*TxFeed, error) {
 	var q bytes.Buffer
 
 	q.WriteString(`
-		SELECT id, alias, filter, after
+		SELECT id, alias, filter, after,
+			COALESCE(webhook_url, ''), COALESCE(webhook_secret, '')
 		FROM txfeeds
 		WHERE
 	`)
@@ -129,7 +175,7 @@ func (t *Tracker) Find(ctx context.Context, id, alias string) (*TxFeed, error) {
 		sqlAlias sql.NullString
 	)
 
-	err := t.DB.QueryRow(ctx, q.String(), id).Scan(&feed.ID, &sqlAlias, &feed.Filter, &feed.After)
+	err := t.DB.QueryRow(ctx, q.String(), id).Scan(&feed.ID, &sqlAlias, &feed.Filter, &feed.After, &feed.WebhookURL, &feed.WebhookSecret)
 	if err == sql.ErrNoRows {
 		err = errors.Sub(pg.ErrUserInputNotFound, err)
 		err = errors.WithDetailf(err, "alias: %s", alias)
@@ -92,7 +92,7 @@ func TestCreateTxFeedBadFilter(t *testing.T) {
 	token := "test_token_0"
 	alias := "test_txfeed"
 	fil := "lol i'm not a ~real~ filter"
-	_, err := tracker.Create(ctx, alias, fil, "", token)
+	_, err := tracker.Create(ctx, alias, fil, "", "", "", token)
 	if errors.Root(err) != filter.ErrBadFilter {
 		t.Errorf("expected ErrBadFilter, got %s", errors.Root(err))
 	}
@@ -0,0 +1,293 @@
+package txfeed
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"chain/core/pin"
+	"chain/core/query"
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol"
+	"chain/protocol/bc"
+)
+
+const (
+	// WebhookPinName is used to identify the pin associated
+	// with delivering transactions to feed webhooks.
+	WebhookPinName = "txfeed-webhook"
+
+	// HeaderFeedID is the header identifying the feed
+	// a webhook delivery belongs to.
+	HeaderFeedID = "Chain-Feed-ID"
+
+	// HeaderSignature is the header holding the hex-encoded
+	// HMAC-SHA256 of a webhook delivery's body, keyed with
+	// the feed's webhook secret.
+	HeaderSignature = "Chain-Signature"
+)
+
+var (
+	// webhookAttempts is the number of times a delivery is
+	// attempted before the feed's delivery fails and is
+	// retried after webhookRetryDelay.
+	webhookAttempts = 5
+
+	// webhookBackoff is the delay before retrying a failed
+	// delivery. It doubles after each attempt.
+	webhookBackoff = time.Second
+
+	// webhookRetryDelay is the delay before retrying a feed
+	// whose delivery failed. It doubles after each failure,
+	// up to webhookMaxRetryDelay.
+	webhookRetryDelay    = 10 * time.Second
+	webhookMaxRetryDelay = 10 * time.Minute
+
+	webhookBatchSize = 100
+)
+
+// Dispatcher pushes the transactions matching feeds with
+// webhooks to the feeds' webhook URLs.
+//
+// Transactions are delivered to each feed in block order, at
+// least once. A feed's cursor is advanced after each successful
+// delivery, so clients see the feed's progress and deliveries
+// resume from the cursor after a restart or a change of leader.
+type Dispatcher struct {
+	tracker  *Tracker
+	indexer  *query.Indexer
+	chain    *protocol.Chain
+	pinStore *pin.Store
+	client   *http.Client
+
+	mu      sync.Mutex
+	running map[string]bool // feed IDs with a delivery in progress
+}
+
+// NewDispatcher constructs a new Dispatcher delivering
+// transactions indexed by indexer.
+func NewDispatcher(tracker *Tracker, indexer *query.Indexer, c *protocol.Chain, pinStore *pin.Store) *Dispatcher {
+	return &Dispatcher{
+		tracker:  tracker,
+		indexer:  indexer,
+		chain:    c,
+		pinStore: pinStore,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		running:  make(map[string]bool),
+	}
+}
+
+func (d *Dispatcher) ProcessBlocks(ctx context.Context) {
+	if d.pinStore == nil {
+		return
+	}
+	d.pinStore.ProcessBlocks(ctx, d.chain, WebhookPinName, d.deliverBlock)
+}
+
+// deliverBlock is registered as a block callback on the Chain.
+// Once block b is indexed, it starts delivering transactions to
+// every feed with a webhook that isn't already being delivered to.
+//
+// Deliveries happen in the background, so a slow or unreachable
+// webhook doesn't hold up block processing or the other feeds.
+// If a webhook can't be reached, its feed's cursor stays put
+// and delivery is tried again after a delay, whether or not
+// another block arrives.
+func (d *Dispatcher) deliverBlock(ctx context.Context, b *bc.Block) error {
+	<-d.pinStore.PinWaiter(query.TxPinName, b.Height)
+
+	feeds, err := d.tracker.webhookFeeds(ctx)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, feed := range feeds {
+		if d.running[feed.ID] {
+			continue
+		}
+		d.running[feed.ID] = true
+		go d.runFeed(ctx, feed)
+	}
+	return nil
+}
+
+// runFeed delivers to feed until it has caught up with
+// the indexed transactions. When a delivery fails, it waits
+// and tries again, doubling the delay after each failure.
+func (d *Dispatcher) runFeed(ctx context.Context, feed *TxFeed) {
+	retryDelay := webhookRetryDelay
+	for {
+		height := d.pinStore.Height(query.TxPinName)
+		err := d.deliverFeed(ctx, feed, height)
+		if err != nil {
+			log.Error(ctx, err, "txfeed ", feed.ID)
+			select {
+			case <-ctx.Done():
+				d.stopFeed(feed.ID)
+				return
+			case <-time.After(retryDelay):
+			}
+			retryDelay *= 2
+			if retryDelay > webhookMaxRetryDelay {
+				retryDelay = webhookMaxRetryDelay
+			}
+
+			// The feed may have been deleted
+			// while its delivery was failing.
+			f, err := d.tracker.Find(ctx, feed.ID, "")
+			if errors.Root(err) == pg.ErrUserInputNotFound {
+				d.stopFeed(feed.ID)
+				return
+			} else if err != nil {
+				log.Error(ctx, err, "reloading txfeed ", feed.ID)
+			} else {
+				feed = f
+			}
+			continue
+		}
+		retryDelay = webhookRetryDelay
+
+		d.mu.Lock()
+		if d.pinStore.Height(query.TxPinName) == height {
+			delete(d.running, feed.ID)
+			d.mu.Unlock()
+			return
+		}
+		d.mu.Unlock()
+	}
+}
+
+// stopFeed records that delivery to the feed with
+// the given ID is no longer in progress.
+func (d *Dispatcher) stopFeed(id string) {
+	d.mu.Lock()
+	delete(d.running, id)
+	d.mu.Unlock()
+}
+
+// deliverFeed delivers the transactions matching feed that
+// come after its cursor, up to and including block height.
+func (d *Dispatcher) deliverFeed(ctx context.Context, feed *TxFeed, height uint64) error {
+	after, err := query.DecodeTxAfter(feed.After)
+	if err != nil {
+		return err
+	}
+	if after.FromBlockHeight > height {
+		return nil
+	}
+	after.StopBlockHeight = height
+
+	for {
+		txs, next, err := d.indexer.TransactionsSince(ctx, feed.Filter, nil, after, webhookBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "querying transactions")
+		}
+		for _, tx := range txs {
+			err = d.deliver(ctx, feed, tx)
+			if err != nil {
+				return errors.Wrapf(err, "delivering tx %s", tx.ID)
+			}
+
+			cursor := query.TxAfter{
+				FromBlockHeight: tx.BlockHeight,
+				FromPosition:    tx.Position,
+				StopBlockHeight: math.MaxInt64,
+			}
+			_, err = d.tracker.Update(ctx, feed.ID, "", cursor.String(), feed.After)
+			if err != nil {
+				return errors.Wrap(err, "advancing feed cursor")
+			}
+			feed.After = cursor.String()
+		}
+		if len(txs) < webhookBatchSize {
+			return nil
+		}
+		after = *next
+	}
+}
+
+// deliver posts tx to feed's webhook, retrying with
+// exponential backoff until the webhook responds with
+// a 2xx status or the attempts are exhausted.
+func (d *Dispatcher) deliver(ctx context.Context, feed *TxFeed, tx *query.AnnotatedTx) error {
+	body, err := json.Marshal(tx)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		err = d.post(ctx, feed, body)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, feed *TxFeed, body []byte) error {
+	req, err := http.NewRequest("POST", feed.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderFeedID, feed.ID)
+	req.Header.Set(HeaderSignature, Signature(feed.WebhookSecret, body))
+
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Signature returns the value of the HeaderSignature header
+// for a webhook delivery of body signed with secret.
+// Receivers can use it to authenticate deliveries.
+func Signature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookFeeds returns all feeds with a webhook.
+func (t *Tracker) webhookFeeds(ctx context.Context) ([]*TxFeed, error) {
+	const q = `
+		SELECT id, filter, after, webhook_url, COALESCE(webhook_secret, '')
+		FROM txfeeds
+		WHERE webhook_url IS NOT NULL
+	`
+	var feeds []*TxFeed
+	err := pg.ForQueryRows(ctx, t.DB, q, func(id, filter, after, webhookURL, webhookSecret string) {
+		feeds = append(feeds, &TxFeed{
+			ID:            id,
+			Filter:        filter,
+			After:         after,
+			WebhookURL:    webhookURL,
+			WebhookSecret: webhookSecret,
+		})
+	})
+	return feeds, errors.Wrap(err, "querying webhook feeds")
+}
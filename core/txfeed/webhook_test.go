@@ -0,0 +1,102 @@
+package txfeed
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chain/core/query"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+func TestValidateWebhook(t *testing.T) {
+	cases := []struct {
+		filter, url, secret string
+		ok                  bool
+	}{
+		{filter: "", url: "https://example.com/hook", secret: "s3cret", ok: true},
+		{filter: "inputs(type='issue')", url: "http://10.0.0.1:8080/", secret: "s3cret", ok: true},
+		{filter: "", url: "example.com/hook", secret: "s3cret"},
+		{filter: "", url: "ftp://example.com/hook", secret: "s3cret"},
+		{filter: "", url: "https://example.com/hook", secret: ""},
+		{filter: "inputs(asset_id=$1)", url: "https://example.com/hook", secret: "s3cret"},
+	}
+
+	for _, c := range cases {
+		err := validateWebhook(c.filter, c.url, c.secret)
+		if c.ok && err != nil {
+			t.Errorf("validateWebhook(%q, %q, %q) = %v, want nil", c.filter, c.url, c.secret, err)
+		} else if !c.ok && errors.Root(err) != ErrBadWebhook {
+			t.Errorf("validateWebhook(%q, %q, %q) = %v, want %v", c.filter, c.url, c.secret, err, ErrBadWebhook)
+		}
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	defer func(b time.Duration) { webhookBackoff = b }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+
+	var (
+		calls   int
+		gotBody []byte
+		gotSig  string
+		gotFeed string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		gotBody, _ = ioutil.ReadAll(req.Body)
+		gotSig = req.Header.Get(HeaderSignature)
+		gotFeed = req.Header.Get(HeaderFeedID)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	d := &Dispatcher{client: server.Client()}
+	feed := &TxFeed{ID: "feed1", WebhookURL: server.URL, WebhookSecret: "s3cret"}
+	tx := &query.AnnotatedTx{ID: bc.Hash{1}, BlockHeight: 2}
+
+	err := d.deliver(context.Background(), feed, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("got %d attempts, want 3", calls)
+	}
+	if gotFeed != feed.ID {
+		t.Errorf("got feed header %q, want %q", gotFeed, feed.ID)
+	}
+	if want := Signature(feed.WebhookSecret, gotBody); gotSig != want {
+		t.Errorf("got signature %q, want %q", gotSig, want)
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	defer func(b time.Duration) { webhookBackoff = b }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	d := &Dispatcher{client: server.Client()}
+	feed := &TxFeed{ID: "feed1", WebhookURL: server.URL, WebhookSecret: "s3cret"}
+
+	err := d.deliver(context.Background(), feed, &query.AnnotatedTx{})
+	if err == nil {
+		t.Error("expected error delivering to failing webhook")
+	}
+	if calls != webhookAttempts {
+		t.Errorf("got %d attempts, want %d", calls, webhookAttempts)
+	}
+}
@@ -16,6 +16,14 @@ func (a *API) createTxFeed(ctx context.Context, in struct {
 	Alias  string
 	Filter string
 
+	// WebhookURL, if set, is the URL the core POSTs each matching
+	// transaction to, in block order. Each request carries the
+	// HMAC-SHA256 of its body, keyed with WebhookSecret, in the
+	// Chain-Signature header. The feed's after cursor advances
+	// as the webhook accepts transactions.
+	WebhookURL    string `json:"webhook_url"`
+	WebhookSecret string `json:"webhook_secret"`
+
 	// ClientToken is the application's unique token for the txfeed. Every txfeed
 	// should have a unique client token. The client token is used to ensure
 	// idempotency of create txfeed requests. Duplicate create txfeed requests
@@ -23,7 +31,10 @@ func (a *API) createTxFeed(ctx context.Context, in struct {
 	ClientToken string `json:"client_token"`
 }) (*txfeed.TxFeed, error) {
 	after := fmt.Sprintf("%d:%d-%d", a.chain.Height(), math.MaxInt32, uint64(math.MaxInt64))
-	return a.txFeeds.Create(ctx, in.Alias, in.Filter, after, in.ClientToken)
+	if in.WebhookURL != "" && !a.indexTxs {
+		return nil, errors.WithDetail(txfeed.ErrBadWebhook, "webhooks require transaction indexing")
+	}
+	return a.txFeeds.Create(ctx, in.Alias, in.Filter, after, in.WebhookURL, in.WebhookSecret, in.ClientToken)
 }
 
 // POST /get-transaction-feed
@@ -0,0 +1,113 @@
+// Package passphrase encrypts small secrets, such as private
+// keys, with a key derived from a passphrase.
+//
+// Sealed data is a version byte, a byte giving the base-2 log
+// of the scrypt cost parameter N, a 16-byte salt, a 12-byte
+// nonce, and the AES-256-GCM ciphertext of the secret. The
+// encryption key is derived from the passphrase and salt with
+// scrypt, using r=8 and p=1.
+package passphrase
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+
+	"golang.org/x/crypto/scrypt"
+
+	"chain/errors"
+)
+
+const (
+	version = 1
+
+	// LogN is the base-2 log of the scrypt
+	// cost parameter N that Seal uses.
+	LogN = 15
+
+	scryptR = 8
+	scryptP = 1
+
+	saltSize  = 16
+	nonceSize = 12
+	keySize   = 32
+
+	headerSize = 1 + 1 + saltSize + nonceSize
+
+	// maxLogN bounds the work and memory Open will
+	// use for sealed data it hasn't authenticated yet.
+	maxLogN = LogN + 2
+)
+
+var (
+	// ErrWrongPassphrase is returned by Open when the passphrase
+	// doesn't match the one the data was sealed with, or the
+	// data has been tampered with.
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+
+	// ErrBadSealed is returned by Open when the data
+	// isn't in the sealed format.
+	ErrBadSealed = errors.New("malformed sealed data")
+)
+
+// Seal encrypts secret with a key derived from passphrase.
+func Seal(secret, passphrase []byte) ([]byte, error) {
+	return seal(secret, passphrase, LogN)
+}
+
+func seal(secret, passphrase []byte, logN uint) ([]byte, error) {
+	header := make([]byte, headerSize)
+	header[0] = version
+	header[1] = byte(logN)
+	salt := header[2 : 2+saltSize]
+	nonce := header[2+saltSize:]
+	_, err := rand.Read(header[2:])
+	if err != nil {
+		return nil, errors.Wrap(err, "reading random salt and nonce")
+	}
+
+	aead, err := newAEAD(passphrase, salt, logN)
+	if err != nil {
+		return nil, err
+	}
+	// The header is additional data, so that changing
+	// the version or cost parameter breaks the seal.
+	return aead.Seal(header, nonce, secret, header), nil
+}
+
+// Open decrypts data sealed by Seal with the same passphrase.
+func Open(sealed, passphrase []byte) ([]byte, error) {
+	if len(sealed) < headerSize || sealed[0] != version {
+		return nil, ErrBadSealed
+	}
+	header := sealed[:headerSize]
+	logN := uint(header[1])
+	if logN == 0 || logN > maxLogN {
+		return nil, errors.WithDetailf(ErrBadSealed, "scrypt cost 2^%d", logN)
+	}
+	salt := header[2 : 2+saltSize]
+	nonce := header[2+saltSize:]
+
+	aead, err := newAEAD(passphrase, salt, logN)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := aead.Open(nil, nonce, sealed[headerSize:], header)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return secret, nil
+}
+
+func newAEAD(passphrase, salt []byte, logN uint) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, 1<<logN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "deriving key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, errors.Wrap(err)
+}
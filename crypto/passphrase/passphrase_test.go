@@ -0,0 +1,57 @@
+package passphrase
+
+import (
+	"bytes"
+	"testing"
+
+	"chain/errors"
+)
+
+func TestSealOpen(t *testing.T) {
+	secret := []byte("secret key material")
+	sealed, err := seal(secret, []byte("correct horse"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Open(sealed, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, secret) {
+		t.Errorf("got %q, want %q", got, secret)
+	}
+
+	_, err = Open(sealed, []byte("battery staple"))
+	if err != ErrWrongPassphrase {
+		t.Errorf("with wrong passphrase, got error %v, want %v", err, ErrWrongPassphrase)
+	}
+
+	// Lowering the cost parameter in the header
+	// must not yield a usable key.
+	tampered := append([]byte(nil), sealed...)
+	tampered[1]--
+	_, err = Open(tampered, []byte("correct horse"))
+	if err != ErrWrongPassphrase {
+		t.Errorf("with tampered header, got error %v, want %v", err, ErrWrongPassphrase)
+	}
+
+	_, err = Open(sealed[:headerSize-1], []byte("correct horse"))
+	if err != ErrBadSealed {
+		t.Errorf("truncated, got error %v, want %v", err, ErrBadSealed)
+	}
+}
+
+func TestOpenCostBound(t *testing.T) {
+	sealed, err := seal([]byte("secret"), []byte("correct horse"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, logN := range []byte{0, maxLogN + 1} {
+		sealed[1] = logN
+		_, err = Open(sealed, []byte("correct horse"))
+		if errors.Root(err) != ErrBadSealed {
+			t.Errorf("with cost 2^%d, got error %v, want %v", logN, err, ErrBadSealed)
+		}
+	}
+}
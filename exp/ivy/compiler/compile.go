@@ -0,0 +1,597 @@
+package compiler
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/vm"
+)
+
+// Errors returned by Compile.
+var (
+	ErrSyntax      = errors.New("syntax error")
+	ErrContract    = errors.New("invalid contract")
+	ErrBadArgument = errors.New("bad contract argument")
+)
+
+// Contract is a compiled contract.
+type Contract struct {
+	Name    string             `json:"name"`
+	Params  []Param            `json:"params"`
+	Value   string             `json:"value"`
+	Clauses []Clause           `json:"clauses"`
+	Opcodes string             `json:"opcodes"`
+	Program chainjson.HexBytes `json:"program"`
+}
+
+// Param is a contract or clause parameter.
+type Param struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Clause describes how to satisfy one clause of a contract.
+// The spender's witness arguments are the clause's arguments,
+// then one output index for each of the clause's lock
+// statements, then, if the contract has more than one clause,
+// the clause's index in the contract.
+type Clause struct {
+	Name    string  `json:"name"`
+	Params  []Param `json:"params"`
+	Outputs int     `json:"outputs"`
+}
+
+// ContractArg is an argument for a contract parameter.
+// Boolean parameters take B; Amount, Integer and Time
+// parameters take I; the others take S.
+type ContractArg struct {
+	B *bool               `json:"boolean,omitempty"`
+	I *int64              `json:"integer,omitempty"`
+	S *chainjson.HexBytes `json:"string,omitempty"`
+}
+
+// byteSizes holds the required length of arguments
+// of fixed-size types.
+var byteSizes = map[typ]int{
+	assetType:  32,
+	hashType:   32,
+	pubkeyType: 32,
+}
+
+// Compile compiles the contract in src, with args for its
+// parameters, into a control program.
+func Compile(src string, args []ContractArg) (*Contract, error) {
+	c, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.clauses) == 0 {
+		return nil, errorf(c.pos, "contract %s has no clauses", c.name)
+	}
+	if len(args) != len(c.params) {
+		return nil, errors.WithDetailf(ErrBadArgument, "contract %s takes %d arguments, got %d", c.name, len(c.params), len(args))
+	}
+
+	result := &Contract{Name: c.name, Value: c.value}
+	names := map[string]bool{c.value: true}
+	consts := make(map[string]constant)
+	for i, p := range c.params {
+		if names[p.name] {
+			return nil, errorf(p.pos, "%s redeclared", p.name)
+		}
+		names[p.name] = true
+		asm, err := argAsm(p, args[i])
+		if err != nil {
+			return nil, err
+		}
+		consts[p.name] = constant{typ: p.typ, asm: asm}
+		result.Params = append(result.Params, Param{Name: p.name, Type: string(p.typ)})
+	}
+
+	var bodies []string
+	clauseNames := make(map[string]bool)
+	for _, cl := range c.clauses {
+		if clauseNames[cl.name] {
+			return nil, errorf(cl.pos, "clause %s redeclared", cl.name)
+		}
+		clauseNames[cl.name] = true
+
+		cc := &clauseCompiler{
+			value:  c.value,
+			consts: consts,
+			params: make(map[string]*param),
+			used:   make(map[string]bool),
+		}
+		err := cc.compile(cl, names)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, strings.Join(cc.ops, " "))
+
+		info := Clause{Name: cl.name, Outputs: cc.outputs}
+		for _, p := range cl.params {
+			info.Params = append(info.Params, Param{Name: p.name, Type: string(p.typ)})
+		}
+		result.Clauses = append(result.Clauses, info)
+	}
+
+	result.Opcodes = selectClause(bodies)
+	result.Program, err = vm.Assemble(result.Opcodes)
+	if err != nil {
+		return nil, errors.Wrap(err, "assembling compiled contract")
+	}
+	return result, nil
+}
+
+// selectClause returns code that runs the clause whose
+// index is on top of the stack. The last clause checks
+// its index rather than being a default, so that each
+// clause has exactly one index.
+func selectClause(bodies []string) string {
+	if len(bodies) == 1 {
+		return bodies[0]
+	}
+	var parts []string
+	last := len(bodies) - 1
+	for i, body := range bodies[:last] {
+		parts = append(parts, fmt.Sprintf("DUP %d NUMEQUAL IF DROP %s ELSE", i, body))
+	}
+	parts = append(parts, fmt.Sprintf("%d NUMEQUALVERIFY %s", last, bodies[last]))
+	for range bodies[:last] {
+		parts = append(parts, "ENDIF")
+	}
+	return strings.Join(parts, " ")
+}
+
+func argAsm(p *param, arg ContractArg) (string, error) {
+	switch {
+	case p.typ == boolType:
+		if arg.B == nil {
+			return "", errors.WithDetailf(ErrBadArgument, "%s must be a boolean", p.name)
+		}
+		if *arg.B {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+
+	case isNumeric(p.typ):
+		if arg.I == nil {
+			return "", errors.WithDetailf(ErrBadArgument, "%s must be an integer", p.name)
+		}
+		if p.typ != intType && *arg.I < 0 {
+			return "", errors.WithDetailf(ErrBadArgument, "%s must not be negative", p.name)
+		}
+		return strconv.FormatInt(*arg.I, 10), nil
+	}
+
+	if arg.S == nil {
+		return "", errors.WithDetailf(ErrBadArgument, "%s must be a string", p.name)
+	}
+	if n := byteSizes[p.typ]; n > 0 && len(*arg.S) != n {
+		return "", errors.WithDetailf(ErrBadArgument, "%s must be %d bytes", p.name, n)
+	}
+	return bytesAsm(*arg.S), nil
+}
+
+func bytesAsm(b []byte) string {
+	if len(b) == 0 {
+		return "0"
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
+func errorf(p pos, format string, args ...interface{}) error {
+	return errors.WithDetailf(ErrContract, p.String()+": "+format, args...)
+}
+
+// constant is a contract parameter,
+// whose value is compiled into the program.
+type constant struct {
+	typ typ
+	asm string
+}
+
+// clauseCompiler compiles a clause, keeping track of
+// what is on the stack so it can find clause arguments.
+type clauseCompiler struct {
+	value   string
+	consts  map[string]constant
+	params  map[string]*param
+	used    map[string]bool
+	outputs int
+
+	// stack holds the names of the clause arguments and
+	// output indexes on the stack, and "" for temporaries.
+	stack []string
+	ops   []string
+}
+
+func (cc *clauseCompiler) compile(cl *clause, names map[string]bool) error {
+	for _, p := range cl.params {
+		if names[p.name] || cc.params[p.name] != nil {
+			return errorf(p.pos, "%s redeclared", p.name)
+		}
+		cc.params[p.name] = p
+		cc.stack = append(cc.stack, p.name)
+	}
+	var nlocks int
+	for _, s := range cl.stmts {
+		if _, ok := s.(*lockStmt); ok {
+			cc.stack = append(cc.stack, outputName(nlocks))
+			nlocks++
+		}
+	}
+
+	var disposed int
+	for _, s := range cl.stmts {
+		switch s := s.(type) {
+		case *verifyStmt:
+			err := cc.typed(s.expr, boolType)
+			if err != nil {
+				return err
+			}
+			cc.emit("VERIFY", 1, 0)
+
+		case *lockStmt:
+			cc.pick(outputName(cc.outputs))
+			cc.outputs++
+			cc.emit("0", 0, 1) // no reference data requirement
+			if s.amount == nil {
+				if s.value != cc.value {
+					return errorf(s.pos, "%s is not the contract's value", s.value)
+				}
+				disposed++
+				cc.emit("AMOUNT", 0, 1)
+				cc.emit("ASSET", 0, 1)
+			} else {
+				err := cc.typed(s.amount, amountType, intType)
+				if err != nil {
+					return err
+				}
+				err = cc.typed(s.asset, assetType)
+				if err != nil {
+					return err
+				}
+			}
+			cc.emit("1", 0, 1) // VM version
+			err := cc.typed(s.program, programType)
+			if err != nil {
+				return err
+			}
+			cc.emit("CHECKOUTPUT", 6, 1)
+			cc.emit("VERIFY", 1, 0)
+
+		case *unlockStmt:
+			if s.value != cc.value {
+				return errorf(s.pos, "%s is not the contract's value", s.value)
+			}
+			disposed++
+		}
+	}
+	if disposed != 1 {
+		return errorf(cl.pos, "clause %s must lock or unlock %s exactly once", cl.name, cc.value)
+	}
+	for _, p := range cl.params {
+		if !cc.used[p.name] {
+			return errorf(p.pos, "parameter %s is unused", p.name)
+		}
+	}
+	cc.emit("TRUE", 0, 1)
+	return nil
+}
+
+func outputName(i int) string {
+	return fmt.Sprintf("#output%d", i)
+}
+
+// emit adds op to the program, where op consumes
+// pops items from the stack and leaves pushes items.
+func (cc *clauseCompiler) emit(op string, pops, pushes int) {
+	cc.ops = append(cc.ops, op)
+	cc.stack = cc.stack[:len(cc.stack)-pops]
+	for i := 0; i < pushes; i++ {
+		cc.stack = append(cc.stack, "")
+	}
+}
+
+// pick copies the named stack item to the top of the stack.
+func (cc *clauseCompiler) pick(name string) {
+	var depth int
+	for i := len(cc.stack) - 1; cc.stack[i] != name; i-- {
+		depth++
+	}
+	switch depth {
+	case 0:
+		cc.emit("DUP", 0, 1)
+	case 1:
+		cc.emit("OVER", 0, 1)
+	default:
+		cc.emit(fmt.Sprintf("%d PICK", depth), 0, 1)
+	}
+}
+
+// typed compiles e, which must have one of the given types.
+func (cc *clauseCompiler) typed(e expression, want ...typ) error {
+	t, err := cc.expr(e)
+	if err != nil {
+		return err
+	}
+	for _, w := range want {
+		if t == w {
+			return nil
+		}
+	}
+	return errorf(e.position(), "expected %s, got %s", want[0], t)
+}
+
+func (cc *clauseCompiler) expr(e expression) (typ, error) {
+	switch e := e.(type) {
+	case *intLiteral:
+		cc.emit(strconv.FormatInt(e.n, 10), 0, 1)
+		return intType, nil
+
+	case *boolLiteral:
+		if e.b {
+			cc.emit("TRUE", 0, 1)
+		} else {
+			cc.emit("FALSE", 0, 1)
+		}
+		return boolType, nil
+
+	case *bytesLiteral:
+		cc.emit(bytesAsm(e.b), 0, 1)
+		return stringType, nil
+
+	case *varRef:
+		if p, ok := cc.params[e.name]; ok {
+			cc.used[e.name] = true
+			cc.pick(e.name)
+			return p.typ, nil
+		}
+		if c, ok := cc.consts[e.name]; ok {
+			cc.emit(c.asm, 0, 1)
+			return c.typ, nil
+		}
+		if e.name == cc.value {
+			return "", errorf(e.pos, "%s can only be locked or unlocked", e.name)
+		}
+		return "", errorf(e.pos, "undefined: %s", e.name)
+
+	case *propRef:
+		if e.name != cc.value {
+			return "", errorf(e.pos, "%s is not the contract's value", e.name)
+		}
+		switch e.prop {
+		case "amount":
+			cc.emit("AMOUNT", 0, 1)
+			return amountType, nil
+		case "asset":
+			cc.emit("ASSET", 0, 1)
+			return assetType, nil
+		}
+		return "", errorf(e.pos, "%s has no property %s", e.name, e.prop)
+
+	case *unaryExpr:
+		t, err := cc.expr(e.expr)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case e.op == "!" && t == boolType:
+			cc.emit("NOT", 1, 1)
+		case e.op == "-" && t == intType:
+			cc.emit("NEGATE", 1, 1)
+		default:
+			return "", errorf(e.pos, "invalid operation %s%s", e.op, t)
+		}
+		return t, nil
+
+	case *binaryExpr:
+		return cc.binary(e)
+
+	case *callExpr:
+		return cc.call(e)
+
+	case *listExpr:
+		return "", errorf(e.pos, "list used outside function arguments")
+	}
+	return "", errorf(e.position(), "unknown expression")
+}
+
+var (
+	numericOps = map[string]string{
+		"<": "LESSTHAN", "<=": "LESSTHANOREQUAL",
+		">": "GREATERTHAN", ">=": "GREATERTHANOREQUAL",
+		"==": "NUMEQUAL", "!=": "NUMNOTEQUAL",
+		"+": "ADD", "-": "SUB",
+	}
+	boolOps = map[string]string{"&&": "BOOLAND", "||": "BOOLOR"}
+)
+
+func (cc *clauseCompiler) binary(e *binaryExpr) (typ, error) {
+	lt, err := cc.expr(e.left)
+	if err != nil {
+		return "", err
+	}
+	rt, err := cc.expr(e.right)
+	if err != nil {
+		return "", err
+	}
+	bad := errorf(e.pos, "invalid operation %s %s %s", lt, e.op, rt)
+
+	switch e.op {
+	case "&&", "||":
+		if lt != boolType || rt != boolType {
+			return "", bad
+		}
+		cc.emit(boolOps[e.op], 2, 1)
+		return boolType, nil
+
+	case "==", "!=":
+		if !canCompare(lt, rt) {
+			return "", bad
+		}
+		if isNumeric(lt) {
+			cc.emit(numericOps[e.op], 2, 1)
+		} else if e.op == "==" {
+			cc.emit("EQUAL", 2, 1)
+		} else {
+			cc.emit("EQUAL", 2, 1)
+			cc.emit("NOT", 1, 1)
+		}
+		return boolType, nil
+
+	case "<", "<=", ">", ">=":
+		if _, ok := arith(lt, rt); !ok {
+			return "", bad
+		}
+		cc.emit(numericOps[e.op], 2, 1)
+		return boolType, nil
+	}
+
+	// + or -
+	t, ok := arith(lt, rt)
+	if !ok {
+		return "", bad
+	}
+	cc.emit(numericOps[e.op], 2, 1)
+	return t, nil
+}
+
+func (cc *clauseCompiler) call(e *callExpr) (typ, error) {
+	nargs := map[string]int{
+		"checkTxSig": 2, "checkTxMultiSig": 2, "checkPredicate": 2,
+		"sha3": 1, "sha256": 1, "size": 1, "abs": 1,
+		"min": 2, "max": 2, "before": 1, "after": 1,
+	}
+	n, ok := nargs[e.fn]
+	if !ok {
+		return "", errorf(e.pos, "undefined function %s", e.fn)
+	}
+	if len(e.args) != n {
+		return "", errorf(e.pos, "%s takes %d arguments, got %d", e.fn, n, len(e.args))
+	}
+
+	switch e.fn {
+	case "checkTxSig":
+		err := cc.typed(e.args[1], sigType)
+		if err != nil {
+			return "", err
+		}
+		cc.emit("TXSIGHASH", 0, 1)
+		err = cc.typed(e.args[0], pubkeyType)
+		if err != nil {
+			return "", err
+		}
+		cc.emit("CHECKSIG", 3, 1)
+		return boolType, nil
+
+	case "checkTxMultiSig":
+		keys, ok1 := e.args[0].(*listExpr)
+		sigs, ok2 := e.args[1].(*listExpr)
+		if !ok1 || !ok2 {
+			return "", errorf(e.pos, "checkTxMultiSig takes a list of keys and a list of signatures")
+		}
+		if len(sigs.elems) == 0 || len(sigs.elems) > len(keys.elems) {
+			return "", errorf(e.pos, "checkTxMultiSig needs between 1 and %d signatures", len(keys.elems))
+		}
+		for _, sig := range sigs.elems {
+			err := cc.typed(sig, sigType)
+			if err != nil {
+				return "", err
+			}
+		}
+		cc.emit("TXSIGHASH", 0, 1)
+		for _, key := range keys.elems {
+			err := cc.typed(key, pubkeyType)
+			if err != nil {
+				return "", err
+			}
+		}
+		cc.emit(strconv.Itoa(len(sigs.elems)), 0, 1)
+		cc.emit(strconv.Itoa(len(keys.elems)), 0, 1)
+		cc.emit("CHECKMULTISIG", len(sigs.elems)+len(keys.elems)+3, 1)
+		return boolType, nil
+
+	case "checkPredicate":
+		args, ok := e.args[1].(*listExpr)
+		if !ok {
+			return "", errorf(e.pos, "checkPredicate takes a program and a list of arguments")
+		}
+		for _, arg := range args.elems {
+			_, err := cc.expr(arg)
+			if err != nil {
+				return "", err
+			}
+		}
+		cc.emit(strconv.Itoa(len(args.elems)), 0, 1)
+		err := cc.typed(e.args[0], programType)
+		if err != nil {
+			return "", err
+		}
+		cc.emit("0", 0, 1) // no run limit beyond the caller's
+		cc.emit("CHECKPREDICATE", len(args.elems)+3, 1)
+		return boolType, nil
+
+	case "sha3", "sha256", "size":
+		t, err := cc.expr(e.args[0])
+		if err != nil {
+			return "", err
+		}
+		if !isBytes(t) {
+			return "", errorf(e.pos, "invalid argument type %s for %s", t, e.fn)
+		}
+		if e.fn == "size" {
+			cc.emit("SIZE", 0, 1)
+			cc.emit("NIP", 2, 1)
+			return intType, nil
+		}
+		cc.emit(strings.ToUpper(e.fn), 1, 1)
+		return hashType, nil
+
+	case "abs":
+		t, err := cc.expr(e.args[0])
+		if err != nil {
+			return "", err
+		}
+		if !isNumeric(t) {
+			return "", errorf(e.pos, "invalid argument type %s for abs", t)
+		}
+		cc.emit("ABS", 1, 1)
+		return t, nil
+
+	case "min", "max":
+		a, err := cc.expr(e.args[0])
+		if err != nil {
+			return "", err
+		}
+		b, err := cc.expr(e.args[1])
+		if err != nil {
+			return "", err
+		}
+		t, ok := arith(a, b)
+		if !ok {
+			return "", errorf(e.pos, "invalid argument types %s, %s for %s", a, b, e.fn)
+		}
+		cc.emit(strings.ToUpper(e.fn), 2, 1)
+		return t, nil
+	}
+
+	// before or after
+	err := cc.typed(e.args[0], timeType, intType)
+	if err != nil {
+		return "", err
+	}
+	if e.fn == "before" {
+		cc.emit("MAXTIME", 0, 1)
+		cc.emit("GREATERTHAN", 2, 1)
+	} else {
+		cc.emit("MINTIME", 0, 1)
+		cc.emit("LESSTHAN", 2, 1)
+	}
+	return boolType, nil
+}
@@ -0,0 +1,251 @@
+package compiler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"chain/crypto/ed25519"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/vm"
+)
+
+const tradeOffer = `
+	// TradeOffer offers a value in exchange for a payment.
+	contract TradeOffer(requestedAsset: Asset, requestedAmount: Amount,
+	                    sellerProgram: Program, sellerKey: PublicKey) locks offered {
+		clause trade() {
+			lock requestedAmount of requestedAsset with sellerProgram
+			unlock offered
+		}
+		clause cancel(sellerSig: Signature) {
+			verify checkTxSig(sellerKey, sellerSig)
+			lock offered with sellerProgram
+		}
+	}
+`
+
+const timeLock = `
+	contract TimeLock(deadline: Time, key: PublicKey) locks value {
+		clause spend(sig: Signature) {
+			verify after(deadline)
+			verify checkTxSig(key, sig)
+			unlock value
+		}
+	}
+`
+
+func TestCompile(t *testing.T) {
+	hash := hexArg(bytes.Repeat([]byte{0xaa}, 32))
+	cases := []struct {
+		src  string
+		args []ContractArg
+		want string
+	}{{
+		src: `contract HashLock(hash: Hash) locks value {
+			clause reveal(preimage: String) {
+				verify sha3(preimage) == hash && size(preimage) <= 32
+				unlock value
+			}
+		}`,
+		args: []ContractArg{hash},
+		want: "DUP SHA3 0x" + strings.Repeat("aa", 32) + " EQUAL OVER SIZE NIP 32 LESSTHANOREQUAL BOOLAND VERIFY TRUE",
+	}, {
+		src: `contract C(n: Integer, b: Boolean) locks v {
+			clause c(x: Integer, y: Integer) {
+				verify (x + n > y) == b
+				verify !(x != -1)
+				unlock v
+			}
+		}`,
+		args: []ContractArg{intArg(5), boolArg(true)},
+		want: "OVER 5 ADD OVER GREATERTHAN TRUE EQUAL VERIFY OVER -1 NUMNOTEQUAL NOT VERIFY TRUE",
+	}, {
+		src: `contract C(p: Program) locks v {
+			clause a(x: String) {
+				verify checkPredicate(p, [x, 2])
+				lock v with p
+			}
+			clause b() { unlock v }
+			clause c() { verify before(1000) unlock v }
+		}`,
+		args: []ContractArg{hexArg([]byte{0x51})},
+		want: "DUP 0 NUMEQUAL IF DROP OVER 2 2 0x51 0 CHECKPREDICATE VERIFY DUP 0 AMOUNT ASSET 1 0x51 CHECKOUTPUT VERIFY TRUE " +
+			"ELSE DUP 1 NUMEQUAL IF DROP TRUE " +
+			"ELSE 2 NUMEQUALVERIFY 1000 MAXTIME GREATERTHAN VERIFY TRUE ENDIF ENDIF",
+	}, {
+		src: `contract C(k1: PublicKey, k2: PublicKey) locks v {
+			clause c(s1: Signature, s2: Signature) {
+				verify checkTxMultiSig([k1, k2], [s1, s2])
+				unlock v
+			}
+		}`,
+		args: []ContractArg{hexArg(make([]byte, 32)), hexArg(make([]byte, 32))},
+		want: "OVER OVER TXSIGHASH 0x" + strings.Repeat("00", 32) + " 0x" + strings.Repeat("00", 32) + " 2 2 CHECKMULTISIG VERIFY TRUE",
+	}}
+	for _, c := range cases {
+		got, err := Compile(c.src, c.args)
+		if err != nil {
+			t.Errorf("Compile(%s) error: %s", c.src, err)
+			continue
+		}
+		if got.Opcodes != c.want {
+			t.Errorf("Compile(%s) opcodes:\ngot:  %s\nwant: %s", c.src, got.Opcodes, c.want)
+		}
+		prog, err := vm.Assemble(c.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Program, prog) {
+			t.Errorf("Compile(%s) program = %x want %x", c.src, got.Program, prog)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	key := hexArg(make([]byte, 32))
+	cases := []struct {
+		src     string
+		args    []ContractArg
+		wantErr error
+	}{
+		{`contract`, nil, ErrSyntax},
+		{`contract C() locks v { clause c() { unlock v }`, nil, ErrSyntax},
+		{`contract C(x: Nope) locks v { clause c() { unlock v } }`, nil, ErrSyntax},
+		{`contract C() locks v { clause c() { verify 1 < 2 < 3 unlock v } }`, nil, ErrSyntax},
+		{`contract C() locks v { clause c() { verify 'abc unlock v } }`, nil, ErrSyntax},
+		{`contract C() locks v { clause c() { verify 0xabc unlock v } }`, nil, ErrSyntax},
+		{`contract C() locks v { clause c() { unlock v } } extra`, nil, ErrSyntax},
+		{`contract C() locks v {}`, nil, ErrContract},
+		{`contract C() locks v { clause c() { verify true } }`, nil, ErrContract},
+		{`contract C() locks v { clause c() { unlock v unlock v } }`, nil, ErrContract},
+		{`contract C() locks v { clause c() { unlock w } }`, nil, ErrContract},
+		{`contract C() locks v { clause c() { verify 1 unlock v } }`, nil, ErrContract},
+		{`contract C() locks v { clause c() { verify x unlock v } }`, nil, ErrContract},
+		{`contract C() locks v { clause c() { verify v unlock v } }`, nil, ErrContract},
+		{`contract C() locks v { clause c() { verify f() unlock v } }`, nil, ErrContract},
+		{`contract C() locks v { clause c() { verify sha3(1) == 0x00 unlock v } }`, nil, ErrContract},
+		{`contract C() locks v { clause c(x: Integer) { unlock v } }`, nil, ErrContract},
+		{`contract C() locks v { clause c(v: Integer) { verify v == 1 unlock v } }`, nil, ErrContract},
+		{`contract C() locks v { clause c() { unlock v } clause c() { unlock v } }`, nil, ErrContract},
+		{`contract C(k: PublicKey) locks v { clause c(s: Signature) { verify s == k unlock v } }`, []ContractArg{key}, ErrContract},
+		{`contract C(k: PublicKey) locks v { clause c() { lock v with k } }`, []ContractArg{key}, ErrContract},
+		{`contract C(t: Time, a: Amount) locks v { clause c() { verify t + a > 0 unlock v } }`, []ContractArg{intArg(1), intArg(1)}, ErrContract},
+		{`contract C(k: PublicKey) locks v { clause c() { unlock v } }`, nil, ErrBadArgument},
+		{`contract C(k: PublicKey) locks v { clause c() { unlock v } }`, []ContractArg{hexArg([]byte{1})}, ErrBadArgument},
+		{`contract C(k: PublicKey) locks v { clause c() { unlock v } }`, []ContractArg{intArg(1)}, ErrBadArgument},
+		{`contract C(a: Amount) locks v { clause c() { unlock v } }`, []ContractArg{intArg(-1)}, ErrBadArgument},
+	}
+	for _, c := range cases {
+		_, err := Compile(c.src, c.args)
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("Compile(%s) err = %v want %v", c.src, err, c.wantErr)
+		}
+	}
+}
+
+func TestRunTradeOffer(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requested := bytes.Repeat([]byte{1}, 32)
+	offered := bytes.Repeat([]byte{2}, 32)
+	seller := []byte{byte(vm.OP_TRUE)}
+	contract, err := Compile(tradeOffer, []ContractArg{
+		hexArg(requested), intArg(100), hexArg(seller), hexArg(pub),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sighash := bytes.Repeat([]byte{3}, 32)
+	var paid [][]byte // assets paid to seller, by output index
+	context := func(args ...[]byte) *vm.Context {
+		var (
+			amount    uint64 = 5
+			minTimeMS uint64
+			maxTimeMS uint64
+		)
+		return &vm.Context{
+			VMVersion: 1,
+			Code:      contract.Program,
+			Arguments: args,
+			TxSigHash: &sighash,
+			AssetID:   &offered,
+			Amount:    &amount,
+			MinTimeMS: &minTimeMS,
+			MaxTimeMS: &maxTimeMS,
+			CheckOutput: func(index uint64, data []byte, amount uint64, assetID []byte, vmVersion uint64, code []byte) (bool, error) {
+				if index >= uint64(len(paid)) {
+					return false, vm.ErrBadValue
+				}
+				return bytes.Equal(paid[index], assetID) && bytes.Equal(code, seller), nil
+			},
+		}
+	}
+	sig := ed25519.Sign(priv, sighash)
+
+	paid = [][]byte{offered, requested}
+	cases := []struct {
+		args [][]byte
+		ok   bool
+	}{
+		{[][]byte{vm.Int64Bytes(1), vm.Int64Bytes(0)}, true},           // trade
+		{[][]byte{vm.Int64Bytes(0), vm.Int64Bytes(0)}, false},          // trade, wrong output
+		{[][]byte{sig, vm.Int64Bytes(0), vm.Int64Bytes(1)}, true},      // cancel
+		{[][]byte{sig, vm.Int64Bytes(1), vm.Int64Bytes(1)}, false},     // cancel, wrong output
+		{[][]byte{sighash, vm.Int64Bytes(0), vm.Int64Bytes(1)}, false}, // cancel, bad signature
+		{[][]byte{sig, vm.Int64Bytes(0), vm.Int64Bytes(2)}, false},     // no such clause
+	}
+	for i, c := range cases {
+		err := vm.Verify(context(c.args...))
+		if c.ok != (err == nil) {
+			t.Errorf("case %d: err = %v want ok = %v", i, err, c.ok)
+		}
+	}
+}
+
+func TestRunTimeLock(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract, err := Compile(timeLock, []ContractArg{intArg(1000), hexArg(pub)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sighash := bytes.Repeat([]byte{3}, 32)
+	sig := ed25519.Sign(priv, sighash)
+	for _, c := range []struct {
+		minTimeMS uint64
+		ok        bool
+	}{{999, false}, {1000, false}, {1001, true}} {
+		maxTimeMS := c.minTimeMS + 10
+		err := vm.Verify(&vm.Context{
+			VMVersion: 1,
+			Code:      contract.Program,
+			Arguments: [][]byte{sig},
+			TxSigHash: &sighash,
+			MinTimeMS: &c.minTimeMS,
+			MaxTimeMS: &maxTimeMS,
+		})
+		if c.ok != (err == nil) {
+			t.Errorf("mintime %d: err = %v want ok = %v", c.minTimeMS, err, c.ok)
+		}
+	}
+}
+
+func hexArg(b []byte) ContractArg {
+	h := chainjson.HexBytes(b)
+	return ContractArg{S: &h}
+}
+
+func intArg(n int64) ContractArg {
+	return ContractArg{I: &n}
+}
+
+func boolArg(b bool) ContractArg {
+	return ContractArg{B: &b}
+}
@@ -0,0 +1,71 @@
+/*
+Package compiler compiles Ivy, a small typed language for writing
+contracts, into control programs for the Chain VM.
+
+A contract has typed parameters, names the value it locks, and has
+one or more clauses. Each clause is a way of spending the contract's
+value; a spender chooses a clause and supplies its arguments.
+
+	contract TradeOffer(requestedAsset: Asset, requestedAmount: Amount,
+	                    sellerProgram: Program, sellerKey: PublicKey) locks offered {
+		clause trade() {
+			lock requestedAmount of requestedAsset with sellerProgram
+			unlock offered
+		}
+		clause cancel(sellerSig: Signature) {
+			verify checkTxSig(sellerKey, sellerSig)
+			lock offered with sellerProgram
+		}
+	}
+
+Types
+
+The types are Amount, Asset, Boolean, Hash, Integer, Program,
+PublicKey, Signature, String and Time. Amount, Integer and Time
+are numbers; a Time is in milliseconds since the Unix epoch.
+The others are byte strings. A String literal (hex, 0x01ab, or
+quoted, 'abc') may be compared with any byte string type.
+
+Statements
+
+	verify <expr>
+	lock <value> with <program>
+	unlock <value>
+
+Verify fails the clause unless the Boolean expression is true.
+
+Lock requires the transaction to have an output paying the given
+value to the given program. The value is either the contract's
+value or "<amount> of <asset>". The spender supplies the index of
+each such output as an extra argument to the clause.
+
+Unlock releases the contract's value to the spender's transaction.
+
+Each clause must dispose of the contract's value exactly once,
+with either lock or unlock.
+
+Expressions
+
+Expressions are built from literals, parameters, the operators
+||, &&, ==, !=, <, <=, >, >=, +, - and !, and these functions:
+
+	checkTxSig(key, sig)                Boolean
+	checkTxMultiSig([key...], [sig...]) Boolean
+	checkPredicate(program, [arg...])   Boolean
+	sha3(x), sha256(x)                  Hash
+	size(x)                             Integer
+	abs(n), min(a, b), max(a, b)        number
+	before(t), after(t)                 Boolean
+
+Before and after compare a Time to the transaction's time window.
+If value is the name of the contract's value, value.amount and
+value.asset are its Amount and Asset.
+
+Compiled programs
+
+Contract arguments are compiled into the program. A spender's
+witness arguments are the clause's arguments in order, then
+the output index for each lock statement in order, then, if the
+contract has more than one clause, the index of the clause.
+*/
+package compiler
@@ -0,0 +1,128 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"chain/errors"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokHex
+	tokString
+	tokPunct
+)
+
+type pos struct {
+	line, col int
+}
+
+func (p pos) String() string {
+	return fmt.Sprintf("%d:%d", p.line, p.col)
+}
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  pos
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// Two-character punctuation must come before
+// its one-character prefixes.
+var puncts = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"(", ")", "{", "}", "[", "]", ",", ":", ".", "<", ">", "+", "-", "!",
+}
+
+// scan splits src into tokens, ending with a tokEOF token.
+// Comments run from // to the end of the line.
+func scan(src string) ([]token, error) {
+	var (
+		toks []token
+		p    = pos{line: 1, col: 1}
+	)
+	advance := func(n int) {
+		for _, r := range src[:n] {
+			if r == '\n' {
+				p.line++
+				p.col = 1
+			} else {
+				p.col++
+			}
+		}
+		src = src[n:]
+	}
+	for {
+		trimmed := strings.TrimLeftFunc(src, unicode.IsSpace)
+		advance(len(src) - len(trimmed))
+		if strings.HasPrefix(src, "//") {
+			n := strings.IndexByte(src, '\n')
+			if n < 0 {
+				n = len(src)
+			}
+			advance(n)
+			continue
+		}
+		if src == "" {
+			return append(toks, token{kind: tokEOF, pos: p}), nil
+		}
+
+		tok := token{pos: p}
+		c := src[0]
+		switch {
+		case strings.HasPrefix(src, "0x"):
+			n := 2 + strings.IndexFunc(src[2:], func(r rune) bool { return !isIdentRune(r) })
+			if n < 2 {
+				n = len(src)
+			}
+			tok.kind, tok.text = tokHex, src[:n]
+		case c >= '0' && c <= '9':
+			n := strings.IndexFunc(src, func(r rune) bool { return !isIdentRune(r) })
+			if n < 0 {
+				n = len(src)
+			}
+			tok.kind, tok.text = tokInt, src[:n]
+		case c == '\'':
+			n := strings.IndexAny(src[1:], "'\n")
+			if n < 0 || src[1+n] != '\'' {
+				return nil, errors.WithDetailf(ErrSyntax, "%s: unterminated string", p)
+			}
+			tok.kind, tok.text = tokString, src[:n+2]
+		case isIdentRune(rune(c)):
+			n := strings.IndexFunc(src, func(r rune) bool { return !isIdentRune(r) })
+			if n < 0 {
+				n = len(src)
+			}
+			tok.kind, tok.text = tokIdent, src[:n]
+		default:
+			for _, punct := range puncts {
+				if strings.HasPrefix(src, punct) {
+					tok.kind, tok.text = tokPunct, punct
+					break
+				}
+			}
+			if tok.kind != tokPunct {
+				return nil, errors.WithDetailf(ErrSyntax, "%s: unexpected character %q", p, c)
+			}
+		}
+		toks = append(toks, tok)
+		advance(len(tok.text))
+	}
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
@@ -0,0 +1,481 @@
+package compiler
+
+import (
+	"encoding/hex"
+	"strconv"
+
+	"chain/errors"
+)
+
+type contract struct {
+	pos     pos
+	name    string
+	params  []*param
+	value   string
+	clauses []*clause
+}
+
+type param struct {
+	pos  pos
+	name string
+	typ  typ
+}
+
+type clause struct {
+	pos    pos
+	name   string
+	params []*param
+	stmts  []statement
+}
+
+type statement interface {
+	position() pos
+}
+
+type verifyStmt struct {
+	pos  pos
+	expr expression
+}
+
+// lockStmt locks either the contract's value, named by value,
+// or amount of asset.
+type lockStmt struct {
+	pos     pos
+	value   string
+	amount  expression
+	asset   expression
+	program expression
+}
+
+type unlockStmt struct {
+	pos   pos
+	value string
+}
+
+func (s *verifyStmt) position() pos { return s.pos }
+func (s *lockStmt) position() pos   { return s.pos }
+func (s *unlockStmt) position() pos { return s.pos }
+
+type expression interface {
+	position() pos
+}
+
+type binaryExpr struct {
+	pos         pos
+	op          string
+	left, right expression
+}
+
+type unaryExpr struct {
+	pos  pos
+	op   string
+	expr expression
+}
+
+type callExpr struct {
+	pos  pos
+	fn   string
+	args []expression
+}
+
+type listExpr struct {
+	pos   pos
+	elems []expression
+}
+
+type varRef struct {
+	pos  pos
+	name string
+}
+
+// propRef is value.amount or value.asset.
+type propRef struct {
+	pos        pos
+	name, prop string
+}
+
+type intLiteral struct {
+	pos pos
+	n   int64
+}
+
+type bytesLiteral struct {
+	pos pos
+	b   []byte
+}
+
+type boolLiteral struct {
+	pos pos
+	b   bool
+}
+
+func (e *binaryExpr) position() pos   { return e.pos }
+func (e *unaryExpr) position() pos    { return e.pos }
+func (e *callExpr) position() pos     { return e.pos }
+func (e *listExpr) position() pos     { return e.pos }
+func (e *varRef) position() pos       { return e.pos }
+func (e *propRef) position() pos      { return e.pos }
+func (e *intLiteral) position() pos   { return e.pos }
+func (e *bytesLiteral) position() pos { return e.pos }
+func (e *boolLiteral) position() pos  { return e.pos }
+
+// Binary operators, from lowest to highest precedence.
+var binaryOps = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func parse(src string) (*contract, error) {
+	toks, err := scan(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	c, err := p.contract()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %s after contract", tok)
+	}
+	return c, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	tok := p.toks[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is
+// punctuation or a keyword with the given text.
+func (p *parser) accept(text string) bool {
+	tok := p.peek()
+	if (tok.kind == tokPunct || tok.kind == tokIdent) && tok.text == text {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		tok := p.peek()
+		return p.errorf(tok, "expected %q, got %s", text, tok)
+	}
+	return nil
+}
+
+func (p *parser) ident() (token, error) {
+	tok := p.next()
+	if tok.kind != tokIdent || keywords[tok.text] {
+		return tok, p.errorf(tok, "expected name, got %s", tok)
+	}
+	return tok, nil
+}
+
+func (p *parser) errorf(tok token, format string, args ...interface{}) error {
+	return errors.WithDetailf(ErrSyntax, tok.pos.String()+": "+format, args...)
+}
+
+var keywords = map[string]bool{
+	"contract": true, "clause": true, "locks": true,
+	"verify": true, "lock": true, "unlock": true,
+	"with": true, "of": true, "true": true, "false": true,
+}
+
+func (p *parser) contract() (*contract, error) {
+	c := &contract{pos: p.peek().pos}
+	err := p.expect("contract")
+	if err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	c.name = name.text
+	c.params, err = p.params()
+	if err != nil {
+		return nil, err
+	}
+	err = p.expect("locks")
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	c.value = value.text
+	err = p.expect("{")
+	if err != nil {
+		return nil, err
+	}
+	for !p.accept("}") {
+		cl, err := p.clause()
+		if err != nil {
+			return nil, err
+		}
+		c.clauses = append(c.clauses, cl)
+	}
+	return c, nil
+}
+
+func (p *parser) params() ([]*param, error) {
+	err := p.expect("(")
+	if err != nil {
+		return nil, err
+	}
+	var params []*param
+	for !p.accept(")") {
+		if len(params) > 0 {
+			err = p.expect(",")
+			if err != nil {
+				return nil, err
+			}
+		}
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect(":")
+		if err != nil {
+			return nil, err
+		}
+		t := p.next()
+		if t.kind != tokIdent || !types[typ(t.text)] {
+			return nil, p.errorf(t, "expected type, got %s", t)
+		}
+		params = append(params, &param{pos: name.pos, name: name.text, typ: typ(t.text)})
+	}
+	return params, nil
+}
+
+func (p *parser) clause() (*clause, error) {
+	cl := &clause{pos: p.peek().pos}
+	err := p.expect("clause")
+	if err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	cl.name = name.text
+	cl.params, err = p.params()
+	if err != nil {
+		return nil, err
+	}
+	err = p.expect("{")
+	if err != nil {
+		return nil, err
+	}
+	for !p.accept("}") {
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		cl.stmts = append(cl.stmts, s)
+	}
+	return cl, nil
+}
+
+func (p *parser) statement() (statement, error) {
+	tok := p.next()
+	switch tok.text {
+	case "verify":
+		expr, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		return &verifyStmt{pos: tok.pos, expr: expr}, nil
+
+	case "lock":
+		s := &lockStmt{pos: tok.pos}
+		amount, err := p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.accept("of") {
+			s.amount = amount
+			s.asset, err = p.expr(0)
+			if err != nil {
+				return nil, err
+			}
+		} else if v, ok := amount.(*varRef); ok {
+			s.value = v.name
+		} else {
+			return nil, p.errorf(tok, "lock needs a value or an amount of an asset")
+		}
+		err = p.expect("with")
+		if err != nil {
+			return nil, err
+		}
+		s.program, err = p.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+
+	case "unlock":
+		value, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		return &unlockStmt{pos: tok.pos, value: value.text}, nil
+	}
+	return nil, p.errorf(tok, "expected statement, got %s", tok)
+}
+
+// expr parses an expression whose binary operators
+// have at least the given precedence.
+func (p *parser) expr(prec int) (expression, error) {
+	if prec == len(binaryOps) {
+		return p.unary()
+	}
+	left, err := p.expr(prec + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.kind != tokPunct || !contains(binaryOps[prec], tok.text) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.expr(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{pos: tok.pos, op: tok.text, left: left, right: right}
+		if prec == 2 {
+			// Comparisons don't associate.
+			if next := p.peek(); next.kind == tokPunct && contains(binaryOps[prec], next.text) {
+				return nil, p.errorf(next, "comparisons cannot be chained")
+			}
+			return left, nil
+		}
+	}
+}
+
+func (p *parser) unary() (expression, error) {
+	tok := p.peek()
+	if tok.kind == tokPunct && (tok.text == "!" || tok.text == "-") {
+		p.next()
+		expr, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := expr.(*intLiteral); ok && tok.text == "-" {
+			return &intLiteral{pos: tok.pos, n: -n.n}, nil
+		}
+		return &unaryExpr{pos: tok.pos, op: tok.text, expr: expr}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (expression, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokInt:
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, p.errorf(tok, "bad integer %s", tok)
+		}
+		return &intLiteral{pos: tok.pos, n: n}, nil
+
+	case tokHex:
+		b, err := hex.DecodeString(tok.text[2:])
+		if err != nil {
+			return nil, p.errorf(tok, "bad hex string %s", tok)
+		}
+		return &bytesLiteral{pos: tok.pos, b: b}, nil
+
+	case tokString:
+		return &bytesLiteral{pos: tok.pos, b: []byte(tok.text[1 : len(tok.text)-1])}, nil
+
+	case tokPunct:
+		switch tok.text {
+		case "(":
+			expr, err := p.expr(0)
+			if err != nil {
+				return nil, err
+			}
+			return expr, p.expect(")")
+		case "[":
+			list := &listExpr{pos: tok.pos}
+			for !p.accept("]") {
+				if len(list.elems) > 0 {
+					err := p.expect(",")
+					if err != nil {
+						return nil, err
+					}
+				}
+				elem, err := p.expr(0)
+				if err != nil {
+					return nil, err
+				}
+				list.elems = append(list.elems, elem)
+			}
+			return list, nil
+		}
+
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return &boolLiteral{pos: tok.pos, b: tok.text == "true"}, nil
+		}
+		if keywords[tok.text] {
+			break
+		}
+		if p.accept("(") {
+			call := &callExpr{pos: tok.pos, fn: tok.text}
+			for !p.accept(")") {
+				if len(call.args) > 0 {
+					err := p.expect(",")
+					if err != nil {
+						return nil, err
+					}
+				}
+				arg, err := p.expr(0)
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+			}
+			return call, nil
+		}
+		if p.accept(".") {
+			prop, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			return &propRef{pos: tok.pos, name: tok.text, prop: prop.text}, nil
+		}
+		return &varRef{pos: tok.pos, name: tok.text}, nil
+	}
+	return nil, p.errorf(tok, "expected expression, got %s", tok)
+}
+
+func contains(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package compiler
+
+type typ string
+
+const (
+	amountType  typ = "Amount"
+	assetType   typ = "Asset"
+	boolType    typ = "Boolean"
+	hashType    typ = "Hash"
+	intType     typ = "Integer"
+	programType typ = "Program"
+	pubkeyType  typ = "PublicKey"
+	sigType     typ = "Signature"
+	stringType  typ = "String"
+	timeType    typ = "Time"
+	listType    typ = "list"
+	valueType   typ = "Value"
+)
+
+// types holds the types a parameter may have.
+var types = map[typ]bool{
+	amountType:  true,
+	assetType:   true,
+	boolType:    true,
+	hashType:    true,
+	intType:     true,
+	programType: true,
+	pubkeyType:  true,
+	sigType:     true,
+	stringType:  true,
+	timeType:    true,
+}
+
+func isNumeric(t typ) bool {
+	return t == amountType || t == intType || t == timeType
+}
+
+func isBytes(t typ) bool {
+	switch t {
+	case assetType, hashType, programType, pubkeyType, sigType, stringType:
+		return true
+	}
+	return false
+}
+
+// canCompare reports whether values of types a and b
+// may be compared with == and !=.
+func canCompare(a, b typ) bool {
+	switch {
+	case a == b:
+		return a != listType && a != valueType
+	case isNumeric(a) && isNumeric(b):
+		return a == intType || b == intType
+	case isBytes(a) && isBytes(b):
+		return a == stringType || b == stringType
+	}
+	return false
+}
+
+// arith returns the type of a+b or a-b, and
+// false if the operation isn't allowed.
+// An Integer may be added to or subtracted from
+// any number; other numbers only combine with
+// their own type.
+func arith(a, b typ) (typ, bool) {
+	switch {
+	case !isNumeric(a) || !isNumeric(b):
+		return "", false
+	case a == b, b == intType:
+		return a, true
+	case a == intType:
+		return b, true
+	}
+	return "", false
+}
@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"time"
@@ -42,9 +43,26 @@ func (c *Chain) GetBlock(ctx context.Context, height uint64) (*bc.Block, error)
 // After generating the block, the pending transaction pool will be
 // empty.
 func (c *Chain) GenerateBlock(ctx context.Context, prev *bc.Block, snapshot *state.Snapshot, now time.Time, txs []*bc.Tx) (b *bc.Block, result *state.Snapshot, err error) {
+	b, result, _, err = c.GenerateBlockWithRejections(ctx, prev, snapshot, now, txs)
+	return b, result, err
+}
+
+// TxRejection describes a transaction that was left out
+// of a generated block because it failed validation.
+type TxRejection struct {
+	Tx  *bc.Tx
+	Err error
+}
+
+// GenerateBlockWithRejections is like GenerateBlock, but it also
+// returns the transactions that were left out of the block because
+// they failed validation, along with the validation error for each.
+// Transactions left out only because the block is full are not
+// rejected.
+func (c *Chain) GenerateBlockWithRejections(ctx context.Context, prev *bc.Block, snapshot *state.Snapshot, now time.Time, txs []*bc.Tx) (b *bc.Block, result *state.Snapshot, rejected []TxRejection, err error) {
 	timestampMS := bc.Millis(now)
 	if timestampMS < prev.TimestampMS {
-		return nil, nil, fmt.Errorf("timestamp %d is earlier than prevblock timestamp %d", timestampMS, prev.TimestampMS)
+		return nil, nil, nil, fmt.Errorf("timestamp %d is earlier than prevblock timestamp %d", timestampMS, prev.TimestampMS)
 	}
 
 	// Make a copy of the state that we can apply our changes to.
@@ -71,23 +89,27 @@ func (c *Chain) GenerateBlock(ctx context.Context, prev *bc.Block, snapshot *sta
 		// TODO(jackson): Should this go in ConfirmTx too?
 		err = c.checkIssuanceWindow(tx)
 		if err != nil {
+			rejected = append(rejected, TxRejection{Tx: tx, Err: err})
 			continue
 		}
 
-		if validation.ConfirmTx(result, c.InitialBlockHash, bc.NewBlockVersion, timestampMS, tx) == nil {
-			err = validation.ApplyTx(result, tx)
-			if err != nil {
-				return nil, nil, err
-			}
-			b.Transactions = append(b.Transactions, tx)
+		err = validation.ConfirmTx(result, c.InitialBlockHash, bc.NewBlockVersion, timestampMS, tx)
+		if err != nil {
+			rejected = append(rejected, TxRejection{Tx: tx, Err: err})
+			continue
+		}
+		err = validation.ApplyTx(result, tx)
+		if err != nil {
+			return nil, nil, nil, err
 		}
+		b.Transactions = append(b.Transactions, tx)
 	}
 	b.TransactionsMerkleRoot, err = bc.MerkleRoot(b.Transactions)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "calculating tx merkle root")
+		return nil, nil, nil, errors.Wrap(err, "calculating tx merkle root")
 	}
 	b.AssetsMerkleRoot = result.Tree.RootHash()
-	return b, result, nil
+	return b, result, rejected, nil
 }
 
 // ValidateBlock performs validation on an incoming block, in advance
@@ -177,7 +199,8 @@ func (c *Chain) setHeight(h uint64) {
 
 // ValidateBlockForSig performs validation on an incoming _unsigned_
 // block in preparation for signing it. By definition it does not
-// execute the sigscript.
+// execute the sigscript. If the block changes the consensus
+// program, the new one must pass validation.CheckConsensusProgram.
 func (c *Chain) ValidateBlockForSig(ctx context.Context, block *bc.Block) error {
 	var (
 		prev     *bc.Block
@@ -201,6 +224,9 @@ func (c *Chain) ValidateBlockForSig(ctx context.Context, block *bc.Block) error
 	// we can skip re-applying it later
 	snapshot = state.Copy(snapshot)
 	err := validation.ValidateBlock(ctx, snapshot, c.InitialBlockHash, prev, block, validation.CheckTxWellFormed)
+	if err == nil && prev != nil && !bytes.Equal(block.ConsensusProgram, prev.ConsensusProgram) {
+		err = validation.CheckConsensusProgram(block.ConsensusProgram)
+	}
 	return errors.Wrap(err, "validation")
 }
 
@@ -6,9 +6,11 @@ import (
 	"testing"
 	"time"
 
+	"chain/errors"
 	"chain/protocol/bc"
 	"chain/protocol/prottest/memstore"
 	"chain/protocol/state"
+	"chain/protocol/validation"
 	"chain/testutil"
 )
 
@@ -193,6 +195,34 @@ func TestGenerateBlock(t *testing.T) {
 	}
 }
 
+func TestGenerateBlockRejections(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(233400000, 0)
+	c, b1 := newTestChain(t, now)
+
+	expired := bc.NewTx(bc.TxData{Version: 1, MaxTime: 233399999999})
+	badVersion := bc.NewTx(bc.TxData{Version: 2})
+
+	got, _, rejected, err := c.GenerateBlockWithRejections(ctx, b1, state.Empty(), now, []*bc.Tx{expired, badVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Transactions) != 0 {
+		t.Errorf("got %d transactions in block, want 0", len(got.Transactions))
+	}
+	if len(rejected) != 2 {
+		t.Fatalf("got %d rejections, want 2", len(rejected))
+	}
+	for i, tx := range []*bc.Tx{expired, badVersion} {
+		if rejected[i].Tx != tx {
+			t.Errorf("rejection %d is for tx %x, want %x", i, rejected[i].Tx.ID, tx.ID)
+		}
+		if errors.Root(rejected[i].Err) != validation.ErrBadTx {
+			t.Errorf("rejection %d error = %v, want %v", i, rejected[i].Err, validation.ErrBadTx)
+		}
+	}
+}
+
 func TestValidateBlockForSig(t *testing.T) {
 	initialBlock, err := NewInitialBlock(testutil.TestPubs, 1, time.Now())
 	if err != nil {
@@ -25,8 +25,36 @@ var (
 	ErrBadSig       = errors.New("invalid signature script")
 	ErrBadTxRoot    = errors.New("invalid transaction merkle root")
 	ErrBadStateRoot = errors.New("invalid state merkle root")
+
+	ErrBadConsensusProgram = errors.New("invalid consensus program")
 )
 
+// CheckConsensusProgram checks that prog is suitable as a new
+// consensus program for a federation of block signers: it must
+// be exactly the program vmutil.BlockMultiSigProgram makes for
+// some set of keys and a quorum of at least one of them.
+//
+// It is not part of block validation; the protocol allows any
+// consensus program. Signers use it to refuse to sign blocks
+// that would hand the blockchain to a program they can't sign.
+func CheckConsensusProgram(prog []byte) error {
+	pubkeys, quorum, err := vmutil.ParseBlockMultiSigProgram(prog)
+	if err != nil {
+		return errors.Sub(ErrBadConsensusProgram, err)
+	}
+	if quorum < 1 {
+		return errors.WithDetail(ErrBadConsensusProgram, "quorum must be at least 1")
+	}
+	want, err := vmutil.BlockMultiSigProgram(pubkeys, quorum)
+	if err != nil {
+		return errors.Sub(ErrBadConsensusProgram, err)
+	}
+	if !bytes.Equal(prog, want) {
+		return errors.WithDetail(ErrBadConsensusProgram, "not a block multisig program")
+	}
+	return nil
+}
+
 // ValidateBlockForAccept performs steps 1 and 2
 // of the "accept block" procedure from the spec.
 // See $CHAIN/protocol/doc/spec/validation.md#accept-block.
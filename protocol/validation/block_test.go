@@ -4,10 +4,12 @@ import (
 	"context"
 	"testing"
 
+	"chain/crypto/ed25519"
 	"chain/errors"
 	"chain/protocol/bc"
 	"chain/protocol/state"
 	"chain/protocol/vm"
+	"chain/protocol/vmutil"
 )
 
 // emptyMerkleRoot is the SHA3-256 of "".
@@ -146,3 +148,31 @@ func mustParseHash(s string) bc.Hash {
 	}
 	return h
 }
+
+func TestCheckConsensusProgram(t *testing.T) {
+	pub1, _, _ := ed25519.GenerateKey(nil)
+	pub2, _, _ := ed25519.GenerateKey(nil)
+	good, err := vmutil.BlockMultiSigProgram([]ed25519.PublicKey{pub1, pub2}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := vmutil.BlockMultiSigProgram(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		prog []byte
+		want error
+	}{
+		{good, nil},
+		{empty, ErrBadConsensusProgram},
+		{[]byte{byte(vm.OP_TRUE)}, ErrBadConsensusProgram},
+		{append([]byte{byte(vm.OP_DROP)}, good...), ErrBadConsensusProgram},
+	}
+	for i, c := range cases {
+		got := CheckConsensusProgram(c.prog)
+		if errors.Root(got) != c.want {
+			t.Errorf("case %d: got error %v, want %v", i, got, c.want)
+		}
+	}
+}
@@ -125,6 +125,37 @@ func ConfirmTx(snapshot *state.Snapshot, initialBlockHash bc.Hash, blockVersion,
 // Result is nil for well-formed transactions, ErrBadTx with
 // supporting detail otherwise.
 func CheckTxWellFormed(tx *bc.Tx) error {
+	return CheckTxWellFormedTrace(tx, nil)
+}
+
+// CheckTxWellFormedTrace is like CheckTxWellFormed, but reports
+// the execution of each input's program to the tracer that trace
+// returns for the input's index. Trace may be nil, or may return
+// nil for inputs that shouldn't be traced.
+func CheckTxWellFormedTrace(tx *bc.Tx, trace func(input int) vm.Tracer) error {
+	err := CheckTxWellFormedUnsigned(tx)
+	if err != nil {
+		return err
+	}
+
+	for i := range tx.Inputs {
+		context := InputVMContext(tx, i)
+		if trace != nil {
+			context.Tracer = trace(i)
+		}
+		err := vm.Verify(context)
+		if err != nil {
+			return badTxErrf(err, "validation failed in script execution, input %d", i)
+		}
+	}
+
+	return nil
+}
+
+// CheckTxWellFormedUnsigned is like CheckTxWellFormed, but
+// doesn't run the input programs, so it can check a transaction
+// before it's signed.
+func CheckTxWellFormedUnsigned(tx *bc.Tx) error {
 	if len(tx.Inputs) == 0 {
 		return badTxErr(errNoInputs)
 	}
@@ -249,28 +280,27 @@ func CheckTxWellFormed(tx *bc.Tx) error {
 		}
 	}
 
-	for i, inp := range tx.Inputs {
-		var (
-			prog bc.Program
-			args [][]byte
-		)
-		switch inp := inp.TypedInput.(type) {
-		case *bc.IssuanceInput:
-			prog = bc.Program{VMVersion: inp.VMVersion, Code: inp.IssuanceProgram}
-			args = inp.Arguments
-		case *bc.SpendInput:
-			prog = bc.Program{VMVersion: inp.VMVersion, Code: inp.ControlProgram}
-			args = inp.Arguments
-		}
-		err := vm.Verify(bc.NewTxVMContext(tx, uint32(i), prog, args))
-		if err != nil {
-			return badTxErrf(err, "validation failed in script execution, input %d", i)
-		}
-	}
-
 	return nil
 }
 
+// InputVMContext returns the VM context in which the program
+// of input i of tx runs during validation.
+func InputVMContext(tx *bc.Tx, i int) *vm.Context {
+	var (
+		prog bc.Program
+		args [][]byte
+	)
+	switch inp := tx.Inputs[i].TypedInput.(type) {
+	case *bc.IssuanceInput:
+		prog = bc.Program{VMVersion: inp.VMVersion, Code: inp.IssuanceProgram}
+		args = inp.Arguments
+	case *bc.SpendInput:
+		prog = bc.Program{VMVersion: inp.VMVersion, Code: inp.ControlProgram}
+		args = inp.Arguments
+	}
+	return bc.NewTxVMContext(tx, uint32(i), prog, args)
+}
+
 // ApplyTx updates the state tree with all the changes to the ledger.
 func ApplyTx(snapshot *state.Snapshot, tx *bc.Tx) error {
 	for i, in := range tx.Inputs {
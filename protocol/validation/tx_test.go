@@ -1100,3 +1100,81 @@ func TestConfirmTx(t *testing.T) {
 		}
 	}
 }
+
+type stepCounter struct {
+	steps    int
+	finished bool
+}
+
+func (c *stepCounter) Step(*vm.TraceStep) { c.steps++ }
+
+func (c *stepCounter) Finish(depth int, err error) { c.finished = depth == 0 && err == nil }
+
+func TestCheckTxWellFormedTrace(t *testing.T) {
+	var initialBlockHash bc.Hash
+	now := time.Now()
+	progs := [][]byte{
+		{byte(vm.OP_TRUE)},
+		{byte(vm.OP_TRUE), byte(vm.OP_TRUE)},
+	}
+	var (
+		inputs  []*bc.TxInput
+		outputs []*bc.TxOutput
+	)
+	for i, prog := range progs {
+		assetID := bc.ComputeAssetID(prog, initialBlockHash, 1, bc.EmptyStringHash)
+		inputs = append(inputs, bc.NewIssuanceInput([]byte{byte(i)}, 1, nil, initialBlockHash, prog, nil, nil))
+		outputs = append(outputs, bc.NewTxOutput(assetID, 1, prog, nil))
+	}
+	tx := bc.NewTx(bc.TxData{
+		Version: 1,
+		Inputs:  inputs,
+		Outputs: outputs,
+		MinTime: bc.Millis(now),
+		MaxTime: bc.Millis(now.Add(time.Hour)),
+	})
+
+	counters := make([]*stepCounter, len(inputs))
+	err := CheckTxWellFormedTrace(tx, func(input int) vm.Tracer {
+		counters[input] = new(stepCounter)
+		return counters[input]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range counters {
+		if c == nil || c.steps != len(progs[i]) || !c.finished {
+			t.Errorf("input %d: trace = %+v, want %d steps and a successful finish", i, c, len(progs[i]))
+		}
+	}
+}
+
+func TestCheckTxWellFormedUnsigned(t *testing.T) {
+	var initialBlockHash bc.Hash
+	now := time.Now()
+	prog := []byte{byte(vm.OP_FALSE)}
+	assetID := bc.ComputeAssetID(prog, initialBlockHash, 1, bc.EmptyStringHash)
+	tx := bc.NewTx(bc.TxData{
+		Version: 1,
+		Inputs:  []*bc.TxInput{bc.NewIssuanceInput([]byte{1}, 1, nil, initialBlockHash, prog, nil, nil)},
+		Outputs: []*bc.TxOutput{bc.NewTxOutput(assetID, 1, prog, nil)},
+		MinTime: bc.Millis(now),
+		MaxTime: bc.Millis(now.Add(time.Hour)),
+	})
+
+	err := CheckTxWellFormedUnsigned(tx)
+	if err != nil {
+		t.Errorf("CheckTxWellFormedUnsigned(tx) = %v want nil", err)
+	}
+	err = CheckTxWellFormed(tx)
+	if errors.Root(err) != ErrBadTx {
+		t.Errorf("CheckTxWellFormed(tx) = %v want %v", err, ErrBadTx)
+	}
+
+	tx.Outputs[0].Amount = 2
+	tx = bc.NewTx(tx.TxData)
+	err = CheckTxWellFormedUnsigned(tx)
+	if errors.Root(err) != ErrBadTx {
+		t.Errorf("CheckTxWellFormedUnsigned(unbalanced tx) = %v want %v", err, ErrBadTx)
+	}
+}
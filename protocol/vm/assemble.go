@@ -18,105 +18,371 @@ import (
 // be inferred.
 // Input may include jump-target labels of the form $foo, which can
 // then be used as JUMP:$foo or JUMPIF:$foo.
+//
+// Input may also use structured control flow, which Assemble
+// translates into jumps:
+//
+//	cond IF ... ENDIF
+//	cond IF ... ELSE ... ENDIF
+//	BEGIN ... cond WHILE ... REPEAT
+//
+// IF and WHILE pop the condition from the stack. A loop runs until
+// the condition at its WHILE is false. Structures may be nested.
+//
+// Finally, input may define named constants and macros:
+//
+//	CONST name value
+//	MACRO name ... ENDMACRO
+//
+// where value is a single number, hex or string literal. Each later
+// use of the name stands for the value or for the macro's body.
 func Assemble(s string) (res []byte, err error) {
+	var tokens []string
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	scanner.Split(split)
+	for scanner.Scan() {
+		tokens = append(tokens, scanner.Text())
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	a := &assembler{
+		locations:  make(map[string]uint32),
+		unresolved: make(map[string][]int),
+		consts:     make(map[string]string),
+		macros:     make(map[string][]string),
+		expanding:  make(map[string]bool),
+	}
+	err = a.assemble(tokens, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.blocks) > 0 {
+		return nil, errors.Wrap(ErrToken, a.blocks[len(a.blocks)-1].kind+" without end")
+	}
+
+	for label, uses := range a.unresolved {
+		location, ok := a.locations[label]
+		if !ok {
+			return nil, fmt.Errorf("undefined label %s", label)
+		}
+		for _, use := range uses {
+			binary.LittleEndian.PutUint32(a.res[use:], location)
+		}
+	}
+
+	return a.res, nil
+}
+
+type assembler struct {
+	res []byte
+
 	// maps labels to the location each refers to
-	locations := make(map[string]uint32)
+	locations map[string]uint32
 
 	// maps unresolved uses of labels to the locations that need to be filled in
-	unresolved := make(map[string][]int)
+	unresolved map[string][]int
 
-	handleJump := func(addrStr string, opcode Op) error {
-		res = append(res, byte(opcode))
-		l := len(res)
+	consts    map[string]string   // constant names to their values
+	macros    map[string][]string // macro names to their bodies
+	expanding map[string]bool     // macros being expanded
 
-		var fourBytes [4]byte
-		res = append(res, fourBytes[:]...)
+	blocks    []*block // open control structures, innermost last
+	numLabels int
+}
 
-		if strings.HasPrefix(addrStr, "$") {
-			unresolved[addrStr] = append(unresolved[addrStr], l)
-			return nil
-		}
+// block is an open IF or BEGIN structure.
+type block struct {
+	kind string // "IF", "ELSE", or "WHILE", after the last keyword seen
 
-		address, err := strconv.ParseUint(addrStr, 10, 32)
-		if err != nil {
-			return err
-		}
-		binary.LittleEndian.PutUint32(res[l:], uint32(address))
-		return nil
-	}
+	// labels of the structure's jump targets
+	start, body, next, end string
+}
 
-	scanner := bufio.NewScanner(strings.NewReader(s))
-	scanner.Split(split)
-	for scanner.Scan() {
-		token := scanner.Text()
-		if info, ok := opsByName[token]; ok {
-			if strings.HasPrefix(token, "PUSHDATA") || strings.HasPrefix(token, "JUMP") {
-				return nil, errors.Wrap(ErrToken, token)
-			}
-			res = append(res, byte(info.op))
-		} else if strings.HasPrefix(token, "JUMP:") {
-			// TODO (Dan): add IF/ELSE/ENDIF and BEGIN/WHILE/REPEAT
-			err = handleJump(strings.TrimPrefix(token, "JUMP:"), OP_JUMP)
+// assemble appends the code for tokens to the program.
+// Definitions of constants and macros are allowed
+// only at the top level.
+func (a *assembler) assemble(tokens []string, topLevel bool) error {
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch token {
+		case "CONST":
+			if !topLevel {
+				return errors.Wrap(ErrToken, "CONST inside MACRO")
+			}
+			if i+2 >= len(tokens) {
+				return errors.Wrap(ErrToken, "CONST needs a name and a value")
+			}
+			name, value := tokens[i+1], tokens[i+2]
+			err := a.checkName(name)
 			if err != nil {
-				return nil, err
+				return err
+			}
+			if !isLiteral(value) {
+				return errors.Wrap(ErrToken, "CONST value "+value)
+			}
+			a.consts[name] = value
+			i += 2
+			continue
+
+		case "MACRO":
+			if !topLevel {
+				return errors.Wrap(ErrToken, "MACRO inside MACRO")
 			}
-		} else if strings.HasPrefix(token, "JUMPIF:") {
-			err = handleJump(strings.TrimPrefix(token, "JUMPIF:"), OP_JUMPIF)
+			if i+1 >= len(tokens) {
+				return errors.Wrap(ErrToken, "MACRO needs a name")
+			}
+			name := tokens[i+1]
+			err := a.checkName(name)
 			if err != nil {
-				return nil, err
+				return err
+			}
+			j := i + 2
+			for ; j < len(tokens) && tokens[j] != "ENDMACRO"; j++ {
 			}
-		} else if strings.HasPrefix(token, "$") {
-			if _, seen := locations[token]; seen {
-				return nil, fmt.Errorf("label %s redefined", token)
+			if j == len(tokens) {
+				return errors.Wrap(ErrToken, "MACRO "+name+" without ENDMACRO")
 			}
-			if len(res) > math.MaxInt32 {
-				return nil, fmt.Errorf("program too long")
+			a.macros[name] = tokens[i+2 : j]
+			i = j
+			continue
+
+		case "ENDMACRO":
+			return errors.Wrap(ErrToken, "ENDMACRO without MACRO")
+		}
+
+		if value, ok := a.consts[token]; ok {
+			token = value
+		} else if body, ok := a.macros[token]; ok {
+			if a.expanding[token] {
+				return errors.Wrap(ErrToken, "recursive MACRO "+token)
 			}
-			locations[token] = uint32(len(res))
-		} else if strings.HasPrefix(token, "0x") {
-			bytes, err := hex.DecodeString(strings.TrimPrefix(token, "0x"))
+			a.expanding[token] = true
+			err := a.assemble(body, false)
+			delete(a.expanding, token)
 			if err != nil {
-				return nil, err
-			}
-			res = append(res, PushdataBytes(bytes)...)
-		} else if len(token) >= 2 && token[0] == '\'' && token[len(token)-1] == '\'' {
-			bytes := make([]byte, 0, len(token)-2)
-			var b int
-			for i := 1; i < len(token)-1; i++ {
-				if token[i] == '\\' {
-					i++
-				}
-				bytes = append(bytes, token[i])
-				b++
+				return errors.Wrapf(err, "in MACRO %s", token)
 			}
-			res = append(res, PushdataBytes(bytes)...)
-		} else if num, err := strconv.ParseInt(token, 10, 64); err == nil {
-			res = append(res, PushdataInt64(num)...)
-		} else {
-			return nil, errors.Wrap(ErrToken, token)
+			continue
+		}
+
+		err := a.assembleToken(token)
+		if err != nil {
+			return err
 		}
 	}
-	err = scanner.Err()
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+func (a *assembler) assembleToken(token string) error {
+	if info, ok := opsByName[token]; ok {
+		if strings.HasPrefix(token, "PUSHDATA") || strings.HasPrefix(token, "JUMP") {
+			return errors.Wrap(ErrToken, token)
+		}
+		a.res = append(a.res, byte(info.op))
+	} else if strings.HasPrefix(token, "JUMP:") {
+		return a.jump(strings.TrimPrefix(token, "JUMP:"), OP_JUMP)
+	} else if strings.HasPrefix(token, "JUMPIF:") {
+		return a.jump(strings.TrimPrefix(token, "JUMPIF:"), OP_JUMPIF)
+	} else if strings.HasPrefix(token, "$") {
+		return a.label(token)
+	} else if strings.HasPrefix(token, "0x") {
+		bytes, err := hex.DecodeString(strings.TrimPrefix(token, "0x"))
+		if err != nil {
+			return err
+		}
+		a.res = append(a.res, PushdataBytes(bytes)...)
+	} else if len(token) >= 2 && token[0] == '\'' && token[len(token)-1] == '\'' {
+		bytes := make([]byte, 0, len(token)-2)
+		var b int
+		for i := 1; i < len(token)-1; i++ {
+			if token[i] == '\\' {
+				i++
+			}
+			bytes = append(bytes, token[i])
+			b++
+		}
+		a.res = append(a.res, PushdataBytes(bytes)...)
+	} else if num, err := strconv.ParseInt(token, 10, 64); err == nil {
+		a.res = append(a.res, PushdataInt64(num)...)
+	} else {
+		return a.control(token)
 	}
+	return nil
+}
 
-	for label, uses := range unresolved {
-		location, ok := locations[label]
-		if !ok {
-			return nil, fmt.Errorf("undefined label %s", label)
+// control assembles the keywords of structured control flow.
+//
+// IF and WHILE can't negate the condition they pop, since NOT
+// works only on numbers, so they jump over a jump instead:
+//
+//	IF:     JUMPIF:$body JUMP:$next $body
+//	ELSE:   JUMP:$end $next
+//	ENDIF:  $next (or $end, after ELSE)
+//	BEGIN:  $start
+//	WHILE:  JUMPIF:$body JUMP:$end $body
+//	REPEAT: JUMP:$start $end
+//
+// Disassemble recognizes these patterns.
+func (a *assembler) control(token string) error {
+	var top *block
+	if len(a.blocks) > 0 {
+		top = a.blocks[len(a.blocks)-1]
+	}
+
+	switch token {
+	case "IF":
+		b := &block{kind: "IF", body: a.newLabel(), next: a.newLabel(), end: a.newLabel()}
+		a.blocks = append(a.blocks, b)
+		return a.cond(b.body, b.next)
+
+	case "ELSE":
+		if top == nil || top.kind != "IF" {
+			return errors.Wrap(ErrToken, "ELSE without IF")
 		}
-		for _, use := range uses {
-			binary.LittleEndian.PutUint32(res[use:], location)
+		top.kind = "ELSE"
+		err := a.jump(top.end, OP_JUMP)
+		if err != nil {
+			return err
+		}
+		return a.label(top.next)
+
+	case "ENDIF":
+		if top == nil || (top.kind != "IF" && top.kind != "ELSE") {
+			return errors.Wrap(ErrToken, "ENDIF without IF")
+		}
+		a.blocks = a.blocks[:len(a.blocks)-1]
+		if top.kind == "IF" {
+			return a.label(top.next)
+		}
+		return a.label(top.end)
+
+	case "BEGIN":
+		b := &block{kind: "BEGIN", start: a.newLabel(), body: a.newLabel(), end: a.newLabel()}
+		a.blocks = append(a.blocks, b)
+		return a.label(b.start)
+
+	case "WHILE":
+		if top == nil || top.kind != "BEGIN" {
+			return errors.Wrap(ErrToken, "WHILE without BEGIN")
+		}
+		top.kind = "WHILE"
+		return a.cond(top.body, top.end)
+
+	case "REPEAT":
+		if top == nil || top.kind != "WHILE" {
+			return errors.Wrap(ErrToken, "REPEAT without BEGIN and WHILE")
+		}
+		a.blocks = a.blocks[:len(a.blocks)-1]
+		err := a.jump(top.start, OP_JUMP)
+		if err != nil {
+			return err
 		}
+		return a.label(top.end)
 	}
+	return errors.Wrap(ErrToken, token)
+}
 
-	return res, nil
+// cond assembles a conditional jump to
+// body if the condition is true, else to next.
+func (a *assembler) cond(body, next string) error {
+	err := a.jump(body, OP_JUMPIF)
+	if err != nil {
+		return err
+	}
+	err = a.jump(next, OP_JUMP)
+	if err != nil {
+		return err
+	}
+	return a.label(body)
 }
 
+func (a *assembler) jump(addrStr string, opcode Op) error {
+	a.res = append(a.res, byte(opcode))
+	l := len(a.res)
+
+	var fourBytes [4]byte
+	a.res = append(a.res, fourBytes[:]...)
+
+	if strings.HasPrefix(addrStr, "$") {
+		a.unresolved[addrStr] = append(a.unresolved[addrStr], l)
+		return nil
+	}
+
+	address, err := strconv.ParseUint(addrStr, 10, 32)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(a.res[l:], uint32(address))
+	return nil
+}
+
+func (a *assembler) label(label string) error {
+	if _, seen := a.locations[label]; seen {
+		return fmt.Errorf("label %s redefined", label)
+	}
+	if len(a.res) > math.MaxInt32 {
+		return fmt.Errorf("program too long")
+	}
+	a.locations[label] = uint32(len(a.res))
+	return nil
+}
+
+// newLabel returns a label for a jump target of a control structure.
+// It contains a space, so it can't clash with labels in the input.
+func (a *assembler) newLabel() string {
+	a.numLabels++
+	return fmt.Sprintf("$ %d", a.numLabels)
+}
+
+var keywords = map[string]bool{
+	"IF": true, "ELSE": true, "ENDIF": true,
+	"BEGIN": true, "WHILE": true, "REPEAT": true,
+	"CONST": true, "MACRO": true, "ENDMACRO": true,
+}
+
+// checkName checks that name can be given to a constant or macro.
+func (a *assembler) checkName(name string) error {
+	if _, ok := opsByName[name]; ok || name == "" || keywords[name] || isLiteral(name) {
+		return errors.Wrap(ErrToken, "bad name "+name)
+	}
+	for i, r := range name {
+		if !(r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return errors.Wrap(ErrToken, "bad name "+name)
+		}
+	}
+	if _, ok := a.consts[name]; ok {
+		return errors.Wrap(ErrToken, name+" redefined")
+	}
+	if _, ok := a.macros[name]; ok {
+		return errors.Wrap(ErrToken, name+" redefined")
+	}
+	return nil
+}
+
+// isLiteral reports whether token is a number, hex or string literal.
+func isLiteral(token string) bool {
+	if strings.HasPrefix(token, "0x") {
+		return true
+	}
+	if len(token) >= 2 && token[0] == '\'' && token[len(token)-1] == '\'' {
+		return true
+	}
+	_, err := strconv.ParseInt(token, 10, 64)
+	return err == nil
+}
+
+// Disassemble converts a program into the form Assemble accepts.
+// Jumps that follow the patterns Assemble produces for structured
+// control flow come out as IF/ELSE/ENDIF and BEGIN/WHILE/REPEAT;
+// if any other jump is present, all jumps come out as jumps to
+// labels.
 func Disassemble(prog []byte) (string, error) {
 	var (
 		insts []Instruction
+		addrs []uint32
 
 		// maps program locations (used as jump targets) to a label for each
 		labels = make(map[uint32]string)
@@ -141,8 +407,20 @@ func Disassemble(prog []byte) (string, error) {
 			}
 		}
 		insts = append(insts, inst)
+		addrs = append(addrs, i)
 		i += inst.Len
 	}
+	addrs = append(addrs, uint32(len(prog)))
+
+	if len(labels) > 0 {
+		d := &disassembler{insts: insts, addrs: addrs, indexes: make(map[uint32]int)}
+		for i, addr := range addrs {
+			d.indexes[addr] = i
+		}
+		if strs, ok := d.structured(0, len(insts)); ok {
+			return strings.Join(strs, " "), nil
+		}
+	}
 
 	var (
 		loc  uint32
@@ -160,11 +438,7 @@ func Disassemble(prog []byte) (string, error) {
 			addr := binary.LittleEndian.Uint32(inst.Data)
 			str = fmt.Sprintf("%s:$%s", inst.Op.String(), labels[addr])
 		default:
-			if len(inst.Data) > 0 {
-				str = fmt.Sprintf("0x%x", inst.Data)
-			} else {
-				str = inst.Op.String()
-			}
+			str = instString(inst)
 		}
 		strs = append(strs, str)
 
@@ -178,6 +452,150 @@ func Disassemble(prog []byte) (string, error) {
 	return strings.Join(strs, " "), nil
 }
 
+func instString(inst Instruction) string {
+	if len(inst.Data) > 0 {
+		return fmt.Sprintf("0x%x", inst.Data)
+	}
+	return inst.Op.String()
+}
+
+// disassembler recovers the control structures
+// Assemble translates into jumps.
+type disassembler struct {
+	insts   []Instruction
+	addrs   []uint32       // addrs[i] is the location of insts[i], plus the program length
+	indexes map[uint32]int // inverse of addrs
+}
+
+// structured disassembles insts[lo:hi] into structured control
+// flow, reporting false if it contains a jump that isn't part of
+// a structure contained in insts[lo:hi]. Since each jump is
+// checked to go where Assemble would put it, assembling the
+// result reproduces the program.
+func (d *disassembler) structured(lo, hi int) ([]string, bool) {
+	var strs []string
+	for i := lo; i < hi; {
+		// A loop starts at the target of a backward JUMP. Loops
+		// may start at the same place; take the outermost one.
+		repeat := -1
+		for j := i + 1; j < hi; j++ {
+			if d.jumpsTo(j, OP_JUMP, i) {
+				repeat = j
+			}
+		}
+		if repeat >= 0 {
+			loop, ok := d.loop(i, repeat)
+			if !ok {
+				return nil, false
+			}
+			strs = append(strs, loop...)
+			i = repeat + 1
+			continue
+		}
+
+		switch d.insts[i].Op {
+		case OP_JUMPIF:
+			ifStrs, end, ok := d.ifElse(i, hi)
+			if !ok {
+				return nil, false
+			}
+			strs = append(strs, ifStrs...)
+			i = end
+		case OP_JUMP:
+			return nil, false
+		default:
+			strs = append(strs, instString(d.insts[i]))
+			i++
+		}
+	}
+	return strs, true
+}
+
+// loop disassembles the loop starting at insts[start] and
+// ending with the JUMP at insts[repeat].
+func (d *disassembler) loop(start, repeat int) ([]string, bool) {
+	for k := start; k+1 < repeat; k++ {
+		if !d.isCond(k) || !d.jumpsTo(k+1, OP_JUMP, repeat+1) {
+			continue
+		}
+		before, ok := d.structured(start, k)
+		if !ok {
+			return nil, false
+		}
+		after, ok := d.structured(k+2, repeat)
+		if !ok {
+			return nil, false
+		}
+		strs := append([]string{"BEGIN"}, before...)
+		strs = append(strs, "WHILE")
+		strs = append(strs, after...)
+		return append(strs, "REPEAT"), true
+	}
+	return nil, false
+}
+
+// ifElse disassembles the IF starting at insts[i], contained in
+// insts[:hi]. It returns the index of the instruction after it.
+func (d *disassembler) ifElse(i, hi int) ([]string, int, bool) {
+	if i+1 >= hi || !d.isCond(i) {
+		return nil, 0, false
+	}
+	next, ok := d.target(i + 1)
+	if !ok || next < i+2 || next > hi {
+		return nil, 0, false
+	}
+
+	strs := []string{"IF"}
+	end := next
+	thenEnd := next
+	var elseStrs []string
+	// A forward JUMP ending the THEN part jumps over the ELSE part.
+	// A backward one is the REPEAT of a loop ending the THEN part.
+	if e, ok := d.target(next - 1); ok && next-1 >= i+2 && d.insts[next-1].Op == OP_JUMP && e >= next {
+		if e > hi {
+			return nil, 0, false
+		}
+		elseStrs, ok = d.structured(next, e)
+		if !ok {
+			return nil, 0, false
+		}
+		elseStrs = append([]string{"ELSE"}, elseStrs...)
+		end = e
+		thenEnd = next - 1
+	}
+	thenStrs, ok := d.structured(i+2, thenEnd)
+	if !ok {
+		return nil, 0, false
+	}
+	strs = append(strs, thenStrs...)
+	strs = append(strs, elseStrs...)
+	return append(strs, "ENDIF"), end, true
+}
+
+// isCond reports whether insts[i] and insts[i+1] are the jumps
+// Assemble makes for IF or WHILE: a JUMPIF over a JUMP.
+func (d *disassembler) isCond(i int) bool {
+	return i+1 < len(d.insts) && d.jumpsTo(i, OP_JUMPIF, i+2) && d.insts[i+1].Op == OP_JUMP
+}
+
+// jumpsTo reports whether insts[i] is a jump
+// with opcode op to the location of insts[j].
+func (d *disassembler) jumpsTo(i int, op Op, j int) bool {
+	t, ok := d.target(i)
+	return ok && d.insts[i].Op == op && t == j
+}
+
+// target returns the index of the instruction
+// the jump at insts[i] goes to.
+func (d *disassembler) target(i int) (int, bool) {
+	switch d.insts[i].Op {
+	case OP_JUMP, OP_JUMPIF:
+		j, ok := d.indexes[binary.LittleEndian.Uint32(d.insts[i].Data)]
+		return j, ok
+	}
+	return 0, false
+}
+
 // split is a bufio.SplitFunc for scanning the input to Compile.
 // It starts like bufio.ScanWords but adjusts the return value to
 // account for quoted strings.
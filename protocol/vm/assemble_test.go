@@ -3,6 +3,7 @@ package vm
 import (
 	"bytes"
 	"encoding/hex"
+	"strings"
 	"testing"
 
 	"chain/errors"
@@ -73,6 +74,105 @@ func TestDisassemble(t *testing.T) {
 	}
 }
 
+func TestAssembleStructured(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"1 IF 2 ELSE 3 ENDIF", "51640b000000631100000052631200000053"},
+		{"1 IF 2 ENDIF 4", "51640b000000630c0000005254"},
+		{"0 BEGIN DUP 10 LESSTHAN WHILE 1ADD REPEAT 10 NUMEQUAL", "00765a9f640e00000063140000008b63010000005a9c"},
+		{"CONST ten 10 ten ten ADD", "5a5a93"},
+		{"MACRO sq DUP MUL ENDMACRO 3 sq 9 NUMEQUAL", "537695599c"},
+		{"MACRO sq DUP MUL ENDMACRO MACRO quad sq sq ENDMACRO 2 quad", "52769576 95"},
+	}
+	for _, c := range cases {
+		got, err := Assemble(c.src)
+		if err != nil {
+			t.Errorf("Assemble(%s) error: %s", c.src, err)
+			continue
+		}
+		want := mustDecodeHex(strings.Replace(c.want, " ", "", -1))
+		if !bytes.Equal(got, want) {
+			t.Errorf("Assemble(%s) = %x want %x", c.src, got, want)
+		}
+	}
+}
+
+func TestAssembleStructuredErrors(t *testing.T) {
+	cases := []string{
+		"ELSE",
+		"ENDIF",
+		"1 IF 2",
+		"1 IF 2 ELSE 3 ELSE 4 ENDIF",
+		"BEGIN 1 REPEAT",
+		"WHILE",
+		"BEGIN 1 WHILE",
+		"1 IF BEGIN ENDIF REPEAT",
+		"CONST x",
+		"CONST ADD 1",
+		"CONST x 1 CONST x 2",
+		"MACRO m m ENDMACRO m",
+		"MACRO m 1",
+		"MACRO m CONST x 1 ENDMACRO m",
+		"ENDMACRO",
+	}
+	for _, src := range cases {
+		_, err := Assemble(src)
+		if errors.Root(err) != ErrToken {
+			t.Errorf("Assemble(%s) err = %v want %v", src, err, ErrToken)
+		}
+	}
+}
+
+func TestDisassembleStructured(t *testing.T) {
+	cases := []string{
+		"0x01 IF 0x02 ELSE 0x03 ENDIF",
+		"0x01 IF 0x02 ENDIF 0x04",
+		"0x01 IF 0x02 IF 0x05 ELSE 0x06 ENDIF ELSE 0x03 ENDIF",
+		"0x01 IF 0x02 ELSE ENDIF",
+		"FALSE BEGIN DUP 0x0a LESSTHAN WHILE 1ADD REPEAT 0x0a NUMEQUAL",
+		"0x01 IF 0x02 ENDIF BEGIN 0x01 WHILE 0x03 REPEAT",
+		"0x01 IF BEGIN 0x01 WHILE 0x02 DROP REPEAT ENDIF 0x03",
+		"0x01 IF BEGIN 0x01 WHILE 0x02 DROP REPEAT ELSE 0x03 ENDIF",
+	}
+	for _, src := range cases {
+		prog, err := Assemble(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Disassemble(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != src {
+			t.Errorf("Disassemble(Assemble(%s)) = %s", src, got)
+		}
+	}
+
+	// Jumps that don't form structured control flow
+	// still disassemble to labels.
+	prog := mustDecodeHex("51630600000051")
+	got, err := Disassemble(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "IF") || !strings.Contains(got, "JUMP:$") {
+		t.Errorf("Disassemble(%x) = %s, want labels", prog, got)
+	}
+	reassembled, err := Assemble(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Disassemble(reassembled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != got {
+		t.Errorf("Disassemble(Assemble(%s)) = %s", got, again)
+	}
+}
+
 func mustDecodeHex(h string) []byte {
 	bits, err := hex.DecodeString(h)
 	if err != nil {
@@ -40,4 +40,8 @@ type Context struct {
 	SpentOutputID    *[]byte
 
 	CheckOutput func(index uint64, data []byte, amount uint64, assetID []byte, vmVersion uint64, code []byte) (bool, error)
+
+	// Tracer, if non-nil, receives an event for
+	// each step of execution.
+	Tracer Tracer
 }
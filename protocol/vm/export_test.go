@@ -1,7 +1,5 @@
 package vm
 
-var InitialRunLimit = initialRunLimit
-
 type VirtualMachine struct {
 	Program           []byte
 	RunLimit          int64
@@ -0,0 +1,95 @@
+package vm
+
+// Tracer receives events from running programs. To trace a
+// verification, set the Tracer field of its Context. Programs
+// run by CHECKPREDICATE share their caller's Context, and so
+// its Tracer; their events have a greater Depth.
+type Tracer interface {
+	// Step is called after each instruction runs,
+	// or fails to.
+	Step(*TraceStep)
+
+	// Finish is called when a program finishes, with
+	// the error that ended it, or nil if it succeeded.
+	// A false result is reported as ErrFalseVMResult.
+	Finish(depth int, err error)
+}
+
+// A BeginTracer is a Tracer that is also
+// told when each program starts.
+type BeginTracer interface {
+	Tracer
+
+	// Begin is called when a program starts,
+	// with its initial data stack.
+	Begin(depth int, prog []byte, dataStack [][]byte)
+}
+
+// TraceStep describes one instruction and the state
+// of the VM after running it.
+type TraceStep struct {
+	Depth int // the CHECKPREDICATE depth; 0 for the outermost program
+	PC    uint32
+	Op    Op
+	Data  []byte
+
+	// NextPC is the pc of the next instruction to run,
+	// if Err is nil.
+	NextPC uint32
+
+	// RunLimit is the run limit before the instruction,
+	// and RunLimitAfter the run limit remaining after it.
+	RunLimit      int64
+	RunLimitAfter int64
+
+	// DataStack and AltStack are copies of the stacks,
+	// bottom first.
+	DataStack [][]byte
+	AltStack  [][]byte
+
+	// Err is the error returned by the instruction, if any.
+	Err error
+}
+
+func (vm *virtualMachine) tracer() Tracer {
+	if vm.context == nil {
+		return nil
+	}
+	return vm.context.Tracer
+}
+
+func (vm *virtualMachine) traceBegin() {
+	if t, ok := vm.tracer().(BeginTracer); ok {
+		t.Begin(vm.depth, vm.program, copyStack(vm.dataStack))
+	}
+}
+
+func (vm *virtualMachine) traceStep(pc uint32, inst Instruction, runLimit int64, err error) {
+	vm.tracer().Step(&TraceStep{
+		Depth:         vm.depth,
+		PC:            pc,
+		Op:            inst.Op,
+		Data:          inst.Data,
+		NextPC:        vm.pc,
+		RunLimit:      runLimit,
+		RunLimitAfter: vm.runLimit,
+		DataStack:     copyStack(vm.dataStack),
+		AltStack:      copyStack(vm.altStack),
+		Err:           err,
+	})
+}
+
+func (vm *virtualMachine) traceFinish(err error) {
+	if err == nil && vm.falseResult() {
+		err = ErrFalseVMResult
+	}
+	vm.tracer().Finish(vm.depth, err)
+}
+
+func copyStack(stack [][]byte) [][]byte {
+	res := make([][]byte, 0, len(stack))
+	for _, item := range stack {
+		res = append(res, append([]byte{}, item...))
+	}
+	return res
+}
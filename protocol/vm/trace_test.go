@@ -0,0 +1,106 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type traceRecorder struct {
+	events []string
+	stacks [][][]byte
+}
+
+func (r *traceRecorder) Begin(depth int, prog []byte, dataStack [][]byte) {
+	r.events = append(r.events, fmt.Sprintf("%d begin %x %x", depth, prog, dataStack))
+}
+
+func (r *traceRecorder) Step(s *TraceStep) {
+	r.events = append(r.events, fmt.Sprintf("%d %d %s %d %v", s.Depth, s.PC, s.Op, s.NextPC, s.Err))
+	r.stacks = append(r.stacks, s.DataStack)
+}
+
+func (r *traceRecorder) Finish(depth int, err error) {
+	r.events = append(r.events, fmt.Sprintf("%d finish %v", depth, err))
+}
+
+func TestTracer(t *testing.T) {
+	cases := []struct {
+		prog    string
+		want    []string
+		wantErr error
+	}{{
+		prog: "0 0x51 0 CHECKPREDICATE",
+		want: []string{
+			"0 begin 00015100c0 []",
+			"0 0 FALSE 1 <nil>",
+			"0 1 DATA_1 3 <nil>",
+			"0 3 FALSE 4 <nil>",
+			"1 begin 51 []",
+			"1 0 1 1 <nil>",
+			"1 finish <nil>",
+			"0 4 CHECKPREDICATE 5 <nil>",
+			"0 finish <nil>",
+		},
+	}, {
+		prog: "0 0x00 0 CHECKPREDICATE",
+		want: []string{
+			"0 begin 00010000c0 []",
+			"0 0 FALSE 1 <nil>",
+			"0 1 DATA_1 3 <nil>",
+			"0 3 FALSE 4 <nil>",
+			"1 begin 00 []",
+			"1 0 FALSE 1 <nil>",
+			"1 finish false VM result",
+			"0 4 CHECKPREDICATE 5 <nil>",
+			"0 finish false VM result",
+		},
+		wantErr: ErrFalseVMResult,
+	}, {
+		prog: "1 FAIL",
+		want: []string{
+			"0 begin 516a []",
+			"0 0 1 1 <nil>",
+			"0 1 FAIL 1 RETURN executed",
+			"0 finish RETURN executed",
+		},
+		wantErr: ErrReturn,
+	}}
+	for _, c := range cases {
+		prog, err := Assemble(c.prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := new(traceRecorder)
+		err = Verify(&Context{VMVersion: 1, Code: prog, Tracer: r})
+		if err != nil {
+			err = err.(Error).Err
+		}
+		if err != c.wantErr {
+			t.Errorf("Verify(%s) err = %v want %v", c.prog, err, c.wantErr)
+		}
+		if !reflect.DeepEqual(r.events, c.want) {
+			t.Errorf("Verify(%s) events:\ngot:  %q\nwant: %q", c.prog, r.events, c.want)
+		}
+	}
+}
+
+func TestTracerStackCopy(t *testing.T) {
+	prog, err := Assemble("0x01 0x02 CAT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := new(traceRecorder)
+	err = Verify(&Context{VMVersion: 1, Code: prog, Tracer: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][][]byte{
+		{{1}},
+		{{1}, {2}},
+		{{1, 2}},
+	}
+	if !reflect.DeepEqual(r.stacks, want) {
+		t.Errorf("stacks = %x want %x", r.stacks, want)
+	}
+}
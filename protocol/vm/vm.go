@@ -3,13 +3,13 @@ package vm
 import (
 	"encoding/hex"
 	"fmt"
-	"io"
 	"strings"
 
 	"chain/errors"
 )
 
-const initialRunLimit = 10000
+// InitialRunLimit is the run limit of a program verified by Verify.
+const InitialRunLimit = 10000
 
 type virtualMachine struct {
 	context *Context
@@ -36,10 +36,6 @@ type virtualMachine struct {
 // ErrFalseVMResult is one of the ways for a transaction to fail validation
 var ErrFalseVMResult = errors.New("false VM result")
 
-// TraceOut - if non-nil - will receive trace output during
-// execution.
-var TraceOut io.Writer
-
 func Verify(context *Context) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -58,7 +54,7 @@ func Verify(context *Context) (err error) {
 	vm := &virtualMachine{
 		expansionReserved: context.TxVersion != nil && *context.TxVersion == 1,
 		program:           context.Code,
-		runLimit:          initialRunLimit,
+		runLimit:          InitialRunLimit,
 		context:           context,
 	}
 
@@ -84,7 +80,16 @@ func (vm *virtualMachine) falseResult() bool {
 	return len(vm.dataStack) == 0 || !AsBool(vm.dataStack[len(vm.dataStack)-1])
 }
 
-func (vm *virtualMachine) run() error {
+func (vm *virtualMachine) run() (err error) {
+	if vm.tracer() != nil {
+		vm.traceBegin()
+		defer func() {
+			if r := recover(); r != nil {
+				panic(r) // don't trace an unfinished program
+			}
+			vm.traceFinish(err)
+		}()
+	}
 	for vm.pc = 0; vm.pc < uint32(len(vm.program)); { // handle vm.pc updates in step
 		err := vm.step()
 		if err != nil {
@@ -94,23 +99,23 @@ func (vm *virtualMachine) run() error {
 	return nil
 }
 
-func (vm *virtualMachine) step() error {
+func (vm *virtualMachine) step() (err error) {
 	inst, err := ParseOp(vm.program, vm.pc)
+	if vm.tracer() != nil {
+		pc, runLimit := vm.pc, vm.runLimit
+		defer func() {
+			if r := recover(); r != nil {
+				panic(r)
+			}
+			vm.traceStep(pc, inst, runLimit, err)
+		}()
+	}
 	if err != nil {
 		return err
 	}
 
 	vm.nextPC = vm.pc + inst.Len
 
-	if TraceOut != nil {
-		opname := inst.Op.String()
-		fmt.Fprintf(TraceOut, "vm %d pc %d limit %d %s", vm.depth, vm.pc, vm.runLimit, opname)
-		if len(inst.Data) > 0 {
-			fmt.Fprintf(TraceOut, " %x", inst.Data)
-		}
-		fmt.Fprint(TraceOut, "\n")
-	}
-
 	if isExpansion[inst.Op] {
 		if vm.expansionReserved {
 			return ErrDisallowedOpcode
@@ -130,13 +135,6 @@ func (vm *virtualMachine) step() error {
 		return err
 	}
 	vm.pc = vm.nextPC
-
-	if TraceOut != nil {
-		for i := len(vm.dataStack) - 1; i >= 0; i-- {
-			fmt.Fprintf(TraceOut, "  stack %d: %x\n", len(vm.dataStack)-1-i, vm.dataStack[i])
-		}
-	}
-
 	return nil
 }
 
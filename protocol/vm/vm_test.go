@@ -14,11 +14,30 @@ import (
 	"chain/testutil"
 )
 
+// tracebuf is a Tracer that records a line of text for each step.
 type tracebuf struct {
 	bytes.Buffer
 }
 
-func (t tracebuf) dump() {
+func (t *tracebuf) Step(s *TraceStep) {
+	fmt.Fprintf(t, "vm %d pc %d limit %d %s", s.Depth, s.PC, s.RunLimit, s.Op)
+	if len(s.Data) > 0 {
+		fmt.Fprintf(t, " %x", s.Data)
+	}
+	fmt.Fprint(t, "\n")
+	for i := len(s.DataStack) - 1; i >= 0; i-- {
+		fmt.Fprintf(t, "  stack %d: %x\n", len(s.DataStack)-1-i, s.DataStack[i])
+	}
+	if s.Err != nil {
+		fmt.Fprintf(t, "  error: %s\n", s.Err)
+	}
+}
+
+func (t *tracebuf) Finish(depth int, err error) {
+	fmt.Fprintf(t, "vm %d finished: %v\n", depth, err)
+}
+
+func (t *tracebuf) dump() {
 	os.Stdout.Write(t.Bytes())
 }
 
@@ -139,7 +158,10 @@ func doOKNotOK(t *testing.T, expectOK bool) {
 		{"0 1 2 3 4 5 6 JUMP:$dup $drop DROP $dup DUP 0 NUMNOTEQUAL JUMPIF:$drop 1", nil}, // same as "0 1 2 3 4 5 6 WHILE DROP ENDWHILE 1"
 		{"0 JUMP:7 1ADD DUP 10 LESSTHAN JUMPIF:6 10 NUMEQUAL", nil},                       // fixed version of "0 1 WHILE DROP 1ADD DUP 10 LESSTHAN ENDWHILE 10 NUMEQUAL"
 		{"0 JUMP:$dup $add 1ADD $dup DUP 10 LESSTHAN JUMPIF:$add 10 NUMEQUAL", nil},       // fixed version of "0 1 WHILE DROP 1ADD DUP 10 LESSTHAN ENDWHILE 10 NUMEQUAL"
-
+		{"0 BEGIN DUP 10 LESSTHAN WHILE 1ADD REPEAT 10 NUMEQUAL", nil},
+		{"1 IF 2 ELSE 3 ENDIF 2 NUMEQUAL", nil},
+		{"0 IF 2 ELSE 3 ENDIF 3 NUMEQUAL", nil},
+		{"MACRO sq DUP MUL ENDMACRO CONST three 3 three sq 9 NUMEQUAL", nil},
 	}
 	for i, c := range cases {
 		progSrc := c.prog
@@ -152,11 +174,11 @@ func doOKNotOK(t *testing.T, expectOK bool) {
 		}
 		fmt.Printf("* case %d, prog [%s] [%x]\n", i, progSrc, prog)
 		trace := new(tracebuf)
-		TraceOut = trace
 		vm := &VirtualMachine{
 			Program:   prog,
 			RunLimit:  int64(InitialRunLimit),
 			DataStack: append([][]byte{}, c.args...),
+			Context:   &Context{Tracer: trace},
 		}
 		gotVM, err := vm.Run()
 		if err == nil && gotVM.FalseResult() {
@@ -0,0 +1,641 @@
+// Package vmanalysis examines VM programs without running them.
+//
+// It follows every path through a program, tracking the height of
+// the data stack and the values of the items the program pushes
+// itself, to find unreachable code, jumps into the middle of
+// instructions, the Context fields the program needs, an estimate
+// of its run cost, and whether it can succeed at all.
+package vmanalysis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"chain/protocol/vm"
+)
+
+// Inst is an instruction of an analyzed program.
+type Inst struct {
+	PC uint32
+	vm.Instruction
+
+	// Reachable reports whether any path
+	// through the program runs the instruction.
+	Reachable bool
+}
+
+// Jump is a jump from the instruction at From to pc To.
+type Jump struct {
+	From, To uint32
+}
+
+// Report is the result of analyzing a program.
+type Report struct {
+	// Insts holds the instructions of the program,
+	// as parsed from the beginning. A program that
+	// ends in a truncated instruction has no Inst
+	// for it.
+	Insts []Inst
+
+	// JumpsIntoData lists the reachable jumps whose targets
+	// lie inside another instruction, usually the data of
+	// a push. The VM runs the bytes there as instructions.
+	JumpsIntoData []Jump
+
+	// Fields lists, in order, the names of the Context fields
+	// that reachable instructions use, including those of
+	// programs the program runs with CHECKPREDICATE.
+	Fields []string
+
+	// MinStack and MaxStack bound the height of the data
+	// stack, relative to its height when the program starts,
+	// and Args is the most arguments any path uses. They're
+	// valid only if StackBounded is true.
+	MinStack, MaxStack int
+	Args               int
+	StackBounded       bool
+
+	// MaxCost estimates the most run limit the program
+	// spends at any point, counting each stack item whose
+	// value the analysis doesn't know as empty, and not
+	// counting the cost of the arguments. It's a bound only
+	// if CostBounded is true; a loop makes it unbounded.
+	MaxCost         int64
+	CostBounded     bool
+	ExceedsRunLimit bool // MaxCost > vm.InitialRunLimit
+
+	// Unspendable reports whether the program
+	// can never succeed, and Reason says why.
+	Unspendable bool
+	Reason      string
+}
+
+// Field names by the opcodes that use them.
+var opFields = map[vm.Op]string{
+	vm.OP_BLOCKHASH:     "BlockHash",
+	vm.OP_BLOCKTIME:     "BlockTimeMS",
+	vm.OP_NEXTPROGRAM:   "NextConsensusProgram",
+	vm.OP_TXSIGHASH:     "TxSigHash",
+	vm.OP_ASSET:         "AssetID",
+	vm.OP_AMOUNT:        "Amount",
+	vm.OP_MINTIME:       "MinTimeMS",
+	vm.OP_MAXTIME:       "MaxTimeMS",
+	vm.OP_REFDATAHASH:   "InputRefDataHash",
+	vm.OP_TXREFDATAHASH: "TxRefDataHash",
+	vm.OP_INDEX:         "InputIndex",
+	vm.OP_NONCE:         "Nonce",
+	vm.OP_OUTPUTID:      "SpentOutputID",
+	vm.OP_CHECKOUTPUT:   "CheckOutput",
+}
+
+var blockFields = map[string]bool{
+	"BlockHash":            true,
+	"BlockTimeMS":          true,
+	"NextConsensusProgram": true,
+}
+
+// kinds is a set of the kinds of Context
+// a path's fields require.
+type kinds uint8
+
+const (
+	kindBlock kinds = 1 << iota
+	kindTx
+	kindNonce    // an issuance
+	kindOutputID // a spend
+)
+
+func fieldKinds(f string) kinds {
+	switch {
+	case blockFields[f]:
+		return kindBlock
+	case f == "Nonce":
+		return kindTx | kindNonce
+	case f == "SpentOutputID":
+		return kindTx | kindOutputID
+	}
+	return kindTx
+}
+
+// conflict returns why no Context has
+// all the fields of k, or "" if one does.
+func (k kinds) conflict() string {
+	switch {
+	case k&kindBlock != 0 && k&kindTx != 0:
+		return "uses both block and transaction fields"
+	case k&kindNonce != 0 && k&kindOutputID != 0:
+		return "uses both Nonce, for issuances, and SpentOutputID, for spends"
+	}
+	return ""
+}
+
+// effect describes an opcode with a fixed effect on the stack.
+// It pops in items, then pushes the popped items listed in out
+// (by position, 0 being the deepest), with -1 for a new item.
+type effect struct {
+	cost int64
+	in   int
+	out  []int
+}
+
+var effects = map[vm.Op]effect{
+	vm.OP_NOP:          {1, 0, nil},
+	vm.OP_TOALTSTACK:   {2, 1, nil},
+	vm.OP_FROMALTSTACK: {2, 0, []int{-1}},
+	vm.OP_2DROP:        {2, 2, nil},
+	vm.OP_2DUP:         {2, 2, []int{0, 1, 0, 1}},
+	vm.OP_3DUP:         {3, 3, []int{0, 1, 2, 0, 1, 2}},
+	vm.OP_2OVER:        {2, 4, []int{0, 1, 2, 3, 0, 1}},
+	vm.OP_2ROT:         {2, 6, []int{2, 3, 4, 5, 0, 1}},
+	vm.OP_2SWAP:        {2, 4, []int{2, 3, 0, 1}},
+	vm.OP_DEPTH:        {1, 0, []int{-1}},
+	vm.OP_DROP:         {1, 1, nil},
+	vm.OP_DUP:          {1, 1, []int{0, 0}},
+	vm.OP_NIP:          {1, 2, []int{1}},
+	vm.OP_OVER:         {1, 2, []int{0, 1, 0}},
+	vm.OP_ROT:          {2, 3, []int{1, 2, 0}},
+	vm.OP_SWAP:         {1, 2, []int{1, 0}},
+	vm.OP_TUCK:         {1, 2, []int{1, 0, 1}},
+
+	vm.OP_CAT:         {4, 2, []int{-1}},
+	vm.OP_SUBSTR:      {4, 3, []int{-1}},
+	vm.OP_LEFT:        {4, 2, []int{-1}},
+	vm.OP_RIGHT:       {4, 2, []int{-1}},
+	vm.OP_SIZE:        {1, 1, []int{0, -1}},
+	vm.OP_CATPUSHDATA: {4, 2, []int{-1}},
+
+	vm.OP_INVERT: {1, 1, []int{-1}},
+	vm.OP_AND:    {1, 2, []int{-1}},
+	vm.OP_OR:     {1, 2, []int{-1}},
+	vm.OP_XOR:    {1, 2, []int{-1}},
+	vm.OP_EQUAL:  {1, 2, []int{-1}},
+
+	vm.OP_1ADD:               {2, 1, []int{-1}},
+	vm.OP_1SUB:               {2, 1, []int{-1}},
+	vm.OP_2MUL:               {2, 1, []int{-1}},
+	vm.OP_2DIV:               {2, 1, []int{-1}},
+	vm.OP_NEGATE:             {2, 1, []int{-1}},
+	vm.OP_ABS:                {2, 1, []int{-1}},
+	vm.OP_NOT:                {2, 1, []int{-1}},
+	vm.OP_0NOTEQUAL:          {2, 1, []int{-1}},
+	vm.OP_ADD:                {2, 2, []int{-1}},
+	vm.OP_SUB:                {2, 2, []int{-1}},
+	vm.OP_MUL:                {8, 2, []int{-1}},
+	vm.OP_DIV:                {8, 2, []int{-1}},
+	vm.OP_MOD:                {8, 2, []int{-1}},
+	vm.OP_LSHIFT:             {8, 2, []int{-1}},
+	vm.OP_RSHIFT:             {8, 2, []int{-1}},
+	vm.OP_BOOLAND:            {2, 2, []int{-1}},
+	vm.OP_BOOLOR:             {2, 2, []int{-1}},
+	vm.OP_NUMEQUAL:           {2, 2, []int{-1}},
+	vm.OP_NUMEQUALVERIFY:     {2, 2, nil},
+	vm.OP_NUMNOTEQUAL:        {2, 2, []int{-1}},
+	vm.OP_LESSTHAN:           {2, 2, []int{-1}},
+	vm.OP_GREATERTHAN:        {2, 2, []int{-1}},
+	vm.OP_LESSTHANOREQUAL:    {2, 2, []int{-1}},
+	vm.OP_GREATERTHANOREQUAL: {2, 2, []int{-1}},
+	vm.OP_MIN:                {2, 2, []int{-1}},
+	vm.OP_MAX:                {2, 2, []int{-1}},
+	vm.OP_WITHIN:             {4, 3, []int{-1}},
+
+	vm.OP_SHA256:    {64, 1, []int{-1}},
+	vm.OP_SHA3:      {64, 1, []int{-1}},
+	vm.OP_CHECKSIG:  {1024, 3, []int{-1}},
+	vm.OP_TXSIGHASH: {256, 0, []int{-1}},
+	vm.OP_BLOCKHASH: {1, 0, []int{-1}},
+
+	vm.OP_CHECKOUTPUT:   {16, 6, []int{-1}},
+	vm.OP_ASSET:         {1, 0, []int{-1}},
+	vm.OP_AMOUNT:        {1, 0, []int{-1}},
+	vm.OP_PROGRAM:       {1, 0, []int{-1}},
+	vm.OP_MINTIME:       {1, 0, []int{-1}},
+	vm.OP_MAXTIME:       {1, 0, []int{-1}},
+	vm.OP_TXREFDATAHASH: {1, 0, []int{-1}},
+	vm.OP_REFDATAHASH:   {1, 0, []int{-1}},
+	vm.OP_INDEX:         {1, 0, []int{-1}},
+	vm.OP_OUTPUTID:      {1, 0, []int{-1}},
+	vm.OP_NONCE:         {1, 0, []int{-1}},
+	vm.OP_NEXTPROGRAM:   {1, 0, []int{-1}},
+	vm.OP_BLOCKTIME:     {1, 0, []int{-1}},
+}
+
+// maxItems bounds the number of items on a stack,
+// since each costs at least 8.
+const maxItems = vm.InitialRunLimit / 8
+
+// item is an abstract stack item.
+type item struct {
+	known bool
+	data  []byte
+}
+
+func (it item) cost() int64 {
+	return 8 + int64(len(it.data))
+}
+
+// state is the abstract state of the VM before an instruction.
+// Its stack holds the items the program pushed, on top of those
+// of the arguments it has used so far (below counts them).
+// A lost state is one whose stack height the analysis can't
+// determine. Kinds holds the kinds of the fields used on the
+// paths to the state; paths with different kinds have
+// separate states.
+type state struct {
+	stack []item
+	below int
+	lost  bool
+	cost  int64
+	kinds kinds
+}
+
+// A key identifies the state before the instruction at pc
+// on paths that have used fields of the given kinds.
+type key struct {
+	pc    uint32
+	kinds kinds
+}
+
+func (s *state) clone() *state {
+	s2 := *s
+	s2.stack = append([]item(nil), s.stack...)
+	return &s2
+}
+
+func (s *state) lose() {
+	s.lost = true
+	s.stack = nil
+	s.below = 0
+}
+
+// ensure makes at least n items available,
+// taking as many as needed from the arguments.
+func (s *state) ensure(n int) {
+	if d := n - len(s.stack); d > 0 && !s.lost {
+		s.stack = append(make([]item, d, d+len(s.stack)), s.stack...)
+		s.below += d
+	}
+}
+
+type analyzer struct {
+	prog      []byte
+	starts    map[uint32]bool // the pcs of Insts
+	states    map[key]*state
+	reached   map[uint32]bool
+	work      []key
+	loop      bool
+	succeeds  map[kinds]bool  // kinds of the paths that succeed
+	conflicts map[string]bool // why paths that would succeed can't
+	fields    map[string]bool
+	jumps     map[Jump]bool
+	r         *Report
+}
+
+// Analyze analyzes prog.
+func Analyze(prog []byte) *Report {
+	return analyze(prog).r
+}
+
+func analyze(prog []byte) *analyzer {
+	a := &analyzer{
+		prog:      prog,
+		starts:    make(map[uint32]bool),
+		states:    make(map[key]*state),
+		reached:   make(map[uint32]bool),
+		succeeds:  make(map[kinds]bool),
+		conflicts: make(map[string]bool),
+		fields:    make(map[string]bool),
+		jumps:     make(map[Jump]bool),
+		r:         &Report{StackBounded: true},
+	}
+	for pc := uint32(0); pc < uint32(len(prog)); {
+		inst, err := vm.ParseOp(prog, pc)
+		if err != nil {
+			break
+		}
+		a.r.Insts = append(a.r.Insts, Inst{PC: pc, Instruction: inst})
+		a.starts[pc] = true
+		pc += inst.Len
+	}
+
+	a.flow(0, 0, &state{}, false)
+	for len(a.work) > 0 {
+		k := a.work[len(a.work)-1]
+		a.work = a.work[:len(a.work)-1]
+		a.reached[k.pc] = true
+		inst, err := vm.ParseOp(prog, k.pc)
+		if err != nil {
+			continue // the VM fails here
+		}
+		a.step(k.pc, inst, a.states[k].clone())
+	}
+	if len(prog) == 0 {
+		a.exit(&state{})
+	}
+
+	a.report()
+	return a
+}
+
+func (a *analyzer) report() {
+	r := a.r
+	for i := range r.Insts {
+		r.Insts[i].Reachable = a.reached[r.Insts[i].PC]
+	}
+	for j := range a.jumps {
+		r.JumpsIntoData = append(r.JumpsIntoData, j)
+	}
+	sort.Slice(r.JumpsIntoData, func(i, j int) bool {
+		return r.JumpsIntoData[i].From < r.JumpsIntoData[j].From
+	})
+	for f := range a.fields {
+		r.Fields = append(r.Fields, f)
+	}
+	sort.Strings(r.Fields)
+	r.CostBounded = !a.loop
+	r.ExceedsRunLimit = r.MaxCost > vm.InitialRunLimit
+
+	if len(a.succeeds) > 0 {
+		return
+	}
+	r.Unspendable, r.Reason = true, "no path through the program succeeds"
+	// Report a conflict only if it's what stops
+	// every path that would otherwise succeed.
+	for _, reason := range []string{(kindBlock | kindTx).conflict(), (kindNonce | kindOutputID).conflict()} {
+		if a.conflicts[reason] {
+			r.Reason = reason
+			break
+		}
+	}
+}
+
+// flow records that s is a state before the instruction at to,
+// reached from from. Jump says whether it was reached by a jump.
+func (a *analyzer) flow(from, to uint32, s *state, jump bool) {
+	if s.lost {
+		a.r.StackBounded = false
+	} else {
+		h := len(s.stack) - s.below
+		if h < a.r.MinStack {
+			a.r.MinStack = h
+		}
+		if h > a.r.MaxStack {
+			a.r.MaxStack = h
+		}
+		if s.below > a.r.Args {
+			a.r.Args = s.below
+		}
+	}
+	if to >= uint32(len(a.prog)) {
+		if len(a.prog) > 0 {
+			a.exit(s)
+		}
+		return
+	}
+	if jump && to <= from {
+		a.loop = true
+	}
+	if jump && !a.starts[to] {
+		a.jumps[Jump{From: from, To: to}] = true
+	}
+	k := key{to, s.kinds}
+	old := a.states[k]
+	if old == nil {
+		a.states[k] = s
+		a.work = append(a.work, k)
+		return
+	}
+	if a.merge(old, s) {
+		a.work = append(a.work, k)
+	}
+}
+
+// merge merges s into old, and reports whether old changed.
+func (a *analyzer) merge(old, s *state) bool {
+	var changed bool
+	if s.cost > old.cost {
+		old.cost = s.cost
+		changed = !a.loop
+	}
+	switch {
+	case old.lost:
+	case s.lost || len(s.stack)-s.below != len(old.stack)-old.below:
+		old.lose()
+		changed = true
+	default:
+		// Make the states use the same arguments,
+		// so their items line up.
+		if s.below < old.below {
+			s.ensure(len(s.stack) + old.below - s.below)
+		} else if s.below > old.below {
+			old.ensure(len(old.stack) + s.below - old.below)
+			changed = true
+		}
+		for i, it := range old.stack {
+			if it.known && (!s.stack[i].known || !bytes.Equal(it.data, s.stack[i].data)) {
+				old.stack[i] = item{}
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// exit records s as a state in which the program finishes.
+func (a *analyzer) exit(s *state) {
+	if !s.lost && len(s.stack) > 0 {
+		top := s.stack[len(s.stack)-1]
+		if top.known && !vm.AsBool(top.data) {
+			return
+		}
+	}
+	if reason := s.kinds.conflict(); reason != "" {
+		a.conflicts[reason] = true
+		return
+	}
+	a.succeeds[s.kinds] = true
+}
+
+func (a *analyzer) pop(s *state) item {
+	if s.lost {
+		return item{}
+	}
+	s.ensure(1)
+	it := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	s.cost -= it.cost()
+	return it
+}
+
+func (a *analyzer) push(s *state, it item) {
+	if s.lost {
+		return
+	}
+	s.stack = append(s.stack, it)
+	s.cost += it.cost()
+	a.spend(s, 0)
+}
+
+// spend adds n to the cost of s, and notes the cost.
+func (a *analyzer) spend(s *state, n int64) {
+	s.cost += n
+	if s.cost > a.r.MaxCost {
+		a.r.MaxCost = s.cost
+	}
+}
+
+// popInt pops an item and returns its value
+// as a number, if it's known.
+func (a *analyzer) popInt(s *state) (int64, bool) {
+	it := a.pop(s)
+	if !it.known {
+		return 0, false
+	}
+	n, err := vm.AsInt64(it.data)
+	return n, err == nil
+}
+
+// step runs inst, at pc, in s, and passes
+// the resulting states to its successors.
+func (a *analyzer) step(pc uint32, inst vm.Instruction, s *state) {
+	if f, ok := opFields[inst.Op]; ok {
+		a.fields[f] = true
+		s.kinds |= fieldKinds(f)
+	}
+	next := pc + inst.Len
+
+	switch op := inst.Op; {
+	case op == vm.OP_FALSE || op >= vm.OP_DATA_1 && op <= vm.OP_PUSHDATA4 || op >= vm.OP_1 && op <= vm.OP_16:
+		a.spend(s, 1)
+		a.push(s, item{known: true, data: inst.Data})
+	case op == vm.OP_1NEGATE:
+		a.spend(s, 1)
+		a.push(s, item{known: true, data: vm.Int64Bytes(-1)})
+	case op == vm.OP_JUMP:
+		a.spend(s, 1)
+		a.flow(pc, jumpTarget(inst), s, true)
+		return
+	case op == vm.OP_JUMPIF:
+		a.spend(s, 1)
+		cond := a.pop(s)
+		if !cond.known || vm.AsBool(cond.data) {
+			a.flow(pc, jumpTarget(inst), s.clone(), true)
+		}
+		if cond.known && vm.AsBool(cond.data) {
+			return
+		}
+	case op == vm.OP_VERIFY:
+		a.spend(s, 1)
+		if it := a.pop(s); it.known && !vm.AsBool(it.data) {
+			return
+		}
+	case op == vm.OP_FAIL:
+		a.spend(s, 1)
+		return
+	case op == vm.OP_EQUALVERIFY:
+		a.spend(s, 1)
+		x, y := a.pop(s), a.pop(s)
+		if x.known && y.known && !bytes.Equal(x.data, y.data) {
+			return
+		}
+	case op == vm.OP_IFDUP:
+		a.spend(s, 1)
+		it := a.pop(s)
+		a.push(s, it)
+		if !it.known {
+			s.lose()
+		} else if vm.AsBool(it.data) {
+			a.push(s, it)
+		}
+	case op == vm.OP_PICK || op == vm.OP_ROLL:
+		a.spend(s, 2)
+		n, ok := a.popInt(s)
+		if !ok || n < 0 || n >= maxItems {
+			s.lose()
+			break
+		}
+		s.ensure(int(n) + 1)
+		i := len(s.stack) - 1 - int(n)
+		if s.lost {
+			break
+		}
+		it := s.stack[i]
+		if op == vm.OP_ROLL {
+			s.stack = append(s.stack[:i], s.stack[i+1:]...)
+			s.cost -= it.cost()
+		}
+		a.push(s, it)
+	case op == vm.OP_CHECKMULTISIG:
+		npub, ok1 := a.popInt(s)
+		nsig, ok2 := a.popInt(s)
+		if !ok1 || !ok2 || npub < 0 || nsig < 0 || nsig > npub || npub >= maxItems {
+			s.lose()
+			break
+		}
+		a.spend(s, 1024*npub)
+		for i := int64(0); i < npub+1+nsig; i++ {
+			a.pop(s)
+		}
+		a.push(s, item{})
+	case op == vm.OP_CHECKPREDICATE:
+		a.spend(s, 256)
+		limit, ok := a.popInt(s)
+		if ok && limit > 0 {
+			a.spend(s, limit)
+			s.cost -= limit
+		}
+		s.cost -= 256 - 64
+		pred := a.pop(s)
+		n, ok := a.popInt(s)
+		if !ok || n < 0 || n >= maxItems {
+			s.lose()
+		}
+		for i := int64(0); i < n && !s.lost; i++ {
+			a.pop(s)
+		}
+		if !pred.known {
+			a.push(s, item{})
+			break
+		}
+		sub := analyze(pred.data)
+		for f := range sub.fields {
+			a.fields[f] = true
+		}
+		if len(sub.succeeds) == 0 {
+			a.push(s, item{known: true, data: []byte{}})
+			break
+		}
+		// The predicate runs in the same Context, so each way
+		// it can succeed continues with the kinds it used.
+		for k := range sub.succeeds {
+			s2 := s.clone()
+			s2.kinds |= k
+			a.push(s2, item{})
+			a.flow(pc, next, s2, false)
+		}
+		return
+	default:
+		e, ok := effects[op]
+		if !ok {
+			e = effect{cost: 1} // an expansion opcode
+		}
+		a.spend(s, e.cost)
+		in := make([]item, e.in)
+		for i := e.in - 1; i >= 0; i-- {
+			in[i] = a.pop(s)
+		}
+		for _, j := range e.out {
+			if j < 0 {
+				a.push(s, item{})
+			} else {
+				a.push(s, in[j])
+			}
+		}
+	}
+
+	a.flow(pc, next, s, false)
+}
+
+func jumpTarget(inst vm.Instruction) uint32 {
+	return binary.LittleEndian.Uint32(inst.Data)
+}
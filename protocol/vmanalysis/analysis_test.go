@@ -0,0 +1,130 @@
+package vmanalysis
+
+import (
+	"reflect"
+	"testing"
+
+	"chain/protocol/vm"
+)
+
+func TestAnalyze(t *testing.T) {
+	cases := []struct {
+		prog string
+		want Report // Insts isn't checked
+	}{{
+		prog: "TRUE",
+		want: Report{MaxStack: 1, StackBounded: true, MaxCost: 10, CostBounded: true},
+	}, {
+		prog: "FAIL 1",
+		want: Report{StackBounded: true, MaxCost: 1, CostBounded: true, Unspendable: true, Reason: "no path through the program succeeds"},
+	}, {
+		prog: "0 VERIFY TRUE",
+		want: Report{MaxStack: 1, StackBounded: true, MaxCost: 10, CostBounded: true, Unspendable: true, Reason: "no path through the program succeeds"},
+	}, {
+		prog: "0x01 0x02 EQUALVERIFY TRUE",
+		want: Report{MaxStack: 2, StackBounded: true, MaxCost: 21, CostBounded: true, Unspendable: true, Reason: "no path through the program succeeds"},
+	}, {
+		prog: "TXSIGHASH SWAP CHECKSIG",
+		want: Report{
+			Fields:   []string{"TxSigHash"},
+			MinStack: -1, MaxStack: 1, Args: 2, StackBounded: true,
+			MaxCost: 1289, CostBounded: true,
+		},
+	}, {
+		prog: "BLOCKTIME DROP AMOUNT",
+		want: Report{
+			Fields:   []string{"Amount", "BlockTimeMS"},
+			MaxStack: 1, StackBounded: true,
+			MaxCost: 11, CostBounded: true,
+			Unspendable: true, Reason: "uses both block and transaction fields",
+		},
+	}, {
+		prog: "NONCE OUTPUTID",
+		want: Report{
+			Fields:   []string{"Nonce", "SpentOutputID"},
+			MaxStack: 2, StackBounded: true,
+			MaxCost: 18, CostBounded: true,
+			Unspendable: true, Reason: "uses both Nonce, for issuances, and SpentOutputID, for spends",
+		},
+	}, {
+		// Each branch uses fields a single Context can have.
+		prog: "JUMPIF:$a BLOCKHASH DROP 1 JUMP:$b $a NONCE DROP 1 $b",
+		want: Report{
+			Fields:   []string{"BlockHash", "Nonce"},
+			MinStack: -1, Args: 1, StackBounded: true,
+			MaxCost: 6, CostBounded: true,
+		},
+	}, {
+		prog: "JUMPIF:$a NONCE DROP 1 JUMP:$b $a OUTPUTID DROP 1 $b",
+		want: Report{
+			Fields:   []string{"Nonce", "SpentOutputID"},
+			MinStack: -1, Args: 1, StackBounded: true,
+			MaxCost: 6, CostBounded: true,
+		},
+	}, {
+		prog: "2 PICK",
+		want: Report{MaxStack: 1, Args: 3, StackBounded: true, MaxCost: 12, CostBounded: true},
+	}, {
+		prog: "DEPTH PICK",
+		want: Report{MaxStack: 1, MaxCost: 11, CostBounded: true},
+	}, {
+		prog: "BEGIN DUP WHILE 1SUB REPEAT",
+		want: Report{MaxStack: 1, Args: 1, StackBounded: true, MaxCost: 14},
+	}, {
+		prog: "0 0x00 0 CHECKPREDICATE",
+		want: Report{
+			MaxStack: 3, StackBounded: true,
+			MaxCost: 284, CostBounded: true,
+			Unspendable: true, Reason: "no path through the program succeeds",
+		},
+	}, {
+		prog: "0 0xc3 0 CHECKPREDICATE",
+		want: Report{
+			Fields:   []string{"Amount"},
+			MaxStack: 3, StackBounded: true,
+			MaxCost: 284, CostBounded: true,
+		},
+	}}
+	for _, c := range cases {
+		prog, err := vm.Assemble(c.prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Analyze(prog)
+		got.Insts = nil
+		if !reflect.DeepEqual(*got, c.want) {
+			t.Errorf("Analyze(%s):\ngot:  %+v\nwant: %+v", c.prog, *got, c.want)
+		}
+	}
+}
+
+func TestAnalyzeReachable(t *testing.T) {
+	cases := []struct {
+		prog      string
+		reachable []bool
+		jumps     []Jump
+	}{
+		{"1 JUMP:$a 0 $a TRUE", []bool{true, true, false, true}, nil},
+		{"0 JUMPIF:$a 0 $a TRUE", []bool{true, true, true, true}, nil},
+		{"1 JUMPIF:$a 0 $a TRUE", []bool{true, true, false, true}, nil},
+		{"DUP JUMPIF:$a 0 $a TRUE", []bool{true, true, true, true}, nil},
+		{"JUMP:6 0x5151 TRUE", []bool{true, false, true}, []Jump{{0, 6}}},
+	}
+	for _, c := range cases {
+		prog, err := vm.Assemble(c.prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Analyze(prog)
+		var reachable []bool
+		for _, inst := range got.Insts {
+			reachable = append(reachable, inst.Reachable)
+		}
+		if !reflect.DeepEqual(reachable, c.reachable) {
+			t.Errorf("Analyze(%s) reachable = %v want %v", c.prog, reachable, c.reachable)
+		}
+		if !reflect.DeepEqual(got.JumpsIntoData, c.jumps) {
+			t.Errorf("Analyze(%s) jumps into data = %v want %v", c.prog, got.JumpsIntoData, c.jumps)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package vmutil
+
+import (
+	"bytes"
+
+	"chain/crypto/ed25519"
+	"chain/errors"
+	"chain/protocol/vm"
+)
+
+// Contract types.
+const (
+	EscrowContract   = "escrow"
+	TimeLockContract = "timelock"
+	HashLockContract = "hashlock"
+)
+
+// ErrContractFormat is returned by ParseContractProgram for
+// programs that aren't contract programs.
+var ErrContractFormat = errors.New("bad contract program format")
+
+// Contract describes a contract program: a P2SP multisig program
+// (see P2SPMultiSigProgram) with a prefix that names the contract
+// and checks its extra conditions:
+//
+//	<type> DROP <conditions> <P2SP multisig program>
+type Contract struct {
+	Type    string
+	Pubkeys []ed25519.PublicKey
+	Quorum  int
+
+	// MinTimeMS is the earliest mintime, in milliseconds,
+	// of a transaction spending a timelock contract.
+	MinTimeMS uint64
+
+	// Hash is the SHA3-256 hash of the preimage that
+	// a transaction spending a hashlock contract must
+	// reveal.
+	Hash []byte
+}
+
+// EscrowProgram returns a contract program that any two of
+// buyer, seller and agent can spend.
+func EscrowProgram(buyer, seller, agent ed25519.PublicKey) ([]byte, error) {
+	return ContractProgram(&Contract{
+		Type:    EscrowContract,
+		Pubkeys: []ed25519.PublicKey{buyer, seller, agent},
+		Quorum:  2,
+	})
+}
+
+// TimeLockProgram returns a contract program that nrequired of
+// pubkeys can spend in a transaction whose mintime is at least
+// minTimeMS.
+func TimeLockProgram(pubkeys []ed25519.PublicKey, nrequired int, minTimeMS uint64) ([]byte, error) {
+	return ContractProgram(&Contract{
+		Type:      TimeLockContract,
+		Pubkeys:   pubkeys,
+		Quorum:    nrequired,
+		MinTimeMS: minTimeMS,
+	})
+}
+
+// HashLockProgram returns a contract program that nrequired of
+// pubkeys can spend by revealing a preimage of hash, a SHA3-256
+// hash. The preimage is the first argument, before those of the
+// P2SP multisig program; it's passed on to the signed predicate.
+func HashLockProgram(pubkeys []ed25519.PublicKey, nrequired int, hash []byte) ([]byte, error) {
+	return ContractProgram(&Contract{
+		Type:    HashLockContract,
+		Pubkeys: pubkeys,
+		Quorum:  nrequired,
+		Hash:    hash,
+	})
+}
+
+// ContractProgram returns the program for c.
+func ContractProgram(c *Contract) ([]byte, error) {
+	multisig, err := P2SPMultiSigProgram(c.Pubkeys, c.Quorum)
+	if err != nil {
+		return nil, err
+	}
+	builder := NewBuilder()
+	builder.AddData([]byte(c.Type)).AddOp(vm.OP_DROP)
+	switch c.Type {
+	case EscrowContract:
+		if len(c.Pubkeys) != 3 || c.Quorum != 2 {
+			return nil, errors.WithDetail(ErrBadValue, "escrow must be 2 of 3")
+		}
+	case TimeLockContract:
+		if int64(c.MinTimeMS) < 0 {
+			return nil, errors.WithDetail(ErrBadValue, "mintime too big")
+		}
+		builder.AddOp(vm.OP_MINTIME).AddInt64(int64(c.MinTimeMS))
+		builder.AddOp(vm.OP_GREATERTHANOREQUAL).AddOp(vm.OP_VERIFY)
+	case HashLockContract:
+		if len(c.Hash) != 32 {
+			return nil, errors.WithDetail(ErrBadValue, "hash must be 32 bytes")
+		}
+		// Expected stack: [... PREIMAGE NARGS SIG... PREDICATE]
+		builder.AddInt64(int64(c.Quorum) + 2).AddOp(vm.OP_PICK)
+		builder.AddOp(vm.OP_SHA3).AddData(c.Hash).AddOp(vm.OP_EQUALVERIFY)
+	default:
+		return nil, errors.WithDetailf(ErrBadValue, "unknown contract type %q", c.Type)
+	}
+	return append(builder.Program, multisig...), nil
+}
+
+// ParseContractProgram parses a program made by ContractProgram.
+func ParseContractProgram(prog []byte) (*Contract, error) {
+	insts, err := vm.ParseProgram(prog)
+	if err != nil {
+		return nil, err
+	}
+	if len(insts) < 2 || insts[1].Op != vm.OP_DROP {
+		return nil, ErrContractFormat
+	}
+	c := &Contract{Type: string(insts[0].Data)}
+	switch c.Type {
+	case EscrowContract:
+	case TimeLockContract:
+		if len(insts) < 4 {
+			return nil, ErrContractFormat
+		}
+		n, err := vm.AsInt64(insts[3].Data)
+		if err != nil || n < 0 {
+			return nil, ErrContractFormat
+		}
+		c.MinTimeMS = uint64(n)
+	case HashLockContract:
+		if len(insts) < 6 {
+			return nil, ErrContractFormat
+		}
+		c.Hash = insts[5].Data
+	default:
+		return nil, ErrContractFormat
+	}
+	c.Pubkeys, c.Quorum, err = ParseP2SPMultiSigProgram(prog)
+	if err != nil {
+		return nil, ErrContractFormat
+	}
+
+	// Make sure there's nothing else in the program.
+	want, err := ContractProgram(c)
+	if err != nil || !bytes.Equal(prog, want) {
+		return nil, ErrContractFormat
+	}
+	return c, nil
+}
@@ -0,0 +1,113 @@
+package vmutil
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"chain/crypto/ed25519"
+	"chain/crypto/sha3pool"
+	"chain/protocol/vm"
+)
+
+func TestContractProgramRoundTrip(t *testing.T) {
+	pub1, _, _ := ed25519.GenerateKey(nil)
+	pub2, _, _ := ed25519.GenerateKey(nil)
+	pub3, _, _ := ed25519.GenerateKey(nil)
+	keys := []ed25519.PublicKey{pub1, pub2, pub3}
+	cases := []*Contract{
+		{Type: EscrowContract, Pubkeys: keys, Quorum: 2},
+		{Type: TimeLockContract, Pubkeys: keys[:1], Quorum: 1, MinTimeMS: 1234567},
+		{Type: HashLockContract, Pubkeys: keys[1:], Quorum: 2, Hash: bytes.Repeat([]byte{1}, 32)},
+	}
+	for _, c := range cases {
+		prog, err := ContractProgram(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseContractProgram(prog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, c) {
+			t.Errorf("ParseContractProgram(ContractProgram(%+v)) = %+v", c, got)
+		}
+	}
+
+	multisig, err := P2SPMultiSigProgram(keys, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseContractProgram(multisig)
+	if err != ErrContractFormat {
+		t.Errorf("ParseContractProgram(multisig) err = %v want %v", err, ErrContractFormat)
+	}
+}
+
+func TestContractProgramErrors(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	keys := []ed25519.PublicKey{pub}
+	cases := []*Contract{
+		{Type: EscrowContract, Pubkeys: keys, Quorum: 1},
+		{Type: HashLockContract, Pubkeys: keys, Quorum: 1, Hash: []byte{1}},
+		{Type: TimeLockContract, Pubkeys: keys, Quorum: 2},
+		{Type: "other", Pubkeys: keys, Quorum: 1},
+	}
+	for _, c := range cases {
+		_, err := ContractProgram(c)
+		if err == nil {
+			t.Errorf("ContractProgram(%+v) err = nil, want error", c)
+		}
+	}
+}
+
+func TestRunContractPrograms(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []ed25519.PublicKey{pub}
+
+	predicate := []byte{byte(vm.OP_TRUE)}
+	var h [32]byte
+	sha3pool.Sum256(h[:], predicate)
+	sig := ed25519.Sign(priv, h[:])
+
+	preimage := []byte("open sesame")
+	var hash [32]byte
+	sha3pool.Sum256(hash[:], preimage)
+
+	timelock, err := TimeLockProgram(keys, 1, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashlock, err := HashLockProgram(keys, 1, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		prog    []byte
+		args    [][]byte
+		minTime uint64
+		ok      bool
+	}{
+		{timelock, [][]byte{vm.Int64Bytes(0), sig, predicate}, 1000, true},
+		{timelock, [][]byte{vm.Int64Bytes(0), sig, predicate}, 999, false},
+		{hashlock, [][]byte{preimage, vm.Int64Bytes(1), sig, predicate}, 0, true},
+		{hashlock, [][]byte{[]byte("open"), vm.Int64Bytes(1), sig, predicate}, 0, false},
+	}
+	for i, c := range cases {
+		maxTime := c.minTime + 1
+		err := vm.Verify(&vm.Context{
+			VMVersion: 1,
+			Code:      c.prog,
+			Arguments: c.args,
+			MinTimeMS: &c.minTime,
+			MaxTimeMS: &maxTime,
+		})
+		if c.ok != (err == nil) {
+			t.Errorf("case %d: err = %v want ok = %v", i, err, c.ok)
+		}
+	}
+}